@@ -4,6 +4,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -15,10 +16,13 @@ import (
 	"github.com/samyaksetu/backend/config"
 	"github.com/samyaksetu/backend/controllers"
 	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/jobs"
 	"github.com/samyaksetu/backend/middlewares"
+	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/routes"
 	"github.com/samyaksetu/backend/services"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func main() {
@@ -35,73 +39,184 @@ func main() {
 	}
 	defer db.Disconnect()
 
-	// Initialize AI service
-	var aiService services.AIService
-	if cfg.BedrockAccessKey != "" && cfg.BedrockSecretKey != "" {
-		aiService, err = services.NewBedrockService(cfg.BedrockRegion, cfg.BedrockAccessKey, cfg.BedrockSecretKey, cfg.BedrockSessionToken)
+	// Stored files are private; clients get expiring links. Local files are served by the
+	// /files route, whose links urlSigner signs.
+	var storageService services.StorageService
+	var urlSigner *services.URLSigner
+	if cfg.S3BucketName != "" {
+		storageService, err = services.NewS3StorageService(services.S3Settings{
+			Region:    cfg.AWSRegion,
+			AccessKey: cfg.AWSAccessKey,
+			SecretKey: cfg.AWSSecretKey,
+			Bucket:    cfg.S3BucketName,
+			Endpoint:  cfg.S3Endpoint,
+			PathStyle: cfg.S3PathStyle,
+			URLTTL:    cfg.FileURLTTL,
+		})
 		if err != nil {
-			log.Fatalf("FATAL: Bedrock service initialization failed: %v", err)
+			log.Fatalf("FATAL: S3 storage initialization failed: %v", err)
 		}
-	} else if cfg.GeminiAPIKey != "" {
-		geminiService, err := services.NewGeminiService(cfg.GeminiAPIKey)
+	} else {
+		urlSigner = services.NewURLSigner(cfg.FileURLSecret)
+		storageService, err = services.NewLocalStorageService(cfg.UploadPath, urlSigner, cfg.FileURLTTL)
 		if err != nil {
-			log.Fatalf("FATAL: Gemini service initialization failed: %v", err)
+			log.Fatalf("FATAL: Storage service initialization failed: %v", err)
 		}
-		defer geminiService.Close()
-		aiService = geminiService
-	} else {
-		log.Fatalf("FATAL: No AI service configured. Set GEMINI_API_KEY or BEDROCK credentials.")
 	}
+	// Files are stored once per content, with reference counts kept in MongoDB
+	storageService = services.NewDedupStorageService(storageService, repositories.NewMediaRepository(db))
 
-	weatherService := services.NewOpenWeatherService(cfg.WeatherAPIKey)
-
-	var storageService services.StorageService
-	if cfg.S3BucketName != "" {
-		storageService, err = services.NewS3StorageService(cfg.AWSRegion, cfg.AWSAccessKey, cfg.AWSSecretKey, cfg.S3BucketName)
-		if err != nil {
-			log.Fatalf("FATAL: AWS S3 service initialization failed: %v", err)
-		}
+	// Initialize AI, weather and voice services: the real providers, or in-process fakes
+	// when SERVICES_MODE=fake
+	var aiProviders []services.AIProvider
+	var weatherService services.WeatherService
+	var voiceService services.VoiceService
+	if cfg.ServicesMode == config.ServicesModeFake {
+		aiProviders, weatherService, voiceService = fakeServices(cfg.FakeScriptPath, storageService)
 	} else {
-		storageService, err = services.NewLocalStorageService(cfg.UploadPath)
+		aiProviders = liveAIProviders(cfg)
+		weatherService = services.NewOpenWeatherService(cfg.WeatherAPIKey)
+		voiceService, err = services.NewAWSVoiceService(cfg.AWSRegion, cfg.AWSAccessKey, cfg.AWSSecretKey, cfg.S3BucketName, storageService)
 		if err != nil {
-			log.Fatalf("FATAL: Storage service initialization failed: %v", err)
+			log.Printf("WARN: Failed to initialize AWS Voice Service: %v (TTS might not work)", err)
 		}
 	}
+	if len(aiProviders) == 0 {
+		log.Fatalf("FATAL: No AI service configured. Set GEMINI_API_KEY, BEDROCK credentials or OPENAI_BASE_URL, or SERVICES_MODE=fake.")
+	}
+	aiService, err := services.NewAIFailoverChain(aiProviders, services.BreakerSettings{
+		Window:      cfg.AIBreakerWindow,
+		MinRequests: cfg.AIBreakerMinRequests,
+		FailureRate: cfg.AIBreakerFailureRate,
+		OpenFor:     cfg.AIBreakerOpenFor,
+	})
+	if err != nil {
+		log.Fatalf("FATAL: AI provider initialization failed: %v", err)
+	}
+	defer aiService.Close()
 
 	farmerRepo := repositories.NewFarmerRepository(db)
 	soilRepo := repositories.NewSoilRepository(db)
 	chatRepo := repositories.NewChatRepository(db)
-	otpRepo := repositories.NewOTPRepository(db)
+	conversationRepo := repositories.NewConversationRepository(db)
+	plotRepo := repositories.NewPlotRepository(db)
+	phoneChangeRepo := repositories.NewPhoneChangeRepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
+	otpRepo := repositories.NewOTPRepository(db, cfg.OTPTTL, cfg.OTPMaxAttempts, cfg.OTPLockout)
+	sessionRepo := repositories.NewSessionRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	jobRepo := repositories.NewJobRepository(db)
+
+	// Make sure the first admin can log in to create the other staff accounts
+	if cfg.BootstrapAdminPhone != "" {
+		ensureBootstrapAdmin(userRepo, cfg.BootstrapAdminPhone, cfg.BootstrapAdminName)
+	}
 
-	// Initialize JWT service for session management
-	jwtService := services.NewJWTService(cfg.JWTSecret)
+	// Initialize JWT keyring and service for session management
+	keyring := services.NewJWTKeyring()
+	if len(cfg.JWTKeys) > 0 {
+		for kid, path := range cfg.JWTKeys {
+			if err := keyring.AddPrivateKeyFile(kid, path); err != nil {
+				log.Fatalf("FATAL: Failed to load JWT signing key: %v", err)
+			}
+		}
+		if err := keyring.SetActive(cfg.JWTActiveKID); err != nil {
+			log.Fatalf("FATAL: Invalid JWT_ACTIVE_KID: %v", err)
+		}
+		log.Printf("INFO: JWT keyring loaded — keys=%d active=%s algorithms=%v", len(cfg.JWTKeys), keyring.ActiveKID(), keyring.Algorithms())
+	} else if err := keyring.AddHMACKey("hs256", []byte(cfg.JWTSecret)); err != nil {
+		log.Fatalf("FATAL: Invalid JWT_SECRET: %v", err)
+	}
+	jwtService := services.NewJWTService(keyring, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
 	if cfg.PrototypeMode {
 		log.Println("INFO: 🧪 PROTOTYPE MODE is ON — master OTP \"000000\" can be used to bypass OTP verification")
 	}
 
+	// Initialize SMS providers in fallback order
+	smsProviders := make([]services.OTPProviderConfig, 0, len(cfg.SMSProviders))
+	for _, p := range cfg.SMSProviders {
+		smsProviders = append(smsProviders, services.OTPProviderConfig{Name: p.Name, Driver: p.Driver, Settings: p.Settings})
+	}
+	otpService, err := services.NewOTPProviderChain(smsProviders)
+	if err != nil {
+		log.Fatalf("FATAL: SMS provider initialization failed: %v", err)
+	}
+
+	// Image pipeline for uploaded photos and profile pictures
+	imagePipeline := services.NewImagePipeline(services.ImageSettings{
+		MaxEdge:       cfg.ImageMaxEdge,
+		ThumbnailEdge: cfg.ImageThumbnailEdge,
+		Quality:       cfg.ImageJPEGQuality,
+		MinEdge:       cfg.ImageMinEdge,
+		MinSharpness:  cfg.ImageMinSharpness,
+		MinBrightness: cfg.ImageMinBrightness,
+		MaxBrightness: cfg.ImageMaxBrightness,
+	})
+
 	// Initialize controllers (dependency injection)
-	authCtrl := controllers.NewAuthController(otpRepo, services.NewMockOTPService())
-	farmerCtrl := controllers.NewFarmerController(farmerRepo, otpRepo, jwtService, storageService, cfg.PrototypeMode)
-	soilCtrl := controllers.NewSoilController(farmerRepo, soilRepo, aiService, storageService)
-	chatCtrl := controllers.NewChatController(farmerRepo, soilRepo, chatRepo, aiService, weatherService)
-	weatherCtrl := controllers.NewWeatherController(farmerRepo, weatherService)
+	authCtrl := controllers.NewAuthController(otpRepo, otpService, controllers.OTPLimits{
+		ResendCooldown: cfg.OTPResendCooldown,
+		DailyLimit:     cfg.OTPDailyLimit,
+		IPHourlyLimit:  cfg.OTPIPHourlyLimit,
+	}, cfg.SMSWebhookSecret)
+	farmerCtrl := controllers.NewFarmerController(farmerRepo, otpRepo, sessionRepo, auditRepo, jwtService, storageService, imagePipeline, cfg.PrototypeMode)
+	sessionCtrl := controllers.NewSessionController(sessionRepo, farmerRepo, userRepo, jwtService)
+	staffCtrl := controllers.NewStaffController(userRepo, farmerRepo, otpRepo, sessionRepo, jwtService, storageService)
+	adminCtrl := controllers.NewAdminController(userRepo, farmerRepo, sessionRepo, auditRepo)
+	phoneChangeCtrl := controllers.NewPhoneChangeController(farmerRepo, otpRepo, phoneChangeRepo, sessionRepo, auditRepo, cfg.PrototypeMode)
+	accountCtrl := controllers.NewAccountController(farmerRepo, soilRepo, chatRepo, conversationRepo, plotRepo, sessionRepo, phoneChangeRepo, auditRepo, storageService, cfg.AccountDeletionGrace)
+	profileCtrl := controllers.NewProfileController(farmerRepo, userRepo, storageService)
+	plotCtrl := controllers.NewPlotController(farmerRepo, plotRepo)
+	conversationCtrl := controllers.NewConversationController(farmerRepo, plotRepo, conversationRepo, chatRepo, storageService)
+	// Background job queue, shared by controllers that hand work to it
+	jobQueue := jobs.NewQueue(jobRepo, jobs.QueueSettings{
+		Workers:      cfg.JobWorkers,
+		PollInterval: cfg.JobPollInterval,
+		MaxAttempts:  cfg.JobMaxAttempts,
+		BackoffBase:  cfg.JobBackoffBase,
+		BackoffMax:   cfg.JobBackoffMax,
+		Timeout:      cfg.JobTimeout,
+	})
+	jobQueue.Register(models.JobTypeSoilAnalysis, jobs.NewSoilAnalysisJob(soilRepo, aiService, storageService))
+
+	soilCtrl := controllers.NewSoilController(farmerRepo, soilRepo, plotRepo, aiService, storageService, imagePipeline, jobQueue)
+	chatCtrl := controllers.NewChatController(farmerRepo, soilRepo, plotRepo, chatRepo, conversationRepo, aiService, weatherService, imagePipeline, cfg.ChatHistoryTokens)
+	weatherCtrl := controllers.NewWeatherController(farmerRepo, plotRepo, weatherService)
 	samyakAICtrl := controllers.NewSamyakAIController(aiService)
+	fileCtrl := controllers.NewFileController(storageService, urlSigner)
 
-	var voiceService services.VoiceService
-	voiceService, err = services.NewAWSVoiceService(cfg.AWSRegion, cfg.AWSAccessKey, cfg.AWSSecretKey, cfg.S3BucketName, storageService)
-	if err != nil {
-		log.Printf("WARN: Failed to initialize AWS Voice Service: %v (TTS might not work)", err)
-	}
-	voiceCtrl := controllers.NewVoiceController(voiceService, aiService)
+	voiceCtrl := controllers.NewVoiceController(voiceService, aiService, farmerRepo, chatRepo, conversationRepo, storageService, cfg.ServicesMode == config.ServicesModeFake)
 
 	// Setup Gin router
 	router := gin.New()
+	// Without trusted proxies c.ClientIP() is the peer address, so clients can't pick their
+	// own IP through X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("FATAL: Invalid TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(gin.Recovery())
 	router.Use(middlewares.SetupCORS())
 	router.Use(middlewares.RequestLogger())
 
 	// Register routes
-	routes.RegisterRoutes(router, authCtrl, farmerCtrl, soilCtrl, chatCtrl, weatherCtrl, samyakAICtrl, voiceCtrl, jwtService)
+	routes.RegisterRoutes(router, routes.Timeouts{
+		Default: cfg.RequestTimeout,
+		Chat:    cfg.ChatTimeout,
+		Stream:  cfg.StreamTimeout,
+		Voice:   cfg.VoiceTimeout,
+		Soil:    cfg.SoilTimeout,
+		Export:  cfg.ExportTimeout,
+	}, authCtrl, farmerCtrl, soilCtrl, chatCtrl, weatherCtrl, samyakAICtrl, voiceCtrl, sessionCtrl, staffCtrl, adminCtrl, profileCtrl, plotCtrl, conversationCtrl, phoneChangeCtrl, accountCtrl, fileCtrl, jwtService, sessionRepo)
+
+	// Start background jobs; they stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	purgeJob := jobs.NewAccountPurgeJob(farmerRepo, soilRepo, chatRepo, conversationRepo, plotRepo, sessionRepo, phoneChangeRepo, auditRepo, storageService, cfg.AccountPurgeInterval)
+	go purgeJob.Start(jobsCtx)
+	sweepJob := jobs.NewStorageSweepJob(storageService, cfg.StorageRetention, cfg.StorageSweepInterval)
+	go sweepJob.Start(jobsCtx)
+	go jobQueue.Start(jobsCtx)
+	go jobs.BackfillLegacySoilAnalyses(jobsCtx, soilRepo, jobQueue)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -126,6 +241,7 @@ func main() {
 	sig := <-quit
 	log.Printf("INFO: Received signal %v — shutting down gracefully...", sig)
 
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
@@ -135,3 +251,91 @@ func main() {
 
 	log.Println("INFO: SamyakSetu Backend stopped")
 }
+
+// bootstrapAdminAttempts is how many times startup tries to look up or create the bootstrap
+// admin before carrying on without it.
+const bootstrapAdminAttempts = 5
+
+// ensureBootstrapAdmin creates an admin with phone unless a staff user already has it. Only a
+// lookup that finds no user leads to an insert; failed lookups and inserts are retried with
+// growing delays, and logged if they keep failing.
+func ensureBootstrapAdmin(userRepo *repositories.UserRepository, phone, name string) {
+	ctx := context.Background()
+	for attempt := 1; attempt <= bootstrapAdminAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+
+		_, err := userRepo.FindByPhone(ctx, phone)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("WARN: Bootstrap admin lookup failed (attempt %d/%d): %v", attempt, bootstrapAdminAttempts, err)
+			continue
+		}
+
+		admin := &models.User{Name: name, Phone: phone, Role: models.RoleAdmin, Active: true}
+		if err := userRepo.Create(ctx, admin); err != nil {
+			// Another instance may have created it meanwhile; the next lookup tells
+			log.Printf("WARN: Failed to create bootstrap admin (attempt %d/%d): %v", attempt, bootstrapAdminAttempts, err)
+			continue
+		}
+		log.Printf("INFO: Bootstrap admin created — id=%s phone=%s", admin.ID.Hex(), admin.Phone)
+		return
+	}
+	log.Printf("ERROR: Could not make sure the bootstrap admin %s exists; starting without it", phone)
+}
+
+// liveAIProviders initializes the AI providers listed in AI_PROVIDERS, in fallback order.
+// Providers without credentials, or that fail to start, are left out.
+func liveAIProviders(cfg *config.Config) []services.AIProvider {
+	var aiProviders []services.AIProvider
+	for _, name := range cfg.AIProviders {
+		var provider services.AIService
+		var err error
+		switch name {
+		case "bedrock":
+			if cfg.BedrockAccessKey == "" || cfg.BedrockSecretKey == "" {
+				log.Println("INFO: Skipping AI provider bedrock — BEDROCK credentials are not set")
+				continue
+			}
+			provider, err = services.NewBedrockService(cfg.BedrockRegion, cfg.BedrockAccessKey, cfg.BedrockSecretKey, cfg.BedrockSessionToken)
+		case "gemini":
+			if cfg.GeminiAPIKey == "" {
+				log.Println("INFO: Skipping AI provider gemini — GEMINI_API_KEY is not set")
+				continue
+			}
+			provider, err = services.NewGeminiService(cfg.GeminiAPIKey)
+		case "openai":
+			if cfg.OpenAIBaseURL == "" {
+				log.Println("INFO: Skipping AI provider openai — OPENAI_BASE_URL is not set")
+				continue
+			}
+			provider, err = services.NewOpenAICompatibleService(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, cfg.OpenAIModel, cfg.OpenAIVisionModel, cfg.OpenAITimeout)
+		default:
+			log.Fatalf("FATAL: Unknown AI provider %q in AI_PROVIDERS (available: bedrock, gemini, openai)", name)
+		}
+		if err != nil {
+			log.Printf("ERROR: AI provider %s initialization failed: %v", name, err)
+			continue
+		}
+		aiProviders = append(aiProviders, services.AIProvider{Name: name, Service: provider})
+	}
+	return aiProviders
+}
+
+// fakeServices returns in-process fakes for the AI, weather and voice services, scripted
+// from scriptPath when it is set.
+func fakeServices(scriptPath string, storageService services.StorageService) ([]services.AIProvider, services.WeatherService, services.VoiceService) {
+	ai := services.NewFakeAIService()
+	weather := services.NewFakeWeatherService()
+	voice := services.NewFakeVoiceService(storageService)
+	if scriptPath != "" {
+		if err := services.LoadFakeScripts(scriptPath, ai, voice, weather); err != nil {
+			log.Fatalf("FATAL: %v", err)
+		}
+	}
+	log.Println("INFO: 🧪 SERVICES_MODE=fake — AI, weather and voice are answered by in-process fakes")
+	return []services.AIProvider{{Name: "fake", Service: ai}}, weather, voice
+}
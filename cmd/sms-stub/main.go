@@ -0,0 +1,157 @@
+// All rights reserved Samyak-Setu
+
+// Command sms-stub is a fake SMS gateway for local development and testing of the
+// "http" SMS driver. It accepts messages, logs them, and can post delivery receipts
+// back to the backend's webhook.
+//
+//	go run ./cmd/sms-stub -addr :9090 -receipt-url "http://localhost:8080/api/webhooks/sms/stub?token=secret"
+//
+// with the backend configured as:
+//
+//	SMS_PROVIDERS=stub,mock
+//	SMS_STUB_URL=http://localhost:9090/send
+//	SMS_STUB_AUTH_TOKEN=stub-token
+//	SMS_WEBHOOK_SECRET=secret
+//
+// Sent messages can be inspected at GET /messages. Setting -fail-rate makes a share of
+// requests fail with 503 so provider fallback can be exercised.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type message struct {
+	MessageID  string    `json:"messageId"`
+	To         string    `json:"to"`
+	Message    string    `json:"message"`
+	Status     string    `json:"status"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+type gateway struct {
+	token        string
+	receiptURL   string
+	receiptDelay time.Duration
+	receiptState string
+	failRate     float64
+
+	mu       sync.Mutex
+	messages []message
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	token := flag.String("token", "stub-token", "bearer token required on /send (empty to disable)")
+	receiptURL := flag.String("receipt-url", "", "webhook to post delivery receipts to (empty to disable)")
+	receiptDelay := flag.Duration("receipt-delay", 2*time.Second, "delay before posting a delivery receipt")
+	receiptState := flag.String("receipt-status", "delivered", "status reported in delivery receipts")
+	failRate := flag.Float64("fail-rate", 0, "fraction of /send requests that fail with 503 (0-1)")
+	flag.Parse()
+
+	g := &gateway{
+		token:        *token,
+		receiptURL:   *receiptURL,
+		receiptDelay: *receiptDelay,
+		receiptState: *receiptState,
+		failRate:     *failRate,
+	}
+
+	http.HandleFunc("/send", g.send)
+	http.HandleFunc("/messages", g.list)
+
+	log.Printf("INFO: SMS stub gateway listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// send accepts {"to": "...", "message": "..."} and replies with a message ID.
+func (g *gateway) send(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if g.token != "" && r.Header.Get("Authorization") != "Bearer "+g.token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+	if g.failRate > 0 && mathrand.Float64() < g.failRate {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "simulated outage"})
+		return
+	}
+
+	var req struct {
+		To      string `json:"to"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil || req.To == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected {\"to\", \"message\"}"})
+		return
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	msg := message{
+		MessageID:  "stub-" + hex.EncodeToString(id),
+		To:         req.To,
+		Message:    req.Message,
+		Status:     "sent",
+		ReceivedAt: time.Now(),
+	}
+
+	g.mu.Lock()
+	g.messages = append(g.messages, msg)
+	g.mu.Unlock()
+
+	log.Printf("INFO: SMS to %s [%s]: %s", msg.To, msg.MessageID, msg.Message)
+	if g.receiptURL != "" {
+		go g.postReceipt(msg.MessageID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"messageId": msg.MessageID, "status": msg.Status})
+}
+
+// list returns every message received so far, newest last.
+func (g *gateway) list(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeJSON(w, http.StatusOK, g.messages)
+}
+
+// postReceipt reports the message's final status to the backend webhook.
+func (g *gateway) postReceipt(messageID string) {
+	time.Sleep(g.receiptDelay)
+
+	body, _ := json.Marshal(map[string]string{"messageId": messageID, "status": g.receiptState})
+	resp, err := http.Post(g.receiptURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("WARN: Delivery receipt for %s failed: %v", messageID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	g.mu.Lock()
+	for i := range g.messages {
+		if g.messages[i].MessageID == messageID {
+			g.messages[i].Status = g.receiptState
+		}
+	}
+	g.mu.Unlock()
+
+	log.Printf("INFO: Delivery receipt for %s posted (%s) — backend replied %d", messageID, g.receiptState, resp.StatusCode)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -5,27 +5,102 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret is the development-only HMAC secret used when JWT_SECRET is unset.
+// The server refuses to start with it unless prototype mode is on.
+const DefaultJWTSecret = "samyaksetu-prototype-secret-2026"
+
+// Values of SERVICES_MODE.
+const (
+	ServicesModeLive = "live" // AI, weather and voice go to the configured providers
+	ServicesModeFake = "fake" // AI, weather and voice are answered by in-process fakes
+)
+
 // Config holds all configuration values loaded from environment variables.
 type Config struct {
-	Port                string
-	MongoURI            string
-	GeminiAPIKey        string
-	WeatherAPIKey       string
-	UploadPath          string
-	AWSRegion           string
-	AWSAccessKey        string
-	AWSSecretKey        string
-	S3BucketName        string
-	BedrockRegion       string
-	BedrockAccessKey    string
-	BedrockSecretKey    string
-	BedrockSessionToken string // In case you use temporary credentials, usually empty for IAM users
-	PrototypeMode       bool   // When true, master OTP "000000" always works, skipping real OTP verification
-	JWTSecret           string // Secret key used to sign and verify JWT tokens
+	Port                 string
+	TrustedProxies       []string // Proxies (IPs or CIDRs) whose X-Forwarded-For is believed; none means the peer address is the client
+	MongoURI             string
+	GeminiAPIKey         string
+	WeatherAPIKey        string
+	UploadPath           string
+	AWSRegion            string
+	AWSAccessKey         string
+	AWSSecretKey         string
+	S3BucketName         string
+	S3Endpoint           string                   // S3-compatible server such as MinIO; empty for AWS
+	S3PathStyle          bool                     // Address the bucket in the URL path rather than the host name, as MinIO needs
+	StorageRetention     map[string]time.Duration // Storage sub-directory → age after which its files are deleted
+	StorageSweepInterval time.Duration            // How often files past their retention are deleted
+	FileURLSecret        string                   // HMAC secret for links to locally stored files; random per start when empty
+	FileURLTTL           time.Duration            // Lifetime of file links (signed local links and presigned S3 URLs)
+	BedrockRegion        string
+	BedrockAccessKey     string
+	BedrockSecretKey     string
+	BedrockSessionToken  string            // In case you use temporary credentials, usually empty for IAM users
+	OpenAIBaseURL        string            // OpenAI-compatible chat-completions API, e.g. http://localhost:11434/v1 for Ollama
+	OpenAIAPIKey         string            // Bearer token for the OpenAI-compatible API; usually empty for local servers
+	OpenAIModel          string            // Model for text requests
+	OpenAIVisionModel    string            // Model for requests with an image (defaults to OpenAIModel)
+	OpenAITimeout        time.Duration     // Per-attempt timeout; local models on a CPU are slow
+	AIProviders          []string          // AI providers in fallback order ("bedrock", "gemini", "openai"); ones not configured are skipped
+	AIBreakerWindow      int               // Recent calls per AI provider the circuit breaker looks at
+	AIBreakerMinRequests int               // Calls in the window needed before the breaker can open
+	AIBreakerFailureRate float64           // Share of failed calls in the window that opens the breaker
+	AIBreakerOpenFor     time.Duration     // How long an open breaker skips its provider before a probe
+	PrototypeMode        bool              // Opt-in; when true, master OTP "000000" works for farmers and the default JWT secret is allowed
+	ServicesMode         string            // ServicesModeLive or ServicesModeFake
+	FakeScriptPath       string            // JSON file scripting the fakes in fake mode (see services.LoadFakeScripts)
+	JWTSecret            string            // HS256 secret, used only when no JWT_KEYS are configured
+	JWTKeys              map[string]string // kid → path of a PEM private key (RSA or Ed25519)
+	JWTActiveKID         string            // kid used to sign new tokens (defaults to the first JWT_KEYS entry)
+	AccessTokenTTL       time.Duration     // Lifetime of access tokens
+	RefreshTokenTTL      time.Duration     // Lifetime of a session's refresh token, extended on every refresh
+	OTPTTL               time.Duration     // How long an OTP stays valid
+	OTPMaxAttempts       int               // Wrong guesses allowed before the phone is locked out
+	OTPLockout           time.Duration     // How long a phone stays locked after too many wrong guesses
+	OTPResendCooldown    time.Duration     // Minimum gap between two OTPs for the same phone
+	OTPDailyLimit        int               // Maximum OTPs per phone in 24 hours
+	OTPIPHourlyLimit     int               // Maximum OTP requests per client IP in one hour
+	SMSProviders         []SMSProvider     // SMS providers in fallback order
+	SMSWebhookSecret     string            // Shared secret that delivery-receipt webhooks must present
+	BootstrapAdminPhone  string            // Phone of an admin created at startup if no staff user has it yet
+	BootstrapAdminName   string            // Display name for the bootstrap admin
+	AccountDeletionGrace time.Duration     // How long a deleted account can still be restored by logging in
+	AccountPurgeInterval time.Duration     // How often the purge job looks for accounts past their grace period
+	JobWorkers           int               // Background jobs run at the same time
+	JobPollInterval      time.Duration     // How often idle job workers look for due jobs
+	JobMaxAttempts       int               // Attempts before a background job is given up
+	JobBackoffBase       time.Duration     // Delay before a job's first retry, doubled after each further failure
+	JobBackoffMax        time.Duration     // Longest delay between job retries
+	JobTimeout           time.Duration     // Time allowed for one attempt at a job
+	ImageMaxEdge         int               // Longest edge, in pixels, of stored photos and photos sent to the AI
+	ImageThumbnailEdge   int               // Longest edge of photo thumbnails
+	ImageJPEGQuality     int               // JPEG quality of stored photos and thumbnails, 1–100
+	ImageMinEdge         int               // Photos whose shorter edge is below this are rejected
+	ImageMinSharpness    float64           // Photos less sharp than this (variance of the Laplacian) are rejected as blurry
+	ImageMinBrightness   float64           // Photos darker than this (0–1) are rejected
+	ImageMaxBrightness   float64           // Photos brighter than this (0–1) are rejected
+	ChatHistoryTokens    int               // Approximate token budget for earlier turns sent with each chat message
+	RequestTimeout       time.Duration     // Budget for API requests without a budget of their own
+	ChatTimeout          time.Duration     // Budget for advisory chat and SamyakAI replies
+	StreamTimeout        time.Duration     // Budget for streamed (Server-Sent Events) replies
+	VoiceTimeout         time.Duration     // Budget for voice endpoints, which wait on transcription
+	SoilTimeout          time.Duration     // Budget for soil photo upload and analysis
+	ExportTimeout        time.Duration     // Budget for building a personal data export
+}
+
+// SMSProvider is one entry of SMS_PROVIDERS together with its SMS_<NAME>_* settings.
+type SMSProvider struct {
+	Name     string
+	Driver   string            // "mock" or "http"; defaults to the name for mock, http otherwise
+	Settings map[string]string // SMS_<NAME>_* variables with the prefix stripped
 }
 
 // LoadConfig reads the .env file and returns a Config struct.
@@ -37,27 +112,98 @@ func LoadConfig() *Config {
 	}
 
 	cfg := &Config{
-		Port:                getEnv("PORT", "8080"),
-		MongoURI:            getEnv("MONGO_URI", "mongodb://localhost:27017/samyaksetu"),
-		GeminiAPIKey:        getEnv("GEMINI_API_KEY", ""),
-		WeatherAPIKey:       getEnv("WEATHER_API_KEY", ""),
-		UploadPath:          getEnv("UPLOAD_PATH", "./uploads"),
-		AWSRegion:           getEnv("AWS_REGION", ""),
-		AWSAccessKey:        getEnv("AWS_ACCESS_KEY_ID", ""),
-		AWSSecretKey:        getEnv("AWS_SECRET_ACCESS_KEY", ""),
-		S3BucketName:        getEnv("S3_BUCKET_NAME", ""),
-		BedrockRegion:       getEnv("BEDROCK_AWS_REGION", "us-east-1"), // Defaulting to us-east-1 since many models are there
-		BedrockAccessKey:    getEnv("BEDROCK_AWS_ACCESS_KEY_ID", ""),
-		BedrockSecretKey:    getEnv("BEDROCK_AWS_SECRET_ACCESS_KEY", ""),
-		BedrockSessionToken: getEnv("BEDROCK_AWS_SESSION_TOKEN", ""), // Optional
-		PrototypeMode:       getEnv("PROTOTYPE_MODE", "true") == "true",
-		JWTSecret:           getEnv("JWT_SECRET", "samyaksetu-prototype-secret-2026"),
-	}
-
-	if cfg.GeminiAPIKey == "" && (cfg.BedrockAccessKey == "" || cfg.BedrockSecretKey == "") {
-		log.Println("WARN: Neither GEMINI_API_KEY nor AWS Bedrock credentials are set — AI features will fail")
-	}
-	if cfg.WeatherAPIKey == "" {
+		Port:                 getEnv("PORT", "8080"),
+		TrustedProxies:       splitList(getEnv("TRUSTED_PROXIES", "")),
+		MongoURI:             getEnv("MONGO_URI", "mongodb://localhost:27017/samyaksetu"),
+		GeminiAPIKey:         getEnv("GEMINI_API_KEY", ""),
+		WeatherAPIKey:        getEnv("WEATHER_API_KEY", ""),
+		UploadPath:           getEnv("UPLOAD_PATH", "./uploads"),
+		AWSRegion:            getEnv("AWS_REGION", ""),
+		AWSAccessKey:         getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretKey:         getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		S3BucketName:         getEnv("S3_BUCKET_NAME", ""),
+		S3Endpoint:           getEnv("S3_ENDPOINT", ""),
+		S3PathStyle:          getEnv("S3_FORCE_PATH_STYLE", "false") == "true",
+		StorageRetention:     getEnvRetention("STORAGE_RETENTION", "stt-input=1h,audio=720h"),
+		StorageSweepInterval: getEnvDuration("STORAGE_SWEEP_INTERVAL", time.Hour),
+		FileURLSecret:        getEnv("FILE_URL_SECRET", ""),
+		FileURLTTL:           getEnvDuration("FILE_URL_TTL", time.Hour),
+		BedrockRegion:        getEnv("BEDROCK_AWS_REGION", "us-east-1"), // Defaulting to us-east-1 since many models are there
+		BedrockAccessKey:     getEnv("BEDROCK_AWS_ACCESS_KEY_ID", ""),
+		BedrockSecretKey:     getEnv("BEDROCK_AWS_SECRET_ACCESS_KEY", ""),
+		BedrockSessionToken:  getEnv("BEDROCK_AWS_SESSION_TOKEN", ""), // Optional
+		OpenAIBaseURL:        getEnv("OPENAI_BASE_URL", ""),
+		OpenAIAPIKey:         getEnv("OPENAI_API_KEY", ""),
+		OpenAIModel:          getEnv("OPENAI_MODEL", "llama3.2"),
+		OpenAIVisionModel:    getEnv("OPENAI_VISION_MODEL", ""),
+		OpenAITimeout:        getEnvDuration("OPENAI_TIMEOUT", 2*time.Minute),
+		AIProviders:          splitList(getEnv("AI_PROVIDERS", "bedrock,gemini,openai")),
+		AIBreakerWindow:      getEnvInt("AI_BREAKER_WINDOW", 20),
+		AIBreakerMinRequests: getEnvInt("AI_BREAKER_MIN_REQUESTS", 5),
+		AIBreakerFailureRate: getEnvFloat("AI_BREAKER_FAILURE_RATE", 0.5),
+		AIBreakerOpenFor:     getEnvDuration("AI_BREAKER_OPEN_FOR", 30*time.Second),
+		PrototypeMode:        getEnv("PROTOTYPE_MODE", "false") == "true",
+		ServicesMode:         getEnv("SERVICES_MODE", ServicesModeLive),
+		FakeScriptPath:       getEnv("FAKE_SCRIPT", ""),
+		JWTSecret:            getEnv("JWT_SECRET", DefaultJWTSecret),
+		JWTKeys:              parseKeyValueList(getEnv("JWT_KEYS", "")),
+		JWTActiveKID:         getEnv("JWT_ACTIVE_KID", firstKey(getEnv("JWT_KEYS", ""))),
+		AccessTokenTTL:       getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:      getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		OTPTTL:               getEnvDuration("OTP_TTL", 5*time.Minute),
+		OTPMaxAttempts:       getEnvInt("OTP_MAX_ATTEMPTS", 5),
+		OTPLockout:           getEnvDuration("OTP_LOCKOUT", 15*time.Minute),
+		OTPResendCooldown:    getEnvDuration("OTP_RESEND_COOLDOWN", 60*time.Second),
+		OTPDailyLimit:        getEnvInt("OTP_DAILY_LIMIT", 5),
+		OTPIPHourlyLimit:     getEnvInt("OTP_IP_HOURLY_LIMIT", 20),
+		SMSProviders:         loadSMSProviders(getEnv("SMS_PROVIDERS", "mock")),
+		SMSWebhookSecret:     getEnv("SMS_WEBHOOK_SECRET", ""),
+		BootstrapAdminPhone:  getEnv("BOOTSTRAP_ADMIN_PHONE", ""),
+		BootstrapAdminName:   getEnv("BOOTSTRAP_ADMIN_NAME", "Administrator"),
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountPurgeInterval: getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+		JobWorkers:           getEnvInt("JOB_WORKERS", 2),
+		JobPollInterval:      getEnvDuration("JOB_POLL_INTERVAL", 5*time.Second),
+		JobMaxAttempts:       getEnvInt("JOB_MAX_ATTEMPTS", 6),
+		JobBackoffBase:       getEnvDuration("JOB_BACKOFF_BASE", 30*time.Second),
+		JobBackoffMax:        getEnvDuration("JOB_BACKOFF_MAX", 30*time.Minute),
+		JobTimeout:           getEnvDuration("JOB_TIMEOUT", 3*time.Minute),
+		ImageMaxEdge:         getEnvInt("IMAGE_MAX_EDGE", 1600),
+		ImageThumbnailEdge:   getEnvInt("IMAGE_THUMBNAIL_EDGE", 320),
+		ImageJPEGQuality:     getEnvInt("IMAGE_JPEG_QUALITY", 85),
+		ImageMinEdge:         getEnvInt("IMAGE_MIN_EDGE", 256),
+		ImageMinSharpness:    getEnvFloat("IMAGE_MIN_SHARPNESS", 15),
+		ImageMinBrightness:   getEnvFloat("IMAGE_MIN_BRIGHTNESS", 0.08),
+		ImageMaxBrightness:   getEnvFloat("IMAGE_MAX_BRIGHTNESS", 0.92),
+		ChatHistoryTokens:    getEnvInt("CHAT_HISTORY_TOKENS", 2000),
+		RequestTimeout:       getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+		ChatTimeout:          getEnvDuration("CHAT_TIMEOUT", 90*time.Second),
+		StreamTimeout:        getEnvDuration("STREAM_TIMEOUT", 5*time.Minute),
+		VoiceTimeout:         getEnvDuration("VOICE_TIMEOUT", 3*time.Minute),
+		SoilTimeout:          getEnvDuration("SOIL_TIMEOUT", 2*time.Minute),
+		ExportTimeout:        getEnvDuration("EXPORT_TIMEOUT", 5*time.Minute),
+	}
+
+	if cfg.ServicesMode != ServicesModeLive && cfg.ServicesMode != ServicesModeFake {
+		log.Fatalf("FATAL: SERVICES_MODE must be %q or %q, got %q", ServicesModeLive, ServicesModeFake, cfg.ServicesMode)
+	}
+	live := cfg.ServicesMode == ServicesModeLive
+	if live && cfg.GeminiAPIKey == "" && (cfg.BedrockAccessKey == "" || cfg.BedrockSecretKey == "") && cfg.OpenAIBaseURL == "" {
+		log.Println("WARN: None of GEMINI_API_KEY, AWS Bedrock credentials or OPENAI_BASE_URL are set — AI features will fail")
+	}
+	if len(cfg.JWTKeys) == 0 && cfg.JWTSecret == DefaultJWTSecret {
+		if !cfg.PrototypeMode {
+			log.Fatalf("FATAL: JWT_SECRET is the built-in default. Set JWT_SECRET or JWT_KEYS, or enable PROTOTYPE_MODE for local development.")
+		}
+		log.Println("WARN: Using the built-in default JWT secret — acceptable only in prototype mode")
+	}
+	if !cfg.PrototypeMode && len(cfg.SMSProviders) == 1 && cfg.SMSProviders[0].Driver == "mock" {
+		log.Println("WARN: SMS_PROVIDERS only has the mock provider — OTPs are written to the log, not sent")
+	}
+	if cfg.SMSWebhookSecret == "" {
+		log.Println("WARN: SMS_WEBHOOK_SECRET is not set — SMS delivery receipts will be rejected")
+	}
+	if live && cfg.WeatherAPIKey == "" {
 		log.Println("WARN: WEATHER_API_KEY is not set — weather features will fail")
 	}
 
@@ -71,3 +217,129 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvDuration parses an environment variable as a time.Duration (e.g. "15m", "720h").
+// Falls back to the default if the variable is unset or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("WARN: Invalid duration for %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvInt parses an environment variable as an integer.
+// Falls back to the default if the variable is unset or invalid.
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("WARN: Invalid integer for %s=%q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvFloat parses an environment variable as a floating-point number.
+// Falls back to the default if the variable is unset or invalid.
+func getEnvFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("WARN: Invalid number for %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+// splitList parses a comma-separated list, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadSMSProviders reads SMS_PROVIDERS (e.g. "msg91,twilio,mock") and collects each
+// provider's SMS_<NAME>_* settings, e.g. SMS_MSG91_URL or SMS_TWILIO_BASIC_USER.
+func loadSMSProviders(names string) []SMSProvider {
+	var providers []SMSProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "SMS_" + strings.ToUpper(name) + "_"
+		settings := make(map[string]string)
+		for _, env := range os.Environ() {
+			key, value, _ := strings.Cut(env, "=")
+			if strings.HasPrefix(key, prefix) && value != "" {
+				settings[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+
+		driver := settings["DRIVER"]
+		if driver == "" {
+			driver = "http"
+			if name == "mock" {
+				driver = "mock"
+			}
+		}
+		providers = append(providers, SMSProvider{Name: name, Driver: driver, Settings: settings})
+	}
+	return providers
+}
+
+// parseKeyValueList parses "a=1,b=2" into a map. Entries without "=" are ignored.
+func parseKeyValueList(value string) map[string]string {
+	result := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || key == "" {
+			continue
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return result
+}
+
+// getEnvRetention parses an environment variable of "dir=duration" rules such as
+// "stt-input=1h,audio=720h". Rules with an invalid or non-positive duration are skipped.
+func getEnvRetention(key, fallback string) map[string]time.Duration {
+	value := getEnv(key, fallback)
+	rules := make(map[string]time.Duration)
+	for dir, raw := range parseKeyValueList(value) {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			log.Printf("WARN: Invalid retention for %q in %s=%q, ignoring it", dir, key, value)
+			continue
+		}
+		rules[strings.Trim(dir, "/")] = d
+	}
+	return rules
+}
+
+// firstKey returns the key of the first "key=value" entry in a comma-separated list.
+func firstKey(value string) string {
+	for _, entry := range strings.Split(value, ",") {
+		if key, _, found := strings.Cut(strings.TrimSpace(entry), "="); found && key != "" {
+			return strings.TrimSpace(key)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/middlewares"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+)
+
+// resolveFarmer loads the farmer the request is allowed to act on.
+// requestedID is the (optional) farmerId sent by the client; it must match the token
+// unless the caller holds a role that may act on behalf of farmers.
+// On failure it writes the error response and returns false.
+func resolveFarmer(c *gin.Context, farmerRepo *repositories.FarmerRepository, requestedID string) (*models.Farmer, bool) {
+	ctx := c.Request.Context()
+	farmerID, err := middlewares.ActingFarmerID(c, requestedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, middlewares.ErrForbidden):
+			log.Printf("WARN: Forbidden farmer access — caller=%s role=%s requested=%s path=%s",
+				callerID(c), c.GetString("role"), requestedID, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, middlewares.ErrUnauthenticated):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	farmer, err := farmerRepo.FindByID(ctx, farmerID)
+	if err != nil || farmer.IsDeleted() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+		return nil, false
+	}
+
+	if err := middlewares.CheckFarmerScope(c, farmer); err != nil {
+		log.Printf("WARN: Out-of-block farmer access — user=%s block=%s farmer=%s path=%s",
+			c.GetString("userId"), c.GetString("block"), farmer.ID.Hex(), c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if c.GetString("farmerId") != farmer.ID.Hex() {
+		log.Printf("INFO: Delegated access — user=%s role=%s farmer=%s path=%s", callerID(c), c.GetString("role"), farmer.ID.Hex(), c.Request.URL.Path)
+	}
+
+	return farmer, true
+}
+
+// isStaff reports whether the request was made with a staff user's token.
+func isStaff(c *gin.Context) bool {
+	return c.GetString("userId") != ""
+}
+
+// callerID returns the staff user ID or farmer ID behind the request, for logging.
+func callerID(c *gin.Context) string {
+	if isStaff(c) {
+		return c.GetString("userId")
+	}
+	return c.GetString("farmerId")
+}
@@ -0,0 +1,269 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AccountController handles data-subject requests: deleting an account and exporting its data.
+type AccountController struct {
+	farmerRepo       *repositories.FarmerRepository
+	soilRepo         *repositories.SoilRepository
+	chatRepo         *repositories.ChatRepository
+	conversationRepo *repositories.ConversationRepository
+	plotRepo         *repositories.PlotRepository
+	sessionRepo      *repositories.SessionRepository
+	phoneChangeRepo  *repositories.PhoneChangeRepository
+	auditRepo        *repositories.AuditRepository
+	storageService   services.StorageService
+	deletionGrace    time.Duration
+}
+
+// NewAccountController creates a new AccountController instance.
+func NewAccountController(
+	farmerRepo *repositories.FarmerRepository,
+	soilRepo *repositories.SoilRepository,
+	chatRepo *repositories.ChatRepository,
+	conversationRepo *repositories.ConversationRepository,
+	plotRepo *repositories.PlotRepository,
+	sessionRepo *repositories.SessionRepository,
+	phoneChangeRepo *repositories.PhoneChangeRepository,
+	auditRepo *repositories.AuditRepository,
+	storageService services.StorageService,
+	deletionGrace time.Duration,
+) *AccountController {
+	return &AccountController{
+		farmerRepo:       farmerRepo,
+		soilRepo:         soilRepo,
+		chatRepo:         chatRepo,
+		conversationRepo: conversationRepo,
+		plotRepo:         plotRepo,
+		sessionRepo:      sessionRepo,
+		phoneChangeRepo:  phoneChangeRepo,
+		auditRepo:        auditRepo,
+		storageService:   storageService,
+		deletionGrace:    deletionGrace,
+	}
+}
+
+// DeleteMe handles DELETE /api/me — schedules the logged-in farmer's account for deletion.
+// The account is hidden and logged out at once; the purge job erases it after the grace
+// period. Logging in again before then cancels the deletion.
+func (ac *AccountController) DeleteMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmerID, ok := selfFarmerID(c)
+	if !ok {
+		return
+	}
+
+	purgeAfter := time.Now().Add(ac.deletionGrace)
+	farmer, err := ac.farmerRepo.SoftDelete(ctx, farmerID, purgeAfter)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to delete account for farmer %s: %v", farmerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	revoked, err := ac.sessionRepo.RevokeAllForFarmer(ctx, farmerID, "account_deleted")
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for deleted farmer %s: %v", farmerID.Hex(), err)
+	}
+
+	recordAudit(c, ac.auditRepo, models.AuditAccountDeleted, farmerID, map[string]interface{}{
+		"purgeAfter":      purgeAfter,
+		"sessionsRevoked": revoked,
+	})
+
+	log.Printf("INFO: Account deletion scheduled — farmer=%s purgeAfter=%s", farmerID.Hex(), purgeAfter.Format(time.RFC3339))
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":         "Your account will be permanently deleted after the grace period. Log in again before then to cancel.",
+		"deletedAt":       farmer.DeletedAt,
+		"purgeAfter":      farmer.PurgeAfter,
+		"sessionsRevoked": revoked,
+	})
+}
+
+// exportFile is one JSON document in a data export.
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+// exportMedia is one stored file referenced by the farmer's records.
+type exportMedia struct {
+	Kind   string `json:"kind"` // "profile", "soil" or "audio"
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"` // path inside the ZIP
+	Error  string `json:"error,omitempty"`
+}
+
+// ExportMe handles GET /api/me/export — downloads a ZIP with every record we hold about the
+// logged-in farmer as JSON, plus their stored photos and audio.
+func (ac *AccountController) ExportMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmerID, ok := selfFarmerID(c)
+	if !ok {
+		return
+	}
+
+	farmer, err := ac.farmerRepo.FindByID(ctx, farmerID)
+	if err != nil || farmer.IsDeleted() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+		return
+	}
+
+	// Load everything before the first byte is written: once the ZIP starts streaming
+	// the status code can no longer change.
+	files, media, err := ac.collectExport(ctx, farmer)
+	if err != nil {
+		log.Printf("ERROR: Failed to collect export for farmer %s: %v", farmerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="samyaksetu-export-%s.zip"`, time.Now().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for i := range media {
+		m := &media[i]
+		data, err := ac.storageService.ReadFile(ctx, m.Source)
+		if err != nil {
+			log.Printf("WARN: Export — failed to read %s for farmer %s: %v", m.Source, farmerID.Hex(), err)
+			m.Error = "file could not be read"
+			continue
+		}
+		m.File = fmt.Sprintf("media/%s/%s", m.Kind, path.Base(m.Source))
+		if err := writeZipFile(zw, m.File, data); err != nil {
+			log.Printf("ERROR: Export for farmer %s aborted: %v", farmerID.Hex(), err)
+			return
+		}
+	}
+
+	files = append(files, exportFile{name: "media.json", data: media})
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.data, "", "  ")
+		if err == nil {
+			err = writeZipFile(zw, f.name, data)
+		}
+		if err != nil {
+			log.Printf("ERROR: Export for farmer %s aborted: %v", farmerID.Hex(), err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("ERROR: Export for farmer %s aborted: %v", farmerID.Hex(), err)
+		return
+	}
+
+	recordAudit(c, ac.auditRepo, models.AuditDataExported, farmerID, map[string]interface{}{"mediaFiles": len(media)})
+	log.Printf("INFO: Data exported — farmer=%s files=%d media=%d", farmerID.Hex(), len(files), len(media))
+}
+
+// collectExport loads the farmer's records and lists the stored media they reference.
+func (ac *AccountController) collectExport(ctx context.Context, farmer *models.Farmer) ([]exportFile, []exportMedia, error) {
+	plots, err := ac.plotRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("plots: %w", err)
+	}
+	soils, err := ac.soilRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("soil data: %w", err)
+	}
+	messages, err := ac.chatRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chat messages: %w", err)
+	}
+	conversations, err := ac.conversationRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("conversations: %w", err)
+	}
+	sessions, err := ac.sessionRepo.FindActiveByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sessions: %w", err)
+	}
+	phoneChanges, err := ac.phoneChangeRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("phone change requests: %w", err)
+	}
+	auditEntries, err := ac.auditRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("audit log: %w", err)
+	}
+
+	files := []exportFile{
+		{name: "profile.json", data: profileResponse(farmer)},
+		{name: "plots.json", data: plots},
+		{name: "soil_analyses.json", data: soils},
+		{name: "conversations.json", data: conversations},
+		{name: "chat_messages.json", data: messages},
+		{name: "devices.json", data: sessions},
+		{name: "phone_change_requests.json", data: phoneChanges},
+		{name: "account_history.json", data: auditEntries},
+	}
+
+	// Records that saved the same content share one stored file, which is exported once
+	var media []exportMedia
+	seen := make(map[string]bool)
+	addMedia := func(kind, source string) {
+		if source != "" && !seen[source] {
+			seen[source] = true
+			media = append(media, exportMedia{Kind: kind, Source: source})
+		}
+	}
+	addMedia("profile", farmer.ProfilePic)
+	for _, soil := range soils {
+		addMedia("soil", soil.ImagePath)
+	}
+	for _, msg := range messages {
+		addMedia("audio", msg.AudioPath)
+	}
+	return files, media, nil
+}
+
+// selfFarmerID returns the farmer behind a farmer token. Staff get 403: these endpoints only
+// act on the caller's own account.
+func selfFarmerID(c *gin.Context) (primitive.ObjectID, bool) {
+	if isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only farmers can manage their own account data"})
+		return primitive.NilObjectID, false
+	}
+	farmerID, err := primitive.ObjectIDFromHex(c.GetString("farmerId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return primitive.NilObjectID, false
+	}
+	return farmerID, true
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AdminController handles staff management and farmer block assignment. All routes require RoleAdmin.
+type AdminController struct {
+	userRepo    *repositories.UserRepository
+	farmerRepo  *repositories.FarmerRepository
+	sessionRepo *repositories.SessionRepository
+	auditRepo   *repositories.AuditRepository
+}
+
+// NewAdminController creates a new AdminController instance.
+func NewAdminController(userRepo *repositories.UserRepository, farmerRepo *repositories.FarmerRepository, sessionRepo *repositories.SessionRepository, auditRepo *repositories.AuditRepository) *AdminController {
+	return &AdminController{
+		userRepo:    userRepo,
+		farmerRepo:  farmerRepo,
+		sessionRepo: sessionRepo,
+		auditRepo:   auditRepo,
+	}
+}
+
+// CreateUser handles POST /api/admin/users — adds an extension officer, agronomist or admin.
+func (ac *AdminController) CreateUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := utils.ValidatePhone(req.Phone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsStaffRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of: " + strings.Join(models.StaffRoles, ", ")})
+		return
+	}
+	req.Block = strings.TrimSpace(req.Block)
+	if models.IsBlockScoped(req.Role) && req.Block == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "block is required for extension officers"})
+		return
+	}
+
+	user := &models.User{
+		Name:     strings.TrimSpace(req.Name),
+		Phone:    req.Phone,
+		Role:     req.Role,
+		Block:    req.Block,
+		District: strings.TrimSpace(req.District),
+		Active:   true,
+	}
+	if adminID, err := primitive.ObjectIDFromHex(c.GetString("userId")); err == nil {
+		user.CreatedBy = &adminID
+	}
+
+	if err := ac.userRepo.Create(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A staff user with this phone number already exists"})
+			return
+		}
+		log.Printf("ERROR: Failed to create staff user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	log.Printf("INFO: Staff user created — id=%s role=%s block=%s by=%s", user.ID.Hex(), user.Role, user.Block, c.GetString("userId"))
+	c.JSON(http.StatusCreated, user)
+}
+
+// ListUsers handles GET /api/admin/users — lists staff users, optionally filtered by ?role= and ?block=.
+func (ac *AdminController) ListUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	users, err := ac.userRepo.List(ctx, c.Query("role"), c.Query("block"))
+	if err != nil {
+		log.Printf("ERROR: Failed to list staff users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// UpdateUser handles PATCH /api/admin/users/:id — changes a staff user's name, role, block or status.
+// Role, block and deactivation changes log the user out everywhere so new tokens carry the change.
+func (ac *AdminController) UpdateUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	existing, err := ac.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	set := bson.M{}
+	revoke := false
+	if req.Name != nil {
+		set["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.Role != nil && *req.Role != existing.Role {
+		if !models.IsStaffRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of: " + strings.Join(models.StaffRoles, ", ")})
+			return
+		}
+		set["role"] = *req.Role
+		revoke = true
+	}
+	if req.Block != nil && strings.TrimSpace(*req.Block) != existing.Block {
+		set["block"] = strings.TrimSpace(*req.Block)
+		revoke = true
+	}
+	if req.District != nil {
+		set["district"] = strings.TrimSpace(*req.District)
+	}
+	if req.Active != nil && *req.Active != existing.Active {
+		if !*req.Active && existing.ID.Hex() == c.GetString("userId") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+			return
+		}
+		set["active"] = *req.Active
+		revoke = revoke || !*req.Active
+	}
+
+	role, block := existing.Role, existing.Block
+	if v, ok := set["role"].(string); ok {
+		role = v
+	}
+	if v, ok := set["block"].(string); ok {
+		block = v
+	}
+	if models.IsBlockScoped(role) && block == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "block is required for extension officers"})
+		return
+	}
+
+	if len(set) == 0 {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	user, err := ac.userRepo.Update(ctx, userID, set)
+	if err != nil {
+		log.Printf("ERROR: Failed to update staff user %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	if revoke {
+		if _, err := ac.sessionRepo.RevokeAllForUser(ctx, userID, "updated_by_admin"); err != nil {
+			log.Printf("ERROR: Failed to revoke sessions for user %s: %v", userID.Hex(), err)
+		}
+	}
+
+	log.Printf("INFO: Staff user updated — id=%s changes=%v by=%s", userID.Hex(), set, c.GetString("userId"))
+	c.JSON(http.StatusOK, user)
+}
+
+// DeactivateUser handles DELETE /api/admin/users/:id — disables a staff account and logs it out.
+// The record is kept so audit trails that reference it stay readable.
+func (ac *AdminController) DeactivateUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	if userID.Hex() == c.GetString("userId") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot deactivate your own account"})
+		return
+	}
+
+	if _, err := ac.userRepo.Update(ctx, userID, bson.M{"active": false}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to deactivate staff user %s: %v", userID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+
+	revoked, err := ac.sessionRepo.RevokeAllForUser(ctx, userID, "deactivated")
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %s: %v", userID.Hex(), err)
+	}
+
+	log.Printf("INFO: Staff user deactivated — id=%s sessions=%d by=%s", userID.Hex(), revoked, c.GetString("userId"))
+	c.JSON(http.StatusOK, gin.H{"message": "User deactivated", "sessionsRevoked": revoked})
+}
+
+// AssignFarmerBlock handles PUT /api/admin/farmers/:id/block — assigns a farmer to a block so
+// that block's extension officers can see them.
+func (ac *AdminController) AssignFarmerBlock(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmerID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
+		return
+	}
+
+	var req models.AssignBlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	farmer, err := ac.farmerRepo.UpdateBlock(ctx, farmerID, strings.TrimSpace(req.Block), strings.TrimSpace(req.District))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+			return
+		}
+		log.Printf("ERROR: Failed to assign block for farmer %s: %v", farmerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign block"})
+		return
+	}
+
+	log.Printf("INFO: Farmer assigned to block — farmer=%s block=%s by=%s", farmerID.Hex(), farmer.Block, c.GetString("userId"))
+	c.JSON(http.StatusOK, farmer)
+}
+
+// ListAuditLogs handles GET /api/admin/audit-logs — the account change history, newest first.
+// Filter with ?farmerId= and ?action=; paginate with ?limit= and ?offset=.
+func (ac *AdminController) ListAuditLogs(c *gin.Context) {
+	ctx := c.Request.Context()
+	var farmerID *primitive.ObjectID
+	if v := c.Query("farmerId"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
+			return
+		}
+		farmerID = &id
+	}
+
+	limit, offset := pageParams(c)
+	entries, err := ac.auditRepo.List(ctx, farmerID, c.Query("action"), limit, offset)
+	if err != nil {
+		log.Printf("ERROR: Failed to list audit logs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,29 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordAudit writes an audit entry for an action on a farmer, attributed to the caller.
+// Failures are logged, not returned: the change itself has already happened.
+func recordAudit(c *gin.Context, auditRepo *repositories.AuditRepository, action string, farmerID primitive.ObjectID, details map[string]interface{}) {
+	ctx := c.Request.Context()
+	entry := &models.AuditLog{
+		Action:    action,
+		ActorID:   callerID(c),
+		ActorRole: c.GetString("role"),
+		FarmerID:  &farmerID,
+		Details:   details,
+		IP:        c.ClientIP(),
+	}
+	if err := auditRepo.Record(ctx, entry); err != nil {
+		log.Printf("ERROR: Failed to write audit entry %s for farmer %s: %v", action, farmerID.Hex(), err)
+	}
+}
@@ -3,32 +3,52 @@
 package controllers
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
 	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// OTPLimits bounds how often OTPs can be requested.
+type OTPLimits struct {
+	ResendCooldown time.Duration // minimum gap between two OTPs for the same phone
+	DailyLimit     int           // maximum OTPs per phone in 24 hours
+	IPHourlyLimit  int           // maximum OTP requests per client IP in one hour
+}
+
 // AuthController handles authentication-related requests.
 type AuthController struct {
-	otpRepo    *repositories.OTPRepository
-	otpService services.OTPService
+	otpRepo       *repositories.OTPRepository
+	otpService    services.OTPService
+	limits        OTPLimits
+	webhookSecret string
 }
 
 // NewAuthController creates a new AuthController instance.
-func NewAuthController(otpRepo *repositories.OTPRepository, otpService services.OTPService) *AuthController {
+// webhookSecret must be presented by SMS providers posting delivery receipts.
+func NewAuthController(otpRepo *repositories.OTPRepository, otpService services.OTPService, limits OTPLimits, webhookSecret string) *AuthController {
 	return &AuthController{
-		otpRepo:    otpRepo,
-		otpService: otpService,
+		otpRepo:       otpRepo,
+		otpService:    otpService,
+		limits:        limits,
+		webhookSecret: webhookSecret,
 	}
 }
 
 // SendOTP handles POST /api/auth/send-otp — generates and sends an OTP via SMS.
 func (ac *AuthController) SendOTP(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req models.SendOTPRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
@@ -41,23 +61,196 @@ func (ac *AuthController) SendOTP(c *gin.Context) {
 		return
 	}
 
+	// Reserve this request before checking the limits, so parallel calls can't all pass them.
+	// Without a reservation no SMS is sent.
+	ip := c.ClientIP()
+	requestID, err := ac.otpRepo.RecordRequest(ctx, req.Phone, ip)
+	if err != nil {
+		log.Printf("ERROR: Failed to record OTP request for %s: %v", req.Phone, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process OTP request"})
+		return
+	}
+
+	// Enforce per-IP, per-phone cooldown and per-phone daily limits
+	if err := ac.checkLimits(ctx, requestID, req.Phone, ip); err != nil {
+		ac.dropRequest(ctx, requestID, req.Phone)
+		respondOTPError(c, err)
+		return
+	}
+
 	// Generate 6-digit OTP
 	code := services.GenerateOTP()
 
-	// Save to database (expires in 5 minutes)
-	if err := ac.otpRepo.SaveOTP(req.Phone, code); err != nil {
-		log.Printf("ERROR: Failed to save OTP to database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process OTP request"})
+	// Save hashed code to database (refused while the phone is locked out)
+	if err := ac.otpRepo.SaveOTP(ctx, req.Phone, code); err != nil {
+		ac.dropRequest(ctx, requestID, req.Phone)
+		respondOTPError(c, err)
 		return
 	}
 
-	// Send via SMS Service
-	if err := ac.otpService.SendOTP(req.Phone, code); err != nil {
+	// Send via SMS providers (falls back through SMS_PROVIDERS in order)
+	delivery, err := ac.otpService.SendOTP(req.Phone, code)
+	if err != nil {
 		log.Printf("ERROR: Failed to send SMS for %s: %v", req.Phone, err)
+		if err := ac.otpRepo.MarkRequestFailed(ctx, requestID, err.Error()); err != nil {
+			log.Printf("WARN: Failed to record SMS failure for %s: %v", req.Phone, err)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send SMS OTP"})
 		return
 	}
 
-	log.Printf("INFO: OTP successfully sent to %s", req.Phone)
-	c.JSON(http.StatusOK, gin.H{"message": "OTP sent successfully. It will expire in 5 minutes."})
+	if err := ac.otpRepo.MarkRequestSent(ctx, requestID, delivery.Provider, delivery.MessageID); err != nil {
+		log.Printf("WARN: Failed to record SMS delivery for %s: %v", req.Phone, err)
+	}
+
+	ttl := ac.otpRepo.CodeTTL()
+	log.Printf("INFO: OTP successfully sent to %s via %s (messageId=%s)", req.Phone, delivery.Provider, delivery.MessageID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     fmt.Sprintf("OTP sent successfully. It will expire in %d minutes.", int(ttl.Minutes())),
+		"expiresIn":   int64(ttl.Seconds()),
+		"resendAfter": int64(ac.limits.ResendCooldown.Seconds()),
+	})
+}
+
+// DeliveryReceipt handles POST /api/webhooks/sms/:provider — records an SMS provider's
+// delivery report against the OTP request it belongs to. Accepts JSON or form-encoded
+// payloads; the provider must pass SMS_WEBHOOK_SECRET as ?token= or X-Webhook-Token.
+func (ac *AuthController) DeliveryReceipt(c *gin.Context) {
+	ctx := c.Request.Context()
+	token := c.Query("token")
+	if token == "" {
+		token = c.GetHeader("X-Webhook-Token")
+	}
+	if ac.webhookSecret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(ac.webhookSecret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook token"})
+		return
+	}
+
+	router, ok := ac.otpService.(services.DeliveryReceiptRouter)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery receipts are not supported"})
+		return
+	}
+
+	payload := make(map[string]interface{})
+	if c.ContentType() == "application/json" {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt body: " + err.Error()})
+			return
+		}
+	} else {
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receipt body: " + err.Error()})
+			return
+		}
+		for key := range c.Request.PostForm {
+			payload[key] = c.Request.PostForm.Get(key)
+		}
+	}
+
+	provider := c.Param("provider")
+	receipt, err := router.ParseDeliveryReceipt(provider, payload)
+	if err != nil {
+		log.Printf("WARN: Rejected delivery receipt from %s: %v", provider, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := ac.otpRepo.UpdateDeliveryStatus(ctx, receipt.Provider, receipt.MessageID, receipt.Status, receipt.ProviderStatus)
+	if err != nil {
+		log.Printf("ERROR: Failed to record delivery receipt %s/%s: %v", receipt.Provider, receipt.MessageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery receipt"})
+		return
+	}
+	if !found {
+		// Acknowledge anyway so the provider doesn't keep retrying a receipt we can't match
+		log.Printf("WARN: Delivery receipt for unknown message %s/%s", receipt.Provider, receipt.MessageID)
+	} else {
+		log.Printf("INFO: SMS %s/%s is %s (%s)", receipt.Provider, receipt.MessageID, receipt.Status, receipt.ProviderStatus)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Receipt recorded", "status": receipt.Status})
+}
+
+// checkLimits returns an *OTPError if this phone or IP has requested too many OTPs. The
+// request with ID requestID has already been recorded, so it is part of every count; a
+// request recorded at the same time by a parallel call counts too, and may refuse both.
+func (ac *AuthController) checkLimits(ctx context.Context, requestID primitive.ObjectID, phone, ip string) error {
+	now := time.Now()
+
+	ipCount, err := ac.otpRepo.CountRequestsByIPSince(ctx, ip, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if ipCount > int64(ac.limits.IPHourlyLimit) {
+		log.Printf("WARN: OTP requests throttled for IP %s (%d in the last hour)", ip, ipCount)
+		return &repositories.OTPError{
+			Code:       models.OTPErrIPThrottled,
+			Message:    "Too many OTP requests from this network. Please try again later.",
+			RetryAfter: time.Hour,
+		}
+	}
+
+	last, err := ac.otpRepo.LastRequestAt(ctx, phone, requestID)
+	if err != nil {
+		return err
+	}
+	if wait := ac.limits.ResendCooldown - now.Sub(last); !last.IsZero() && wait > 0 {
+		return &repositories.OTPError{
+			Code:       models.OTPErrResendCooldown,
+			Message:    "Please wait before requesting another OTP.",
+			RetryAfter: wait,
+		}
+	}
+
+	dailyCount, err := ac.otpRepo.CountRequestsByPhoneSince(ctx, phone, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if dailyCount > int64(ac.limits.DailyLimit) {
+		return &repositories.OTPError{
+			Code:       models.OTPErrDailyLimit,
+			Message:    "OTP limit reached for today. Please try again tomorrow.",
+			RetryAfter: 24 * time.Hour,
+		}
+	}
+
+	return nil
+}
+
+// dropRequest removes a reserved request that was refused, so it doesn't count against
+// later ones. If that fails the request keeps counting, which only errs on the safe side.
+func (ac *AuthController) dropRequest(ctx context.Context, requestID primitive.ObjectID, phone string) {
+	if err := ac.otpRepo.DeleteRequest(context.WithoutCancel(ctx), requestID); err != nil {
+		log.Printf("WARN: Failed to drop refused OTP request for %s: %v", phone, err)
+	}
+}
+
+// respondOTPError writes an OTP failure with a machine-readable code for the app.
+// Throttling and lockouts return 429 with a Retry-After header; wrong or expired codes return 401.
+func respondOTPError(c *gin.Context, err error) {
+	var otpErr *repositories.OTPError
+	if !errors.As(err, &otpErr) {
+		log.Printf("ERROR: OTP processing failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process OTP request"})
+		return
+	}
+
+	body := gin.H{"error": otpErr.Message, "code": otpErr.Code}
+	status := http.StatusUnauthorized
+
+	switch otpErr.Code {
+	case models.OTPErrInvalid:
+		body["attemptsLeft"] = otpErr.AttemptsLeft
+	case models.OTPErrLocked, models.OTPErrResendCooldown, models.OTPErrDailyLimit, models.OTPErrIPThrottled:
+		status = http.StatusTooManyRequests
+	}
+
+	if otpErr.RetryAfter > 0 {
+		retryAfter := int64(math.Ceil(otpErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+		body["retryAfter"] = retryAfter
+	}
+
+	c.JSON(status, body)
 }
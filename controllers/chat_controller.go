@@ -3,104 +3,214 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
 	"github.com/samyaksetu/backend/utils"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // ChatController handles HTTP requests related to AI advisory chat.
 type ChatController struct {
-	farmerRepo     *repositories.FarmerRepository
-	soilRepo       *repositories.SoilRepository
-	chatRepo       *repositories.ChatRepository
-	aiService      services.AIService
-	weatherService services.WeatherService
+	farmerRepo       *repositories.FarmerRepository
+	soilRepo         *repositories.SoilRepository
+	plotRepo         *repositories.PlotRepository
+	chatRepo         *repositories.ChatRepository
+	conversationRepo *repositories.ConversationRepository
+	aiService        services.AIService
+	weatherService   services.WeatherService
+	imagePipeline    *services.ImagePipeline
+	historyTokens    int // budget for earlier turns sent with each message
 }
 
 // NewChatController creates a new ChatController instance.
 func NewChatController(
 	farmerRepo *repositories.FarmerRepository,
 	soilRepo *repositories.SoilRepository,
+	plotRepo *repositories.PlotRepository,
 	chatRepo *repositories.ChatRepository,
+	conversationRepo *repositories.ConversationRepository,
 	aiService services.AIService,
 	weatherService services.WeatherService,
+	imagePipeline *services.ImagePipeline,
+	historyTokens int,
 ) *ChatController {
 	return &ChatController{
-		farmerRepo:     farmerRepo,
-		soilRepo:       soilRepo,
-		chatRepo:       chatRepo,
-		aiService:      aiService,
-		weatherService: weatherService,
+		farmerRepo:       farmerRepo,
+		soilRepo:         soilRepo,
+		plotRepo:         plotRepo,
+		chatRepo:         chatRepo,
+		conversationRepo: conversationRepo,
+		aiService:        aiService,
+		weatherService:   weatherService,
+		imagePipeline:    imagePipeline,
+		historyTokens:    historyTokens,
 	}
 }
 
+// chatTurn is a farmer's message, stored, together with everything needed to answer it.
+type chatTurn struct {
+	farmer       *models.Farmer
+	plot         *models.Plot
+	conversation *models.Conversation
+	userMsg      *models.ChatMessage
+	system       string
+	messages     []services.Message
+	history      []models.ChatMessage // unsummarized earlier messages, newest first
+	overflowed   bool                 // some of history did not fit the budget
+}
+
 // Chat handles POST /api/chat — AI-powered agricultural advisory.
 func (cc *ChatController) Chat(c *gin.Context) {
-	// Parse farmer ID
-	farmerIDStr := c.PostForm("farmerId")
-	if farmerIDStr == "" {
-		// Try JSON binding as fallback
-		farmerIDStr = c.Query("farmerId")
-	}
-
-	// Also try from JSON body
-	var jsonReq models.ChatRequest
-	if farmerIDStr == "" {
-		if err := c.ShouldBindJSON(&jsonReq); err == nil {
-			farmerIDStr = jsonReq.FarmerID
-		}
-	} else {
-		jsonReq.Message = c.PostForm("message")
+	ctx := c.Request.Context()
+	turn, ok := cc.startTurn(c)
+	if !ok {
+		return
 	}
 
-	if farmerIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "farmerId is required"})
+	aiReply, err := cc.aiService.GenerateChat(ctx, turn.system, turn.messages)
+	if err != nil {
+		log.Printf("ERROR: AI advisory failed for farmer %s: %v", turn.farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI advisory service is temporarily unavailable. Please try again."})
 		return
 	}
 
-	farmerID, err := primitive.ObjectIDFromHex(farmerIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
+	cc.finishTurn(ctx, turn, aiReply, false)
+	c.JSON(http.StatusOK, models.ChatResponse{Reply: aiReply, ConversationID: turn.conversation.ID.Hex()})
+}
+
+// ChatStream handles POST /api/chat/stream — the same advisory as Chat, with the reply
+// streamed as Server-Sent Events. If the client goes away the partial reply is still saved.
+func (cc *ChatController) ChatStream(c *gin.Context) {
+	ctx := c.Request.Context()
+	turn, ok := cc.startTurn(c)
+	if !ok {
 		return
 	}
 
-	// Get message
-	message := jsonReq.Message
-	if message == "" {
-		message = c.PostForm("message")
+	startSSE(c)
+	sendEvent(c, "start", gin.H{
+		"conversationId": turn.conversation.ID.Hex(),
+		"userMessageId":  turn.userMsg.ID.Hex(),
+	})
+
+	aiReply, err := cc.aiService.StreamChat(ctx, turn.system, turn.messages, func(delta string) error {
+		return sendEvent(c, "delta", gin.H{"text": delta})
+	})
+	if err != nil && aiReply == "" {
+		if ctx.Err() != nil {
+			log.Printf("INFO: Client disconnected before the AI advisory stream started — farmer=%s", turn.farmer.ID.Hex())
+			return
+		}
+		log.Printf("ERROR: AI advisory stream failed for farmer %s: %v", turn.farmer.ID.Hex(), err)
+		sendEvent(c, "error", gin.H{"error": "AI advisory service is temporarily unavailable. Please try again."})
+		return
 	}
-	if message == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+	if aiReply == "" {
+		// Nothing to save or show; an empty message in the thread would only confuse
+		log.Printf("WARN: AI advisory stream for farmer %s returned an empty reply", turn.farmer.ID.Hex())
+		sendEvent(c, "error", gin.H{"error": "The AI did not return a reply. Please try again."})
 		return
 	}
 
-	// Ensure farmer exists
-	farmer, err := cc.farmerRepo.FindByID(farmerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+	interrupted := err != nil
+	aiMsg := cc.finishTurn(ctx, turn, aiReply, interrupted)
+	if interrupted && ctx.Err() != nil {
+		log.Printf("INFO: Client disconnected from the AI advisory stream — farmer=%s saved %d bytes", turn.farmer.ID.Hex(), len(aiReply))
+		return
+	}
+	if interrupted {
+		log.Printf("WARN: AI advisory stream interrupted for farmer %s after %d bytes: %v", turn.farmer.ID.Hex(), len(aiReply), err)
+		sendEvent(c, "error", gin.H{
+			"error":          "The reply was cut off. The part received has been saved.",
+			"messageId":      aiMsg.ID.Hex(),
+			"conversationId": turn.conversation.ID.Hex(),
+		})
 		return
 	}
+	sendEvent(c, "done", gin.H{
+		"messageId":      aiMsg.ID.Hex(),
+		"conversationId": turn.conversation.ID.Hex(),
+	})
+}
+
+// startTurn validates a chat request, gathers the farmer's context and stores their message.
+// On failure it writes the error response and returns false.
+func (cc *ChatController) startTurn(c *gin.Context) (*chatTurn, bool) {
+	ctx := c.Request.Context()
+	// Accept either multipart form (text + image) or a JSON body (text only)
+	var req models.ChatRequest
+	if ct := c.ContentType(); ct == "multipart/form-data" || ct == "application/x-www-form-urlencoded" {
+		req.FarmerID = c.PostForm("farmerId")
+		req.ConversationID = c.PostForm("conversationId")
+		req.PlotID = c.PostForm("plotId")
+		req.Message = c.PostForm("message")
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return nil, false
+	}
+
+	message := req.Message
+	if message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return nil, false
+	}
+
+	// Resolve the acting farmer from the token (farmerId in the body is optional)
+	farmer, ok := resolveFarmer(c, cc.farmerRepo, req.FarmerID)
+	if !ok {
+		return nil, false
+	}
+	farmerID := farmer.ID
+
+	// Optional thread the message continues
+	conversation, ok := farmerConversation(c, cc.conversationRepo, farmer, req.ConversationID)
+	if !ok {
+		return nil, false
+	}
+
+	// Optional plot the question is about. Follow-ups in a plot's thread stay about that
+	// plot unless it has since been deleted.
+	plot, ok := farmerPlot(c, cc.plotRepo, farmer, req.PlotID)
+	if !ok {
+		return nil, false
+	}
+	if conversation != nil && conversation.PlotID != nil {
+		if plot == nil {
+			plot, _ = cc.plotRepo.FindByID(ctx, *conversation.PlotID)
+		} else if plot.ID != *conversation.PlotID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This conversation is about a different plot"})
+			return nil, false
+		}
+	}
 
-	// Fetch latest soil data (optional — farmer may not have uploaded soil yet)
-	soilType := "Not available (no soil analysis done yet)"
-	soilData, err := cc.soilRepo.FindLatestByFarmerID(farmerID)
+	// Fetch latest soil data (optional — farmer may not have uploaded soil yet).
+	// For a plot only that plot's samples count; another field's soil would mislead.
+	soil := "Not available (no soil analysis done yet)"
+	var soilData *models.SoilData
+	var err error
+	if plot != nil {
+		soil = "Not available (no soil analysis for this plot yet)"
+		soilData, err = cc.soilRepo.FindLatestByPlotID(ctx, plot.ID)
+	} else {
+		soilData, err = cc.soilRepo.FindLatestByFarmerID(ctx, farmerID)
+	}
 	if err == nil && soilData != nil {
-		soilType = soilData.SoilType
+		soil = soilText(soilData)
 	} else if err != nil && err != mongo.ErrNoDocuments {
 		log.Printf("WARN: Failed to fetch soil data for farmer %s: %v", farmerID.Hex(), err)
 	}
 
-	// Fetch weather data
-	weatherSummary, err := cc.weatherService.GetWeather(farmer.Location.Latitude, farmer.Location.Longitude)
+	// Fetch weather data for the plot, or the farmer's location
+	location := advisoryLocation(farmer, plot)
+	weatherSummary, err := cc.weatherService.GetWeather(ctx, location.Latitude, location.Longitude)
 	if err != nil {
 		log.Printf("WARN: Weather fetch failed for farmer %s: %v", farmerID.Hex(), err)
 		weatherSummary = "Weather data unavailable"
@@ -109,92 +219,241 @@ func (cc *ChatController) Chat(c *gin.Context) {
 	// Check for optional image
 	var imageData []byte
 	var mimeType string
-	file, err := c.FormFile("image")
-	if err == nil && file != nil {
-		if validErr := utils.ValidateImageFile(file); validErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validErr.Error()})
-			return
-		}
-		src, openErr := file.Open()
-		if openErr == nil {
-			imageData, _ = io.ReadAll(src)
-			src.Close()
-			mimeType = utils.GetMimeType(file)
+	image, ok := readUpload(c, "image", utils.ValidateImage)
+	if !ok {
+		return nil, false
+	}
+	if image != nil {
+		photo, ok := processPhoto(c, cc.imagePipeline, image.data)
+		if !ok {
+			return nil, false
 		}
+		imageData, mimeType = photo.Data, photo.MimeType
+	}
+
+	// Earlier turns of the thread that fit the budget; older ones live in the summary
+	history := cc.recentHistory(ctx, conversation)
+	turns, overflow := splitHistory(history, cc.historyTokens)
+	summary := ""
+	if conversation != nil {
+		summary = conversation.Summary
 	}
 
-	// Build structured prompt
-	prompt := buildAdvisoryPrompt(farmer, soilType, weatherSummary, message)
+	// Build structured system prompt and the conversation
+	system := buildAdvisoryPrompt(farmer, plot, soil, weatherSummary, summary)
+	messages := append(historyMessages(turns), services.Message{
+		Role:      services.MessageRoleUser,
+		Text:      message,
+		ImageData: imageData,
+		MimeType:  mimeType,
+	})
+
+	if conversation == nil {
+		conversation, err = startConversation(ctx, cc.conversationRepo, farmerID, plot, message)
+		if err != nil {
+			log.Printf("ERROR: Failed to start conversation for farmer %s: %v", farmerID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start conversation"})
+			return nil, false
+		}
+	}
 
 	// Save user message
 	userMsg := &models.ChatMessage{
-		FarmerID: farmerID,
-		Role:     "user",
-		Message:  message,
-	}
-	if file != nil {
-		userMsg.ImagePath = file.Filename
+		FarmerID:       farmerID,
+		ConversationID: &conversation.ID,
+		Role:           "user",
+		Message:        message,
 	}
-	if saveErr := cc.chatRepo.SaveMessage(userMsg); saveErr != nil {
-		log.Printf("WARN: Failed to save user message: %v", saveErr)
+	if plot != nil {
+		userMsg.PlotID = &plot.ID
 	}
-
-	// Call AI
-	var aiReply string
-	if len(imageData) > 0 {
-		aiReply, err = cc.aiService.GenerateAdvisoryWithImage(prompt, imageData, mimeType)
-	} else {
-		aiReply, err = cc.aiService.GenerateAdvisory(prompt)
+	if image != nil {
+		userMsg.ImagePath = image.file.Filename
 	}
+	saveChatMessage(ctx, cc.chatRepo, cc.conversationRepo, userMsg)
 
-	if err != nil {
-		log.Printf("ERROR: AI advisory failed for farmer %s: %v", farmerID.Hex(), err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI advisory service is temporarily unavailable. Please try again."})
-		return
-	}
+	return &chatTurn{
+		farmer:       farmer,
+		plot:         plot,
+		conversation: conversation,
+		userMsg:      userMsg,
+		system:       system,
+		messages:     messages,
+		history:      history,
+		overflowed:   len(overflow) > 0,
+	}, true
+}
 
-	// Save AI response
+// finishTurn stores the AI's reply and, once the history window overflows, folds everything
+// older than half the budget into the summary so the next few turns fit without another
+// roll-up. interrupted marks a reply that was cut off while streaming; it is saved even
+// though the request has been cancelled by then.
+func (cc *ChatController) finishTurn(ctx context.Context, turn *chatTurn, reply string, interrupted bool) *models.ChatMessage {
+	ctx = context.WithoutCancel(ctx)
 	aiMsg := &models.ChatMessage{
-		FarmerID: farmerID,
-		Role:     "ai",
-		Message:  aiReply,
+		FarmerID:       turn.farmer.ID,
+		ConversationID: &turn.conversation.ID,
+		PlotID:         turn.userMsg.PlotID,
+		Role:           "ai",
+		Message:        reply,
+		Interrupted:    interrupted,
+		AIProvider:     services.AIProviderUsed(ctx),
 	}
-	if saveErr := cc.chatRepo.SaveMessage(aiMsg); saveErr != nil {
-		log.Printf("WARN: Failed to save AI message: %v", saveErr)
+	saveChatMessage(ctx, cc.chatRepo, cc.conversationRepo, aiMsg)
+
+	if turn.overflowed {
+		_, fold := splitHistory(turn.history, cc.historyTokens/2)
+		go cc.rollUpSummary(*turn.conversation, fold)
 	}
 
-	log.Printf("INFO: Chat completed — farmer=%s query_len=%d reply_len=%d", farmer.Name, len(message), len(aiReply))
-	c.JSON(http.StatusOK, models.ChatResponse{Reply: aiReply})
+	log.Printf("INFO: Chat completed — farmer=%s query_len=%d history=%d reply_len=%d interrupted=%t",
+		turn.farmer.Name, len(turn.userMsg.Message), len(turn.messages)-1, len(reply), interrupted)
+	return aiMsg
 }
 
-// buildAdvisoryPrompt constructs a context-rich prompt for agricultural advisory.
-func buildAdvisoryPrompt(farmer *models.Farmer, soilType, weather, query string) string {
+// buildAdvisoryPrompt constructs the context-rich system prompt for agricultural advisory.
+// The farmer's messages are sent separately as conversation turns. When plot is set, location
+// and crops describe that field rather than the whole farm; soil describes the latest soil
+// analysis (see soilText) and summary recaps older turns.
+func buildAdvisoryPrompt(farmer *models.Farmer, plot *models.Plot, soil, weather, summary string) string {
+	location := advisoryLocation(farmer, plot)
+	earlier := ""
+	if summary != "" {
+		earlier = "\n=== EARLIER IN THIS CONVERSATION ===\n" + summary + "\n"
+	}
 	return fmt.Sprintf(`You are SamyakSetu AI, an expert agricultural advisor for Indian farmers.
 You provide practical, actionable advice based on the farmer's specific conditions.
 
 === FARMER CONTEXT ===
 Name: %s
 Location: Latitude %.6f, Longitude %.6f
-Soil Type: %s
+Region: %s
+Land Holding: %s
+Irrigation: %s
+Primary Crops: %s
+Plot: %s
+Soil: %s
 Current Weather: %s
-
-=== FARMER'S QUESTION ===
 %s
-
 === INSTRUCTIONS ===
-1. Provide advice specific to the farmer's soil type, location, and current weather conditions.
-2. If the farmer asks about crops, recommend varieties suitable for their soil and climate.
+1. Provide advice specific to the farmer's soil, location, land, irrigation and current weather conditions. If a plot is given, the question is about that plot.
+2. If the farmer asks about crops, recommend varieties suitable for their soil and climate, starting from the crops they already grow.
 3. If asking about pests or diseases, consider the weather conditions in your diagnosis.
-4. Keep advice practical and actionable for a small to medium-scale farmer.
+4. Keep advice practical and actionable for a farmer of this land size and water availability.
 5. If relevant, mention any weather-related precautions.
 6. Respond in a friendly, supportive tone.
 7. If you don't have enough context, ask clarifying questions.
-8. Keep the response concise but comprehensive (200-400 words unless more detail is needed).`,
+8. Keep the response concise but comprehensive (200-400 words unless more detail is needed).
+9. Answer the farmer's latest message. Use the earlier conversation to understand follow-up questions such as "what about for wheat?".
+10. %s`,
 		farmer.Name,
-		farmer.Location.Latitude,
-		farmer.Location.Longitude,
-		soilType,
+		location.Latitude,
+		location.Longitude,
+		orUnknown(joinNonEmpty(", ", farmer.Block, farmer.District, farmer.State)),
+		landSizeText(farmer.LandSizeAcres),
+		orUnknown(strings.ReplaceAll(farmer.IrrigationSource, "_", " ")),
+		orUnknown(strings.Join(farmer.PrimaryCrops, ", ")),
+		plotText(plot),
+		soil,
 		weather,
-		query,
+		earlier,
+		languageInstruction(farmer.PreferredLanguage),
 	)
 }
+
+// languageInstruction tells the model which language to answer in.
+// Without a stored preference the model mirrors the farmer's own language.
+func languageInstruction(code string) string {
+	if name := models.LanguageName(code); name != "" {
+		return fmt.Sprintf("Respond in %s (the farmer's preferred language), using simple words a farmer would use. If the farmer writes in a different language, reply in that language instead.", name)
+	}
+	return "Respond in the same language the farmer used (Hindi, English, or Hinglish)."
+}
+
+// plotText describes the selected plot, e.g. "North field — 2.5 acres, growing wheat, mustard".
+func plotText(plot *models.Plot) string {
+	if plot == nil {
+		return "Whole farm (no specific plot selected)"
+	}
+	text := fmt.Sprintf("%s — %s", plot.Name, landSizeText(plot.AreaAcres))
+	if len(plot.Crops) > 0 {
+		text += ", growing " + strings.Join(plot.Crops, ", ")
+	}
+	return text
+}
+
+// soilText describes a soil sample for the advisory prompt, e.g. "Black Soil (confidence 85%)
+// — clay texture, very dark grey colour (10YR 3/1), medium organic matter, moist; concerns:
+// surface cracking". A manual label replaces the AI's class and confidence, noting who set
+// it. Records from before structured analysis only have their soil type.
+func soilText(soil *models.SoilData) string {
+	a := soil.Analysis
+	if a == nil {
+		label := orUnknown(soil.SoilType)
+		if soil.ManualSoilClass != "" {
+			label += relabelText(soil)
+		}
+		return label
+	}
+	if a.ImageQuality == models.ImageQualityNotSoil && soil.ManualSoilClass == "" {
+		return "Not available (the latest soil photo did not show soil)"
+	}
+
+	label := fmt.Sprintf("%s (confidence %.0f%%)", a.Label(), a.Confidence*100)
+	if a.Confidence < 0.5 {
+		label = fmt.Sprintf("%s (low confidence %.0f%%)", a.Label(), a.Confidence*100)
+	}
+	if soil.ManualSoilClass != "" {
+		label = models.SoilClassLabels[soil.ManualSoilClass] + relabelText(soil)
+	}
+	color := a.Color.Name + " colour"
+	if a.Color.Munsell != "" {
+		color += " (" + a.Color.Munsell + ")"
+	}
+	text := fmt.Sprintf("%s — %s texture, %s, %s organic matter, %s",
+		label, a.Texture, color, a.OrganicMatter, a.Moisture)
+	if len(a.Concerns) > 0 {
+		text += "; concerns: " + strings.Join(a.Concerns, ", ")
+	}
+	if a.ImageQuality == models.ImageQualityPoor {
+		text += "; the photo was poor, so treat this with caution"
+	}
+	return text
+}
+
+// relabelText notes who corrected a sample's soil class by hand: the farmer, or staff such
+// as their extension officer.
+func relabelText(soil *models.SoilData) string {
+	switch soil.RelabeledBy {
+	case soil.FarmerID.Hex():
+		return " (corrected by the farmer)"
+	case "":
+		return " (corrected manually)"
+	default:
+		return " (corrected by agricultural staff)"
+	}
+}
+
+func landSizeText(acres float64) string {
+	if acres <= 0 {
+		return "Not specified"
+	}
+	return fmt.Sprintf("%g acres", acres)
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "Not specified"
+	}
+	return value
+}
+
+func joinNonEmpty(sep string, values ...string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,135 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/services"
+)
+
+// historyFetchLimit bounds how many not-yet-summarized messages one chat request loads.
+const historyFetchLimit = 100
+
+// summaryTimeout bounds a background summary roll-up, which outlives the chat request.
+const summaryTimeout = 2 * time.Minute
+
+// recentHistory loads the conversation's messages that are not yet covered by its running
+// summary, newest first. Failures are logged and the chat goes ahead without memory.
+func (cc *ChatController) recentHistory(ctx context.Context, conversation *models.Conversation) []models.ChatMessage {
+	if conversation == nil {
+		return nil
+	}
+	messages, err := cc.chatRepo.ListSince(ctx, conversation.ID, conversation.SummarizedUntil, historyFetchLimit)
+	if err != nil {
+		log.Printf("WARN: Failed to load history of conversation %s: %v", conversation.ID.Hex(), err)
+		return nil
+	}
+	return messages
+}
+
+// splitHistory takes messages newest first and keeps the most recent ones that fit in
+// budget tokens. Both results are oldest first; older holds the messages that did not fit.
+func splitHistory(newestFirst []models.ChatMessage, budget int) (recent, older []models.ChatMessage) {
+	used, cut := 0, len(newestFirst)
+	for i, msg := range newestFirst {
+		used += estimateTokens(msg.Message)
+		if used > budget {
+			cut = i
+			break
+		}
+	}
+
+	recent = make([]models.ChatMessage, 0, cut)
+	for i := cut - 1; i >= 0; i-- {
+		recent = append(recent, newestFirst[i])
+	}
+	older = make([]models.ChatMessage, 0, len(newestFirst)-cut)
+	for i := len(newestFirst) - 1; i >= cut; i-- {
+		older = append(older, newestFirst[i])
+	}
+	return recent, older
+}
+
+// estimateTokens roughly counts the tokens of a chat turn: about three characters per token
+// across English and Indic scripts, plus a little per-turn overhead.
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 4
+}
+
+// historyMessages converts stored chat turns into AI conversation turns.
+func historyMessages(turns []models.ChatMessage) []services.Message {
+	messages := make([]services.Message, 0, len(turns)+1)
+	for _, turn := range turns {
+		role := services.MessageRoleUser
+		if turn.Role == "ai" {
+			role = services.MessageRoleAssistant
+		}
+		text := turn.Message
+		if turn.ImagePath != "" {
+			text += "\n[The farmer attached a photo to this message.]"
+		}
+		messages = append(messages, services.Message{Role: role, Text: text})
+	}
+	return messages
+}
+
+// rollUpSummary folds messages that have left the history window into the conversation's
+// running summary. It runs after the reply is sent; if it fails the messages are folded in
+// on a later turn.
+func (cc *ChatController) rollUpSummary(conversation models.Conversation, fold []models.ChatMessage) {
+	if len(fold) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+
+	summary, err := cc.aiService.GenerateAdvisory(ctx, buildSummaryPrompt(conversation.Summary, fold))
+	if err != nil {
+		log.Printf("WARN: Failed to summarize conversation %s: %v", conversation.ID.Hex(), err)
+		return
+	}
+
+	until := fold[len(fold)-1].CreatedAt
+	stored, err := cc.conversationRepo.UpdateSummary(ctx, conversation.ID, strings.TrimSpace(summary), until, conversation.SummarizedUntil)
+	if err != nil {
+		log.Printf("WARN: Failed to store summary of conversation %s: %v", conversation.ID.Hex(), err)
+		return
+	}
+	if stored {
+		log.Printf("INFO: Conversation summarized — conversation=%s folded=%d", conversation.ID.Hex(), len(fold))
+	}
+}
+
+// buildSummaryPrompt asks the model to extend a running summary with older turns.
+func buildSummaryPrompt(previous string, turns []models.ChatMessage) string {
+	var transcript strings.Builder
+	for _, turn := range turns {
+		speaker := "Farmer"
+		if turn.Role == "ai" {
+			speaker = "Advisor"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, turn.Message)
+	}
+	if previous == "" {
+		previous = "(none yet)"
+	}
+
+	return fmt.Sprintf(`You maintain the memory of a conversation between an Indian farmer and an agricultural advisor.
+Update the summary below with the new messages. Keep every fact that later advice may depend on:
+crops, plots, symptoms, products and doses already suggested, what the farmer tried, and open questions.
+Write in English, at most 200 words, as plain sentences. Respond with ONLY the updated summary.
+
+=== SUMMARY SO FAR ===
+%s
+
+=== NEW MESSAGES ===
+%s`, previous, transcript.String())
+}
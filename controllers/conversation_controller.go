@@ -0,0 +1,399 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxConversationTitleLength = 100
+	autoTitleLength            = 60 // titles taken from a thread's first message
+	defaultConversationTitle   = "New conversation"
+)
+
+// ConversationController handles HTTP requests for a farmer's chat threads and their history.
+type ConversationController struct {
+	farmerRepo       *repositories.FarmerRepository
+	plotRepo         *repositories.PlotRepository
+	conversationRepo *repositories.ConversationRepository
+	chatRepo         *repositories.ChatRepository
+	storageService   services.StorageService
+}
+
+// NewConversationController creates a new ConversationController instance.
+func NewConversationController(
+	farmerRepo *repositories.FarmerRepository,
+	plotRepo *repositories.PlotRepository,
+	conversationRepo *repositories.ConversationRepository,
+	chatRepo *repositories.ChatRepository,
+	storageService services.StorageService,
+) *ConversationController {
+	return &ConversationController{
+		farmerRepo:       farmerRepo,
+		plotRepo:         plotRepo,
+		conversationRepo: conversationRepo,
+		chatRepo:         chatRepo,
+		storageService:   storageService,
+	}
+}
+
+// CreateConversation handles POST /api/conversations — starts an empty thread.
+// Threads are also started implicitly by POST /api/chat without a conversationId.
+func (cc *ConversationController) CreateConversation(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	farmer, ok := resolveFarmer(c, cc.farmerRepo, req.FarmerID)
+	if !ok {
+		return
+	}
+	plot, ok := farmerPlot(c, cc.plotRepo, farmer, req.PlotID)
+	if !ok {
+		return
+	}
+
+	conv := &models.Conversation{
+		FarmerID: farmer.ID,
+		Title:    defaultConversationTitle,
+		Topic:    models.TopicGeneral,
+	}
+	if req.Title != "" {
+		title, err := validateConversationTitle(req.Title)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		conv.Title = title
+	}
+	if req.Topic != "" {
+		if !models.IsValidConversationTopic(req.Topic) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "topic must be one of: " + strings.Join(models.ConversationTopics, ", ")})
+			return
+		}
+		conv.Topic = req.Topic
+	}
+	if plot != nil {
+		conv.PlotID = &plot.ID
+	}
+
+	if err := cc.conversationRepo.Create(ctx, conv); err != nil {
+		log.Printf("ERROR: Failed to create conversation for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+		return
+	}
+
+	log.Printf("INFO: Conversation created — farmer=%s conversation=%s", farmer.ID.Hex(), conv.ID.Hex())
+	c.JSON(http.StatusCreated, conv)
+}
+
+// ListConversations handles GET /api/conversations — the acting farmer's threads, most
+// recently active first. Pages are chained with the returned nextCursor.
+func (cc *ConversationController) ListConversations(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmer, ok := resolveFarmer(c, cc.farmerRepo, c.Query("farmerId"))
+	if !ok {
+		return
+	}
+
+	var plotID *primitive.ObjectID
+	if v := c.Query("plotId"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plotId"})
+			return
+		}
+		plotID = &id
+	}
+	after, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := pageParams(c)
+
+	// Fetch one extra to know whether another page follows
+	conversations, err := cc.conversationRepo.ListByFarmer(ctx, farmer.ID, plotID, after, limit+1)
+	if err != nil {
+		log.Printf("ERROR: Failed to list conversations for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+
+	nextCursor := ""
+	if int64(len(conversations)) > limit {
+		conversations = conversations[:limit]
+		last := conversations[len(conversations)-1]
+		nextCursor = utils.EncodeCursor(utils.Cursor{Time: last.LastMessageAt, ID: last.ID})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"farmerId":      farmer.ID.Hex(),
+		"conversations": conversations,
+		"nextCursor":    nextCursor,
+	})
+}
+
+// GetConversation handles GET /api/conversations/:id.
+func (cc *ConversationController) GetConversation(c *gin.Context) {
+	conv, ok := cc.resolveConversation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// ListMessages handles GET /api/conversations/:id/messages — a page of the thread's
+// messages, newest first. Pass nextCursor back as cursor to load older messages.
+func (cc *ConversationController) ListMessages(c *gin.Context) {
+	ctx := c.Request.Context()
+	conv, ok := cc.resolveConversation(c)
+	if !ok {
+		return
+	}
+
+	after, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := pageParams(c)
+
+	messages, err := cc.chatRepo.ListByConversation(ctx, conv.ID, after, limit+1)
+	if err != nil {
+		log.Printf("ERROR: Failed to list messages of conversation %s: %v", conv.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	nextCursor := ""
+	if int64(len(messages)) > limit {
+		messages = messages[:limit]
+		last := messages[len(messages)-1]
+		nextCursor = utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+	}
+	for i := range messages {
+		messages[i].AudioURL = fileURL(ctx, cc.storageService, messages[i].AudioPath)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"conversationId": conv.ID.Hex(),
+		"messages":       messages,
+		"nextCursor":     nextCursor,
+	})
+}
+
+// UpdateConversation handles PATCH /api/conversations/:id — renames a thread or changes its topic.
+func (cc *ConversationController) UpdateConversation(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	conv, ok := cc.resolveConversation(c)
+	if !ok {
+		return
+	}
+
+	set := bson.M{}
+	if req.Title != nil {
+		title, err := validateConversationTitle(*req.Title)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["title"] = title
+	}
+	if req.Topic != nil {
+		if !models.IsValidConversationTopic(*req.Topic) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "topic must be one of: " + strings.Join(models.ConversationTopics, ", ")})
+			return
+		}
+		set["topic"] = *req.Topic
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusOK, conv)
+		return
+	}
+
+	updated, err := cc.conversationRepo.Update(ctx, conv.ID, set)
+	if err != nil {
+		log.Printf("ERROR: Failed to update conversation %s: %v", conv.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteConversation handles DELETE /api/conversations/:id — removes the thread, its
+// messages and any voice reply audio stored for them.
+func (cc *ConversationController) DeleteConversation(c *gin.Context) {
+	ctx := c.Request.Context()
+	conv, ok := cc.resolveConversation(c)
+	if !ok {
+		return
+	}
+
+	audioPaths, err := cc.chatRepo.FindAudioPathsByConversation(ctx, conv.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list audio of conversation %s: %v", conv.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
+		return
+	}
+
+	// Messages go first: stored audio may be shared, so a retry after a failure must not
+	// let go of it a second time
+	deleted, err := cc.chatRepo.DeleteByConversation(ctx, conv.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to delete messages of conversation %s: %v", conv.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
+		return
+	}
+	for _, path := range audioPaths {
+		if err := cc.storageService.Delete(ctx, path); err != nil {
+			log.Printf("WARN: Failed to delete audio %s of conversation %s: %v", path, conv.ID.Hex(), err)
+		}
+	}
+	if err := cc.conversationRepo.Delete(ctx, conv.ID); err != nil {
+		log.Printf("ERROR: Failed to delete conversation %s: %v", conv.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
+		return
+	}
+
+	log.Printf("INFO: Conversation deleted — farmer=%s conversation=%s messages=%d by=%s", conv.FarmerID.Hex(), conv.ID.Hex(), deleted, callerID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted", "messagesDeleted": deleted})
+}
+
+// resolveConversation loads the conversation named in the URL and checks the caller may act
+// on its farmer. Farmers get 404 for threads that are not theirs.
+func (cc *ConversationController) resolveConversation(c *gin.Context) (*models.Conversation, bool) {
+	ctx := c.Request.Context()
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return nil, false
+	}
+
+	conv, err := cc.conversationRepo.FindByID(ctx, id)
+	if err != nil || (!isStaff(c) && conv.FarmerID.Hex() != c.GetString("farmerId")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+
+	if _, ok := resolveFarmer(c, cc.farmerRepo, conv.FarmerID.Hex()); !ok {
+		return nil, false
+	}
+	return conv, true
+}
+
+// farmerConversation loads the conversation a chat request continues. It must belong to the
+// already-resolved farmer. An empty conversationID returns (nil, true).
+func farmerConversation(c *gin.Context, conversationRepo *repositories.ConversationRepository, farmer *models.Farmer, conversationID string) (*models.Conversation, bool) {
+	ctx := c.Request.Context()
+	if conversationID == "" {
+		return nil, true
+	}
+
+	id, err := primitive.ObjectIDFromHex(conversationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversationId"})
+		return nil, false
+	}
+
+	conv, err := conversationRepo.FindByID(ctx, id)
+	if err != nil || conv.FarmerID != farmer.ID {
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("ERROR: Failed to load conversation %s: %v", conversationID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load conversation"})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+	return conv, true
+}
+
+// startConversation creates a thread for a chat that did not name one, titled after its
+// first message.
+func startConversation(ctx context.Context, conversationRepo *repositories.ConversationRepository, farmerID primitive.ObjectID, plot *models.Plot, firstMessage string) (*models.Conversation, error) {
+	conv := &models.Conversation{
+		FarmerID: farmerID,
+		Title:    conversationTitle(firstMessage),
+		Topic:    models.TopicGeneral,
+	}
+	if plot != nil {
+		conv.PlotID = &plot.ID
+	}
+	if err := conversationRepo.Create(ctx, conv); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// saveChatMessage stores a message in its conversation and updates the thread's preview.
+// Failures are logged, not returned: the farmer already has their answer.
+func saveChatMessage(ctx context.Context, chatRepo *repositories.ChatRepository, conversationRepo *repositories.ConversationRepository, msg *models.ChatMessage) {
+	if err := chatRepo.SaveMessage(ctx, msg); err != nil {
+		log.Printf("WARN: Failed to save %s message for farmer %s: %v", msg.Role, msg.FarmerID.Hex(), err)
+		return
+	}
+	if msg.ConversationID == nil {
+		return
+	}
+	if err := conversationRepo.RecordMessage(ctx, *msg.ConversationID, msg); err != nil {
+		log.Printf("WARN: Failed to update conversation %s: %v", msg.ConversationID.Hex(), err)
+	}
+}
+
+// conversationTitle derives a thread title from its first message: the first line,
+// whitespace collapsed, cut at a word boundary.
+func conversationTitle(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	title := strings.Join(strings.Fields(line), " ")
+	if title == "" {
+		return defaultConversationTitle
+	}
+	if utf8.RuneCountInString(title) <= autoTitleLength {
+		return title
+	}
+
+	runes := []rune(title)[:autoTitleLength]
+	for i := len(runes) - 1; i > autoTitleLength/2; i-- {
+		if runes[i] == ' ' {
+			runes = runes[:i]
+			break
+		}
+	}
+	return strings.TrimRight(string(runes), " ,.;:-") + "…"
+}
+
+// validateConversationTitle trims a farmer-entered title and checks its length.
+func validateConversationTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", errors.New("title cannot be empty")
+	}
+	if utf8.RuneCountInString(title) > maxConversationTitleLength {
+		return "", errors.New("title must be at most 100 characters")
+	}
+	return title, nil
+}
@@ -3,39 +3,49 @@
 package controllers
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
 	"github.com/samyaksetu/backend/utils"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // FarmerController handles HTTP requests related to farmers.
 type FarmerController struct {
+	sessionIssuer
 	farmerRepo     *repositories.FarmerRepository
 	otpRepo        *repositories.OTPRepository
-	jwtService     *services.JWTService
+	auditRepo      *repositories.AuditRepository
 	storageService services.StorageService
+	imagePipeline  *services.ImagePipeline
 	prototypeMode  bool
 }
 
 // NewFarmerController creates a new FarmerController instance.
-func NewFarmerController(farmerRepo *repositories.FarmerRepository, otpRepo *repositories.OTPRepository, jwtService *services.JWTService, storageService services.StorageService, prototypeMode bool) *FarmerController {
+func NewFarmerController(farmerRepo *repositories.FarmerRepository, otpRepo *repositories.OTPRepository, sessionRepo *repositories.SessionRepository, auditRepo *repositories.AuditRepository, jwtService *services.JWTService, storageService services.StorageService, imagePipeline *services.ImagePipeline, prototypeMode bool) *FarmerController {
 	return &FarmerController{
+		sessionIssuer: sessionIssuer{
+			sessionRepo: sessionRepo,
+			jwtService:  jwtService,
+		},
 		farmerRepo:     farmerRepo,
 		otpRepo:        otpRepo,
-		jwtService:     jwtService,
+		auditRepo:      auditRepo,
 		storageService: storageService,
+		imagePipeline:  imagePipeline,
 		prototypeMode:  prototypeMode,
 	}
 }
 
-// Signup handles POST /api/signup — registers a new farmer and returns a JWT token.
+// Signup handles POST /api/signup — registers a new farmer and opens a session for the device.
 func (fc *FarmerController) Signup(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req models.SignupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
@@ -54,9 +64,19 @@ func (fc *FarmerController) Signup(c *gin.Context) {
 		return
 	}
 
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	if req.Language != "" && !models.IsSupportedLanguage(req.Language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "preferredLanguage must be one of: " + strings.Join(supportedLanguageCodes(), ", ")})
+		return
+	}
+
 	// Check if phone already registered
-	existing, _ := fc.farmerRepo.FindByPhone(req.Phone)
+	existing, _ := fc.farmerRepo.FindByPhone(ctx, req.Phone)
 	if existing != nil {
+		if existing.IsDeleted() {
+			c.JSON(http.StatusConflict, gin.H{"error": "This phone number belongs to an account scheduled for deletion. Log in to restore it."})
+			return
+		}
 		c.JSON(http.StatusConflict, gin.H{"error": "Phone number already registered"})
 		return
 	}
@@ -66,9 +86,9 @@ func (fc *FarmerController) Signup(c *gin.Context) {
 		log.Printf("INFO: Prototype mode — skipping OTP verification for %s", req.Phone)
 	} else {
 		// Normal OTP verification
-		if err := fc.otpRepo.VerifyOTP(req.Phone, req.OTP); err != nil {
+		if err := fc.otpRepo.VerifyOTP(ctx, req.Phone, req.OTP); err != nil {
 			log.Printf("WARN: OTP verification failed for %s: %v", req.Phone, err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
+			respondOTPError(c, err)
 			return
 		}
 	}
@@ -80,39 +100,49 @@ func (fc *FarmerController) Signup(c *gin.Context) {
 			Latitude:  req.Latitude,
 			Longitude: req.Longitude,
 		},
+		District:          strings.TrimSpace(req.District),
+		PreferredLanguage: req.Language,
 	}
+	prefs := models.DefaultNotificationPreferences()
+	farmer.Notifications = &prefs
 
-	if err := fc.farmerRepo.Create(farmer); err != nil {
+	if err := fc.farmerRepo.Create(ctx, farmer); err != nil {
 		log.Printf("ERROR: Failed to create farmer: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create farmer"})
 		return
 	}
 
-	// Generate JWT token for the newly registered farmer
-	token, err := fc.jwtService.GenerateToken(farmer.ID.Hex(), farmer.Phone, farmer.Name)
+	// Open a session for the newly registered farmer
+	tokens, err := fc.start(c, farmer, req.DeviceName)
 	if err != nil {
-		log.Printf("ERROR: Failed to generate JWT for farmer %s: %v", farmer.ID.Hex(), err)
+		log.Printf("ERROR: Failed to start session for farmer %s: %v", farmer.ID.Hex(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration successful but failed to generate session token"})
 		return
 	}
 
 	log.Printf("INFO: Farmer registered — id=%s name=%s phone=%s", farmer.ID.Hex(), farmer.Name, farmer.Phone)
 	c.JSON(http.StatusCreated, gin.H{
-		"id":         farmer.ID.Hex(),
-		"name":       farmer.Name,
-		"phone":      farmer.Phone,
-		"location":   farmer.Location,
-		"profilePic": farmer.ProfilePic,
-		"createdAt":  farmer.CreatedAt,
-		"token":      token,
+		"id":                farmer.ID.Hex(),
+		"name":              farmer.Name,
+		"phone":             farmer.Phone,
+		"location":          farmer.Location,
+		"district":          farmer.District,
+		"preferredLanguage": farmer.PreferredLanguage,
+		"profilePic":        farmer.ProfilePic,
+		"createdAt":         farmer.CreatedAt,
+		"token":             tokens.AccessToken,
+		"refreshToken":      tokens.RefreshToken,
+		"expiresIn":         tokens.ExpiresIn,
 	})
 }
 
-// Login handles POST /api/login — authenticates an existing farmer and returns a JWT token.
+// Login handles POST /api/login — authenticates an existing farmer and opens a session for the device.
 func (fc *FarmerController) Login(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req struct {
-		Phone string `json:"phone" binding:"required"`
-		OTP   string `json:"otp" binding:"required"`
+		Phone      string `json:"phone" binding:"required"`
+		OTP        string `json:"otp" binding:"required"`
+		DeviceName string `json:"deviceName"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -127,7 +157,7 @@ func (fc *FarmerController) Login(c *gin.Context) {
 	}
 
 	// Find the farmer
-	farmer, err := fc.farmerRepo.FindByPhone(req.Phone)
+	farmer, err := fc.farmerRepo.FindByPhone(ctx, req.Phone)
 	if err != nil || farmer == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No account found with this phone number"})
 		return
@@ -137,68 +167,77 @@ func (fc *FarmerController) Login(c *gin.Context) {
 	if fc.prototypeMode && req.OTP == "000000" {
 		log.Printf("INFO: Prototype mode — skipping OTP verification for login %s", req.Phone)
 	} else {
-		if err := fc.otpRepo.VerifyOTP(req.Phone, req.OTP); err != nil {
+		if err := fc.otpRepo.VerifyOTP(ctx, req.Phone, req.OTP); err != nil {
 			log.Printf("WARN: Login OTP verification failed for %s: %v", req.Phone, err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired OTP"})
+			respondOTPError(c, err)
 			return
 		}
 	}
 
-	// Generate JWT token
-	token, err := fc.jwtService.GenerateToken(farmer.ID.Hex(), farmer.Phone, farmer.Name)
+	// Logging in during the deletion grace period cancels the deletion
+	restored := false
+	if farmer.IsDeleted() {
+		if !farmer.PurgeAfter.After(time.Now()) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No account found with this phone number"})
+			return
+		}
+		if err := fc.farmerRepo.Restore(ctx, farmer.ID); err != nil {
+			log.Printf("ERROR: Failed to restore account for farmer %s: %v", farmer.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+			return
+		}
+		restored = true
+		recordAudit(c, fc.auditRepo, models.AuditAccountRestored, farmer.ID, nil)
+		log.Printf("INFO: Account deletion cancelled by login — farmer=%s", farmer.ID.Hex())
+	}
+
+	// Open a session for this device
+	tokens, err := fc.start(c, farmer, req.DeviceName)
 	if err != nil {
-		log.Printf("ERROR: Failed to generate JWT for farmer %s: %v", farmer.ID.Hex(), err)
+		log.Printf("ERROR: Failed to start session for farmer %s: %v", farmer.ID.Hex(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate session token"})
 		return
 	}
 
 	log.Printf("INFO: Farmer logged in — id=%s name=%s phone=%s", farmer.ID.Hex(), farmer.Name, farmer.Phone)
 	c.JSON(http.StatusOK, gin.H{
-		"id":         farmer.ID.Hex(),
-		"name":       farmer.Name,
-		"phone":      farmer.Phone,
-		"location":   farmer.Location,
-		"profilePic": farmer.ProfilePic,
-		"token":      token,
+		"id":                farmer.ID.Hex(),
+		"name":              farmer.Name,
+		"phone":             farmer.Phone,
+		"location":          farmer.Location,
+		"preferredLanguage": farmer.PreferredLanguage,
+		"profilePic":        farmer.ProfilePic,
+		"profilePicUrl":     fileURL(ctx, fc.storageService, farmer.ProfilePic),
+		"accountRestored":   restored,
+		"token":             tokens.AccessToken,
+		"refreshToken":      tokens.RefreshToken,
+		"expiresIn":         tokens.ExpiresIn,
 	})
 }
 
-// Logout handles POST /api/logout — for prototype, just confirms logout (frontend clears the token).
-func (fc *FarmerController) Logout(c *gin.Context) {
-	farmerName, _ := c.Get("farmerName")
-	log.Printf("INFO: Farmer logged out — name=%v", farmerName)
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
-}
-
 // UpdateLocation handles PUT /api/location — updates a farmer's GPS coordinates.
 func (fc *FarmerController) UpdateLocation(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req models.UpdateLocationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
 
-	// Validate ObjectID
-	farmerID, err := primitive.ObjectIDFromHex(req.FarmerID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
-		return
-	}
-
 	// Validate coordinates
 	if err := utils.ValidateCoordinates(req.Latitude, req.Longitude); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Ensure farmer exists
-	farmer, err := fc.farmerRepo.FindByID(farmerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+	// Resolve the acting farmer from the token (farmerId in the body is optional)
+	farmer, ok := resolveFarmer(c, fc.farmerRepo, req.FarmerID)
+	if !ok {
 		return
 	}
+	farmerID := farmer.ID
 
-	if err := fc.farmerRepo.UpdateLocation(farmerID, req.Latitude, req.Longitude); err != nil {
+	if err := fc.farmerRepo.UpdateLocation(ctx, farmerID, req.Latitude, req.Longitude); err != nil {
 		log.Printf("ERROR: Failed to update location for farmer %s: %v", farmerID.Hex(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
 		return
@@ -218,28 +257,34 @@ func (fc *FarmerController) UpdateLocation(c *gin.Context) {
 // UploadProfilePic handles PUT /api/profile-pic
 // Accepts a file upload and updates the farmer's profile picture.
 func (fc *FarmerController) UploadProfilePic(c *gin.Context) {
-	// Let's get the farmerID from the context since it's a protected route
-	farmerIDVal, exists := c.Get("farmerId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Farmer ID not found in context"})
+	ctx := c.Request.Context()
+	// Resolve the acting farmer from the token
+	farmer, ok := resolveFarmer(c, fc.farmerRepo, "")
+	if !ok {
 		return
 	}
-	farmerIDStr := farmerIDVal.(string)
+	farmerID := farmer.ID
+	farmerIDStr := farmerID.Hex()
 
-	farmerID, err := primitive.ObjectIDFromHex(farmerIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
+	image, ok := readUpload(c, "profilePic", utils.ValidateImage)
+	if !ok {
+		return
+	}
+	if image == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "profilePic is required"})
 		return
 	}
 
-	file, err := c.FormFile("profilePic")
+	// Re-encode the picture so metadata such as the GPS position of the farmer's home is not
+	// served to everyone who sees it
+	picture, err := fc.imagePipeline.Normalize(image.data)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get profile picture from request: " + err.Error()})
+		log.Printf("WARN: Failed to process profile pic of farmer %s: %v", farmerIDStr, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The image could not be read. Upload a JPEG, PNG, WebP or GIF photo."})
 		return
 	}
 
-	// Upload to storage service
-	fileURL, err := fc.storageService.SaveFile(file, "profiles")
+	key, err := fc.storageService.SaveBytes(ctx, picture.Data, picture.MimeType, picture.Ext, "profiles")
 	if err != nil {
 		log.Printf("ERROR: Failed to save profile pic to storage for farmer %s: %v", farmerIDStr, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload profile picture"})
@@ -247,15 +292,24 @@ func (fc *FarmerController) UploadProfilePic(c *gin.Context) {
 	}
 
 	// Update DB
-	if err := fc.farmerRepo.UpdateProfilePic(farmerID, fileURL); err != nil {
+	if err := fc.farmerRepo.UpdateProfilePic(ctx, farmerID, key); err != nil {
 		log.Printf("ERROR: Failed to update profile pic in DB for farmer %s: %v", farmerIDStr, err)
+		if err := fc.storageService.Delete(context.WithoutCancel(ctx), key); err != nil {
+			log.Printf("WARN: Failed to delete unused profile pic %s: %v", key, err)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile picture in database"})
 		return
 	}
+	if farmer.ProfilePic != "" {
+		if err := fc.storageService.Delete(ctx, farmer.ProfilePic); err != nil {
+			log.Printf("WARN: Failed to delete the previous profile pic %s of farmer %s: %v", farmer.ProfilePic, farmerIDStr, err)
+		}
+	}
 
-	log.Printf("INFO: Profile picture updated — farmer=%s url=%s", farmerIDStr, fileURL)
+	log.Printf("INFO: Profile picture updated — farmer=%s key=%s", farmerIDStr, key)
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Profile picture updated successfully",
-		"profilePic": fileURL,
+		"message":       "Profile picture updated successfully",
+		"profilePic":    key,
+		"profilePicUrl": fileURL(ctx, fc.storageService, key),
 	})
 }
@@ -0,0 +1,91 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/services"
+)
+
+// FileController serves locally stored files through signed, expiring links.
+type FileController struct {
+	storageService services.StorageService
+	urlSigner      *services.URLSigner
+}
+
+// NewFileController creates a new FileController instance. urlSigner is nil when files are
+// not stored locally; storage then hands out its own links and the route serves nothing.
+func NewFileController(storageService services.StorageService, urlSigner *services.URLSigner) *FileController {
+	return &FileController{
+		storageService: storageService,
+		urlSigner:      urlSigner,
+	}
+}
+
+// ServeFile handles GET /files/*key — the file, if the link's signature is valid and it has
+// not expired. No API token is needed; the signature is the permission.
+func (fc *FileController) ServeFile(c *gin.Context) {
+	ctx := c.Request.Context()
+	if fc.urlSigner == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expiry, err := fc.urlSigner.Verify(key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This link is invalid or has expired"})
+		return
+	}
+
+	info, err := fc.storageService.Stat(ctx, key)
+	if err != nil {
+		if !errors.Is(err, services.ErrFileNotFound) {
+			log.Printf("ERROR: Failed to stat file %s: %v", key, err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	file, err := fc.storageService.Open(ctx, key)
+	if err != nil {
+		log.Printf("ERROR: Failed to open file %s: %v", key, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	defer file.Close()
+
+	// Cacheable by the device only, and no longer than the link is valid
+	maxAge := max(0, int(time.Until(expiry).Seconds()))
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, file, map[string]string{
+		"Cache-Control":          fmt.Sprintf("private, max-age=%d", maxAge),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// fileURL returns an expiring link to a stored file, or "" when there is no file or no link
+// could be made.
+func fileURL(ctx context.Context, storageService services.StorageService, key string) string {
+	if key == "" {
+		return ""
+	}
+	url, err := storageService.URL(ctx, key, 0)
+	if err != nil {
+		log.Printf("WARN: Failed to make a link to %s: %v", key, err)
+		return ""
+	}
+	return url
+}
+
+// setProfilePicURL fills in the link to the farmer's profile picture.
+func setProfilePicURL(ctx context.Context, storageService services.StorageService, farmer *models.Farmer) {
+	farmer.ProfilePicURL = fileURL(ctx, storageService, farmer.ProfilePic)
+}
@@ -0,0 +1,405 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxReasonLength bounds the free-text fields of phone change requests.
+const maxReasonLength = 500
+
+// PhoneChangeController moves farmer accounts to a new phone number.
+//
+// A farmer who still has the old SIM changes the number directly with OTPs to both numbers.
+// A farmer who lost it verifies only the new number and files a request that an extension
+// officer for their block (or an admin) approves. Either way the farmer record is updated in
+// one atomic write, every session is revoked, and the change is written to the audit log.
+type PhoneChangeController struct {
+	farmerRepo      *repositories.FarmerRepository
+	otpRepo         *repositories.OTPRepository
+	phoneChangeRepo *repositories.PhoneChangeRepository
+	sessionRepo     *repositories.SessionRepository
+	auditRepo       *repositories.AuditRepository
+	prototypeMode   bool
+}
+
+// NewPhoneChangeController creates a new PhoneChangeController instance.
+func NewPhoneChangeController(
+	farmerRepo *repositories.FarmerRepository,
+	otpRepo *repositories.OTPRepository,
+	phoneChangeRepo *repositories.PhoneChangeRepository,
+	sessionRepo *repositories.SessionRepository,
+	auditRepo *repositories.AuditRepository,
+	prototypeMode bool,
+) *PhoneChangeController {
+	return &PhoneChangeController{
+		farmerRepo:      farmerRepo,
+		otpRepo:         otpRepo,
+		phoneChangeRepo: phoneChangeRepo,
+		sessionRepo:     sessionRepo,
+		auditRepo:       auditRepo,
+		prototypeMode:   prototypeMode,
+	}
+}
+
+// ChangePhone handles PUT /api/me/phone — the logged-in farmer moves to a new number,
+// proving they hold both the old and the new SIM.
+func (pc *PhoneChangeController) ChangePhone(c *gin.Context) {
+	if isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff phone numbers are managed by an admin"})
+		return
+	}
+
+	var req models.ChangePhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	farmer, ok := resolveFarmer(c, pc.farmerRepo, "")
+	if !ok {
+		return
+	}
+	if !pc.checkNewPhone(c, farmer.Phone, req.NewPhone) {
+		return
+	}
+
+	// Both codes must be right before either is used up, so a wrong code for one number
+	// doesn't burn the other. The new number is checked first since the farmer just got it.
+	newOTP, ok := pc.checkOTP(c, req.NewPhone, req.NewPhoneOTP)
+	if !ok {
+		return
+	}
+	oldOTP, ok := pc.checkOTP(c, farmer.Phone, req.OldPhoneOTP)
+	if !ok {
+		return
+	}
+	if !pc.consumeOTPs(c, newOTP, oldOTP) {
+		return
+	}
+
+	updated, revoked, ok := pc.migrate(c, farmer, req.NewPhone, map[string]interface{}{"method": "otp_both_numbers"})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Phone number changed. Please log in again with your new number.",
+		"phone":           updated.Phone,
+		"sessionsRevoked": revoked,
+	})
+}
+
+// RequestRecovery handles POST /api/phone-change/recovery — a farmer who lost the old SIM
+// verifies the new number and asks an officer to move the account to it.
+func (pc *PhoneChangeController) RequestRecovery(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.PhoneRecoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := utils.ValidatePhone(req.OldPhone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len([]rune(reason)) > maxReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is too long"})
+		return
+	}
+
+	farmer, err := pc.farmerRepo.FindByPhone(ctx, req.OldPhone)
+	if err != nil || farmer == nil || farmer.IsDeleted() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No account found with this phone number"})
+		return
+	}
+	if !pc.checkNewPhone(c, farmer.Phone, req.NewPhone) {
+		return
+	}
+	if !pc.verifyOTP(c, req.NewPhone, req.NewPhoneOTP) {
+		return
+	}
+
+	request := &models.PhoneChangeRequest{
+		FarmerID:   farmer.ID,
+		FarmerName: farmer.Name,
+		Block:      farmer.Block,
+		OldPhone:   farmer.Phone,
+		NewPhone:   req.NewPhone,
+		Reason:     reason,
+	}
+	if err := pc.phoneChangeRepo.Create(ctx, request); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A phone change request for this account is already waiting for approval"})
+			return
+		}
+		log.Printf("ERROR: Failed to create phone change request for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit request"})
+		return
+	}
+
+	recordAudit(c, pc.auditRepo, models.AuditPhoneChangeRequested, farmer.ID, map[string]interface{}{
+		"requestId": request.ID.Hex(),
+		"oldPhone":  request.OldPhone,
+		"newPhone":  request.NewPhone,
+	})
+
+	log.Printf("INFO: Phone change requested — farmer=%s request=%s block=%s", farmer.ID.Hex(), request.ID.Hex(), farmer.Block)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Request submitted. Your extension officer will verify your identity and approve the change.",
+		"requestId": request.ID.Hex(),
+		"status":    request.Status,
+	})
+}
+
+// ListRequests handles GET /api/staff/phone-changes — the approval queue.
+// Extension officers see their own block; admins may filter with ?block=.
+// ?status= defaults to pending; ?status=all lists every request.
+func (pc *PhoneChangeController) ListRequests(c *gin.Context) {
+	ctx := c.Request.Context()
+	block := c.Query("block")
+	if models.IsBlockScoped(c.GetString("role")) {
+		block = c.GetString("block")
+		if block == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to a block yet"})
+			return
+		}
+	}
+
+	status := c.DefaultQuery("status", models.PhoneChangePending)
+	if status == "all" {
+		status = ""
+	}
+
+	limit, offset := pageParams(c)
+	requests, err := pc.phoneChangeRepo.List(ctx, status, block, limit, offset)
+	if err != nil {
+		log.Printf("ERROR: Failed to list phone change requests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// ApproveRequest handles POST /api/staff/phone-changes/:id/approve — the officer has confirmed
+// the farmer's identity, and the account moves to the new number.
+func (pc *PhoneChangeController) ApproveRequest(c *gin.Context) {
+	ctx := c.Request.Context()
+	request, farmer, note, ok := pc.loadForReview(c)
+	if !ok {
+		return
+	}
+
+	reviewerID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	claimed, err := pc.phoneChangeRepo.Resolve(ctx, request.ID, models.PhoneChangeApproved, reviewerID, note)
+	if err != nil {
+		respondReviewError(c, request.ID, err)
+		return
+	}
+
+	updated, revoked, ok := pc.migrate(c, farmer, claimed.NewPhone, map[string]interface{}{
+		"method":    "officer_approval",
+		"requestId": claimed.ID.Hex(),
+		"note":      note,
+	})
+	if !ok {
+		if err := pc.phoneChangeRepo.Reopen(ctx, claimed.ID); err != nil {
+			log.Printf("ERROR: Failed to reopen phone change request %s: %v", claimed.ID.Hex(), err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Phone number changed",
+		"request":         claimed,
+		"phone":           updated.Phone,
+		"sessionsRevoked": revoked,
+	})
+}
+
+// RejectRequest handles POST /api/staff/phone-changes/:id/reject.
+func (pc *PhoneChangeController) RejectRequest(c *gin.Context) {
+	ctx := c.Request.Context()
+	request, farmer, note, ok := pc.loadForReview(c)
+	if !ok {
+		return
+	}
+
+	reviewerID, _ := primitive.ObjectIDFromHex(c.GetString("userId"))
+	rejected, err := pc.phoneChangeRepo.Resolve(ctx, request.ID, models.PhoneChangeRejected, reviewerID, note)
+	if err != nil {
+		respondReviewError(c, request.ID, err)
+		return
+	}
+
+	recordAudit(c, pc.auditRepo, models.AuditPhoneChangeRejected, farmer.ID, map[string]interface{}{
+		"requestId": rejected.ID.Hex(),
+		"newPhone":  rejected.NewPhone,
+		"note":      note,
+	})
+
+	log.Printf("INFO: Phone change rejected — farmer=%s request=%s by=%s", farmer.ID.Hex(), rejected.ID.Hex(), c.GetString("userId"))
+	c.JSON(http.StatusOK, gin.H{"message": "Request rejected", "request": rejected})
+}
+
+// loadForReview reads the review note and loads a pending request and its farmer,
+// checking the reviewer covers the farmer's block.
+func (pc *PhoneChangeController) loadForReview(c *gin.Context) (*models.PhoneChangeRequest, *models.Farmer, string, bool) {
+	ctx := c.Request.Context()
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID format"})
+		return nil, nil, "", false
+	}
+
+	var req models.ReviewPhoneChangeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return nil, nil, "", false
+		}
+	}
+	note := strings.TrimSpace(req.Note)
+	if len([]rune(note)) > maxReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note is too long"})
+		return nil, nil, "", false
+	}
+
+	request, err := pc.phoneChangeRepo.FindByID(ctx, requestID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+		return nil, nil, "", false
+	}
+	if request.Status != models.PhoneChangePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request was already " + request.Status})
+		return nil, nil, "", false
+	}
+
+	farmer, ok := resolveFarmer(c, pc.farmerRepo, request.FarmerID.Hex())
+	if !ok {
+		return nil, nil, "", false
+	}
+	if farmer.Phone != request.OldPhone {
+		c.JSON(http.StatusConflict, gin.H{"error": "The account's phone number changed after this request was made"})
+		return nil, nil, "", false
+	}
+	return request, farmer, note, true
+}
+
+// migrate moves the farmer to newPhone, revokes every session and records the change.
+// On failure it writes the error response and returns false.
+func (pc *PhoneChangeController) migrate(c *gin.Context, farmer *models.Farmer, newPhone string, details map[string]interface{}) (*models.Farmer, int64, bool) {
+	ctx := c.Request.Context()
+	updated, err := pc.farmerRepo.ChangePhone(ctx, farmer.ID, farmer.Phone, newPhone)
+	if err != nil {
+		switch {
+		case mongo.IsDuplicateKeyError(err):
+			c.JSON(http.StatusConflict, gin.H{"error": "The new phone number is already registered to another account"})
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.JSON(http.StatusConflict, gin.H{"error": "The account's phone number changed in the meantime. Please start again."})
+		default:
+			log.Printf("ERROR: Failed to change phone for farmer %s: %v", farmer.ID.Hex(), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change phone number"})
+		}
+		return nil, 0, false
+	}
+
+	// Tokens carry the old phone, so every device has to log in again
+	revoked, err := pc.sessionRepo.RevokeAllForFarmer(ctx, farmer.ID, "phone_changed")
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions after phone change for farmer %s: %v", farmer.ID.Hex(), err)
+	}
+
+	details["oldPhone"] = farmer.Phone
+	details["newPhone"] = updated.Phone
+	details["sessionsRevoked"] = revoked
+	recordAudit(c, pc.auditRepo, models.AuditPhoneChanged, farmer.ID, details)
+
+	log.Printf("INFO: Phone changed — farmer=%s method=%v sessions=%d by=%s", farmer.ID.Hex(), details["method"], revoked, callerID(c))
+	return updated, revoked, true
+}
+
+// checkNewPhone validates the requested number and makes sure no farmer already uses it.
+func (pc *PhoneChangeController) checkNewPhone(c *gin.Context, oldPhone, newPhone string) bool {
+	ctx := c.Request.Context()
+	if err := utils.ValidatePhone(newPhone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if newPhone == oldPhone {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The new phone number is the same as the current one"})
+		return false
+	}
+	if existing, _ := pc.farmerRepo.FindByPhone(ctx, newPhone); existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The new phone number is already registered to another account"})
+		return false
+	}
+	return true
+}
+
+// verifyOTP checks an OTP for phone and uses it up, honouring the prototype-mode master OTP.
+func (pc *PhoneChangeController) verifyOTP(c *gin.Context, phone, code string) bool {
+	id, ok := pc.checkOTP(c, phone, code)
+	return ok && pc.consumeOTPs(c, id)
+}
+
+// checkOTP checks an OTP for phone without using it up, honouring the prototype-mode master
+// OTP. It returns the ID of the code to pass to consumeOTPs, nil for the master OTP.
+func (pc *PhoneChangeController) checkOTP(c *gin.Context, phone, code string) (primitive.ObjectID, bool) {
+	ctx := c.Request.Context()
+	if pc.prototypeMode && code == "000000" {
+		log.Printf("INFO: Prototype mode — skipping OTP verification for phone change %s", phone)
+		return primitive.NilObjectID, true
+	}
+	id, err := pc.otpRepo.CheckOTP(ctx, phone, code)
+	if err != nil {
+		log.Printf("WARN: Phone change OTP verification failed for %s: %v", phone, err)
+		respondOTPError(c, err)
+		return primitive.NilObjectID, false
+	}
+	return id, true
+}
+
+// consumeOTPs uses up checked OTPs so they can't be replayed.
+func (pc *PhoneChangeController) consumeOTPs(c *gin.Context, ids ...primitive.ObjectID) bool {
+	ctx := c.Request.Context()
+	for _, id := range ids {
+		if id.IsZero() {
+			continue
+		}
+		if err := pc.otpRepo.ConsumeOTP(ctx, id); err != nil {
+			log.Printf("WARN: Phone change OTP %s could not be used up: %v", id.Hex(), err)
+			respondOTPError(c, err)
+			return false
+		}
+	}
+	return true
+}
+
+// respondReviewError maps a failed Resolve to a response.
+func respondReviewError(c *gin.Context, requestID primitive.ObjectID, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Request was already reviewed"})
+		return
+	}
+	log.Printf("ERROR: Failed to review phone change request %s: %v", requestID.Hex(), err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review request"})
+}
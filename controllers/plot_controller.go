@@ -0,0 +1,311 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PlotController handles HTTP requests for a farmer's plots (fields).
+type PlotController struct {
+	farmerRepo *repositories.FarmerRepository
+	plotRepo   *repositories.PlotRepository
+}
+
+// NewPlotController creates a new PlotController instance.
+func NewPlotController(farmerRepo *repositories.FarmerRepository, plotRepo *repositories.PlotRepository) *PlotController {
+	return &PlotController{
+		farmerRepo: farmerRepo,
+		plotRepo:   plotRepo,
+	}
+}
+
+// CreatePlot handles POST /api/plots — adds a plot with a GeoJSON boundary or point.
+func (pc *PlotController) CreatePlot(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.CreatePlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// Resolve the acting farmer from the token (farmerId in the body is optional)
+	farmer, ok := resolveFarmer(c, pc.farmerRepo, req.FarmerID)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if err := utils.ValidateName(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	crops, err := utils.NormalizeCrops(req.Crops)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plot := &models.Plot{
+		FarmerID: farmer.ID,
+		Name:     name,
+		Crops:    crops,
+	}
+	if err := applyPlotGeometry(plot, req.Geometry, req.AreaAcres); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pc.plotRepo.Create(ctx, plot); err != nil {
+		if repositories.IsInvalidGeometryError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geometry: the boundary must not cross itself"})
+			return
+		}
+		log.Printf("ERROR: Failed to create plot for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save plot"})
+		return
+	}
+
+	log.Printf("INFO: Plot created — farmer=%s plot=%s type=%s area=%.2facres", farmer.ID.Hex(), plot.ID.Hex(), plot.Geometry.Type, plot.AreaAcres)
+	c.JSON(http.StatusCreated, plot)
+}
+
+// ListPlots handles GET /api/plots — lists the acting farmer's plots.
+func (pc *PlotController) ListPlots(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmer, ok := resolveFarmer(c, pc.farmerRepo, c.Query("farmerId"))
+	if !ok {
+		return
+	}
+
+	plots, err := pc.plotRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list plots for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plots"})
+		return
+	}
+
+	var totalAcres float64
+	for _, plot := range plots {
+		totalAcres += plot.AreaAcres
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"farmerId":   farmer.ID.Hex(),
+		"plots":      plots,
+		"totalAcres": roundArea(totalAcres),
+	})
+}
+
+// GetPlot handles GET /api/plots/:id.
+func (pc *PlotController) GetPlot(c *gin.Context) {
+	plot, ok := pc.resolvePlot(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, plot)
+}
+
+// UpdatePlot handles PATCH /api/plots/:id — renames a plot, redraws its boundary or changes its crops.
+func (pc *PlotController) UpdatePlot(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.UpdatePlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	plot, ok := pc.resolvePlot(c)
+	if !ok {
+		return
+	}
+
+	set := bson.M{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if err := utils.ValidateName(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["name"] = name
+	}
+	if req.Crops != nil {
+		crops, err := utils.NormalizeCrops(*req.Crops)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["crops"] = crops
+	}
+	if req.Geometry != nil || req.AreaAcres != nil {
+		declared := 0.0
+		if req.AreaAcres != nil {
+			declared = *req.AreaAcres
+		} else if plot.AreaSource == models.PlotAreaDeclared {
+			declared = plot.AreaAcres
+		}
+
+		var err error
+		if req.Geometry != nil {
+			err = applyPlotGeometry(plot, req.Geometry, declared)
+		} else {
+			err = applyDeclaredArea(plot, declared)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["geometry"] = plot.Geometry
+		set["centroid"] = plot.Centroid
+		set["areaAcres"] = plot.AreaAcres
+		set["areaHectares"] = plot.AreaHectares
+		set["areaSource"] = plot.AreaSource
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusOK, plot)
+		return
+	}
+
+	updated, err := pc.plotRepo.Update(ctx, plot.ID, set)
+	if err != nil {
+		if repositories.IsInvalidGeometryError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid geometry: the boundary must not cross itself"})
+			return
+		}
+		log.Printf("ERROR: Failed to update plot %s: %v", plot.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plot"})
+		return
+	}
+
+	log.Printf("INFO: Plot updated — farmer=%s plot=%s", updated.FarmerID.Hex(), updated.ID.Hex())
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeletePlot handles DELETE /api/plots/:id. Soil samples and chats that referred to the
+// plot keep their plotId for history.
+func (pc *PlotController) DeletePlot(c *gin.Context) {
+	ctx := c.Request.Context()
+	plot, ok := pc.resolvePlot(c)
+	if !ok {
+		return
+	}
+
+	if err := pc.plotRepo.Delete(ctx, plot.ID); err != nil {
+		log.Printf("ERROR: Failed to delete plot %s: %v", plot.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete plot"})
+		return
+	}
+
+	log.Printf("INFO: Plot deleted — farmer=%s plot=%s by=%s", plot.FarmerID.Hex(), plot.ID.Hex(), callerID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Plot deleted"})
+}
+
+// resolvePlot loads the plot named in the URL and checks the caller may act on its farmer.
+// Farmers get 404 for plots that are not theirs so plot IDs cannot be probed.
+func (pc *PlotController) resolvePlot(c *gin.Context) (*models.Plot, bool) {
+	ctx := c.Request.Context()
+	plotID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plot ID"})
+		return nil, false
+	}
+
+	plot, err := pc.plotRepo.FindByID(ctx, plotID)
+	if err != nil || (!isStaff(c) && plot.FarmerID.Hex() != c.GetString("farmerId")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plot not found"})
+		return nil, false
+	}
+
+	// Staff go through the usual delegation and block checks for the plot's farmer
+	if _, ok := resolveFarmer(c, pc.farmerRepo, plot.FarmerID.Hex()); !ok {
+		return nil, false
+	}
+	return plot, true
+}
+
+// farmerPlot loads an optional plot referenced by a soil upload, chat or weather request.
+// The plot must belong to the already-resolved farmer. An empty plotID returns (nil, true).
+func farmerPlot(c *gin.Context, plotRepo *repositories.PlotRepository, farmer *models.Farmer, plotID string) (*models.Plot, bool) {
+	ctx := c.Request.Context()
+	if plotID == "" {
+		return nil, true
+	}
+
+	id, err := primitive.ObjectIDFromHex(plotID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plotId"})
+		return nil, false
+	}
+
+	plot, err := plotRepo.FindByID(ctx, id)
+	if err != nil || plot.FarmerID != farmer.ID {
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("ERROR: Failed to load plot %s: %v", plotID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plot"})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plot not found"})
+		return nil, false
+	}
+	return plot, true
+}
+
+// applyPlotGeometry validates a GeoJSON geometry and sets the plot's geometry, centroid and area.
+// Polygon areas are computed; point plots need a declared area in acres.
+func applyPlotGeometry(plot *models.Plot, input *models.GeometryInput, declaredAcres float64) error {
+	geometry, err := utils.ParseGeometry(input.Type, input.Coordinates)
+	if err != nil {
+		return fmt.Errorf("invalid geometry: %w", err)
+	}
+
+	lat, lng := geometry.Centroid()
+	plot.Geometry = models.GeoJSON{Type: geometry.Type, Coordinates: geometry.Coordinates()}
+	plot.Centroid = models.Location{Latitude: lat, Longitude: lng}
+
+	if geometry.Type == "Point" {
+		return applyDeclaredArea(plot, declaredAcres)
+	}
+
+	acres := geometry.AreaSqMeters() / utils.SqMetersPerAcre
+	if err := utils.ValidateLandSize(acres); err != nil {
+		return fmt.Errorf("plot boundary covers %.0f acres, more than the %d acre limit", acres, utils.MaxLandSize)
+	}
+	plot.AreaAcres = roundArea(acres)
+	plot.AreaHectares = roundArea(geometry.AreaSqMeters() / utils.SqMetersPerHectare)
+	plot.AreaSource = models.PlotAreaComputed
+	return nil
+}
+
+// applyDeclaredArea sets a farmer-entered area on a point plot.
+func applyDeclaredArea(plot *models.Plot, acres float64) error {
+	if plot.Geometry.Type != "Point" {
+		return fmt.Errorf("areaAcres is computed from the boundary and cannot be set for polygon plots")
+	}
+	if acres <= 0 {
+		return fmt.Errorf("areaAcres is required for point plots")
+	}
+	if err := utils.ValidateLandSize(acres); err != nil {
+		return err
+	}
+	plot.AreaAcres = roundArea(acres)
+	plot.AreaHectares = roundArea(acres * utils.SqMetersPerAcre / utils.SqMetersPerHectare)
+	plot.AreaSource = models.PlotAreaDeclared
+	return nil
+}
+
+// roundArea rounds an area to two decimals (≈40 m² for acres), plenty for advice.
+func roundArea(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,208 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProfileController handles reading and editing the logged-in caller's own profile.
+type ProfileController struct {
+	farmerRepo     *repositories.FarmerRepository
+	userRepo       *repositories.UserRepository
+	storageService services.StorageService
+}
+
+// NewProfileController creates a new ProfileController instance.
+func NewProfileController(farmerRepo *repositories.FarmerRepository, userRepo *repositories.UserRepository, storageService services.StorageService) *ProfileController {
+	return &ProfileController{
+		farmerRepo:     farmerRepo,
+		userRepo:       userRepo,
+		storageService: storageService,
+	}
+}
+
+// GetMe handles GET /api/me — returns the farmer (or staff user) behind the token.
+func (pc *ProfileController) GetMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	id, err := primitive.ObjectIDFromHex(callerID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	if isStaff(c) {
+		user, err := pc.userRepo.FindByID(ctx, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	farmer, err := pc.farmerRepo.FindByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+		return
+	}
+	setProfilePicURL(ctx, pc.storageService, farmer)
+	c.JSON(http.StatusOK, profileResponse(farmer))
+}
+
+// UpdateMe handles PATCH /api/me — updates the logged-in farmer's profile and preferences.
+// Location and profile picture have their own endpoints; block is assigned by admins.
+func (pc *ProfileController) UpdateMe(c *gin.Context) {
+	ctx := c.Request.Context()
+	if isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff profiles are managed by an admin"})
+		return
+	}
+
+	farmerID, err := primitive.ObjectIDFromHex(c.GetString("farmerId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	farmer, err := pc.farmerRepo.FindByID(ctx, farmerID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+		return
+	}
+
+	set, err := profileChanges(farmer, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(set) == 0 {
+		setProfilePicURL(ctx, pc.storageService, farmer)
+		c.JSON(http.StatusOK, profileResponse(farmer))
+		return
+	}
+
+	updated, err := pc.farmerRepo.UpdateProfile(ctx, farmerID, set)
+	if err != nil {
+		log.Printf("ERROR: Failed to update profile for farmer %s: %v", farmerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	fields := make([]string, 0, len(set))
+	for key := range set {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+	log.Printf("INFO: Profile updated — farmer=%s fields=%v", farmerID.Hex(), fields)
+	setProfilePicURL(ctx, pc.storageService, updated)
+	c.JSON(http.StatusOK, profileResponse(updated))
+}
+
+// profileChanges validates an update request and returns the fields to $set.
+func profileChanges(farmer *models.Farmer, req *models.UpdateProfileRequest) (bson.M, error) {
+	set := bson.M{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if err := utils.ValidateName(name); err != nil {
+			return nil, err
+		}
+		set["name"] = name
+	}
+	if req.PreferredLanguage != nil {
+		lang := strings.ToLower(strings.TrimSpace(*req.PreferredLanguage))
+		if lang != "" && !models.IsSupportedLanguage(lang) {
+			return nil, fmt.Errorf("preferredLanguage must be one of: %s", strings.Join(supportedLanguageCodes(), ", "))
+		}
+		set["preferredLanguage"] = lang
+	}
+	if req.State != nil {
+		state := strings.TrimSpace(*req.State)
+		if err := utils.ValidateRegion("state", state); err != nil {
+			return nil, err
+		}
+		set["state"] = state
+	}
+	if req.District != nil {
+		district := strings.TrimSpace(*req.District)
+		if err := utils.ValidateRegion("district", district); err != nil {
+			return nil, err
+		}
+		set["district"] = district
+	}
+	if req.LandSizeAcres != nil {
+		if err := utils.ValidateLandSize(*req.LandSizeAcres); err != nil {
+			return nil, err
+		}
+		set["landSizeAcres"] = *req.LandSizeAcres
+	}
+	if req.IrrigationSource != nil {
+		source := strings.ToLower(strings.TrimSpace(*req.IrrigationSource))
+		if source != "" && !models.IsValidIrrigationSource(source) {
+			return nil, fmt.Errorf("irrigationSource must be one of: %s", strings.Join(models.IrrigationSources, ", "))
+		}
+		set["irrigationSource"] = source
+	}
+	if req.PrimaryCrops != nil {
+		crops, err := utils.NormalizeCrops(*req.PrimaryCrops)
+		if err != nil {
+			return nil, err
+		}
+		set["primaryCrops"] = crops
+	}
+	if n := req.Notifications; n != nil {
+		prefs := farmer.NotificationSettings()
+		apply := func(dst *bool, src *bool) {
+			if src != nil {
+				*dst = *src
+			}
+		}
+		apply(&prefs.SMS, n.SMS)
+		apply(&prefs.Push, n.Push)
+		apply(&prefs.Voice, n.Voice)
+		apply(&prefs.WeatherAlerts, n.WeatherAlerts)
+		apply(&prefs.MarketPrices, n.MarketPrices)
+		apply(&prefs.AdvisoryTips, n.AdvisoryTips)
+		set["notifications"] = prefs
+	}
+
+	return set, nil
+}
+
+// profileResponse returns the farmer with defaults filled in for fields that predate the profile API.
+func profileResponse(farmer *models.Farmer) *models.Farmer {
+	prefs := farmer.NotificationSettings()
+	farmer.Notifications = &prefs
+	if farmer.PreferredLanguage == "" {
+		farmer.PreferredLanguage = models.DefaultLanguage
+	}
+	return farmer
+}
+
+func supportedLanguageCodes() []string {
+	codes := make([]string, 0, len(models.SupportedLanguages))
+	for code := range models.SupportedLanguages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -32,6 +32,7 @@ type samyakAIRequest struct {
 // It only answers farming, crops, agriculture, soil, weather, irrigation,
 // livestock, farmer mental health, and related topics.
 func (sc *SamyakAIController) Chat(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req samyakAIRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
@@ -45,7 +46,7 @@ func (sc *SamyakAIController) Chat(c *gin.Context) {
 
 	prompt := buildSamyakAIPrompt(req.Message)
 
-	reply, err := sc.aiService.GenerateAdvisory(prompt)
+	reply, err := sc.aiService.GenerateAdvisory(ctx, prompt)
 	if err != nil {
 		log.Printf("ERROR: SamyakAI chat failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI service is temporarily unavailable. Please try again."})
@@ -56,6 +57,40 @@ func (sc *SamyakAIController) Chat(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"reply": reply})
 }
 
+// ChatStream handles POST /api/samyakai/stream — the same chatbot as Chat, with the reply
+// streamed as Server-Sent Events. SamyakAI chats are not stored, so no message ID is sent.
+func (sc *SamyakAIController) ChatStream(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req samyakAIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if len(req.Message) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message cannot be empty"})
+		return
+	}
+
+	startSSE(c)
+	prompt := buildSamyakAIPrompt(req.Message)
+	reply, err := sc.aiService.StreamChat(ctx, "", []services.Message{{Role: services.MessageRoleUser, Text: prompt}}, func(delta string) error {
+		return sendEvent(c, "delta", gin.H{"text": delta})
+	})
+	if err != nil && ctx.Err() != nil {
+		log.Printf("INFO: Client disconnected from the SamyakAI stream after %d bytes", len(reply))
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: SamyakAI stream failed after %d bytes: %v", len(reply), err)
+		sendEvent(c, "error", gin.H{"error": "AI service is temporarily unavailable. Please try again."})
+		return
+	}
+
+	log.Printf("INFO: SamyakAI stream — query_len=%d reply_len=%d", len(req.Message), len(reply))
+	sendEvent(c, "done", gin.H{})
+}
+
 // buildSamyakAIPrompt constructs the system prompt that restricts the AI to farming topics only.
 func buildSamyakAIPrompt(userMessage string) string {
 	return fmt.Sprintf(`You are SamyakAI, a friendly and expert agricultural chatbot built for Indian farmers.
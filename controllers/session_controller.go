@@ -0,0 +1,334 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxDeviceNameLength caps the client-supplied device label stored on a session.
+const maxDeviceNameLength = 100
+
+// tokenPair is the set of credentials returned to the app after login, signup or refresh.
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	SessionID    string
+}
+
+// sessionIssuer creates server-side sessions and the token pairs bound to them.
+type sessionIssuer struct {
+	sessionRepo *repositories.SessionRepository
+	jwtService  *services.JWTService
+}
+
+// start opens a new session for the farmer on the calling device.
+func (si *sessionIssuer) start(c *gin.Context, farmer *models.Farmer, deviceName string) (*tokenPair, error) {
+	session, refreshToken, err := si.open(c, &models.Session{FarmerID: farmer.ID}, deviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := si.jwtService.GenerateToken(farmer.ID.Hex(), farmer.Phone, farmer.Name, session.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	return si.pair(session, accessToken, refreshToken), nil
+}
+
+// startStaff opens a new session for a staff user on the calling device.
+func (si *sessionIssuer) startStaff(c *gin.Context, user *models.User, deviceName string) (*tokenPair, error) {
+	session, refreshToken, err := si.open(c, &models.Session{UserID: user.ID}, deviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := si.jwtService.GenerateStaffToken(user, session.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	return si.pair(session, accessToken, refreshToken), nil
+}
+
+// open stores a new session for the owner set on session and returns its refresh token.
+func (si *sessionIssuer) open(c *gin.Context, session *models.Session, deviceName string) (*models.Session, string, error) {
+	ctx := c.Request.Context()
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = "Unknown device"
+	}
+	if len(deviceName) > maxDeviceNameLength {
+		deviceName = deviceName[:maxDeviceNameLength]
+	}
+
+	session.ID = primitive.NewObjectID()
+	session.DeviceName = deviceName
+	session.IP = c.ClientIP()
+	session.UserAgent = c.Request.UserAgent()
+	session.ExpiresAt = time.Now().Add(si.jwtService.RefreshTTL())
+
+	refreshToken, refreshHash, err := services.GenerateRefreshToken(session.ID.Hex())
+	if err != nil {
+		return nil, "", err
+	}
+	session.RefreshTokenHash = refreshHash
+
+	if err := si.sessionRepo.Create(ctx, session); err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+func (si *sessionIssuer) pair(session *models.Session, accessToken, refreshToken string) *tokenPair {
+	return &tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(si.jwtService.AccessTTL().Seconds()),
+		SessionID:    session.ID.Hex(),
+	}
+}
+
+// SessionController handles token refresh, logout and device session management.
+type SessionController struct {
+	sessionIssuer
+	farmerRepo *repositories.FarmerRepository
+	userRepo   *repositories.UserRepository
+}
+
+// NewSessionController creates a new SessionController instance.
+func NewSessionController(sessionRepo *repositories.SessionRepository, farmerRepo *repositories.FarmerRepository, userRepo *repositories.UserRepository, jwtService *services.JWTService) *SessionController {
+	return &SessionController{
+		sessionIssuer: sessionIssuer{
+			sessionRepo: sessionRepo,
+			jwtService:  jwtService,
+		},
+		farmerRepo: farmerRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// Refresh handles POST /api/auth/refresh — exchanges a refresh token for a new token pair.
+// Refresh tokens are single-use: presenting an already-rotated token revokes the whole
+// session, because it means the token was copied.
+func (sc *SessionController) Refresh(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	sessionIDStr, err := services.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(sessionIDStr)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	session, err := sc.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil || !session.IsActive() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or was logged out. Please log in again."})
+		return
+	}
+
+	presentedHash := services.HashRefreshToken(req.RefreshToken)
+	if presentedHash != session.RefreshTokenHash {
+		if presentedHash == session.PreviousRefreshTokenHash {
+			log.Printf("WARN: Refresh token reuse detected — session=%s farmer=%s user=%s; revoking session", sessionIDStr, session.FarmerID.Hex(), session.UserID.Hex())
+			if err := sc.sessionRepo.Revoke(ctx, sessionID, "refresh_token_reuse"); err != nil {
+				log.Printf("ERROR: Failed to revoke session %s: %v", sessionIDStr, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Staff sessions re-read the user so role, block and deactivation take effect on refresh
+	var generateToken func() (string, error)
+	ownerID := session.FarmerID.Hex()
+	if !session.UserID.IsZero() {
+		ownerID = session.UserID.Hex()
+		user, err := sc.userRepo.FindByID(ctx, session.UserID)
+		if err != nil || !user.Active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account not found"})
+			return
+		}
+		generateToken = func() (string, error) { return sc.jwtService.GenerateStaffToken(user, sessionIDStr) }
+	} else {
+		farmer, err := sc.farmerRepo.FindByID(ctx, session.FarmerID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account not found"})
+			return
+		}
+		generateToken = func() (string, error) {
+			return sc.jwtService.GenerateToken(farmer.ID.Hex(), farmer.Phone, farmer.Name, sessionIDStr)
+		}
+	}
+
+	newRefreshToken, newHash, err := services.GenerateRefreshToken(sessionIDStr)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	rotated, err := sc.sessionRepo.RotateRefreshToken(ctx, sessionID, presentedHash, newHash, c.ClientIP(), time.Now().Add(sc.jwtService.RefreshTTL()))
+	if err != nil {
+		log.Printf("ERROR: Failed to rotate refresh token for session %s: %v", sessionIDStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	if !rotated {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	accessToken, err := generateToken()
+	if err != nil {
+		log.Printf("ERROR: Failed to generate JWT for %s: %v", ownerID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate session token"})
+		return
+	}
+
+	log.Printf("INFO: Session refreshed — owner=%s session=%s", ownerID, sessionIDStr)
+	c.JSON(http.StatusOK, gin.H{
+		"token":        accessToken,
+		"refreshToken": newRefreshToken,
+		"expiresIn":    int64(sc.jwtService.AccessTTL().Seconds()),
+	})
+}
+
+// Logout handles POST /api/logout — revokes the session behind the current token.
+func (sc *SessionController) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+	sessionID, err := primitive.ObjectIDFromHex(c.GetString("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	if err := sc.sessionRepo.Revoke(ctx, sessionID, "logout"); err != nil {
+		log.Printf("ERROR: Failed to revoke session %s: %v", sessionID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	log.Printf("INFO: Farmer logged out — name=%s session=%s", c.GetString("farmerName"), sessionID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll handles POST /api/logout-all — revokes every session of the logged-in farmer or staff user.
+func (sc *SessionController) LogoutAll(c *gin.Context) {
+	ctx := c.Request.Context()
+	ownerID, err := primitive.ObjectIDFromHex(callerID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	var revoked int64
+	if isStaff(c) {
+		revoked, err = sc.sessionRepo.RevokeAllForUser(ctx, ownerID, "logout_all")
+	} else {
+		revoked, err = sc.sessionRepo.RevokeAllForFarmer(ctx, ownerID, "logout_all")
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for %s: %v", ownerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out from all devices"})
+		return
+	}
+
+	log.Printf("INFO: Logged out of all devices — owner=%s role=%s sessions=%d", ownerID.Hex(), c.GetString("role"), revoked)
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Logged out from all devices",
+		"sessionsRevoked": revoked,
+	})
+}
+
+// ListSessions handles GET /api/sessions — lists the logged-in farmer's or staff user's active devices.
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	ownerID, err := primitive.ObjectIDFromHex(callerID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	var sessions []models.Session
+	if isStaff(c) {
+		sessions, err = sc.sessionRepo.FindActiveByUserID(ctx, ownerID)
+	} else {
+		sessions, err = sc.sessionRepo.FindActiveByFarmerID(ctx, ownerID)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to list sessions for %s: %v", ownerID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	currentID := c.GetString("sessionId")
+	items := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, gin.H{
+			"id":         s.ID.Hex(),
+			"deviceName": s.DeviceName,
+			"ip":         s.IP,
+			"userAgent":  s.UserAgent,
+			"createdAt":  s.CreatedAt,
+			"lastSeenAt": s.LastSeenAt,
+			"current":    s.ID.Hex() == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": items})
+}
+
+// RevokeSession handles DELETE /api/sessions/:id — logs out one of the caller's other devices.
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format"})
+		return
+	}
+
+	session, err := sc.sessionRepo.FindByID(ctx, sessionID)
+	if err != nil || !ownsSession(c, session) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := sc.sessionRepo.Revoke(ctx, sessionID, "revoked_by_user"); err != nil {
+		log.Printf("ERROR: Failed to revoke session %s: %v", sessionID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	log.Printf("INFO: Session revoked — owner=%s session=%s", callerID(c), sessionID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// ownsSession reports whether the session belongs to the farmer or staff user behind the request.
+func ownsSession(c *gin.Context, session *models.Session) bool {
+	if isStaff(c) {
+		return !session.UserID.IsZero() && session.UserID.Hex() == c.GetString("userId")
+	}
+	return !session.FarmerID.IsZero() && session.FarmerID.Hex() == c.GetString("farmerId")
+}
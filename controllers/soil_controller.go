@@ -3,123 +3,378 @@
 package controllers
 
 import (
-	"io"
+	"context"
+	"errors"
 	"log"
+	"mime"
 	"net/http"
+	"path"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/jobs"
 	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
 	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // SoilController handles HTTP requests related to soil analysis.
 type SoilController struct {
 	farmerRepo     *repositories.FarmerRepository
 	soilRepo       *repositories.SoilRepository
+	plotRepo       *repositories.PlotRepository
 	aiService      services.AIService
 	storageService services.StorageService
+	imagePipeline  *services.ImagePipeline
+	jobQueue       *jobs.Queue
 }
 
 // NewSoilController creates a new SoilController instance.
 func NewSoilController(
 	farmerRepo *repositories.FarmerRepository,
 	soilRepo *repositories.SoilRepository,
+	plotRepo *repositories.PlotRepository,
 	aiService services.AIService,
 	storageService services.StorageService,
+	imagePipeline *services.ImagePipeline,
+	jobQueue *jobs.Queue,
 ) *SoilController {
 	return &SoilController{
 		farmerRepo:     farmerRepo,
 		soilRepo:       soilRepo,
+		plotRepo:       plotRepo,
 		aiService:      aiService,
 		storageService: storageService,
+		imagePipeline:  imagePipeline,
+		jobQueue:       jobQueue,
 	}
 }
 
 // UploadSoil handles POST /api/soil/upload — uploads a soil image and analyzes it.
 func (sc *SoilController) UploadSoil(c *gin.Context) {
-	// Get farmer ID from form
-	farmerIDStr := c.PostForm("farmerId")
-	if farmerIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "farmerId is required"})
+	ctx := c.Request.Context()
+	// Resolve the acting farmer from the token (farmerId in the form is optional)
+	farmer, ok := resolveFarmer(c, sc.farmerRepo, c.PostForm("farmerId"))
+	if !ok {
 		return
 	}
+	farmerID := farmer.ID
 
-	farmerID, err := primitive.ObjectIDFromHex(farmerIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
+	// Optional plot the sample was taken from
+	plot, ok := farmerPlot(c, sc.plotRepo, farmer, c.PostForm("plotId"))
+	if !ok {
 		return
 	}
 
-	// Ensure farmer exists
-	_, err = sc.farmerRepo.FindByID(farmerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+	// Get the uploaded image, checked by its content
+	image, ok := readUpload(c, "soilImage", utils.ValidateImage)
+	if !ok {
 		return
 	}
-
-	// Get uploaded file
-	file, err := c.FormFile("soilImage")
-	if err != nil {
+	if image == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "soilImage is required"})
 		return
 	}
 
-	// Validate image file
-	if err := utils.ValidateImageFile(file); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Prepare the image for storage and AI analysis
+	photo, ok := processPhoto(c, sc.imagePipeline, image.data)
+	if !ok {
 		return
 	}
 
-	// Read image bytes for AI analysis
-	src, err := file.Open()
+	// Save the photo and its thumbnail to storage
+	storedPath, err := sc.storageService.SaveBytes(ctx, photo.Data, photo.MimeType, photo.Ext, "soil")
 	if err != nil {
-		log.Printf("ERROR: Failed to open uploaded file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+		log.Printf("ERROR: Failed to save soil image: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
 		return
 	}
-	imageData, err := io.ReadAll(src)
-	src.Close()
+	thumbnailPath, err := sc.storageService.SaveBytes(ctx, photo.Thumbnail, photo.MimeType, photo.Ext, "soil/thumbnails")
 	if err != nil {
-		log.Printf("ERROR: Failed to read uploaded file: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read image"})
+		log.Printf("ERROR: Failed to save soil thumbnail: %v", err)
+		sc.discardImages(ctx, storedPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
 		return
 	}
 
-	// Save file to storage
-	storedPath, err := sc.storageService.SaveFile(file, "soil")
-	if err != nil {
-		log.Printf("ERROR: Failed to save soil image: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
-		return
+	soilData := &models.SoilData{
+		FarmerID:       farmerID,
+		ImagePath:      storedPath,
+		ThumbnailPath:  thumbnailPath,
+		Photo:          &photo.Metadata,
+		AnalysisStatus: models.SoilAnalysisDone,
 	}
 
-	// Analyze soil with AI
-	mimeType := utils.GetMimeType(file)
-	soilType, err := sc.aiService.AnalyzeSoilImage(imageData, mimeType)
-	if err != nil {
-		log.Printf("WARN: AI soil analysis failed: %v", err)
-		soilType = "Unknown (Pending AI Analysis)"
+	// Images are stored under their content hash, so the same photo uploaded again — usually
+	// a retry on a flaky network — has the same path and keeps its earlier analysis
+	previous, err := sc.soilRepo.FindAnalyzedByImagePath(ctx, storedPath)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("WARN: Failed to look up earlier analyses of %s: %v", storedPath, err)
+	}
+	if previous != nil {
+		log.Printf("INFO: Reusing the analysis of soil sample %s for an identical photo", previous.ID.Hex())
+		soilData.Analysis = previous.Analysis
+		soilData.SoilType = previous.Analysis.Label()
+		soilData.AIProvider = previous.AIProvider
+		// A manual correction of the earlier sample applies to the same photo too
+		if previous.ManualSoilClass != "" {
+			soilData.ManualSoilClass = previous.ManualSoilClass
+			soilData.SoilType = models.SoilClassLabels[previous.ManualSoilClass]
+			soilData.RelabeledBy = previous.RelabeledBy
+			soilData.RelabeledAt = previous.RelabeledAt
+		}
+	} else {
+		// Analyze soil with AI
+		analysis, err := sc.aiService.AnalyzeSoilImage(ctx, photo.Data, photo.MimeType)
+		if err != nil {
+			log.Printf("WARN: AI soil analysis failed, queueing a retry: %v", err)
+			soilData.AnalysisStatus = models.SoilAnalysisPending
+		} else {
+			soilData.Analysis = analysis
+			soilData.SoilType = analysis.Label()
+			soilData.AIProvider = services.AIProviderUsed(ctx)
+		}
 	}
 
 	// Save soil data to database
-	soilData := &models.SoilData{
-		FarmerID:  farmerID,
-		ImagePath: storedPath,
-		SoilType:  soilType,
+	if plot != nil {
+		soilData.PlotID = &plot.ID
 	}
 
-	if err := sc.soilRepo.Create(soilData); err != nil {
+	if err := sc.soilRepo.Create(ctx, soilData); err != nil {
 		log.Printf("ERROR: Failed to save soil data: %v", err)
+		sc.discardImages(ctx, storedPath, thumbnailPath)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save soil data"})
 		return
 	}
+	if soilData.AnalysisStatus == models.SoilAnalysisPending {
+		sc.queueAnalysis(ctx, soilData)
+	}
+
+	response := models.SoilUploadResponse{
+		ID:              soilData.ID.Hex(),
+		SoilType:        soilData.SoilType,
+		AnalysisStatus:  soilData.AnalysisStatus,
+		Analysis:        soilData.Analysis,
+		AnalysisReused:  previous != nil,
+		ManualSoilClass: soilData.ManualSoilClass,
+		ImagePath:       storedPath,
+		ImageURL:        fileURL(ctx, sc.storageService, storedPath),
+		ThumbnailPath:   thumbnailPath,
+		ThumbnailURL:    fileURL(ctx, sc.storageService, thumbnailPath),
+		Photo:           photo.Metadata,
+	}
+	if plot != nil {
+		response.PlotID = plot.ID.Hex()
+	}
+
+	log.Printf("INFO: Soil analyzed — farmer=%s plot=%s status=%s soilType=%s path=%s", farmerID.Hex(), response.PlotID, soilData.AnalysisStatus, soilData.SoilType, storedPath)
+	c.JSON(http.StatusOK, response)
+}
+
+// discardImages deletes images saved for an upload that could not be completed.
+func (sc *SoilController) discardImages(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := sc.storageService.Delete(context.WithoutCancel(ctx), key); err != nil {
+			log.Printf("WARN: Failed to delete image %s of a failed upload: %v", key, err)
+		}
+	}
+}
+
+// queueAnalysis schedules a background retry of a sample's failed analysis. If the job
+// cannot be queued the sample is marked failed rather than left pending forever.
+func (sc *SoilController) queueAnalysis(ctx context.Context, soil *models.SoilData) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := sc.jobQueue.Enqueue(ctx, models.JobTypeSoilAnalysis, soil.ID, sc.jobQueue.Backoff(1))
+	if err == nil {
+		return
+	}
+	log.Printf("ERROR: Failed to queue soil analysis for %s: %v", soil.ID.Hex(), err)
+
+	soil.AnalysisStatus = models.SoilAnalysisFailed
+	if err := sc.soilRepo.Update(ctx, soil.ID, bson.M{"analysisStatus": soil.AnalysisStatus}); err != nil {
+		log.Printf("ERROR: Failed to mark soil analysis %s failed: %v", soil.ID.Hex(), err)
+	}
+}
+
+// ListSoil handles GET /api/soil — the acting farmer's soil samples, newest first, optionally
+// only those of one plot. Pages are chained with the returned nextCursor.
+func (sc *SoilController) ListSoil(c *gin.Context) {
+	ctx := c.Request.Context()
+	farmer, ok := resolveFarmer(c, sc.farmerRepo, c.Query("farmerId"))
+	if !ok {
+		return
+	}
+
+	var plotID *primitive.ObjectID
+	if v := c.Query("plotId"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid plotId"})
+			return
+		}
+		plotID = &id
+	}
+	after, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := pageParams(c)
+
+	// Fetch one extra to know whether another page follows
+	soils, err := sc.soilRepo.ListByFarmer(ctx, farmer.ID, plotID, after, limit+1)
+	if err != nil {
+		log.Printf("ERROR: Failed to list soil samples for farmer %s: %v", farmer.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch soil analyses"})
+		return
+	}
 
-	log.Printf("INFO: Soil analyzed — farmer=%s soilType=%s path=%s", farmerID.Hex(), soilType, storedPath)
-	c.JSON(http.StatusOK, models.SoilUploadResponse{
-		SoilType:  soilType,
-		ImagePath: storedPath,
+	nextCursor := ""
+	if int64(len(soils)) > limit {
+		soils = soils[:limit]
+		last := soils[len(soils)-1]
+		nextCursor = utils.EncodeCursor(utils.Cursor{Time: last.CreatedAt, ID: last.ID})
+	}
+	for i := range soils {
+		sc.setImageURLs(ctx, &soils[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"farmerId":   farmer.ID.Hex(),
+		"soil":       soils,
+		"nextCursor": nextCursor,
 	})
 }
+
+// GetSoil handles GET /api/soil/:id.
+func (sc *SoilController) GetSoil(c *gin.Context) {
+	soil, ok := sc.resolveSoil(c)
+	if !ok {
+		return
+	}
+	sc.setImageURLs(c.Request.Context(), soil)
+	c.JSON(http.StatusOK, soil)
+}
+
+// GetSoilImage handles GET /api/soil/:id/image — the sample's photo, fetched with the API
+// token rather than through its expiring link. ?size=thumbnail returns the thumbnail, or the
+// photo for samples uploaded before thumbnails were made.
+func (sc *SoilController) GetSoilImage(c *gin.Context) {
+	ctx := c.Request.Context()
+	soil, ok := sc.resolveSoil(c)
+	if !ok {
+		return
+	}
+
+	imagePath := soil.ImagePath
+	if c.Query("size") == "thumbnail" && soil.ThumbnailPath != "" {
+		imagePath = soil.ThumbnailPath
+	}
+	data, err := sc.storageService.ReadFile(ctx, imagePath)
+	if err != nil {
+		log.Printf("ERROR: Failed to read soil image %s: %v", imagePath, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Soil image not found"})
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(imagePath))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// RelabelSoil handles PATCH /api/soil/:id — corrects a sample's soil class by hand. The AI's
+// analysis is kept; chat uses the manual class from then on.
+func (sc *SoilController) RelabelSoil(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.RelabelSoilRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	soilClass := strings.ToLower(strings.TrimSpace(req.SoilClass))
+	if !models.IsValidSoilClass(soilClass) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "soilClass must be one of: " + strings.Join(models.SoilClasses, ", ")})
+		return
+	}
+
+	soil, ok := sc.resolveSoil(c)
+	if !ok {
+		return
+	}
+
+	updated, err := sc.soilRepo.Relabel(ctx, soil.ID, soilClass, callerID(c))
+	if err != nil {
+		log.Printf("ERROR: Failed to relabel soil sample %s: %v", soil.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update soil analysis"})
+		return
+	}
+
+	log.Printf("INFO: Soil relabeled — farmer=%s soil=%s class=%s by=%s", soil.FarmerID.Hex(), soil.ID.Hex(), soilClass, callerID(c))
+	sc.setImageURLs(ctx, updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteSoil handles DELETE /api/soil/:id — removes the sample and its image. Chat then
+// uses the next-latest sample.
+func (sc *SoilController) DeleteSoil(c *gin.Context) {
+	ctx := c.Request.Context()
+	soil, ok := sc.resolveSoil(c)
+	if !ok {
+		return
+	}
+
+	if err := sc.soilRepo.Delete(ctx, soil.ID); err != nil {
+		log.Printf("ERROR: Failed to delete soil sample %s: %v", soil.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete soil analysis"})
+		return
+	}
+	for _, imagePath := range []string{soil.ImagePath, soil.ThumbnailPath} {
+		if imagePath == "" {
+			continue
+		}
+		if err := sc.storageService.Delete(ctx, imagePath); err != nil {
+			log.Printf("WARN: Failed to delete image %s of soil sample %s: %v", imagePath, soil.ID.Hex(), err)
+		}
+	}
+
+	log.Printf("INFO: Soil deleted — farmer=%s soil=%s by=%s", soil.FarmerID.Hex(), soil.ID.Hex(), callerID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Soil analysis deleted"})
+}
+
+// resolveSoil loads the soil sample named in the URL and checks the caller may act on its
+// farmer. Farmers get 404 for samples that are not theirs.
+func (sc *SoilController) resolveSoil(c *gin.Context) (*models.SoilData, bool) {
+	ctx := c.Request.Context()
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid soil ID"})
+		return nil, false
+	}
+
+	soil, err := sc.soilRepo.FindByID(ctx, id)
+	if err != nil || (!isStaff(c) && soil.FarmerID.Hex() != c.GetString("farmerId")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Soil analysis not found"})
+		return nil, false
+	}
+
+	if _, ok := resolveFarmer(c, sc.farmerRepo, soil.FarmerID.Hex()); !ok {
+		return nil, false
+	}
+	return soil, true
+}
+
+// setImageURLs fills in expiring links to a sample's photo and thumbnail. Samples uploaded
+// before thumbnails were made use the photo for both.
+func (sc *SoilController) setImageURLs(ctx context.Context, soil *models.SoilData) {
+	soil.ImageURL = fileURL(ctx, sc.storageService, soil.ImagePath)
+	soil.ThumbnailURL = soil.ImageURL
+	if soil.ThumbnailPath != "" {
+		soil.ThumbnailURL = fileURL(ctx, sc.storageService, soil.ThumbnailPath)
+	}
+}
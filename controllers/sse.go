@@ -0,0 +1,31 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startSSE turns the response into a Server-Sent Events stream. The stream stays open until
+// the reply is complete or the route's request budget runs out.
+func startSSE(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+}
+
+// sendEvent writes one event and flushes it to the client. It returns the request's context
+// error once the client has gone away, so producers know to stop.
+func sendEvent(c *gin.Context, event string, data interface{}) error {
+	if err := c.Request.Context().Err(); err != nil {
+		return err
+	}
+	c.SSEvent(event, data)
+	c.Writer.Flush()
+	return nil
+}
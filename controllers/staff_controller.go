@@ -0,0 +1,153 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// StaffController handles login and farmer lookups for extension officers, agronomists and admins.
+type StaffController struct {
+	sessionIssuer
+	userRepo       *repositories.UserRepository
+	farmerRepo     *repositories.FarmerRepository
+	otpRepo        *repositories.OTPRepository
+	storageService services.StorageService
+}
+
+// NewStaffController creates a new StaffController instance.
+func NewStaffController(userRepo *repositories.UserRepository, farmerRepo *repositories.FarmerRepository, otpRepo *repositories.OTPRepository, sessionRepo *repositories.SessionRepository, jwtService *services.JWTService, storageService services.StorageService) *StaffController {
+	return &StaffController{
+		sessionIssuer: sessionIssuer{
+			sessionRepo: sessionRepo,
+			jwtService:  jwtService,
+		},
+		userRepo:       userRepo,
+		farmerRepo:     farmerRepo,
+		otpRepo:        otpRepo,
+		storageService: storageService,
+	}
+}
+
+// Login handles POST /api/staff/login — authenticates a staff user with phone + OTP.
+// The OTP is requested through the same /api/auth/send-otp endpoint farmers use.
+func (sc *StaffController) Login(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req models.StaffLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := utils.ValidatePhone(req.Phone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := sc.userRepo.FindByPhone(ctx, req.Phone)
+	if err != nil || !user.Active {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active staff account found with this phone number"})
+		return
+	}
+
+	// Staff accounts can manage other users and whole blocks, so the prototype master OTP
+	// never applies to them
+	if err := sc.otpRepo.VerifyOTP(ctx, req.Phone, req.OTP); err != nil {
+		log.Printf("WARN: Staff login OTP verification failed for %s: %v", req.Phone, err)
+		respondOTPError(c, err)
+		return
+	}
+
+	tokens, err := sc.startStaff(c, user, req.DeviceName)
+	if err != nil {
+		log.Printf("ERROR: Failed to start session for user %s: %v", user.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate session token"})
+		return
+	}
+
+	log.Printf("INFO: Staff logged in — id=%s name=%s role=%s block=%s", user.ID.Hex(), user.Name, user.Role, user.Block)
+	c.JSON(http.StatusOK, gin.H{
+		"id":           user.ID.Hex(),
+		"name":         user.Name,
+		"phone":        user.Phone,
+		"role":         user.Role,
+		"block":        user.Block,
+		"district":     user.District,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+	})
+}
+
+// ListFarmers handles GET /api/staff/farmers — lists farmers the caller looks after.
+// Extension officers always see their own block; agronomists and admins may filter with ?block=.
+// Supports ?limit= (default 50, max 200) and ?offset=.
+func (sc *StaffController) ListFarmers(c *gin.Context) {
+	ctx := c.Request.Context()
+	block := c.Query("block")
+	if models.IsBlockScoped(c.GetString("role")) {
+		block = c.GetString("block")
+		if block == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not assigned to a block yet"})
+			return
+		}
+	}
+
+	limit, offset := pageParams(c)
+	farmers, total, err := sc.farmerRepo.List(ctx, block, limit, offset)
+	if err != nil {
+		log.Printf("ERROR: Failed to list farmers for block %q: %v", block, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list farmers"})
+		return
+	}
+
+	for i := range farmers {
+		setProfilePicURL(ctx, sc.storageService, &farmers[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"farmers": farmers,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"block":   block,
+	})
+}
+
+// GetFarmer handles GET /api/staff/farmers/:id — shows one farmer, subject to block scoping.
+func (sc *StaffController) GetFarmer(c *gin.Context) {
+	farmer, ok := resolveFarmer(c, sc.farmerRepo, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	setProfilePicURL(c.Request.Context(), sc.storageService, farmer)
+	c.JSON(http.StatusOK, farmer)
+}
+
+// pageParams reads ?limit= and ?offset= with sane defaults and bounds.
+func pageParams(c *gin.Context) (limit, offset int64) {
+	limit = defaultPageSize
+	if v, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if v, err := strconv.ParseInt(c.Query("offset"), 10, 64); err == nil && v > 0 {
+		offset = v
+	}
+	return limit, offset
+}
@@ -0,0 +1,72 @@
+// All rights reserved Samyak-Setu
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+)
+
+// upload is a file sent in a multipart form, read into memory and checked by its content.
+type upload struct {
+	file     *multipart.FileHeader
+	data     []byte
+	fileType utils.FileType
+}
+
+// readUpload reads the file in a multipart form field and checks it with validate. A missing
+// field returns (nil, true), leaving it to the caller whether the file is required. On
+// failure it writes the error response and returns false.
+func readUpload(c *gin.Context, field string, validate func(*multipart.FileHeader, []byte) (utils.FileType, error)) (*upload, bool) {
+	file, err := c.FormFile(field)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload too large (limit %d MB)", tooLarge.Limit>>20)})
+		return nil, false
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		return nil, true
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form: " + err.Error()})
+		return nil, false
+	}
+
+	data, err := utils.ReadFileBytes(file)
+	if err != nil {
+		log.Printf("ERROR: Failed to read uploaded %s: %v", field, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read uploaded file"})
+		return nil, false
+	}
+
+	fileType, err := validate(file, data)
+	if err != nil {
+		log.Printf("WARN: Rejected %s upload — filename=%q declared=%q size=%d: %v", field, file.Filename, file.Header.Get("Content-Type"), len(data), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &upload{file: file, data: data, fileType: fileType}, true
+}
+
+// processPhoto runs an uploaded photo through the image pipeline. Photos the pipeline
+// rejects get 422 with the reason and a hint for a better photo.
+func processPhoto(c *gin.Context, pipeline *services.ImagePipeline, data []byte) (*services.ProcessedImage, bool) {
+	photo, err := pipeline.Process(data)
+	var rejected *services.ImageRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": rejected.Message, "reason": rejected.Reason})
+		return nil, false
+	case err != nil:
+		log.Printf("WARN: Failed to process uploaded image: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The image could not be read. Upload a JPEG, PNG, WebP or GIF photo."})
+		return nil, false
+	}
+	return photo, true
+}
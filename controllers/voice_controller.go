@@ -3,38 +3,57 @@
 package controllers
 
 import (
-	"io"
+	"context"
+	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // VoiceController handles the Voice endpoints for TTS (Polly) and STT (Transcribe).
 type VoiceController struct {
-	voiceService services.VoiceService
-	aiService    services.AIService
+	voiceService     services.VoiceService
+	aiService        services.AIService
+	farmerRepo       *repositories.FarmerRepository
+	chatRepo         *repositories.ChatRepository
+	conversationRepo *repositories.ConversationRepository
+	storageService   services.StorageService
+	textAudio        bool // accept plain text as audio, for the fake voice service
 }
 
-// NewVoiceController creates a new VoiceController instance.
-func NewVoiceController(voiceService services.VoiceService, aiService services.AIService) *VoiceController {
+// NewVoiceController creates a new VoiceController instance. With textAudio set, plain text
+// is accepted in place of a recording, which the fake voice service reads back as speech.
+func NewVoiceController(voiceService services.VoiceService, aiService services.AIService, farmerRepo *repositories.FarmerRepository, chatRepo *repositories.ChatRepository, conversationRepo *repositories.ConversationRepository, storageService services.StorageService, textAudio bool) *VoiceController {
 	return &VoiceController{
-		voiceService: voiceService,
-		aiService:    aiService,
+		voiceService:     voiceService,
+		aiService:        aiService,
+		farmerRepo:       farmerRepo,
+		chatRepo:         chatRepo,
+		conversationRepo: conversationRepo,
+		storageService:   storageService,
+		textAudio:        textAudio,
 	}
 }
 
 // ttsRequest is the expected JSON body for the TTS endpoint.
 type ttsRequest struct {
-	Text string `json:"text" binding:"required"`
+	Text     string `json:"text" binding:"required"`
+	Language string `json:"language"`
 }
 
 // TextToSpeech handles POST /api/voice/tts
 // Converts text into a natural-sounding MP3 using Amazon Polly (Kajal Neural voice).
 func (vc *VoiceController) TextToSpeech(c *gin.Context) {
+	ctx := c.Request.Context()
 	var req ttsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
@@ -46,41 +65,39 @@ func (vc *VoiceController) TextToSpeech(c *gin.Context) {
 		return
 	}
 
-	audioURL, err := vc.voiceService.TextToSpeech(req.Text)
+	_, language, ok := vc.voiceContext(c, req.Language)
+	if !ok {
+		return
+	}
+
+	audioKey, err := vc.voiceService.TextToSpeech(ctx, req.Text, language)
 	if err != nil {
 		log.Printf("ERROR: TTS failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Text-to-Speech service is temporarily unavailable."})
 		return
 	}
 
-	log.Printf("INFO: TTS audio generated — len=%d url=%s", len(req.Text), audioURL)
-	c.JSON(http.StatusOK, gin.H{"audioUrl": audioURL})
+	log.Printf("INFO: TTS audio generated — len=%d key=%s", len(req.Text), audioKey)
+	c.JSON(http.StatusOK, gin.H{"audioUrl": fileURL(ctx, vc.storageService, audioKey)})
 }
 
 // SpeechToText handles POST /api/voice/stt
 // Accepts a multipart audio file upload (mp3, wav, m4a, ogg, flac, webm) and returns the transcribed text.
 func (vc *VoiceController) SpeechToText(c *gin.Context) {
-	file, header, err := c.Request.FormFile("audio")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'audio' file in request"})
+	ctx := c.Request.Context()
+	audio, ok := vc.readAudio(c)
+	if !ok {
 		return
 	}
-	defer file.Close()
 
-	audioData, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
+	_, language, ok := vc.voiceContext(c, c.PostForm("language"))
+	if !ok {
 		return
 	}
 
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext == "" {
-		ext = ".wav" // default
-	}
-
-	log.Printf("INFO: STT request — filename=%s size=%d ext=%s", header.Filename, len(audioData), ext)
+	log.Printf("INFO: STT request — filename=%s size=%d type=%s language=%s", audio.file.Filename, len(audio.data), audio.fileType.MimeType, language)
 
-	text, err := vc.voiceService.SpeechToText(audioData, ext)
+	text, err := vc.voiceService.SpeechToText(ctx, audio.data, audio.fileType.Ext, language)
 	if err != nil {
 		log.Printf("ERROR: STT failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Speech-to-Text service failed: " + err.Error()})
@@ -91,6 +108,14 @@ func (vc *VoiceController) SpeechToText(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"text": text})
 }
 
+// voiceTurn is a transcribed voice question together with who asked it.
+type voiceTurn struct {
+	farmer       *models.Farmer // nil for staff
+	language     string
+	conversation *models.Conversation
+	userText     string
+}
+
 // VoiceChat handles POST /api/voice/chat
 // Full voice-to-voice pipeline:
 //  1. Farmer sends audio file (wav, mp3, etc.)
@@ -99,40 +124,16 @@ func (vc *VoiceController) SpeechToText(c *gin.Context) {
 //  4. Backend converts the AI response to speech (Amazon Polly)
 //  5. Returns both the text reply AND the audio URL
 func (vc *VoiceController) VoiceChat(c *gin.Context) {
-	// Step 1: Read audio file
-	file, header, err := c.Request.FormFile("audio")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'audio' file in request"})
+	ctx := c.Request.Context()
+	// Steps 1-2: Read and transcribe the audio
+	turn, ok := vc.transcribe(c)
+	if !ok {
 		return
 	}
-	defer file.Close()
-
-	audioData, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
-		return
-	}
-
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext == "" {
-		ext = ".wav"
-	}
-
-	log.Printf("INFO: VoiceChat request — filename=%s size=%d", header.Filename, len(audioData))
-
-	// Step 2: Transcribe audio to text
-	userText, err := vc.voiceService.SpeechToText(audioData, ext)
-	if err != nil {
-		log.Printf("ERROR: VoiceChat STT failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not understand the audio. Please try again."})
-		return
-	}
-
-	log.Printf("INFO: VoiceChat transcribed — text=%s", userText)
 
 	// Step 3: Send to SamyakAI (farming-focused chatbot)
-	prompt := buildVoiceChatPrompt(userText)
-	aiReply, err := vc.aiService.GenerateAdvisory(prompt)
+	prompt := buildVoiceChatPrompt(turn.farmer, turn.language, turn.userText)
+	aiReply, err := vc.aiService.GenerateAdvisory(ctx, prompt)
 	if err != nil {
 		log.Printf("ERROR: VoiceChat AI failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI service is temporarily unavailable."})
@@ -142,31 +143,246 @@ func (vc *VoiceController) VoiceChat(c *gin.Context) {
 	log.Printf("INFO: VoiceChat AI replied — reply_len=%d", len(aiReply))
 
 	// Step 4: Convert AI response to speech
-	audioURL, err := vc.voiceService.TextToSpeech(aiReply)
+	audioKey, err := vc.voiceService.TextToSpeech(ctx, aiReply, turn.language)
 	if err != nil {
 		log.Printf("ERROR: VoiceChat TTS failed: %v", err)
 		// Still return the text reply even if audio generation fails
+		conversation, _ := vc.saveExchange(ctx, turn, aiReply, "", false)
 		c.JSON(http.StatusOK, gin.H{
-			"userText": userText,
-			"reply":    aiReply,
-			"audioUrl": nil,
-			"error":    "Audio generation failed, but text reply is available.",
+			"userText":       turn.userText,
+			"reply":          aiReply,
+			"audioUrl":       nil,
+			"conversationId": conversationIDText(conversation),
+			"error":          "Audio generation failed, but text reply is available.",
 		})
 		return
 	}
 
-	log.Printf("INFO: VoiceChat complete — user=%s reply_len=%d audio=%s", userText, len(aiReply), audioURL)
+	log.Printf("INFO: VoiceChat complete — user=%s reply_len=%d audio=%s", turn.userText, len(aiReply), audioKey)
+	conversation, _ := vc.saveExchange(ctx, turn, aiReply, audioKey, false)
 
 	// Step 5: Return everything
 	c.JSON(http.StatusOK, gin.H{
-		"userText": userText,
-		"reply":    aiReply,
-		"audioUrl": audioURL,
+		"userText":       turn.userText,
+		"reply":          aiReply,
+		"audioUrl":       fileURL(ctx, vc.storageService, audioKey),
+		"conversationId": conversationIDText(conversation),
+	})
+}
+
+// VoiceChatStream handles POST /api/voice/chat/stream — the voice pipeline with the text
+// reply streamed as Server-Sent Events while it is generated. Speech is synthesised once
+// the reply is complete and a link to it arrives in the final event.
+func (vc *VoiceController) VoiceChatStream(c *gin.Context) {
+	ctx := c.Request.Context()
+	turn, ok := vc.transcribe(c)
+	if !ok {
+		return
+	}
+
+	startSSE(c)
+	sendEvent(c, "transcript", gin.H{"userText": turn.userText})
+
+	prompt := buildVoiceChatPrompt(turn.farmer, turn.language, turn.userText)
+	aiReply, err := vc.aiService.StreamChat(ctx, "", []services.Message{{Role: services.MessageRoleUser, Text: prompt}}, func(delta string) error {
+		return sendEvent(c, "delta", gin.H{"text": delta})
+	})
+	if err != nil && aiReply == "" {
+		if ctx.Err() != nil {
+			log.Println("INFO: Client disconnected before the VoiceChat AI stream started")
+			return
+		}
+		log.Printf("ERROR: VoiceChat AI stream failed: %v", err)
+		sendEvent(c, "error", gin.H{"error": "AI service is temporarily unavailable."})
+		return
+	}
+	if aiReply == "" {
+		log.Println("WARN: VoiceChat AI stream returned an empty reply")
+		sendEvent(c, "error", gin.H{"error": "The AI did not return a reply. Please try again."})
+		return
+	}
+
+	// A cut-off reply is saved as text only; speaking half an answer would mislead
+	if err != nil {
+		conversation, aiMsg := vc.saveExchange(ctx, turn, aiReply, "", true)
+		if ctx.Err() != nil {
+			log.Printf("INFO: Client disconnected from the VoiceChat AI stream — saved %d bytes", len(aiReply))
+			return
+		}
+		log.Printf("WARN: VoiceChat AI stream interrupted after %d bytes: %v", len(aiReply), err)
+		sendEvent(c, "error", gin.H{
+			"error":          "The reply was cut off. The part received has been saved.",
+			"messageId":      messageIDText(aiMsg),
+			"conversationId": conversationIDText(conversation),
+		})
+		return
+	}
+
+	var audioURL interface{}
+	audioKey, err := vc.voiceService.TextToSpeech(ctx, aiReply, turn.language)
+	if err != nil {
+		log.Printf("ERROR: VoiceChat TTS failed: %v", err)
+	} else {
+		audioURL = fileURL(ctx, vc.storageService, audioKey)
+	}
+
+	conversation, aiMsg := vc.saveExchange(ctx, turn, aiReply, audioKey, false)
+	log.Printf("INFO: VoiceChat stream complete — reply_len=%d audio=%s", len(aiReply), audioKey)
+	sendEvent(c, "done", gin.H{
+		"messageId":      messageIDText(aiMsg),
+		"conversationId": conversationIDText(conversation),
+		"audioUrl":       audioURL,
 	})
 }
 
+// transcribe reads the uploaded audio, works out the language and thread, and converts the
+// speech to text. On failure it writes the error response and returns false.
+func (vc *VoiceController) transcribe(c *gin.Context) (*voiceTurn, bool) {
+	ctx := c.Request.Context()
+	audio, ok := vc.readAudio(c)
+	if !ok {
+		return nil, false
+	}
+
+	farmer, language, ok := vc.voiceContext(c, c.PostForm("language"))
+	if !ok {
+		return nil, false
+	}
+
+	// Farmers may continue an existing thread; staff voice chats are not stored
+	var conversation *models.Conversation
+	if farmer != nil {
+		if conversation, ok = farmerConversation(c, vc.conversationRepo, farmer, c.PostForm("conversationId")); !ok {
+			return nil, false
+		}
+	}
+
+	log.Printf("INFO: VoiceChat request — filename=%s size=%d type=%s language=%s", audio.file.Filename, len(audio.data), audio.fileType.MimeType, language)
+
+	userText, err := vc.voiceService.SpeechToText(ctx, audio.data, audio.fileType.Ext, language)
+	if err != nil {
+		log.Printf("ERROR: VoiceChat STT failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not understand the audio. Please try again."})
+		return nil, false
+	}
+
+	log.Printf("INFO: VoiceChat transcribed — text=%s", userText)
+	return &voiceTurn{farmer: farmer, language: language, conversation: conversation, userText: userText}, true
+}
+
+// saveExchange stores a farmer's voice chat turn in their chat history, so the reply audio
+// is covered by data export and account deletion. Without a conversation a new one is started.
+// Staff conversations are not stored. It returns the conversation and the saved reply, which
+// is stored even if the request was cancelled part-way through.
+func (vc *VoiceController) saveExchange(ctx context.Context, turn *voiceTurn, reply, audioKey string, interrupted bool) (*models.Conversation, *models.ChatMessage) {
+	ctx = context.WithoutCancel(ctx)
+	farmer, conversation := turn.farmer, turn.conversation
+	if farmer == nil {
+		return nil, nil
+	}
+	if conversation == nil {
+		var err error
+		if conversation, err = startConversation(ctx, vc.conversationRepo, farmer.ID, nil, turn.userText); err != nil {
+			log.Printf("WARN: Failed to start voice conversation for farmer %s: %v", farmer.ID.Hex(), err)
+			return nil, nil
+		}
+	}
+
+	userMsg := &models.ChatMessage{FarmerID: farmer.ID, ConversationID: &conversation.ID, Role: "user", Message: turn.userText}
+	aiMsg := &models.ChatMessage{FarmerID: farmer.ID, ConversationID: &conversation.ID, Role: "ai", Message: reply, AudioPath: audioKey, Interrupted: interrupted, AIProvider: services.AIProviderUsed(ctx)}
+	saveChatMessage(ctx, vc.chatRepo, vc.conversationRepo, userMsg)
+	saveChatMessage(ctx, vc.chatRepo, vc.conversationRepo, aiMsg)
+	return conversation, aiMsg
+}
+
+// conversationIDText returns the conversation's ID for a response, or nil when the
+// exchange was not stored.
+func conversationIDText(conversation *models.Conversation) interface{} {
+	if conversation == nil {
+		return nil
+	}
+	return conversation.ID.Hex()
+}
+
+// messageIDText returns a saved message's ID for a response, or nil when it was not stored.
+func messageIDText(msg *models.ChatMessage) interface{} {
+	if msg == nil || msg.ID.IsZero() {
+		return nil
+	}
+	return msg.ID.Hex()
+}
+
+// readAudio reads and checks the recording in the "audio" form field. On failure it writes
+// the error response and returns false.
+func (vc *VoiceController) readAudio(c *gin.Context) (*upload, bool) {
+	audio, ok := readUpload(c, "audio", vc.validateAudio)
+	if !ok {
+		return nil, false
+	}
+	if audio == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'audio' file in request"})
+		return nil, false
+	}
+	return audio, true
+}
+
+func (vc *VoiceController) validateAudio(file *multipart.FileHeader, data []byte) (utils.FileType, error) {
+	fileType, err := utils.ValidateAudio(file, data)
+	if err != nil && vc.textAudio && len(data) <= utils.MaxAudioSize && utf8.Valid(data) {
+		return utils.FileType{MimeType: "text/plain", Ext: ".txt"}, nil
+	}
+	return fileType, err
+}
+
+// voiceContext works out which language to listen and speak in: an explicit language
+// from the request wins, otherwise the logged-in farmer's preferred language is used.
+// The farmer is nil for staff tokens. On failure it writes the error response and returns false.
+func (vc *VoiceController) voiceContext(c *gin.Context, requested string) (*models.Farmer, string, bool) {
+	ctx := c.Request.Context()
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if requested != "" && !models.IsSupportedLanguage(requested) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "language must be one of: " + strings.Join(supportedLanguageCodes(), ", ")})
+		return nil, "", false
+	}
+
+	var farmer *models.Farmer
+	if farmerID, err := primitive.ObjectIDFromHex(c.GetString("farmerId")); err == nil {
+		if farmer, err = vc.farmerRepo.FindByID(ctx, farmerID); err != nil {
+			log.Printf("WARN: Voice request could not load farmer %s: %v", farmerID.Hex(), err)
+			farmer = nil
+		}
+	}
+
+	if requested != "" {
+		return farmer, requested, true
+	}
+	if farmer != nil {
+		return farmer, farmer.PreferredLanguage, true
+	}
+	return nil, "", true
+}
+
 // buildVoiceChatPrompt constructs the SamyakAI system prompt for voice chat.
-func buildVoiceChatPrompt(userMessage string) string {
+// farmer may be nil when the caller is not a farmer.
+func buildVoiceChatPrompt(farmer *models.Farmer, language, userMessage string) string {
+	farmerContext := ""
+	if farmer != nil {
+		farmerContext = fmt.Sprintf(`
+=== FARMER CONTEXT ===
+Name: %s
+Region: %s
+Land Holding: %s
+Irrigation: %s
+Primary Crops: %s
+`,
+			farmer.Name,
+			orUnknown(joinNonEmpty(", ", farmer.Block, farmer.District, farmer.State)),
+			landSizeText(farmer.LandSizeAcres),
+			orUnknown(strings.ReplaceAll(farmer.IrrigationSource, "_", " ")),
+			orUnknown(strings.Join(farmer.PrimaryCrops, ", ")),
+		)
+	}
+
 	return `You are SamyakAI, a friendly and expert agricultural chatbot built for Indian farmers.
 You are speaking to the farmer through VOICE, so keep your responses concise and conversational.
 
@@ -187,8 +403,8 @@ You are speaking to the farmer through VOICE, so keep your responses concise and
 3. Since this is VOICE conversation, keep answers SHORT and CLEAR (2-3 paragraphs max).
    Avoid bullet points and numbered lists — speak naturally like a conversation.
 
-4. Respond in the same language the farmer used (Hindi, English, or Hinglish).
-
+4. ` + languageInstruction(language) + `
+` + farmerContext + `
 === FARMER SAID ===
 ` + userMessage + `
 
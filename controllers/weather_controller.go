@@ -7,73 +7,81 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
 	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // WeatherController handles HTTP requests related to weather data.
 type WeatherController struct {
 	farmerRepo     *repositories.FarmerRepository
+	plotRepo       *repositories.PlotRepository
 	weatherService services.WeatherService
 }
 
 // NewWeatherController creates a new WeatherController instance.
-func NewWeatherController(farmerRepo *repositories.FarmerRepository, weatherService services.WeatherService) *WeatherController {
+func NewWeatherController(farmerRepo *repositories.FarmerRepository, plotRepo *repositories.PlotRepository, weatherService services.WeatherService) *WeatherController {
 	return &WeatherController{
 		farmerRepo:     farmerRepo,
+		plotRepo:       plotRepo,
 		weatherService: weatherService,
 	}
 }
 
-// GetWeather handles GET /api/weather?farmerId=xxx — returns current weather + 5-day forecast.
+// GetWeather handles GET /api/weather — returns current weather + 5-day forecast for the logged-in farmer.
+// With ?plotId= the forecast is for that plot's centre instead of the farmer's signup location.
 func (wc *WeatherController) GetWeather(c *gin.Context) {
-	farmerIDStr := c.Query("farmerId")
-	if farmerIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "farmerId query parameter is required"})
+	ctx := c.Request.Context()
+	// Resolve the acting farmer from the token (the farmerId query parameter is optional)
+	farmer, ok := resolveFarmer(c, wc.farmerRepo, c.Query("farmerId"))
+	if !ok {
 		return
 	}
+	farmerID := farmer.ID
 
-	farmerID, err := primitive.ObjectIDFromHex(farmerIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID format"})
-		return
-	}
-
-	farmer, err := wc.farmerRepo.FindByID(farmerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+	plot, ok := farmerPlot(c, wc.plotRepo, farmer, c.Query("plotId"))
+	if !ok {
 		return
 	}
+	location := advisoryLocation(farmer, plot)
 
 	// Fetch current weather (structured)
-	current, err := wc.weatherService.GetWeatherDetailed(farmer.Location.Latitude, farmer.Location.Longitude)
+	current, err := wc.weatherService.GetWeatherDetailed(ctx, location.Latitude, location.Longitude)
 	if err != nil {
 		log.Printf("ERROR: Weather fetch failed for farmer %s: %v", farmerID.Hex(), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weather data"})
 		return
 	}
 
+	response := gin.H{
+		"farmerId": farmerID.Hex(),
+		"location": location,
+		"current":  current,
+	}
+	if plot != nil {
+		response["plotId"] = plot.ID.Hex()
+	}
+
 	// Fetch 5-day forecast
-	forecast, err := wc.weatherService.GetForecast(farmer.Location.Latitude, farmer.Location.Longitude)
+	forecast, err := wc.weatherService.GetForecast(ctx, location.Latitude, location.Longitude)
 	if err != nil {
 		log.Printf("WARN: Forecast fetch failed for farmer %s: %v", farmerID.Hex(), err)
 		// Return current weather even if forecast fails
-		c.JSON(http.StatusOK, gin.H{
-			"farmerId":      farmerID.Hex(),
-			"location":      farmer.Location,
-			"current":       current,
-			"forecast":      []interface{}{},
-			"forecastError": "Forecast data temporarily unavailable",
-		})
+		response["forecast"] = []interface{}{}
+		response["forecastError"] = "Forecast data temporarily unavailable"
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
 	log.Printf("INFO: Weather data fetched — farmer=%s location=%s", farmer.Name, current.Location)
-	c.JSON(http.StatusOK, gin.H{
-		"farmerId": farmerID.Hex(),
-		"location": farmer.Location,
-		"current":  current,
-		"forecast": forecast,
-	})
+	response["forecast"] = forecast
+	c.JSON(http.StatusOK, response)
+}
+
+// advisoryLocation returns the plot's centre when a plot was chosen, else the farmer's location.
+func advisoryLocation(farmer *models.Farmer, plot *models.Plot) models.Location {
+	if plot != nil {
+		return plot.Centroid
+	}
+	return farmer.Location
 }
@@ -76,14 +76,54 @@ func (m *MongoDB) ensureIndexes(ctx context.Context) {
 		log.Printf("WARN: Failed to create phone index: %v", err)
 	}
 
-	// Index on soil_data.farmerId for quick lookups
+	// Index on farmers.block for extension officers' farmer lists
+	_, err = farmersCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "block", Value: 1}, {Key: "name", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create farmer block index: %v", err)
+	}
+
+	// Index on farmers.purgeAfter for the account purge job (only deleted farmers have it)
+	_, err = farmersCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "purgeAfter", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create farmer purgeAfter index: %v", err)
+	}
+
+	// Staff users: unique phone, lookup by role and block
+	usersCol := m.Database.Collection("users")
+	_, err = usersCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "phone", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "role", Value: 1}, {Key: "block", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create users indexes: %v", err)
+	}
+
+	// Index on soil_data.farmerId + createdAt for a farmer's soil history, newest first
 	soilCol := m.Database.Collection("soil_data")
 	_, err = soilCol.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: bson.D{{Key: "farmerId", Value: 1}},
+		Keys: bson.D{{Key: "farmerId", Value: 1}, {Key: "createdAt", Value: -1}},
 	})
 	if err != nil {
 		log.Printf("WARN: Failed to create soil farmerId index: %v", err)
 	}
+	_, err = soilCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "plotId", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create soil plotId index: %v", err)
+	}
+	// Earlier analyses of the same photo, found by its content-addressed image path
+	_, err = soilCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "imagePath", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create soil imagePath index: %v", err)
+	}
 
 	// Index on chat_messages.farmerId + createdAt for sorted history
 	chatCol := m.Database.Collection("chat_messages")
@@ -96,6 +136,109 @@ func (m *MongoDB) ensureIndexes(ctx context.Context) {
 	if err != nil {
 		log.Printf("WARN: Failed to create chat index: %v", err)
 	}
+	_, err = chatCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "conversationId", Value: 1},
+			{Key: "createdAt", Value: -1},
+			{Key: "_id", Value: -1},
+		},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create chat conversationId index: %v", err)
+	}
+
+	// Conversations: a farmer's threads, most recently active first
+	convCol := m.Database.Collection("conversations")
+	_, err = convCol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "farmerId", Value: 1},
+			{Key: "lastMessageAt", Value: -1},
+			{Key: "_id", Value: -1},
+		},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create conversations index: %v", err)
+	}
+
+	// Plots: a farmer's fields, with a 2dsphere index on the boundary for spatial queries
+	plotsCol := m.Database.Collection("plots")
+	_, err = plotsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "farmerId", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{Keys: bson.D{{Key: "geometry", Value: "2dsphere"}}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create plots indexes: %v", err)
+	}
+
+	// OTP codes: lookup by phone, and TTL cleanup of expired codes
+	otpCol := m.Database.Collection("otp_codes")
+	_, err = otpCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "phone", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create otp_codes indexes: %v", err)
+	}
+
+	// OTP request log: rate-limit lookups by phone and IP, delivery receipt lookups, kept for 24 hours
+	otpReqCol := m.Database.Collection("otp_requests")
+	_, err = otpReqCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "phone", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "messageId", Value: 1}}},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60)},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create otp_requests indexes: %v", err)
+	}
+
+	// Sessions: lookup by farmer or staff user, and TTL cleanup once the refresh window has passed
+	sessionsCol := m.Database.Collection("sessions")
+	_, err = sessionsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "farmerId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create sessions indexes: %v", err)
+	}
+
+	// Phone change requests: officer queues by status and block, at most one pending request per farmer
+	phoneChangeCol := m.Database.Collection("phone_change_requests")
+	_, err = phoneChangeCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "block", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "farmerId", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": "pending"}),
+		},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create phone_change_requests indexes: %v", err)
+	}
+
+	// Audit trail: history per farmer and per action
+	auditCol := m.Database.Collection("audit_logs")
+	_, err = auditCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "farmerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create audit_logs indexes: %v", err)
+	}
+
+	jobsCol := m.Database.Collection("jobs")
+	_, err = jobsCol.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "runAt", Value: 1}}},
+		{
+			// Finished jobs are kept a week for troubleshooting
+			Keys:    bson.D{{Key: "finishedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60),
+		},
+	})
+	if err != nil {
+		log.Printf("WARN: Failed to create jobs indexes: %v", err)
+	}
 
 	log.Println("INFO: Database indexes ensured")
 }
@@ -0,0 +1,189 @@
+// All rights reserved Samyak-Setu
+
+// Package jobs contains background work that runs alongside the HTTP server.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+)
+
+// purgeBatchSize bounds how many accounts one run erases.
+const purgeBatchSize = 50
+
+// AccountPurgeJob permanently erases farmer accounts whose deletion grace period has ended:
+// stored media, soil analyses, chats and conversations, plots, sessions and phone change requests, then the
+// farmer record itself. Audit entries are kept but stripped of personal details.
+type AccountPurgeJob struct {
+	farmerRepo       *repositories.FarmerRepository
+	soilRepo         *repositories.SoilRepository
+	chatRepo         *repositories.ChatRepository
+	conversationRepo *repositories.ConversationRepository
+	plotRepo         *repositories.PlotRepository
+	sessionRepo      *repositories.SessionRepository
+	phoneChangeRepo  *repositories.PhoneChangeRepository
+	auditRepo        *repositories.AuditRepository
+	storageService   services.StorageService
+	interval         time.Duration
+}
+
+// NewAccountPurgeJob creates a new AccountPurgeJob that checks for due accounts every interval.
+func NewAccountPurgeJob(
+	farmerRepo *repositories.FarmerRepository,
+	soilRepo *repositories.SoilRepository,
+	chatRepo *repositories.ChatRepository,
+	conversationRepo *repositories.ConversationRepository,
+	plotRepo *repositories.PlotRepository,
+	sessionRepo *repositories.SessionRepository,
+	phoneChangeRepo *repositories.PhoneChangeRepository,
+	auditRepo *repositories.AuditRepository,
+	storageService services.StorageService,
+	interval time.Duration,
+) *AccountPurgeJob {
+	return &AccountPurgeJob{
+		farmerRepo:       farmerRepo,
+		soilRepo:         soilRepo,
+		chatRepo:         chatRepo,
+		conversationRepo: conversationRepo,
+		plotRepo:         plotRepo,
+		sessionRepo:      sessionRepo,
+		phoneChangeRepo:  phoneChangeRepo,
+		auditRepo:        auditRepo,
+		storageService:   storageService,
+		interval:         interval,
+	}
+}
+
+// Start runs the job immediately and then every interval until ctx is cancelled.
+func (j *AccountPurgeJob) Start(ctx context.Context) {
+	log.Printf("INFO: Account purge job started — interval=%v", j.interval)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: Account purge job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce purges every account that is due, up to purgeBatchSize, and returns how many were purged.
+// Cancelling ctx stops the run between steps; a half-purged account is finished next run.
+func (j *AccountPurgeJob) RunOnce(ctx context.Context) int {
+	farmers, err := j.farmerRepo.FindDueForPurge(ctx, time.Now(), purgeBatchSize)
+	if err != nil {
+		log.Printf("ERROR: Account purge — failed to find due accounts: %v", err)
+		return 0
+	}
+
+	purged := 0
+	for i := range farmers {
+		if err := j.purge(ctx, &farmers[i]); err != nil {
+			log.Printf("ERROR: Account purge failed for farmer %s (will retry): %v", farmers[i].ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("INFO: Account purge — purged=%d", purged)
+	}
+	return purged
+}
+
+// purge erases one farmer. Records go before the media they point at: stored files may be
+// shared with other records, so a purge retried after a failure must never let go of a file
+// twice. A file that cannot be released is logged and left behind. The farmer record goes
+// last, so a failure part-way leaves the account due and the next run picks it up again.
+func (j *AccountPurgeJob) purge(ctx context.Context, farmer *models.Farmer) error {
+	soils, err := j.soilRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return err
+	}
+	messages, err := j.chatRepo.FindByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return err
+	}
+
+	mediaCount := 0
+	soilCount, err := j.soilRepo.DeleteByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return err
+	}
+	for _, soil := range soils {
+		mediaCount += j.deleteMedia(ctx, farmer, soil.ImagePath, soil.ThumbnailPath)
+	}
+	chatCount, err := j.chatRepo.DeleteByFarmerID(ctx, farmer.ID)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		mediaCount += j.deleteMedia(ctx, farmer, msg.AudioPath)
+	}
+	if farmer.ProfilePic != "" {
+		if err := j.farmerRepo.UpdateProfilePic(ctx, farmer.ID, ""); err != nil {
+			return err
+		}
+		mediaCount += j.deleteMedia(ctx, farmer, farmer.ProfilePic)
+	}
+
+	if _, err := j.conversationRepo.DeleteByFarmerID(ctx, farmer.ID); err != nil {
+		return err
+	}
+	if _, err := j.plotRepo.DeleteByFarmerID(ctx, farmer.ID); err != nil {
+		return err
+	}
+	if _, err := j.phoneChangeRepo.DeleteByFarmerID(ctx, farmer.ID); err != nil {
+		return err
+	}
+	if _, err := j.sessionRepo.DeleteAllForFarmer(ctx, farmer.ID); err != nil {
+		return err
+	}
+	if _, err := j.auditRepo.RedactFarmer(ctx, farmer.ID); err != nil {
+		return err
+	}
+	if err := j.farmerRepo.Delete(ctx, farmer.ID); err != nil {
+		return err
+	}
+
+	farmerID := farmer.ID
+	entry := &models.AuditLog{
+		Action:   models.AuditAccountPurged,
+		FarmerID: &farmerID,
+		Details: map[string]interface{}{
+			"mediaFiles":   mediaCount,
+			"soilRecords":  soilCount,
+			"chatMessages": chatCount,
+		},
+	}
+	if err := j.auditRepo.Record(ctx, entry); err != nil {
+		log.Printf("ERROR: Failed to write audit entry %s for farmer %s: %v", entry.Action, farmerID.Hex(), err)
+	}
+
+	log.Printf("INFO: Account purged — farmer=%s media=%d soil=%d chats=%d", farmerID.Hex(), mediaCount, soilCount, chatCount)
+	return nil
+}
+
+// deleteMedia deletes a purged farmer's stored files and returns how many were deleted.
+func (j *AccountPurgeJob) deleteMedia(ctx context.Context, farmer *models.Farmer, keys ...string) int {
+	deleted := 0
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := j.storageService.Delete(ctx, key); err != nil {
+			log.Printf("WARN: Account purge — failed to delete file %s of farmer %s: %v", key, farmer.ID.Hex(), err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
@@ -0,0 +1,176 @@
+// All rights reserved Samyak-Setu
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// JobHandler does the work of one job type.
+type JobHandler interface {
+	// Run makes one attempt at the job. An error schedules another attempt with backoff.
+	Run(ctx context.Context, job *models.Job) error
+
+	// GiveUp is called once the job's last attempt has failed with err.
+	GiveUp(ctx context.Context, job *models.Job, err error)
+}
+
+// QueueSettings configures a Queue.
+type QueueSettings struct {
+	Workers      int           // jobs run at the same time
+	PollInterval time.Duration // how often idle workers look for due jobs
+	MaxAttempts  int           // attempts before a job is given up
+	BackoffBase  time.Duration // delay after the first failed attempt, doubled after each further one
+	BackoffMax   time.Duration // longest delay between attempts
+	Timeout      time.Duration // time allowed for one attempt
+}
+
+// Queue runs background jobs stored in MongoDB with a pool of workers inside the server
+// process. Failed attempts are retried with exponential backoff; a job whose worker died is
+// picked up again once its lease expires.
+type Queue struct {
+	jobRepo  *repositories.JobRepository
+	settings QueueSettings
+	handlers map[string]JobHandler
+	wake     chan struct{}
+}
+
+// NewQueue creates a queue. Register handlers before calling Start.
+func NewQueue(jobRepo *repositories.JobRepository, settings QueueSettings) *Queue {
+	if settings.Workers < 1 {
+		settings.Workers = 1
+	}
+	return &Queue{
+		jobRepo:  jobRepo,
+		settings: settings,
+		handlers: map[string]JobHandler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for a job type.
+func (q *Queue) Register(jobType string, handler JobHandler) {
+	q.handlers[jobType] = handler
+}
+
+// Enqueue adds a job of the given type for the record refID, first run after delay.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, refID primitive.ObjectID, delay time.Duration) (*models.Job, error) {
+	if _, ok := q.handlers[jobType]; !ok {
+		return nil, fmt.Errorf("no handler registered for job type %q", jobType)
+	}
+
+	job := &models.Job{
+		Type:        jobType,
+		RefID:       refID,
+		MaxAttempts: q.settings.MaxAttempts,
+		RunAt:       time.Now().Add(delay),
+	}
+	if err := q.jobRepo.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	if delay <= 0 {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return job, nil
+}
+
+// Backoff returns the delay before the attempt that follows attempt failed ones.
+func (q *Queue) Backoff(attempts int) time.Duration {
+	delay := q.settings.BackoffBase
+	for i := 1; i < attempts && delay < q.settings.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, q.settings.BackoffMax)
+}
+
+// Start runs the workers until ctx is cancelled and returns once they have stopped. Jobs
+// interrupted by cancellation go back to the queue without counting the attempt.
+func (q *Queue) Start(ctx context.Context) {
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	log.Printf("INFO: Job queue started — workers=%d types=%v", q.settings.Workers, types)
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.settings.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, types)
+		}()
+	}
+	wg.Wait()
+	log.Println("INFO: Job queue stopped")
+}
+
+// work claims and runs due jobs, waiting for the next poll or a wake-up when there are none.
+func (q *Queue) work(ctx context.Context, types []string) {
+	// The lease outlives the attempt's timeout, so a slow attempt is not taken over while it runs
+	lease := q.settings.Timeout + time.Minute
+	for {
+		job, err := q.jobRepo.ClaimNext(ctx, types, lease)
+		if err == nil {
+			q.run(ctx, job)
+			continue
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+			log.Printf("ERROR: Job queue — failed to claim a job: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.settings.PollInterval):
+		}
+	}
+}
+
+// run makes one attempt at a claimed job and records the outcome.
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	// Outcomes are stored even when ctx was cancelled mid-attempt
+	store := context.WithoutCancel(ctx)
+	handler := q.handlers[job.Type]
+
+	attemptCtx, cancel := context.WithTimeout(ctx, q.settings.Timeout)
+	err := handler.Run(attemptCtx, job)
+	cancel()
+
+	switch {
+	case err == nil:
+		if err := q.jobRepo.Complete(store, job.ID); err != nil {
+			log.Printf("ERROR: Job %s (%s) — failed to mark done: %v", job.ID.Hex(), job.Type, err)
+		}
+		log.Printf("INFO: Job %s (%s) done — attempt=%d ref=%s", job.ID.Hex(), job.Type, job.Attempts, job.RefID.Hex())
+	case ctx.Err() != nil:
+		if err := q.jobRepo.Release(store, job.ID); err != nil {
+			log.Printf("ERROR: Job %s (%s) — failed to release: %v", job.ID.Hex(), job.Type, err)
+		}
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("WARN: Job %s (%s) gave up after %d attempts — ref=%s: %v", job.ID.Hex(), job.Type, job.Attempts, job.RefID.Hex(), err)
+		handler.GiveUp(store, job, err)
+		if err := q.jobRepo.Fail(store, job.ID, err.Error()); err != nil {
+			log.Printf("ERROR: Job %s (%s) — failed to mark failed: %v", job.ID.Hex(), job.Type, err)
+		}
+	default:
+		delay := q.Backoff(job.Attempts)
+		log.Printf("WARN: Job %s (%s) attempt %d/%d failed, retrying in %v: %v", job.ID.Hex(), job.Type, job.Attempts, job.MaxAttempts, delay, err)
+		if err := q.jobRepo.Retry(store, job.ID, time.Now().Add(delay), err.Error()); err != nil {
+			log.Printf("ERROR: Job %s (%s) — failed to reschedule: %v", job.ID.Hex(), job.Type, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// All rights reserved Samyak-Setu
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
+	"github.com/samyaksetu/backend/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backfillBatchSize bounds how many legacy samples one query of the backfill returns.
+const backfillBatchSize = 100
+
+// SoilAnalysisJob re-runs the AI analysis of a soil photo whose analysis failed at upload.
+// The sample stays "pending" until an attempt succeeds, and becomes "failed" when the
+// queue gives up.
+type SoilAnalysisJob struct {
+	soilRepo       *repositories.SoilRepository
+	aiService      services.AIService
+	storageService services.StorageService
+}
+
+// NewSoilAnalysisJob creates a new SoilAnalysisJob.
+func NewSoilAnalysisJob(soilRepo *repositories.SoilRepository, aiService services.AIService, storageService services.StorageService) *SoilAnalysisJob {
+	return &SoilAnalysisJob{
+		soilRepo:       soilRepo,
+		aiService:      aiService,
+		storageService: storageService,
+	}
+}
+
+// Run analyzes the sample's photo and stores the result. Samples deleted or analyzed in the
+// meantime are left alone.
+func (j *SoilAnalysisJob) Run(ctx context.Context, job *models.Job) error {
+	soil, err := j.soilRepo.FindByID(ctx, job.RefID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("INFO: Soil analysis job — sample %s was deleted, nothing to do", job.RefID.Hex())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if soil.AnalysisStatus != models.SoilAnalysisPending {
+		return nil
+	}
+
+	imageData, err := j.storageService.ReadFile(ctx, soil.ImagePath)
+	if err != nil {
+		return err
+	}
+	mimeType := mime.TypeByExtension(path.Ext(soil.ImagePath))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(imageData)
+	}
+
+	ctx = services.WithAIProviderTrace(ctx)
+	analysis, err := j.aiService.AnalyzeSoilImage(ctx, imageData, mimeType)
+	if err != nil {
+		return err
+	}
+
+	// A label the farmer set while the analysis was pending wins over the AI's class
+	if err := j.soilRepo.SaveAnalysis(ctx, soil.ID, analysis, services.AIProviderUsed(ctx)); err != nil {
+		return err
+	}
+
+	log.Printf("INFO: Soil re-analyzed — farmer=%s soil=%s soilType=%s attempt=%d", soil.FarmerID.Hex(), soil.ID.Hex(), analysis.Label(), job.Attempts)
+	return nil
+}
+
+// BackfillLegacySoilAnalyses queues an analysis for each sample stored with the legacy
+// placeholder soil type, in batches of backfillBatchSize, and returns how many were queued.
+// The placeholder is cleared, and the samples become pending like any upload whose analysis
+// failed. Samples whose image path is still a public URL from before storage keys cannot be
+// read back and are marked failed instead.
+func BackfillLegacySoilAnalyses(ctx context.Context, soilRepo *repositories.SoilRepository, queue *Queue) int {
+	queued, failed := 0, 0
+	for ctx.Err() == nil {
+		soils, err := soilRepo.FindLegacyPending(ctx, backfillBatchSize)
+		if err != nil {
+			log.Printf("ERROR: Soil analysis backfill — failed to find legacy samples: %v", err)
+			break
+		}
+		if len(soils) == 0 {
+			break
+		}
+
+		for _, soil := range soils {
+			status := models.SoilAnalysisPending
+			if strings.HasPrefix(soil.ImagePath, "http://") || strings.HasPrefix(soil.ImagePath, "https://") {
+				status = models.SoilAnalysisFailed
+			}
+			if err := soilRepo.Update(ctx, soil.ID, bson.M{"analysisStatus": status, "soilType": ""}); err != nil {
+				// The sample would be found again by the next batch, so stop here
+				log.Printf("ERROR: Soil analysis backfill — failed to update sample %s: %v", soil.ID.Hex(), err)
+				return queued
+			}
+			if status == models.SoilAnalysisFailed {
+				failed++
+				continue
+			}
+
+			if _, err := queue.Enqueue(ctx, models.JobTypeSoilAnalysis, soil.ID, queue.Backoff(1)); err != nil {
+				log.Printf("ERROR: Failed to queue soil analysis for %s: %v", soil.ID.Hex(), err)
+				if err := soilRepo.Update(context.WithoutCancel(ctx), soil.ID, bson.M{"analysisStatus": models.SoilAnalysisFailed}); err != nil {
+					log.Printf("ERROR: Failed to mark soil analysis %s failed: %v", soil.ID.Hex(), err)
+				}
+				failed++
+				continue
+			}
+			queued++
+		}
+	}
+
+	if queued > 0 || failed > 0 {
+		log.Printf("INFO: Soil analysis backfill — queued=%d failed=%d", queued, failed)
+	}
+	return queued
+}
+
+// GiveUp marks the sample's analysis as failed.
+func (j *SoilAnalysisJob) GiveUp(ctx context.Context, job *models.Job, err error) {
+	if err := j.soilRepo.Update(ctx, job.RefID, bson.M{"analysisStatus": models.SoilAnalysisFailed}); err != nil {
+		log.Printf("ERROR: Failed to mark soil analysis %s failed: %v", job.RefID.Hex(), err)
+	}
+}
@@ -0,0 +1,81 @@
+// All rights reserved Samyak-Setu
+
+package jobs
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/samyaksetu/backend/services"
+)
+
+// StorageSweepJob deletes stored files that are only kept for a while, such as the
+// recordings sent to speech-to-text and generated speech, once they are older than the
+// retention set for their sub-directory. Sub-directories without a rule are never touched.
+type StorageSweepJob struct {
+	storageService services.StorageService
+	retention      map[string]time.Duration
+	interval       time.Duration
+}
+
+// NewStorageSweepJob creates a new StorageSweepJob that applies the retention rules
+// (sub-directory → maximum age) every interval.
+func NewStorageSweepJob(storageService services.StorageService, retention map[string]time.Duration, interval time.Duration) *StorageSweepJob {
+	return &StorageSweepJob{
+		storageService: storageService,
+		retention:      retention,
+		interval:       interval,
+	}
+}
+
+// Start runs the job immediately and then every interval until ctx is cancelled. Without
+// retention rules it returns at once.
+func (j *StorageSweepJob) Start(ctx context.Context) {
+	if len(j.retention) == 0 {
+		log.Println("INFO: Storage sweep job disabled — no retention rules")
+		return
+	}
+	log.Printf("INFO: Storage sweep job started — interval=%v retention=%v", j.interval, j.retention)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: Storage sweep job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce deletes the files past their retention and returns how many were deleted. A
+// failure in one sub-directory does not stop the others.
+func (j *StorageSweepJob) RunOnce(ctx context.Context) int {
+	dirs := make([]string, 0, len(j.retention))
+	for dir := range j.retention {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	total := 0
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			break
+		}
+		maxAge := j.retention[dir]
+		deleted, err := j.storageService.DeleteOlderThan(ctx, dir, time.Now().Add(-maxAge), nil)
+		total += deleted
+		if err != nil {
+			log.Printf("ERROR: Storage sweep of %s/ failed after %d files: %v", dir, deleted, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("INFO: Storage sweep deleted %d files older than %v from %s/", deleted, maxAge, dir)
+		}
+	}
+	return total
+}
@@ -0,0 +1,105 @@
+// All rights reserved Samyak-Setu
+
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OnBehalfOfHeader lets staff users name the farmer they are acting for.
+const OnBehalfOfHeader = "X-On-Behalf-Of"
+
+var (
+	// ErrUnauthenticated is returned when the request carries no authenticated identity.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned when the caller may not act on the requested farmer.
+	ErrForbidden = errors.New("you are not allowed to access another farmer's data")
+	// ErrFarmerRequired is returned when a delegated role does not say which farmer it acts for.
+	ErrFarmerRequired = errors.New("farmerId or " + OnBehalfOfHeader + " header is required when acting on behalf of a farmer")
+	// ErrInvalidFarmerID is returned when a farmer ID is not a valid ObjectID.
+	ErrInvalidFarmerID = errors.New("invalid farmer ID format")
+	// ErrOutsideBlock is returned when an extension officer targets a farmer outside their block.
+	ErrOutsideBlock = errors.New("this farmer is not assigned to your block")
+)
+
+// RequireRole only lets requests through whose token carries one of the given roles.
+// It must run after JWTAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+
+		log.Printf("WARN: Role check failed — role=%s required=%v path=%s", role, roles, c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{"error": "This action requires one of the roles: " + strings.Join(roles, ", ")})
+		c.Abort()
+	}
+}
+
+// CheckFarmerScope verifies that the caller may see the given farmer. Extension
+// officers are limited to farmers in their own block; other roles are not restricted here.
+func CheckFarmerScope(c *gin.Context, farmer *models.Farmer) error {
+	if !models.IsBlockScoped(c.GetString("role")) {
+		return nil
+	}
+	block := c.GetString("block")
+	if block == "" || farmer.Block != block {
+		return ErrOutsideBlock
+	}
+	return nil
+}
+
+// ActingFarmerID determines which farmer the current request acts on.
+//
+// Farmers always act on themselves: the ID comes from the token, and a
+// requestedID (from a body or query string) is only accepted if it matches.
+// Staff (admins, agronomists and extension officers) must name the target farmer
+// explicitly, either through the X-On-Behalf-Of header or the requestedID.
+func ActingFarmerID(c *gin.Context, requestedID string) (primitive.ObjectID, error) {
+	role := c.GetString("role")
+
+	if models.CanActOnBehalfOfFarmer(role) {
+		target := c.GetHeader(OnBehalfOfHeader)
+		if target == "" {
+			target = requestedID
+		} else if requestedID != "" && requestedID != target {
+			return primitive.NilObjectID, ErrForbidden
+		}
+		if target == "" {
+			return primitive.NilObjectID, ErrFarmerRequired
+		}
+		id, err := primitive.ObjectIDFromHex(target)
+		if err != nil {
+			return primitive.NilObjectID, ErrInvalidFarmerID
+		}
+		return id, nil
+	}
+
+	tokenFarmerID := c.GetString("farmerId")
+	if tokenFarmerID == "" {
+		return primitive.NilObjectID, ErrUnauthenticated
+	}
+	if requestedID != "" && requestedID != tokenFarmerID {
+		return primitive.NilObjectID, ErrForbidden
+	}
+	if c.GetHeader(OnBehalfOfHeader) != "" && c.GetHeader(OnBehalfOfHeader) != tokenFarmerID {
+		return primitive.NilObjectID, ErrForbidden
+	}
+
+	id, err := primitive.ObjectIDFromHex(tokenFarmerID)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidFarmerID
+	}
+	return id, nil
+}
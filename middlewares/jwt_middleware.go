@@ -3,17 +3,29 @@
 package middlewares
 
 import (
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// sessionTouchInterval limits how often a session's lastSeenAt is written.
+const sessionTouchInterval = time.Minute
+
 // JWTAuth is a middleware that verifies the JWT token in the Authorization header.
-// If valid, it sets "farmerId", "farmerPhone", and "farmerName" in the Gin context.
-// Protected routes can then use c.GetString("farmerId") to identify the logged-in user.
-func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
+// The token's session must still be active, so logged-out or revoked devices are rejected
+// even before their access token expires.
+// If valid, it sets "farmerId", "farmerPhone", "farmerName", "role" and "sessionId" in the Gin context.
+// Staff tokens set "userId" and "block" instead of "farmerId".
+// Protected routes should resolve the farmer they act on with ActingFarmerID rather than
+// trusting IDs sent in request bodies or query strings.
+func JWTAuth(jwtService *services.JWTService, sessionRepo *repositories.SessionRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -37,11 +49,43 @@ func JWTAuth(jwtService *services.JWTService) gin.HandlerFunc {
 			return
 		}
 
-		// Inject farmer info into request context for downstream handlers
-		c.Set("farmerId", claims.FarmerID)
+		sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		session, err := sessionRepo.FindByID(c.Request.Context(), sessionID)
+		if err != nil || !session.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been logged out. Please log in again."})
+			c.Abort()
+			return
+		}
+
+		if time.Since(session.LastSeenAt) > sessionTouchInterval {
+			if err := sessionRepo.Touch(c.Request.Context(), sessionID, c.ClientIP()); err != nil {
+				log.Printf("WARN: Failed to update session last seen — session=%s: %v", claims.SessionID, err)
+			}
+		}
+
+		// Inject caller info into request context for downstream handlers
+		if claims.UserID != "" {
+			c.Set("userId", claims.UserID)
+			c.Set("block", claims.Block)
+		} else {
+			c.Set("farmerId", claims.FarmerID)
+		}
 		c.Set("farmerPhone", claims.Phone)
 		c.Set("farmerName", claims.Name)
 
+		role := claims.Role
+		if role == "" {
+			role = models.RoleFarmer
+		}
+		c.Set("role", role)
+		c.Set("sessionId", claims.SessionID)
+
 		c.Next()
 	}
 }
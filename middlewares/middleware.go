@@ -3,12 +3,16 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/samyaksetu/backend/services"
 )
 
 // SetupCORS returns a CORS middleware configured for development and production.
@@ -16,33 +20,80 @@ func SetupCORS() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", OnBehalfOfHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: false,
 		MaxAge:           12 * time.Hour,
 	})
 }
 
-// RequestLogger logs each incoming HTTP request with method, path, status, and latency.
+// RequestLogger logs each incoming HTTP request with method, path, status, and latency,
+// plus the AI providers that answered it, if any.
 func RequestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		startTime := time.Now()
 		path := c.Request.URL.Path
 		method := c.Request.Method
+		ctx := services.WithAIProviderTrace(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
 
 		latency := time.Since(startTime)
 		statusCode := c.Writer.Status()
 
+		if providers := services.AIProvidersUsed(ctx); len(providers) > 0 {
+			log.Printf("INFO: %s %s → %d (%v) ai=%s", method, path, statusCode, latency, strings.Join(providers, ","))
+			return
+		}
 		log.Printf("INFO: %s %s → %d (%v)", method, path, statusCode, latency)
 	}
 }
 
-// MaxBodySize limits the request body size to prevent abuse.
-func MaxBodySize(maxBytes int64) gin.HandlerFunc {
+// MaxBodySize limits the request body size to prevent abuse: the limit for the route pattern
+// (for example "/api/soil/upload") or fallback when the route has none. Bodies declared
+// larger are refused with 413 before they are read; longer bodies without a declared length
+// fail when the handler reads past the limit.
+func MaxBodySize(fallback int64, limits map[string]int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		maxBytes, ok := limits[c.FullPath()]
+		if !ok {
+			maxBytes = fallback
+		}
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			return
+		}
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
 		c.Next()
 	}
 }
+
+// deadlineGrace is how long past its budget a request may keep writing, so a handler whose
+// work was cut short can still send its error response.
+const deadlineGrace = 5 * time.Second
+
+// RequestBudget gives each request a deadline: the budget for its route pattern
+// (for example "/api/chat") or fallback when the route has none. Cancellation of the
+// request context then reaches every repository and service call made for it. The
+// connection's write deadline moves with the budget, so routes allowed longer than the
+// server's write timeout can still answer.
+func RequestBudget(fallback time.Duration, budgets map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		budget, ok := budgets[c.FullPath()]
+		if !ok {
+			budget = fallback
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(budget + deadlineGrace))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Printf("WARN: Could not set write deadline for %s: %v", c.FullPath(), err)
+		}
+
+		c.Next()
+	}
+}
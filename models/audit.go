@@ -0,0 +1,32 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions.
+const (
+	AuditPhoneChanged         = "farmer.phone_changed"
+	AuditPhoneChangeRequested = "farmer.phone_change_requested"
+	AuditPhoneChangeRejected  = "farmer.phone_change_rejected"
+	AuditAccountDeleted       = "farmer.account_deleted"
+	AuditAccountRestored      = "farmer.account_restored"
+	AuditAccountPurged        = "farmer.account_purged"
+	AuditDataExported         = "farmer.data_exported"
+)
+
+// AuditLog records a security-relevant change to an account: who did what, to whom, and when.
+type AuditLog struct {
+	ID        primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Action    string                 `json:"action" bson:"action"`
+	ActorID   string                 `json:"actorId,omitempty" bson:"actorId,omitempty"` // farmer or staff user ID; empty for unauthenticated requests
+	ActorRole string                 `json:"actorRole,omitempty" bson:"actorRole,omitempty"`
+	FarmerID  *primitive.ObjectID    `json:"farmerId,omitempty" bson:"farmerId,omitempty"` // farmer the action was about
+	Details   map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+	IP        string                 `json:"ip,omitempty" bson:"ip,omitempty"`
+	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
+}
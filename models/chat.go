@@ -10,21 +10,34 @@ import (
 
 // ChatMessage represents a single message in a farmer's chat history.
 type ChatMessage struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	FarmerID  primitive.ObjectID `json:"farmerId" bson:"farmerId"`
-	Role      string             `json:"role" bson:"role"` // "user" or "ai"
-	Message   string             `json:"message" bson:"message"`
-	ImagePath string             `json:"imagePath,omitempty" bson:"imagePath,omitempty"`
-	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	FarmerID       primitive.ObjectID  `json:"farmerId" bson:"farmerId"`
+	ConversationID *primitive.ObjectID `json:"conversationId,omitempty" bson:"conversationId,omitempty"` // unset for messages saved before threads existed
+	PlotID         *primitive.ObjectID `json:"plotId,omitempty" bson:"plotId,omitempty"`
+	Role           string              `json:"role" bson:"role"` // "user" or "ai"
+	Message        string              `json:"message" bson:"message"`
+	ImagePath      string              `json:"imagePath,omitempty" bson:"imagePath,omitempty"`
+	AudioPath      string              `json:"audioPath,omitempty" bson:"audioPath,omitempty"`     // storage key of the speech for voice chat replies
+	AudioURL       string              `json:"audioUrl,omitempty" bson:"-"`                        // expiring link to the speech; set on responses
+	Interrupted    bool                `json:"interrupted,omitempty" bson:"interrupted,omitempty"` // streamed reply cut off before it finished
+	AIProvider     string              `json:"aiProvider,omitempty" bson:"aiProvider,omitempty"`   // AI provider that wrote an "ai" message
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
 }
 
 // ChatRequest is the expected input for the advisory chat endpoint.
+// FarmerID is optional: the farmer is taken from the JWT, and a supplied ID must match it
+// unless the caller is acting on behalf of a farmer. PlotID focuses the advice on one of the
+// farmer's plots. ConversationID continues an existing thread; without it a new thread is
+// started, titled after the message.
 type ChatRequest struct {
-	FarmerID string `json:"farmerId" form:"farmerId" binding:"required"`
-	Message  string `json:"message" form:"message" binding:"required"`
+	FarmerID       string `json:"farmerId" form:"farmerId"`
+	ConversationID string `json:"conversationId" form:"conversationId"`
+	PlotID         string `json:"plotId" form:"plotId"`
+	Message        string `json:"message" form:"message" binding:"required"`
 }
 
 // ChatResponse is returned after a successful AI advisory chat.
 type ChatResponse struct {
-	Reply string `json:"reply"`
+	Reply          string `json:"reply"`
+	ConversationID string `json:"conversationId"`
 }
@@ -0,0 +1,73 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Conversation topics a farmer can file a thread under.
+const (
+	TopicGeneral    = "general"
+	TopicCrops      = "crops"
+	TopicSoil       = "soil"
+	TopicPests      = "pests"
+	TopicIrrigation = "irrigation"
+	TopicWeather    = "weather"
+	TopicMarket     = "market"
+	TopicSchemes    = "schemes"
+	TopicLivestock  = "livestock"
+)
+
+// ConversationTopics lists the valid conversation topics, in display order.
+var ConversationTopics = []string{
+	TopicGeneral, TopicCrops, TopicSoil, TopicPests, TopicIrrigation,
+	TopicWeather, TopicMarket, TopicSchemes, TopicLivestock,
+}
+
+// IsValidConversationTopic reports whether topic is one of ConversationTopics.
+func IsValidConversationTopic(topic string) bool {
+	for _, t := range ConversationTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Conversation is a chat thread between a farmer and the advisory AI. Every message in
+// the thread carries its ID; PlotID pins the thread to one of the farmer's plots.
+type Conversation struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	FarmerID      primitive.ObjectID  `json:"farmerId" bson:"farmerId"`
+	Title         string              `json:"title" bson:"title"`
+	Topic         string              `json:"topic" bson:"topic"`
+	PlotID        *primitive.ObjectID `json:"plotId,omitempty" bson:"plotId,omitempty"`
+	MessageCount  int                 `json:"messageCount" bson:"messageCount"`
+	LastMessage   string              `json:"lastMessage,omitempty" bson:"lastMessage,omitempty"` // preview of the latest message
+	LastMessageAt time.Time           `json:"lastMessageAt" bson:"lastMessageAt"`
+	// Summary rolls up the messages up to SummarizedUntil that no longer fit in the
+	// chat history sent to the AI.
+	Summary         string     `json:"summary,omitempty" bson:"summary,omitempty"`
+	SummarizedUntil *time.Time `json:"-" bson:"summarizedUntil,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CreateConversationRequest is the expected input for starting an empty thread.
+// Title defaults to "New conversation" and Topic to TopicGeneral.
+type CreateConversationRequest struct {
+	FarmerID string `json:"farmerId"`
+	Title    string `json:"title"`
+	Topic    string `json:"topic"`
+	PlotID   string `json:"plotId"`
+}
+
+// UpdateConversationRequest is the expected input for renaming a thread or changing its
+// topic. Only present fields change.
+type UpdateConversationRequest struct {
+	Title *string `json:"title"`
+	Topic *string `json:"topic"`
+}
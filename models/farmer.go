@@ -14,28 +14,109 @@ type Location struct {
 	Longitude float64 `json:"longitude" bson:"longitude"`
 }
 
+// NotificationPreferences controls how and about what a farmer wants to be contacted.
+type NotificationPreferences struct {
+	SMS           bool `json:"sms" bson:"sms"`
+	Push          bool `json:"push" bson:"push"`
+	Voice         bool `json:"voice" bson:"voice"` // voice calls / IVR messages
+	WeatherAlerts bool `json:"weatherAlerts" bson:"weatherAlerts"`
+	MarketPrices  bool `json:"marketPrices" bson:"marketPrices"`
+	AdvisoryTips  bool `json:"advisoryTips" bson:"advisoryTips"`
+}
+
+// DefaultNotificationPreferences is what a newly registered farmer starts with.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{SMS: true, Push: true, WeatherAlerts: true, AdvisoryTips: true}
+}
+
 // Farmer represents a registered farmer in the system.
 type Farmer struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name       string             `json:"name" bson:"name"`
-	Phone      string             `json:"phone" bson:"phone"`
-	ProfilePic string             `json:"profilePic,omitempty" bson:"profilePic,omitempty"`
-	Location   Location           `json:"location" bson:"location"`
-	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ID                primitive.ObjectID       `json:"id" bson:"_id,omitempty"`
+	Name              string                   `json:"name" bson:"name"`
+	Phone             string                   `json:"phone" bson:"phone"`
+	ProfilePic        string                   `json:"profilePic,omitempty" bson:"profilePic,omitempty"` // storage key
+	ProfilePicURL     string                   `json:"profilePicUrl,omitempty" bson:"-"`                 // expiring link to the picture; set on responses
+	Location          Location                 `json:"location" bson:"location"`
+	Block             string                   `json:"block,omitempty" bson:"block,omitempty"`       // administrative block, used to assign extension officers
+	District          string                   `json:"district,omitempty" bson:"district,omitempty"` // district the block belongs to
+	State             string                   `json:"state,omitempty" bson:"state,omitempty"`
+	PreferredLanguage string                   `json:"preferredLanguage,omitempty" bson:"preferredLanguage,omitempty"` // one of SupportedLanguages, e.g. "hi"
+	LandSizeAcres     float64                  `json:"landSizeAcres,omitempty" bson:"landSizeAcres,omitempty"`
+	IrrigationSource  string                   `json:"irrigationSource,omitempty" bson:"irrigationSource,omitempty"` // one of IrrigationSources
+	PrimaryCrops      []string                 `json:"primaryCrops,omitempty" bson:"primaryCrops,omitempty"`
+	Notifications     *NotificationPreferences `json:"notifications,omitempty" bson:"notifications,omitempty"` // nil means DefaultNotificationPreferences
+	CreatedAt         time.Time                `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         *time.Time               `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	DeletedAt         *time.Time               `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`   // set when the farmer asked for the account to be deleted
+	PurgeAfter        *time.Time               `json:"purgeAfter,omitempty" bson:"purgeAfter,omitempty"` // end of the grace period; the purge job erases the account after this
+}
+
+// IsDeleted reports whether the farmer has asked for the account to be deleted.
+func (f *Farmer) IsDeleted() bool {
+	return f.DeletedAt != nil
+}
+
+// NotificationSettings returns the farmer's notification preferences, falling back to the
+// defaults for farmers registered before preferences existed.
+func (f *Farmer) NotificationSettings() NotificationPreferences {
+	if f.Notifications == nil {
+		return DefaultNotificationPreferences()
+	}
+	return *f.Notifications
+}
+
+// IrrigationSources lists the accepted values for Farmer.IrrigationSource.
+var IrrigationSources = []string{"rainfed", "canal", "borewell", "open_well", "tank", "river", "drip", "sprinkler", "other"}
+
+// IsValidIrrigationSource reports whether source is one of IrrigationSources.
+func IsValidIrrigationSource(source string) bool {
+	for _, s := range IrrigationSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
 }
 
 // SignupRequest is the expected input for farmer registration.
 type SignupRequest struct {
-	Name      string  `json:"name" binding:"required"`
-	Phone     string  `json:"phone" binding:"required"`
-	OTP       string  `json:"otp" binding:"required"`
-	Latitude  float64 `json:"latitude" binding:"required"`
-	Longitude float64 `json:"longitude" binding:"required"`
+	Name       string  `json:"name" binding:"required"`
+	Phone      string  `json:"phone" binding:"required"`
+	OTP        string  `json:"otp" binding:"required"`
+	Latitude   float64 `json:"latitude" binding:"required"`
+	Longitude  float64 `json:"longitude" binding:"required"`
+	District   string  `json:"district"`
+	Language   string  `json:"preferredLanguage"`
+	DeviceName string  `json:"deviceName"`
+}
+
+// UpdateProfileRequest is the expected input for PATCH /api/me. Only the fields that are
+// present are changed; sending an empty string or list clears an optional field.
+type UpdateProfileRequest struct {
+	Name              *string                        `json:"name"`
+	PreferredLanguage *string                        `json:"preferredLanguage"`
+	State             *string                        `json:"state"`
+	District          *string                        `json:"district"`
+	LandSizeAcres     *float64                       `json:"landSizeAcres"`
+	IrrigationSource  *string                        `json:"irrigationSource"`
+	PrimaryCrops      *[]string                      `json:"primaryCrops"`
+	Notifications     *NotificationPreferencesUpdate `json:"notifications"`
+}
+
+// NotificationPreferencesUpdate changes individual notification settings.
+type NotificationPreferencesUpdate struct {
+	SMS           *bool `json:"sms"`
+	Push          *bool `json:"push"`
+	Voice         *bool `json:"voice"`
+	WeatherAlerts *bool `json:"weatherAlerts"`
+	MarketPrices  *bool `json:"marketPrices"`
+	AdvisoryTips  *bool `json:"advisoryTips"`
 }
 
 // UpdateLocationRequest is the expected input for location updates.
+// FarmerID is optional and must match the authenticated farmer when supplied.
 type UpdateLocationRequest struct {
-	FarmerID  string  `json:"farmerId" binding:"required"`
+	FarmerID  string  `json:"farmerId"`
 	Latitude  float64 `json:"latitude" binding:"required"`
 	Longitude float64 `json:"longitude" binding:"required"`
 }
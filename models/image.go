@@ -0,0 +1,19 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import "time"
+
+// ImageMetadata describes an uploaded photo after the image pipeline has processed it.
+// Stored files carry no EXIF; the capture time and position worth keeping are kept here.
+type ImageMetadata struct {
+	Width          int        `json:"width" bson:"width"` // of the stored image
+	Height         int        `json:"height" bson:"height"`
+	OriginalWidth  int        `json:"originalWidth" bson:"originalWidth"` // as uploaded, upright
+	OriginalHeight int        `json:"originalHeight" bson:"originalHeight"`
+	TakenAt        *time.Time `json:"takenAt,omitempty" bson:"takenAt,omitempty"` // from EXIF, camera clock
+	Latitude       *float64   `json:"latitude,omitempty" bson:"latitude,omitempty"`
+	Longitude      *float64   `json:"longitude,omitempty" bson:"longitude,omitempty"`
+	Sharpness      float64    `json:"sharpness" bson:"sharpness"`   // variance of the Laplacian; higher is sharper
+	Brightness     float64    `json:"brightness" bson:"brightness"` // mean luminance, 0 (black) to 1 (white)
+}
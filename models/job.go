@@ -0,0 +1,39 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job types.
+const (
+	JobTypeSoilAnalysis = "soil_analysis" // re-run the AI analysis of a soil photo; RefID is the sample
+)
+
+// Job statuses.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed" // gave up after MaxAttempts
+)
+
+// Job is a unit of background work. Jobs are kept in MongoDB so they survive restarts and
+// can be shared by several server processes.
+type Job struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type        string             `json:"type" bson:"type"`
+	RefID       primitive.ObjectID `json:"refId" bson:"refId"` // the record the job works on
+	Status      string             `json:"status" bson:"status"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	MaxAttempts int                `json:"maxAttempts" bson:"maxAttempts"`
+	RunAt       time.Time          `json:"runAt" bson:"runAt"`                                 // earliest time of the next attempt
+	LockedUntil *time.Time         `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"` // a running job whose lease expired is picked up again
+	LastError   string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	FinishedAt  *time.Time         `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"` // finished jobs expire after a week
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,32 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+// DefaultLanguage is used when a farmer has not chosen a preferred language.
+const DefaultLanguage = "hi"
+
+// SupportedLanguages maps the language codes farmers can choose (ISO 639-1) to their English names.
+var SupportedLanguages = map[string]string{
+	"hi": "Hindi",
+	"en": "English",
+	"mr": "Marathi",
+	"bn": "Bengali",
+	"gu": "Gujarati",
+	"pa": "Punjabi",
+	"ta": "Tamil",
+	"te": "Telugu",
+	"kn": "Kannada",
+	"ml": "Malayalam",
+	"or": "Odia",
+}
+
+// IsSupportedLanguage reports whether code is one of SupportedLanguages.
+func IsSupportedLanguage(code string) bool {
+	_, ok := SupportedLanguages[code]
+	return ok
+}
+
+// LanguageName returns the English name for a language code, or "" if it is not supported.
+func LanguageName(code string) string {
+	return SupportedLanguages[code]
+}
@@ -0,0 +1,19 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import "time"
+
+// MediaObject is a stored file kept under the SHA-256 hash of its content, shared by every
+// record that stored the same bytes. It is deleted when the last of them lets go of it.
+type MediaObject struct {
+	Key         string     `json:"key" bson:"_id"` // storage key: <subDir>/<sha256><ext>
+	Hash        string     `json:"hash" bson:"hash"`
+	ContentType string     `json:"contentType" bson:"contentType"`
+	Size        int64      `json:"size" bson:"size"`
+	RefCount    int64      `json:"refCount" bson:"refCount"` // records pointing at the object
+	Stored      bool       `json:"stored" bson:"stored"`     // false until the upload finishes, and again once retention removes the file
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt  time.Time  `json:"lastUsedAt" bson:"lastUsedAt"`                     // last time the content was saved
+	DeletingAt  *time.Time `json:"deletingAt,omitempty" bson:"deletingAt,omitempty"` // set while the file is being removed; saves of the same content wait for it
+}
@@ -8,16 +8,45 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// OTP represents an OTP code for a phone number.
+// OTP represents an OTP code for a phone number. The code itself is never stored;
+// only a salted SHA-256 hash of it.
 type OTP struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	Phone     string             `bson:"phone"`
-	Code      string             `bson:"code"`
-	ExpiresAt time.Time          `bson:"expiresAt"`
-	CreatedAt time.Time          `bson:"createdAt"`
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Phone       string             `bson:"phone"`
+	CodeHash    string             `bson:"codeHash"`
+	Salt        string             `bson:"salt"`
+	Attempts    int                `bson:"attempts"`
+	LockedUntil *time.Time         `bson:"lockedUntil,omitempty"`
+	ExpiresAt   time.Time          `bson:"expiresAt"` // TTL index removes the document after this time
+	CreatedAt   time.Time          `bson:"createdAt"`
+}
+
+// OTPRequest records a single send-otp call, used for resend cooldowns and rate limits,
+// along with which SMS provider sent it and the latest delivery receipt.
+type OTPRequest struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty"`
+	Phone             string             `bson:"phone"`
+	IP                string             `bson:"ip"`
+	Provider          string             `bson:"provider,omitempty"`
+	MessageID         string             `bson:"messageId,omitempty"`      // provider's message ID, matched against delivery receipts
+	DeliveryStatus    string             `bson:"deliveryStatus,omitempty"` // pending, sent, delivered, failed or unknown
+	ProviderStatus    string             `bson:"providerStatus,omitempty"` // raw status string from the provider's receipt
+	DeliveryError     string             `bson:"deliveryError,omitempty"`
+	DeliveryUpdatedAt *time.Time         `bson:"deliveryUpdatedAt,omitempty"`
+	CreatedAt         time.Time          `bson:"createdAt"` // TTL index removes the document after 24 hours
 }
 
 // SendOTPRequest is the input for requesting an OTP.
 type SendOTPRequest struct {
 	Phone string `json:"phone" binding:"required"`
 }
+
+// Error codes returned to the app alongside OTP failures so it can show a localized message.
+const (
+	OTPErrInvalid        = "OTP_INVALID"
+	OTPErrExpired        = "OTP_EXPIRED"
+	OTPErrLocked         = "OTP_LOCKED"
+	OTPErrResendCooldown = "OTP_RESEND_COOLDOWN"
+	OTPErrDailyLimit     = "OTP_DAILY_LIMIT"
+	OTPErrIPThrottled    = "OTP_IP_THROTTLED"
+)
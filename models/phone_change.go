@@ -0,0 +1,56 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Phone change request statuses.
+const (
+	PhoneChangePending  = "pending"
+	PhoneChangeApproved = "approved"
+	PhoneChangeRejected = "rejected"
+)
+
+// PhoneChangeRequest is a farmer's request to move their account to a new number when the
+// old SIM is lost. The new number is verified by OTP; an extension officer for the farmer's
+// block (or an admin) approves it after confirming the farmer's identity.
+type PhoneChangeRequest struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	FarmerID   primitive.ObjectID  `json:"farmerId" bson:"farmerId"`
+	FarmerName string              `json:"farmerName" bson:"farmerName"`
+	Block      string              `json:"block,omitempty" bson:"block,omitempty"` // farmer's block when requested, for officer scoping
+	OldPhone   string              `json:"oldPhone" bson:"oldPhone"`
+	NewPhone   string              `json:"newPhone" bson:"newPhone"`
+	Reason     string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	Status     string              `json:"status" bson:"status"`
+	ReviewedBy *primitive.ObjectID `json:"reviewedBy,omitempty" bson:"reviewedBy,omitempty"`
+	ReviewNote string              `json:"reviewNote,omitempty" bson:"reviewNote,omitempty"`
+	ReviewedAt *time.Time          `json:"reviewedAt,omitempty" bson:"reviewedAt,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// ChangePhoneRequest is the expected input for a logged-in farmer who still has the old SIM.
+// Both numbers must be verified with OTPs requested through /api/auth/send-otp.
+type ChangePhoneRequest struct {
+	NewPhone    string `json:"newPhone" binding:"required"`
+	OldPhoneOTP string `json:"oldPhoneOtp" binding:"required"`
+	NewPhoneOTP string `json:"newPhoneOtp" binding:"required"`
+}
+
+// PhoneRecoveryRequest is the expected input for a farmer who can no longer receive SMS on
+// the old number. Only the new number is verified; an officer must approve the change.
+type PhoneRecoveryRequest struct {
+	OldPhone    string `json:"oldPhone" binding:"required"`
+	NewPhone    string `json:"newPhone" binding:"required"`
+	NewPhoneOTP string `json:"newPhoneOtp" binding:"required"`
+	Reason      string `json:"reason"`
+}
+
+// ReviewPhoneChangeRequest is the expected input for approving or rejecting a request.
+type ReviewPhoneChangeRequest struct {
+	Note string `json:"note"`
+}
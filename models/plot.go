@@ -0,0 +1,62 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Where a plot's area came from.
+const (
+	PlotAreaComputed = "computed" // calculated from the polygon boundary
+	PlotAreaDeclared = "declared" // entered by the farmer for a point-only plot
+)
+
+// GeoJSON is a GeoJSON geometry as stored in MongoDB (indexed with 2dsphere).
+type GeoJSON struct {
+	Type        string      `json:"type" bson:"type"` // "Point" or "Polygon"
+	Coordinates interface{} `json:"coordinates" bson:"coordinates"`
+}
+
+// Plot is one field a farmer cultivates. A farmer may have several plots with
+// different soils and crops; soil samples, chats and weather can refer to a plot.
+type Plot struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FarmerID     primitive.ObjectID `json:"farmerId" bson:"farmerId"`
+	Name         string             `json:"name" bson:"name"`
+	Geometry     GeoJSON            `json:"geometry" bson:"geometry"`
+	Centroid     Location           `json:"centroid" bson:"centroid"` // used for weather lookups
+	AreaAcres    float64            `json:"areaAcres" bson:"areaAcres"`
+	AreaHectares float64            `json:"areaHectares" bson:"areaHectares"`
+	AreaSource   string             `json:"areaSource" bson:"areaSource"` // PlotAreaComputed or PlotAreaDeclared
+	Crops        []string           `json:"crops,omitempty" bson:"crops,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// GeometryInput is a GeoJSON geometry as sent by the app, parsed with utils.ParseGeometry.
+type GeometryInput struct {
+	Type        string          `json:"type" binding:"required"`
+	Coordinates json.RawMessage `json:"coordinates" binding:"required"`
+}
+
+// CreatePlotRequest is the expected input for adding a plot.
+// AreaAcres is required for Point geometries and ignored for polygons, whose area is computed.
+type CreatePlotRequest struct {
+	FarmerID  string         `json:"farmerId"`
+	Name      string         `json:"name" binding:"required"`
+	Geometry  *GeometryInput `json:"geometry" binding:"required"`
+	AreaAcres float64        `json:"areaAcres"`
+	Crops     []string       `json:"crops"`
+}
+
+// UpdatePlotRequest is the expected input for editing a plot. Only present fields change.
+type UpdatePlotRequest struct {
+	Name      *string        `json:"name"`
+	Geometry  *GeometryInput `json:"geometry"`
+	AreaAcres *float64       `json:"areaAcres"`
+	Crops     *[]string      `json:"crops"`
+}
@@ -0,0 +1,36 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+// Roles carried in JWT claims. Tokens issued before roles existed have no role
+// claim and are treated as RoleFarmer. Every other role belongs to a staff User.
+const (
+	RoleFarmer           = "farmer"
+	RoleExtensionOfficer = "extension_officer"
+	RoleAgronomist       = "agronomist"
+	RoleAdmin            = "admin"
+)
+
+// StaffRoles lists the roles that can be assigned to staff users.
+var StaffRoles = []string{RoleExtensionOfficer, RoleAgronomist, RoleAdmin}
+
+// IsStaffRole reports whether role is one of StaffRoles.
+func IsStaffRole(role string) bool {
+	for _, r := range StaffRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanActOnBehalfOfFarmer reports whether a role may operate on another farmer's data.
+func CanActOnBehalfOfFarmer(role string) bool {
+	return IsStaffRole(role)
+}
+
+// IsBlockScoped reports whether a role only sees farmers in its own block.
+// Agronomists and admins work across all blocks.
+func IsBlockScoped(role string) bool {
+	return role == RoleExtensionOfficer
+}
@@ -0,0 +1,38 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session represents a logged-in device. Access tokens carry the session ID, and the
+// session holds the hash of the current refresh token so it can be rotated or revoked.
+// A session belongs either to a farmer (FarmerID) or to a staff user (UserID).
+type Session struct {
+	ID                       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FarmerID                 primitive.ObjectID `json:"farmerId,omitempty" bson:"farmerId,omitempty"`
+	UserID                   primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	RefreshTokenHash         string             `json:"-" bson:"refreshTokenHash"`
+	PreviousRefreshTokenHash string             `json:"-" bson:"previousRefreshTokenHash,omitempty"`
+	DeviceName               string             `json:"deviceName" bson:"deviceName"`
+	IP                       string             `json:"ip" bson:"ip"`
+	UserAgent                string             `json:"userAgent" bson:"userAgent"`
+	CreatedAt                time.Time          `json:"createdAt" bson:"createdAt"`
+	LastSeenAt               time.Time          `json:"lastSeenAt" bson:"lastSeenAt"`
+	ExpiresAt                time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt                *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	RevokedReason            string             `json:"-" bson:"revokedReason,omitempty"`
+}
+
+// IsActive reports whether the session can still be used.
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshRequest is the expected input for exchanging a refresh token.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
@@ -3,22 +3,210 @@
 package models
 
 import (
+	"fmt"
+	"regexp"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Soil classes, after the major soil groups of India.
+const (
+	SoilClassAlluvial = "alluvial"
+	SoilClassBlack    = "black"
+	SoilClassRed      = "red"
+	SoilClassLaterite = "laterite"
+	SoilClassArid     = "arid"
+	SoilClassSaline   = "saline"
+	SoilClassPeaty    = "peaty"
+	SoilClassForest   = "forest"
+	SoilClassUnknown  = "unknown"
+)
+
+// SoilClasses lists the valid soil classes.
+var SoilClasses = []string{
+	SoilClassAlluvial, SoilClassBlack, SoilClassRed, SoilClassLaterite,
+	SoilClassArid, SoilClassSaline, SoilClassPeaty, SoilClassForest, SoilClassUnknown,
+}
+
+// SoilClassLabels maps each soil class to its display name.
+var SoilClassLabels = map[string]string{
+	SoilClassAlluvial: "Alluvial Soil",
+	SoilClassBlack:    "Black Soil",
+	SoilClassRed:      "Red Soil",
+	SoilClassLaterite: "Laterite Soil",
+	SoilClassArid:     "Arid (Desert) Soil",
+	SoilClassSaline:   "Saline / Alkaline Soil",
+	SoilClassPeaty:    "Peaty / Marshy Soil",
+	SoilClassForest:   "Forest / Mountain Soil",
+	SoilClassUnknown:  "Unknown",
+}
+
+// SoilTextures are the USDA soil texture classes, plus "unknown".
+var SoilTextures = []string{
+	"sand", "loamy sand", "sandy loam", "loam", "silt loam", "silt",
+	"sandy clay loam", "clay loam", "silty clay loam", "sandy clay", "silty clay", "clay",
+	"unknown",
+}
+
+// Levels of visible organic matter.
+var SoilOrganicMatterLevels = []string{"low", "medium", "high", "unknown"}
+
+// Moisture states of a soil sample.
+var SoilMoistureLevels = []string{"dry", "moist", "wet", "waterlogged", "unknown"}
+
+// Image quality verdicts. A "poor" or "not_soil" photo should be retaken.
+const (
+	ImageQualityGood    = "good"
+	ImageQualityUsable  = "usable"
+	ImageQualityPoor    = "poor"
+	ImageQualityNotSoil = "not_soil"
+)
+
+// SoilImageQualities lists the valid image quality verdicts.
+var SoilImageQualities = []string{ImageQualityGood, ImageQualityUsable, ImageQualityPoor, ImageQualityNotSoil}
+
+// Limits on the free-text parts of a soil analysis.
+const (
+	maxSoilConcerns      = 8
+	maxSoilConcernLength = 200
+	maxSoilColorName     = 60
+)
+
+// munsellPattern matches Munsell-style notations such as "10YR 4/3", "2.5Y 5/2" or "N 3/".
+var munsellPattern = regexp.MustCompile(`^(\d+(\.\d+)?(R|YR|Y|GY|G|BG|B|PB|P|RP) \d+(\.\d+)?/\d+(\.\d+)?|N \d+(\.\d+)?/)$`)
+
+// SoilColor describes the colour of a soil sample.
+type SoilColor struct {
+	Munsell string `json:"munsell,omitempty" bson:"munsell,omitempty"` // Munsell-like notation, e.g. "10YR 4/3"; empty if unsure
+	Name    string `json:"name" bson:"name"`                           // plain colour name, e.g. "dark brown"
+}
+
+// SoilAnalysis is the AI's structured reading of a soil photo.
+type SoilAnalysis struct {
+	SoilClass     string    `json:"soilClass" bson:"soilClass"`   // one of the SoilClass* constants
+	Confidence    float64   `json:"confidence" bson:"confidence"` // 0 to 1
+	Texture       string    `json:"texture" bson:"texture"`       // one of SoilTextures
+	Color         SoilColor `json:"color" bson:"color"`
+	OrganicMatter string    `json:"organicMatter" bson:"organicMatter"` // one of SoilOrganicMatterLevels
+	Moisture      string    `json:"moisture" bson:"moisture"`           // one of SoilMoistureLevels
+	ImageQuality  string    `json:"imageQuality" bson:"imageQuality"`   // one of SoilImageQualities
+	Concerns      []string  `json:"concerns" bson:"concerns"`           // visible problems, e.g. "salt crust on the surface"
+}
+
+// Validate checks that every field holds an allowed value.
+func (a *SoilAnalysis) Validate() error {
+	if !IsValidSoilClass(a.SoilClass) {
+		return fmt.Errorf("soilClass %q is not one of the soil classes", a.SoilClass)
+	}
+	if a.Confidence < 0 || a.Confidence > 1 {
+		return fmt.Errorf("confidence %v must be between 0 and 1", a.Confidence)
+	}
+	if !contains(SoilTextures, a.Texture) {
+		return fmt.Errorf("texture %q is not one of the texture classes", a.Texture)
+	}
+	if a.Color.Munsell != "" && !munsellPattern.MatchString(a.Color.Munsell) {
+		return fmt.Errorf("color.munsell %q is not a Munsell notation like \"10YR 4/3\"", a.Color.Munsell)
+	}
+	if a.Color.Name == "" || utf8.RuneCountInString(a.Color.Name) > maxSoilColorName {
+		return fmt.Errorf("color.name must be 1 to %d characters", maxSoilColorName)
+	}
+	if !contains(SoilOrganicMatterLevels, a.OrganicMatter) {
+		return fmt.Errorf("organicMatter %q is not one of %v", a.OrganicMatter, SoilOrganicMatterLevels)
+	}
+	if !contains(SoilMoistureLevels, a.Moisture) {
+		return fmt.Errorf("moisture %q is not one of %v", a.Moisture, SoilMoistureLevels)
+	}
+	if !contains(SoilImageQualities, a.ImageQuality) {
+		return fmt.Errorf("imageQuality %q is not one of %v", a.ImageQuality, SoilImageQualities)
+	}
+	if a.Concerns == nil {
+		return fmt.Errorf("concerns is required (use [] when there are none)")
+	}
+	if len(a.Concerns) > maxSoilConcerns {
+		return fmt.Errorf("at most %d concerns are allowed", maxSoilConcerns)
+	}
+	for _, concern := range a.Concerns {
+		if concern == "" || utf8.RuneCountInString(concern) > maxSoilConcernLength {
+			return fmt.Errorf("each concern must be 1 to %d characters", maxSoilConcernLength)
+		}
+	}
+	return nil
+}
+
+// IsValidSoilClass checks a soil class against the taxonomy.
+func IsValidSoilClass(class string) bool {
+	_, ok := SoilClassLabels[class]
+	return ok
+}
+
+// Label returns the display name of the analysis' soil class.
+func (a *SoilAnalysis) Label() string {
+	return SoilClassLabels[a.SoilClass]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// States of a soil photo's analysis.
+const (
+	SoilAnalysisPending = "pending" // the AI failed at upload; a background job is retrying
+	SoilAnalysisDone    = "done"
+	SoilAnalysisFailed  = "failed" // the AI could not analyse the photo; Analysis is empty
+)
+
+// LegacyPendingSoilType is the soil type stored, without an analysis status, on records
+// whose analysis failed before failed analyses were retried. Such records are queued for
+// analysis at startup.
+const LegacyPendingSoilType = "Unknown (Pending AI Analysis)"
+
 // SoilData represents an analyzed soil sample from a farmer's land.
 type SoilData struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	FarmerID  primitive.ObjectID `json:"farmerId" bson:"farmerId"`
-	ImagePath string             `json:"imagePath" bson:"imagePath"`
-	SoilType  string             `json:"soilType" bson:"soilType"`
-	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	FarmerID       primitive.ObjectID  `json:"farmerId" bson:"farmerId"`
+	PlotID         *primitive.ObjectID `json:"plotId,omitempty" bson:"plotId,omitempty"` // the field the sample came from, if given
+	ImagePath      string              `json:"imagePath" bson:"imagePath"`               // storage key, named by the content hash; the public URL on records from before keys
+	ImageURL       string              `json:"imageUrl,omitempty" bson:"-"`              // expiring link to the image; set on responses
+	ThumbnailPath  string              `json:"thumbnailPath,omitempty" bson:"thumbnailPath,omitempty"`
+	ThumbnailURL   string              `json:"thumbnailUrl,omitempty" bson:"-"`
+	Photo          *ImageMetadata      `json:"photo,omitempty" bson:"photo,omitempty"`         // empty on records from before the image pipeline
+	SoilType       string              `json:"soilType" bson:"soilType"`                       // display name of the soil class; free text on records from before structured analysis
+	AnalysisStatus string              `json:"analysisStatus" bson:"analysisStatus,omitempty"` // a SoilAnalysis* state; empty on older records
+	Analysis       *SoilAnalysis       `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	AIProvider     string              `json:"aiProvider,omitempty" bson:"aiProvider,omitempty"` // AI provider that analyzed the photo
+
+	// A manual label overrides the AI's soil class; the rest of the analysis is kept.
+	ManualSoilClass string     `json:"manualSoilClass,omitempty" bson:"manualSoilClass,omitempty"`
+	RelabeledBy     string     `json:"relabeledBy,omitempty" bson:"relabeledBy,omitempty"` // user or farmer ID
+	RelabeledAt     *time.Time `json:"relabeledAt,omitempty" bson:"relabeledAt,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// RelabelSoilRequest is the expected input for correcting a sample's soil class by hand.
+type RelabelSoilRequest struct {
+	SoilClass string `json:"soilClass" binding:"required"`
 }
 
-// SoilUploadResponse is returned after a successful soil analysis.
+// SoilUploadResponse is returned after a soil photo is uploaded.
 type SoilUploadResponse struct {
-	SoilType  string `json:"soilType"`
-	ImagePath string `json:"imagePath"`
+	ID              string        `json:"id"`
+	SoilType        string        `json:"soilType"`
+	AnalysisStatus  string        `json:"analysisStatus"`
+	Analysis        *SoilAnalysis `json:"analysis,omitempty"`
+	AnalysisReused  bool          `json:"analysisReused,omitempty"`  // the same photo was analyzed before; its analysis was copied
+	ManualSoilClass string        `json:"manualSoilClass,omitempty"` // copied with a reused analysis that was relabeled by hand
+	ImagePath       string        `json:"imagePath"`
+	ImageURL        string        `json:"imageUrl"`
+	ThumbnailPath   string        `json:"thumbnailPath"`
+	ThumbnailURL    string        `json:"thumbnailUrl"`
+	Photo           ImageMetadata `json:"photo"`
+	PlotID          string        `json:"plotId,omitempty"`
 }
@@ -0,0 +1,56 @@
+// All rights reserved Samyak-Setu
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is a staff member — an extension officer, agronomist or admin.
+// Staff log in with their phone and an OTP like farmers do, but through /api/staff/login.
+type User struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name      string              `json:"name" bson:"name"`
+	Phone     string              `json:"phone" bson:"phone"`
+	Role      string              `json:"role" bson:"role"`
+	Block     string              `json:"block,omitempty" bson:"block,omitempty"`       // administrative block an extension officer covers
+	District  string              `json:"district,omitempty" bson:"district,omitempty"` // district the block belongs to
+	Active    bool                `json:"active" bson:"active"`
+	CreatedBy *primitive.ObjectID `json:"createdBy,omitempty" bson:"createdBy,omitempty"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
+
+// StaffLoginRequest is the expected input for staff login.
+type StaffLoginRequest struct {
+	Phone      string `json:"phone" binding:"required"`
+	OTP        string `json:"otp" binding:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+// CreateUserRequest is the expected input for an admin creating a staff user.
+type CreateUserRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Phone    string `json:"phone" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	Block    string `json:"block"`
+	District string `json:"district"`
+}
+
+// UpdateUserRequest is the expected input for an admin editing a staff user.
+// Only the fields that are present are changed.
+type UpdateUserRequest struct {
+	Name     *string `json:"name"`
+	Role     *string `json:"role"`
+	Block    *string `json:"block"`
+	District *string `json:"district"`
+	Active   *bool   `json:"active"`
+}
+
+// AssignBlockRequest is the expected input for assigning a farmer to a block.
+type AssignBlockRequest struct {
+	Block    string `json:"block" binding:"required"`
+	District string `json:"district"`
+}
@@ -0,0 +1,102 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository stores the audit trail of account changes.
+type AuditRepository struct {
+	db *database.MongoDB
+}
+
+// NewAuditRepository creates a new AuditRepository instance.
+func NewAuditRepository(db *database.MongoDB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Record appends an entry to the audit trail.
+func (r *AuditRepository) Record(ctx context.Context, entry *models.AuditLog) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	entry.CreatedAt = time.Now()
+	result, err := r.db.Collection("audit_logs").InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// List returns audit entries newest first, optionally only those about one farmer or of one action.
+func (r *AuditRepository) List(ctx context.Context, farmerID *primitive.ObjectID, action string, limit, offset int64) ([]models.AuditLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if farmerID != nil {
+		filter["farmerId"] = *farmerID
+	}
+	if action != "" {
+		filter["action"] = action
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := r.db.Collection("audit_logs").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// FindByFarmerID returns every audit entry about a farmer, newest first.
+func (r *AuditRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.AuditLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.db.Collection("audit_logs").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RedactFarmer strips personal details (phone numbers, notes, IPs) from a purged farmer's
+// audit entries. The entries themselves are kept as a record of what happened.
+func (r *AuditRepository) RedactFarmer(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("audit_logs").UpdateMany(ctx,
+		bson.M{"farmerId": farmerID},
+		bson.M{"$unset": bson.M{"details": "", "ip": ""}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
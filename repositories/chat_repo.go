@@ -8,7 +8,10 @@ import (
 
 	"github.com/samyaksetu/backend/database"
 	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // ChatRepository handles all database operations for chat messages.
@@ -22,8 +25,8 @@ func NewChatRepository(db *database.MongoDB) *ChatRepository {
 }
 
 // SaveMessage inserts a single chat message into the database.
-func (r *ChatRepository) SaveMessage(msg *models.ChatMessage) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *ChatRepository) SaveMessage(ctx context.Context, msg *models.ChatMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	msg.CreatedAt = time.Now()
@@ -35,3 +38,117 @@ func (r *ChatRepository) SaveMessage(msg *models.ChatMessage) error {
 	msg.ID = result.InsertedID.(primitive.ObjectID)
 	return nil
 }
+
+// FindByFarmerID returns a farmer's whole chat history, oldest first.
+func (r *ChatRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.ChatMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.db.Collection("chat_messages").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ChatMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// DeleteByFarmerID removes a farmer's whole chat history.
+func (r *ChatRepository) DeleteByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("chat_messages").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ListByConversation returns up to limit messages of a conversation, newest first,
+// starting after the given cursor (nil for the latest messages).
+func (r *ChatRepository) ListByConversation(ctx context.Context, conversationID primitive.ObjectID, after *utils.Cursor, limit int64) ([]models.ChatMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"conversationId": conversationID}
+	if after != nil {
+		filter["$or"] = cursorFilter("createdAt", after)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := r.db.Collection("chat_messages").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ChatMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListSince returns up to limit messages of a conversation created after since (all messages
+// when since is nil), newest first.
+func (r *ChatRepository) ListSince(ctx context.Context, conversationID primitive.ObjectID, since *time.Time, limit int64) ([]models.ChatMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"conversationId": conversationID}
+	if since != nil {
+		filter["createdAt"] = bson.M{"$gt": *since}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := r.db.Collection("chat_messages").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ChatMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// FindAudioPathsByConversation lists the stored audio files of a conversation's messages.
+func (r *ChatRepository) FindAudioPathsByConversation(ctx context.Context, conversationID primitive.ObjectID) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	values, err := r.db.Collection("chat_messages").Distinct(ctx, "audioPath",
+		bson.M{"conversationId": conversationID, "audioPath": bson.M{"$gt": ""}})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(values))
+	for _, v := range values {
+		if path, ok := v.(string); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// DeleteByConversation removes all messages of a conversation.
+func (r *ChatRepository) DeleteByConversation(ctx context.Context, conversationID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("chat_messages").DeleteMany(ctx, bson.M{"conversationId": conversationID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,204 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// conversationPreviewLength caps the lastMessage preview stored on a conversation.
+const conversationPreviewLength = 120
+
+// ConversationRepository handles all database operations for chat conversations.
+type ConversationRepository struct {
+	db *database.MongoDB
+}
+
+// NewConversationRepository creates a new ConversationRepository instance.
+func NewConversationRepository(db *database.MongoDB) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+// Create inserts a new, empty conversation.
+func (r *ConversationRepository) Create(ctx context.Context, conv *models.Conversation) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	conv.CreatedAt = now
+	conv.UpdatedAt = now
+	conv.LastMessageAt = now
+	result, err := r.db.Collection("conversations").InsertOne(ctx, conv)
+	if err != nil {
+		return err
+	}
+
+	conv.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID retrieves a conversation by its ObjectID.
+func (r *ConversationRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var conv models.Conversation
+	err := r.db.Collection("conversations").FindOne(ctx, bson.M{"_id": id}).Decode(&conv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conv, nil
+}
+
+// ListByFarmer returns up to limit of a farmer's conversations, most recently active first,
+// starting after the given cursor (nil for the first page). A non-nil plotID keeps only
+// threads about that plot.
+func (r *ConversationRepository) ListByFarmer(ctx context.Context, farmerID primitive.ObjectID, plotID *primitive.ObjectID, after *utils.Cursor, limit int64) ([]models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"farmerId": farmerID}
+	if plotID != nil {
+		filter["plotId"] = *plotID
+	}
+	if after != nil {
+		filter["$or"] = cursorFilter("lastMessageAt", after)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "lastMessageAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := r.db.Collection("conversations").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []models.Conversation{}
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// FindByFarmerID returns all of a farmer's conversations, oldest first.
+func (r *ConversationRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.db.Collection("conversations").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := []models.Conversation{}
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// Update replaces the given fields of a conversation and returns the updated conversation.
+func (r *ConversationRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (*models.Conversation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	var conv models.Conversation
+	err := r.db.Collection("conversations").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&conv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conv, nil
+}
+
+// RecordMessage bumps a conversation's message count and moves it to the top of the list.
+func (r *ConversationRepository) RecordMessage(ctx context.Context, id primitive.ObjectID, msg *models.ChatMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("conversations").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$inc": bson.M{"messageCount": 1},
+			"$set": bson.M{
+				"lastMessage":   truncateRunes(msg.Message, conversationPreviewLength),
+				"lastMessageAt": msg.CreatedAt,
+				"updatedAt":     time.Now(),
+			},
+		},
+	)
+	return err
+}
+
+// UpdateSummary stores a new running summary covering messages up to until. It only applies
+// if the summary has not moved on since previous was read, so two concurrent roll-ups cannot
+// overwrite each other; it reports whether the summary was stored.
+func (r *ConversationRepository) UpdateSummary(ctx context.Context, id primitive.ObjectID, summary string, until time.Time, previous *time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "summarizedUntil": bson.M{"$exists": false}}
+	if previous != nil {
+		filter["summarizedUntil"] = *previous
+	}
+	result, err := r.db.Collection("conversations").UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"summary": summary, "summarizedUntil": until},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// Delete removes a conversation. Its messages are deleted separately.
+func (r *ConversationRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("conversations").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// DeleteByFarmerID removes all of a farmer's conversations.
+func (r *ConversationRepository) DeleteByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("conversations").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// cursorFilter matches documents that sort after cur in a (field desc, _id desc) order.
+func cursorFilter(field string, cur *utils.Cursor) bson.A {
+	return bson.A{
+		bson.M{field: bson.M{"$lt": cur.Time}},
+		bson.M{field: cur.Time, "_id": bson.M{"$lt": cur.ID}},
+	}
+}
+
+// truncateRunes shortens s to at most n runes, adding an ellipsis when cut.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/samyaksetu/backend/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // FarmerRepository handles all database operations for farmers.
@@ -23,8 +24,8 @@ func NewFarmerRepository(db *database.MongoDB) *FarmerRepository {
 }
 
 // Create inserts a new farmer into the database.
-func (r *FarmerRepository) Create(farmer *models.Farmer) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *FarmerRepository) Create(ctx context.Context, farmer *models.Farmer) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	farmer.CreatedAt = time.Now()
@@ -38,8 +39,8 @@ func (r *FarmerRepository) Create(farmer *models.Farmer) error {
 }
 
 // FindByID retrieves a farmer by their ObjectID.
-func (r *FarmerRepository) FindByID(id primitive.ObjectID) (*models.Farmer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *FarmerRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var farmer models.Farmer
@@ -52,8 +53,8 @@ func (r *FarmerRepository) FindByID(id primitive.ObjectID) (*models.Farmer, erro
 }
 
 // FindByPhone retrieves a farmer by their phone number.
-func (r *FarmerRepository) FindByPhone(phone string) (*models.Farmer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *FarmerRepository) FindByPhone(ctx context.Context, phone string) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var farmer models.Farmer
@@ -66,8 +67,8 @@ func (r *FarmerRepository) FindByPhone(phone string) (*models.Farmer, error) {
 }
 
 // UpdateLocation updates a farmer's GPS coordinates.
-func (r *FarmerRepository) UpdateLocation(id primitive.ObjectID, lat, lng float64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *FarmerRepository) UpdateLocation(ctx context.Context, id primitive.ObjectID, lat, lng float64) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	update := bson.M{
@@ -81,17 +82,197 @@ func (r *FarmerRepository) UpdateLocation(id primitive.ObjectID, lat, lng float6
 	return err
 }
 
-// UpdateProfilePic updates a farmer's profile picture URL.
-func (r *FarmerRepository) UpdateProfilePic(id primitive.ObjectID, picURL string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// UpdateProfilePic updates the storage key of a farmer's profile picture.
+func (r *FarmerRepository) UpdateProfilePic(ctx context.Context, id primitive.ObjectID, picKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	update := bson.M{
 		"$set": bson.M{
-			"profilePic": picURL,
+			"profilePic": picKey,
 		},
 	}
 
 	_, err := r.db.Collection("farmers").UpdateByID(ctx, id, update)
 	return err
 }
+
+// UpdateProfile applies the given field changes to a farmer and returns the updated farmer.
+func (r *FarmerRepository) UpdateProfile(ctx context.Context, id primitive.ObjectID, set bson.M) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	update := bson.M{"$set": set}
+
+	// Empty optional fields are removed rather than stored as zero values
+	unset := bson.M{}
+	for key, value := range set {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				unset[key] = ""
+			}
+		case float64:
+			if v == 0 {
+				unset[key] = ""
+			}
+		case []string:
+			if len(v) == 0 {
+				unset[key] = ""
+			}
+		}
+	}
+	for key := range unset {
+		delete(set, key)
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var farmer models.Farmer
+	err := r.db.Collection("farmers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&farmer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &farmer, nil
+}
+
+// UpdateBlock assigns a farmer to an administrative block (and optionally its district).
+func (r *FarmerRepository) UpdateBlock(ctx context.Context, id primitive.ObjectID, block, district string) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"block": block}
+	if district != "" {
+		set["district"] = district
+	}
+
+	var farmer models.Farmer
+	err := r.db.Collection("farmers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&farmer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &farmer, nil
+}
+
+// List returns farmers sorted by name, optionally only those in the given block,
+// together with the total number of matching farmers. Deleted farmers are left out.
+func (r *FarmerRepository) List(ctx context.Context, block string, limit, offset int64) ([]models.Farmer, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deletedAt": bson.M{"$exists": false}}
+	if block != "" {
+		filter["block"] = block
+	}
+
+	total, err := r.db.Collection("farmers").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := r.db.Collection("farmers").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	farmers := []models.Farmer{}
+	if err := cursor.All(ctx, &farmers); err != nil {
+		return nil, 0, err
+	}
+	return farmers, total, nil
+}
+
+// ChangePhone moves a farmer to a new phone number in a single atomic update. The update only
+// applies while the farmer still has oldPhone, so concurrent changes cannot both win; it
+// returns mongo.ErrNoDocuments otherwise, and a duplicate key error if newPhone is taken.
+func (r *FarmerRepository) ChangePhone(ctx context.Context, id primitive.ObjectID, oldPhone, newPhone string) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var farmer models.Farmer
+	err := r.db.Collection("farmers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "phone": oldPhone},
+		bson.M{"$set": bson.M{"phone": newPhone, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&farmer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &farmer, nil
+}
+
+// SoftDelete marks a farmer as deleted and schedules the purge. It returns mongo.ErrNoDocuments
+// if the farmer does not exist or is already deleted.
+func (r *FarmerRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, purgeAfter time.Time) (*models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var farmer models.Farmer
+	err := r.db.Collection("farmers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "deletedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deletedAt": time.Now(), "purgeAfter": purgeAfter}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&farmer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &farmer, nil
+}
+
+// Restore cancels a pending deletion. It only applies before the purge has started.
+func (r *FarmerRepository) Restore(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("farmers").UpdateOne(ctx,
+		bson.M{"_id": id, "purgeAfter": bson.M{"$gt": time.Now()}},
+		bson.M{"$unset": bson.M{"deletedAt": "", "purgeAfter": ""}},
+	)
+	return err
+}
+
+// FindDueForPurge returns deleted farmers whose grace period ended before now, oldest first.
+func (r *FarmerRepository) FindDueForPurge(ctx context.Context, now time.Time, limit int64) ([]models.Farmer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "purgeAfter", Value: 1}}).SetLimit(limit)
+	cursor, err := r.db.Collection("farmers").Find(ctx, bson.M{"purgeAfter": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	farmers := []models.Farmer{}
+	if err := cursor.All(ctx, &farmers); err != nil {
+		return nil, err
+	}
+	return farmers, nil
+}
+
+// Delete permanently removes a farmer record.
+func (r *FarmerRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("farmers").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,133 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobRepository handles all database operations for the background job queue.
+type JobRepository struct {
+	db *database.MongoDB
+}
+
+// NewJobRepository creates a new JobRepository instance.
+func NewJobRepository(db *database.MongoDB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Enqueue inserts a queued job.
+func (r *JobRepository) Enqueue(ctx context.Context, job *models.Job) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	job.Status = models.JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	result, err := r.db.Collection("jobs").InsertOne(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	job.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ClaimNext atomically takes the job of one of the given types that is due longest, marks
+// it running for lease and counts the attempt. Running jobs whose lease expired — their
+// worker died — are taken too. It returns mongo.ErrNoDocuments when nothing is due.
+func (r *JobRepository) ClaimNext(ctx context.Context, types []string, lease time.Duration) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"type": bson.M{"$in": types},
+		"$or": bson.A{
+			bson.M{"status": models.JobQueued, "runAt": bson.M{"$lte": now}},
+			bson.M{"status": models.JobRunning, "lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": models.JobRunning, "lockedUntil": now.Add(lease), "updatedAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+
+	var job models.Job
+	err := r.db.Collection("jobs").FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "runAt", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Complete marks a job done.
+func (r *JobRepository) Complete(ctx context.Context, id primitive.ObjectID) error {
+	return r.finish(ctx, id, models.JobDone, "")
+}
+
+// Fail marks a job as given up, keeping the last error.
+func (r *JobRepository) Fail(ctx context.Context, id primitive.ObjectID, lastError string) error {
+	return r.finish(ctx, id, models.JobFailed, lastError)
+}
+
+func (r *JobRepository) finish(ctx context.Context, id primitive.ObjectID, status, lastError string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	set := bson.M{"status": status, "finishedAt": now, "updatedAt": now}
+	if lastError != "" {
+		set["lastError"] = lastError
+	}
+	_, err := r.db.Collection("jobs").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set, "$unset": bson.M{"lockedUntil": ""}},
+	)
+	return err
+}
+
+// Retry puts a failed attempt back in the queue to run again at runAt.
+func (r *JobRepository) Retry(ctx context.Context, id primitive.ObjectID, runAt time.Time, lastError string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("jobs").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set":   bson.M{"status": models.JobQueued, "runAt": runAt, "lastError": lastError, "updatedAt": time.Now()},
+			"$unset": bson.M{"lockedUntil": ""},
+		},
+	)
+	return err
+}
+
+// Release puts a job whose attempt was interrupted, e.g. by shutdown, straight back in the
+// queue without counting the attempt.
+func (r *JobRepository) Release(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("jobs").UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set":   bson.M{"status": models.JobQueued, "runAt": time.Now(), "updatedAt": time.Now()},
+			"$inc":   bson.M{"attempts": -1},
+			"$unset": bson.M{"lockedUntil": ""},
+		},
+	)
+	return err
+}
@@ -0,0 +1,200 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MediaRepository handles all database operations for the content-addressed media index.
+type MediaRepository struct {
+	db *database.MongoDB
+}
+
+// NewMediaRepository creates a new MediaRepository instance.
+func NewMediaRepository(db *database.MongoDB) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+// Acquire takes a reference to the object with obj's key, creating its record from obj if
+// there is none yet, and returns the record as it is afterwards. The caller uploads the
+// content when the returned record is not Stored.
+func (r *MediaRepository) Acquire(ctx context.Context, obj *models.MediaObject) (*models.MediaObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	update := bson.M{
+		"$inc": bson.M{"refCount": 1},
+		"$set": bson.M{"lastUsedAt": now},
+		"$setOnInsert": bson.M{
+			"hash":        obj.Hash,
+			"contentType": obj.ContentType,
+			"size":        obj.Size,
+			"stored":      false,
+			"createdAt":   now,
+		},
+	}
+
+	var acquired models.MediaObject
+	err := r.db.Collection("media_objects").FindOneAndUpdate(ctx, bson.M{"_id": obj.Key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&acquired)
+	if err != nil {
+		return nil, err
+	}
+
+	return &acquired, nil
+}
+
+// FindByKey retrieves an object's record, or nil if the key is not in the index.
+func (r *MediaRepository) FindByKey(ctx context.Context, key string) (*models.MediaObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var obj models.MediaObject
+	err := r.db.Collection("media_objects").FindOne(ctx, bson.M{"_id": key}).Decode(&obj)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &obj, nil
+}
+
+// MarkStored records that the object's content has been uploaded. It also clears the mark
+// of a removal that was abandoned before it finished.
+func (r *MediaRepository) MarkStored(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("media_objects").UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$set":   bson.M{"stored": true},
+			"$unset": bson.M{"deletingAt": ""},
+		},
+	)
+	return err
+}
+
+// Release drops a reference to an object and returns the record as it is afterwards, or nil
+// if the key is not in the index.
+func (r *MediaRepository) Release(ctx context.Context, key string) (*models.MediaObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var released models.MediaObject
+	err := r.db.Collection("media_objects").FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{"$inc": bson.M{"refCount": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&released)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &released, nil
+}
+
+// BeginDelete marks an object's file as being removed if nothing refers to it any more and
+// no removal is under way. It reports whether the object was marked; a reference taken in
+// the meantime keeps the file. Saves of the same content wait until FinishDelete.
+func (r *MediaRepository) BeginDelete(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("media_objects").UpdateOne(ctx,
+		bson.M{"_id": key, "refCount": bson.M{"$lte": 0}, "deletingAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"stored": false, "deletingAt": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// FinishDelete ends the removal of an object's file: the record is removed if nothing refers
+// to it, and otherwise kept, not stored, for the saves that took a reference meanwhile.
+func (r *MediaRepository) FinishDelete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("media_objects").DeleteOne(ctx, bson.M{
+		"_id":      key,
+		"refCount": bson.M{"$lte": 0},
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount > 0 {
+		return nil
+	}
+
+	_, err = r.db.Collection("media_objects").UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$unset": bson.M{"deletingAt": ""}},
+	)
+	return err
+}
+
+// FindUnusedSince retrieves up to limit stored objects whose key starts with prefix and
+// whose content was last saved before cutoff.
+func (r *MediaRepository) FindUnusedSince(ctx context.Context, prefix string, cutoff time.Time, limit int64) ([]models.MediaObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.db.Collection("media_objects").Find(ctx,
+		bson.M{
+			"_id":        bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+			"stored":     true,
+			"lastUsedAt": bson.M{"$lt": cutoff},
+		},
+		options.Find().SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var objects []models.MediaObject
+	if err := cursor.All(ctx, &objects); err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// MarkExpired marks an object's file as being removed by retention, as long as its content
+// has still not been saved again since cutoff. It reports whether the record was changed.
+// References are kept, so saving the same content again uploads it afresh once
+// FinishDelete has run.
+func (r *MediaRepository) MarkExpired(ctx context.Context, key string, cutoff time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("media_objects").UpdateOne(ctx,
+		bson.M{"_id": key, "stored": true, "lastUsedAt": bson.M{"$lt": cutoff}},
+		bson.M{"$set": bson.M{"stored": false, "deletingAt": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
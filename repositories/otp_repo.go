@@ -4,67 +4,389 @@ package repositories
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/samyaksetu/backend/database"
 	"github.com/samyaksetu/backend/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// OTPError describes why an OTP could not be issued or verified.
+// Code is one of the models.OTPErr* constants and is safe to show to the app.
+type OTPError struct {
+	Code         string
+	Message      string
+	RetryAfter   time.Duration // set when the caller must wait before trying again
+	AttemptsLeft int           // set for OTPErrInvalid
+}
+
+func (e *OTPError) Error() string {
+	return e.Message
+}
+
 // OTPRepository handles database operations for OTP verification.
 type OTPRepository struct {
-	db *database.MongoDB
+	db          *database.MongoDB
+	codeTTL     time.Duration
+	maxAttempts int
+	lockout     time.Duration
 }
 
-// NewOTPRepository creates a new OTP repository and ensures index for expiry.
-func NewOTPRepository(db *database.MongoDB) *OTPRepository {
+// NewOTPRepository creates a new OTP repository.
+// After maxAttempts wrong guesses the phone is locked out for the lockout duration.
+func NewOTPRepository(db *database.MongoDB, codeTTL time.Duration, maxAttempts int, lockout time.Duration) *OTPRepository {
 	return &OTPRepository{
-		db: db,
+		db:          db,
+		codeTTL:     codeTTL,
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
 	}
 }
 
-// SaveOTP stores the OTP code with a 5-minute expiration time.
-func (r *OTPRepository) SaveOTP(phone, code string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// CodeTTL returns how long a freshly issued OTP stays valid.
+func (r *OTPRepository) CodeTTL() time.Duration {
+	return r.codeTTL
+}
+
+// SaveOTP stores a salted hash of the OTP code, replacing any previous code for the phone.
+// Returns an OTPError if the phone is currently locked out.
+func (r *OTPRepository) SaveOTP(ctx context.Context, phone, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	if locked, err := r.findLock(ctx, phone); err != nil {
+		return err
+	} else if locked != nil {
+		return lockedError(*locked.LockedUntil)
+	}
+
 	// Delete any existing OTP for this phone number to avoid duplicates
 	_, _ = r.db.Collection("otp_codes").DeleteMany(ctx, bson.M{"phone": phone})
 
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate OTP salt: %w", err)
+	}
+
+	now := time.Now()
 	otp := models.OTP{
 		Phone:     phone,
-		Code:      code,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(5 * time.Minute),
+		CodeHash:  hashOTP(salt, code),
+		Salt:      hex.EncodeToString(salt),
+		CreatedAt: now,
+		ExpiresAt: now.Add(r.codeTTL),
 	}
 
 	_, err := r.db.Collection("otp_codes").InsertOne(ctx, otp)
 	return err
 }
 
-// VerifyOTP checks if the supplied code is valid and unexpired for the phone number.
-func (r *OTPRepository) VerifyOTP(phone, code string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// VerifyOTP checks the supplied code against the stored hash for the phone number and
+// consumes it on success. Every guess uses up one of maxAttempts; once they are gone the
+// phone is locked out. Errors that the app should show are returned as *OTPError.
+func (r *OTPRepository) VerifyOTP(ctx context.Context, phone, code string) error {
+	id, err := r.CheckOTP(ctx, phone, code)
+	if err != nil {
+		return err
+	}
+	return r.ConsumeOTP(ctx, id)
+}
+
+// CheckOTP reserves an attempt on the phone's latest code and compares the guess with it.
+// It returns the ID of the matching code without consuming it, for callers that need
+// several codes to be right before using any of them up; they must call ConsumeOTP.
+func (r *OTPRepository) CheckOTP(ctx context.Context, phone, code string) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
 	var otp models.OTP
-	err := r.db.Collection("otp_codes").FindOne(ctx, bson.M{
-		"phone":     phone,
-		"code":      code,
-		"expiresAt": bson.M{"$gt": time.Now()}, // Ensure not expired
-	}).Decode(&otp)
+	err := r.db.Collection("otp_codes").FindOne(ctx, bson.M{"phone": phone}, opts).Decode(&otp)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return primitive.NilObjectID, &OTPError{Code: models.OTPErrExpired, Message: "OTP has expired or was never requested. Please request a new OTP."}
+		}
+		return primitive.NilObjectID, err
+	}
 
+	now := time.Now()
+	switch otpStateAt(&otp, now, r.maxAttempts) {
+	case otpLocked:
+		return primitive.NilObjectID, lockedError(*otp.LockedUntil)
+	case otpExpired:
+		return primitive.NilObjectID, expiredError()
+	case otpExhausted:
+		return primitive.NilObjectID, r.lock(ctx, otp.ID, now)
+	}
+
+	// Take one attempt before looking at the guess. The filter only matches while attempts
+	// are left, so parallel guesses can never compare more than maxAttempts codes.
+	var reserved models.OTP
+	err = r.db.Collection("otp_codes").FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":         otp.ID,
+			"attempts":    bson.M{"$lt": r.maxAttempts},
+			"lockedUntil": bson.M{"$exists": false},
+			"expiresAt":   bson.M{"$gt": now},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reserved)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return errors.New("invalid or expired OTP")
+			// Parallel guesses used up the attempts since the code was read
+			return primitive.NilObjectID, r.lock(ctx, otp.ID, now)
 		}
-		return err
+		return primitive.NilObjectID, err
 	}
 
-	// Delete OTP after successful verification so it can't be reused
-	_, _ = r.db.Collection("otp_codes").DeleteOne(ctx, bson.M{"_id": otp.ID})
+	matched, err := otpMatches(&reserved, code)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if matched {
+		return reserved.ID, nil
+	}
+	if otpStateAt(&reserved, now, r.maxAttempts) == otpExhausted {
+		return primitive.NilObjectID, r.lock(ctx, reserved.ID, now)
+	}
+	return primitive.NilObjectID, &OTPError{
+		Code:         models.OTPErrInvalid,
+		Message:      "Invalid OTP",
+		AttemptsLeft: r.maxAttempts - reserved.Attempts,
+	}
+}
+
+// ConsumeOTP deletes a checked code so it can't be reused. Only one caller can delete it,
+// so of two parallel correct submissions the second fails.
+func (r *OTPRepository) ConsumeOTP(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
+	result, err := r.db.Collection("otp_codes").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return &OTPError{Code: models.OTPErrExpired, Message: "OTP has already been used. Please request a new OTP."}
+	}
 	return nil
 }
+
+// lock locks the phone out after its attempts ran out and returns the error to show.
+// Returns an expired error if the code is gone, e.g. consumed by a parallel correct guess.
+func (r *OTPRepository) lock(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	lockedUntil := now.Add(r.lockout)
+	// Keep the document until the lockout ends so the TTL index doesn't lift it early
+	result, err := r.db.Collection("otp_codes").UpdateOne(ctx,
+		bson.M{"_id": id, "lockedUntil": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"lockedUntil": lockedUntil, "expiresAt": lockedUntil}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// Either a parallel guess set the lock first, or the code no longer exists
+		var otp models.OTP
+		err := r.db.Collection("otp_codes").FindOne(ctx, bson.M{"_id": id}).Decode(&otp)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return expiredError()
+			}
+			return err
+		}
+		if otp.LockedUntil != nil {
+			return lockedError(*otp.LockedUntil)
+		}
+	}
+	return lockedError(lockedUntil)
+}
+
+// RecordRequest logs a send-otp call and returns its ID. The request is recorded before
+// the limits are checked, so it reserves its place: parallel calls each see the others in
+// their counts. The ID is used to drop a refused request and to attach the delivery
+// outcome once the SMS has been handed to a provider.
+func (r *OTPRepository) RecordRequest(ctx context.Context, phone, ip string) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("otp_requests").InsertOne(ctx, models.OTPRequest{
+		Phone:          phone,
+		IP:             ip,
+		DeliveryStatus: "pending",
+		CreatedAt:      time.Now(),
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return result.InsertedID.(primitive.ObjectID), nil
+}
+
+// DeleteRequest removes a recorded request that was refused before any SMS was sent.
+func (r *OTPRepository) DeleteRequest(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("otp_requests").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// MarkRequestSent records which provider accepted the SMS and the message ID it assigned.
+func (r *OTPRepository) MarkRequestSent(ctx context.Context, id primitive.ObjectID, provider, messageID string) error {
+	return r.updateRequest(ctx, bson.M{"_id": id}, bson.M{
+		"provider":       provider,
+		"messageId":      messageID,
+		"deliveryStatus": "sent",
+	})
+}
+
+// MarkRequestFailed records that no provider could send the SMS.
+func (r *OTPRepository) MarkRequestFailed(ctx context.Context, id primitive.ObjectID, reason string) error {
+	return r.updateRequest(ctx, bson.M{"_id": id}, bson.M{
+		"deliveryStatus": "failed",
+		"deliveryError":  reason,
+	})
+}
+
+// UpdateDeliveryStatus applies a provider's delivery receipt to the matching OTP request.
+// Returns false if no request was sent with that provider and message ID.
+func (r *OTPRepository) UpdateDeliveryStatus(ctx context.Context, provider, messageID, status, providerStatus string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	result, err := r.db.Collection("otp_requests").UpdateOne(ctx,
+		bson.M{"provider": provider, "messageId": messageID},
+		bson.M{"$set": bson.M{
+			"deliveryStatus":    status,
+			"providerStatus":    providerStatus,
+			"deliveryUpdatedAt": now,
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *OTPRepository) updateRequest(ctx context.Context, filter, set bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	set["deliveryUpdatedAt"] = time.Now()
+	_, err := r.db.Collection("otp_requests").UpdateOne(ctx, filter, bson.M{"$set": set})
+	return err
+}
+
+// LastRequestAt returns when an OTP was last requested for the phone, not counting the
+// request with ID except, or the zero time.
+func (r *OTPRepository) LastRequestAt(ctx context.Context, phone string, except primitive.ObjectID) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	var req models.OTPRequest
+	err := r.db.Collection("otp_requests").FindOne(ctx, bson.M{"phone": phone, "_id": bson.M{"$ne": except}}, opts).Decode(&req)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return req.CreatedAt, nil
+}
+
+// CountRequestsByPhoneSince counts OTP requests for a phone since the given time.
+func (r *OTPRepository) CountRequestsByPhoneSince(ctx context.Context, phone string, since time.Time) (int64, error) {
+	return r.countRequests(ctx, bson.M{"phone": phone, "createdAt": bson.M{"$gte": since}})
+}
+
+// CountRequestsByIPSince counts OTP requests from an IP address since the given time.
+func (r *OTPRepository) CountRequestsByIPSince(ctx context.Context, ip string, since time.Time) (int64, error) {
+	return r.countRequests(ctx, bson.M{"ip": ip, "createdAt": bson.M{"$gte": since}})
+}
+
+func (r *OTPRepository) countRequests(ctx context.Context, filter bson.M) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return r.db.Collection("otp_requests").CountDocuments(ctx, filter)
+}
+
+// findLock returns the OTP document that currently locks the phone out, if any.
+func (r *OTPRepository) findLock(ctx context.Context, phone string) (*models.OTP, error) {
+	var otp models.OTP
+	err := r.db.Collection("otp_codes").FindOne(ctx, bson.M{
+		"phone":       phone,
+		"lockedUntil": bson.M{"$gt": time.Now()},
+	}).Decode(&otp)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &otp, nil
+}
+
+// hashOTP returns the hex SHA-256 of salt||code.
+func hashOTP(salt []byte, code string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// otpState is where an OTP document stands for the next guess.
+type otpState int
+
+const (
+	otpOpen      otpState = iota // a guess may be made
+	otpLocked                    // the phone is locked out
+	otpExpired                   // the code expired, or its lockout has ended
+	otpExhausted                 // every attempt is used up but the lock is not set yet
+)
+
+// otpStateAt returns the state of otp at now.
+func otpStateAt(otp *models.OTP, now time.Time, maxAttempts int) otpState {
+	switch {
+	case otp.LockedUntil != nil && otp.LockedUntil.After(now):
+		return otpLocked
+	case otp.LockedUntil != nil || !otp.ExpiresAt.After(now):
+		return otpExpired
+	case otp.Attempts >= maxAttempts:
+		return otpExhausted
+	default:
+		return otpOpen
+	}
+}
+
+// otpMatches compares code with the stored hash in constant time.
+func otpMatches(otp *models.OTP, code string) (bool, error) {
+	salt, err := hex.DecodeString(otp.Salt)
+	if err != nil {
+		return false, fmt.Errorf("corrupt OTP salt: %w", err)
+	}
+	return subtle.ConstantTimeCompare([]byte(hashOTP(salt, code)), []byte(otp.CodeHash)) == 1, nil
+}
+
+func expiredError() *OTPError {
+	return &OTPError{Code: models.OTPErrExpired, Message: "OTP has expired. Please request a new OTP."}
+}
+
+func lockedError(until time.Time) *OTPError {
+	return &OTPError{
+		Code:       models.OTPErrLocked,
+		Message:    "Too many wrong OTP attempts. Please try again later.",
+		RetryAfter: time.Until(until),
+	}
+}
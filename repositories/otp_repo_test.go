@@ -0,0 +1,111 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+func newTestOTP(t *testing.T, code string, now time.Time) *models.OTP {
+	t.Helper()
+	salt := []byte("0123456789abcdef")
+	return &models.OTP{
+		Phone:     "9876543210",
+		CodeHash:  hashOTP(salt, code),
+		Salt:      hex.EncodeToString(salt),
+		CreatedAt: now,
+		ExpiresAt: now.Add(5 * time.Minute),
+	}
+}
+
+func TestOTPStateAt(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	tests := []struct {
+		name        string
+		attempts    int
+		lockedUntil *time.Time
+		expiresAt   time.Time
+		want        otpState
+	}{
+		{name: "fresh code", expiresAt: future, want: otpOpen},
+		{name: "one attempt left", attempts: 2, expiresAt: future, want: otpOpen},
+		{name: "attempts used up", attempts: 3, expiresAt: future, want: otpExhausted},
+		{name: "locked", attempts: 3, lockedUntil: &future, expiresAt: future, want: otpLocked},
+		{name: "lockout ended", attempts: 3, lockedUntil: &past, expiresAt: past, want: otpExpired},
+		{name: "expired", expiresAt: past, want: otpExpired},
+		{name: "expires right now", expiresAt: now, want: otpExpired},
+		{name: "expired with attempts used up", attempts: 3, expiresAt: past, want: otpExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			otp := &models.OTP{Attempts: tt.attempts, LockedUntil: tt.lockedUntil, ExpiresAt: tt.expiresAt}
+			if got := otpStateAt(otp, now, 3); got != tt.want {
+				t.Fatalf("otpStateAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTPMatches(t *testing.T) {
+	otp := newTestOTP(t, "123456", time.Now())
+	if ok, err := otpMatches(otp, "123456"); err != nil || !ok {
+		t.Fatalf("otpMatches(right code) = %v, %v", ok, err)
+	}
+	for _, code := range []string{"654321", "12345", "1234567", ""} {
+		if ok, err := otpMatches(otp, code); err != nil || ok {
+			t.Errorf("otpMatches(%q) = %v, %v; want no match", code, ok, err)
+		}
+	}
+
+	otp.Salt = "not hex"
+	if _, err := otpMatches(otp, "123456"); err == nil {
+		t.Error("expected an error for a corrupt salt")
+	}
+}
+
+// TestOTPAttemptTransitions walks a code through the guesses VerifyOTP makes: each guess
+// reserves an attempt while the code is open, and running out of attempts locks the phone.
+func TestOTPAttemptTransitions(t *testing.T) {
+	const maxAttempts = 3
+	now := time.Now()
+	otp := newTestOTP(t, "123456", now)
+
+	// guess mirrors checkOTP on a single document
+	guess := func(code string) otpState {
+		t.Helper()
+		if state := otpStateAt(otp, now, maxAttempts); state != otpOpen {
+			return state
+		}
+		otp.Attempts++
+		ok, err := otpMatches(otp, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok && otpStateAt(otp, now, maxAttempts) == otpExhausted {
+			lockedUntil := now.Add(15 * time.Minute)
+			otp.LockedUntil, otp.ExpiresAt = &lockedUntil, lockedUntil
+		}
+		return otpStateAt(otp, now, maxAttempts)
+	}
+
+	for i := 1; i < maxAttempts; i++ {
+		if state := guess("000001"); state != otpOpen || otp.Attempts != i {
+			t.Fatalf("wrong guess %d: state %v after %d attempts, want open", i, state, otp.Attempts)
+		}
+	}
+	if state := guess("000002"); state != otpLocked {
+		t.Fatalf("last wrong guess: state %v, want locked", state)
+	}
+	if state := guess("123456"); state != otpLocked || otp.Attempts != maxAttempts {
+		t.Fatalf("right code while locked: state %v after %d attempts, want locked with no attempt taken", state, otp.Attempts)
+	}
+
+	if state := otpStateAt(otp, now.Add(16*time.Minute), maxAttempts); state != otpExpired {
+		t.Fatalf("after the lockout: state %v, want expired so a new code is needed", state)
+	}
+}
@@ -0,0 +1,156 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PhoneChangeRepository handles phone change requests awaiting officer approval.
+type PhoneChangeRepository struct {
+	db *database.MongoDB
+}
+
+// NewPhoneChangeRepository creates a new PhoneChangeRepository instance.
+func NewPhoneChangeRepository(db *database.MongoDB) *PhoneChangeRepository {
+	return &PhoneChangeRepository{db: db}
+}
+
+// Create inserts a new pending request. A farmer can only have one pending request at a time;
+// a second one fails with a duplicate key error.
+func (r *PhoneChangeRepository) Create(ctx context.Context, req *models.PhoneChangeRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req.Status = models.PhoneChangePending
+	req.CreatedAt = time.Now()
+	result, err := r.db.Collection("phone_change_requests").InsertOne(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	req.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID retrieves a request by its ObjectID.
+func (r *PhoneChangeRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.PhoneChangeRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var req models.PhoneChangeRequest
+	err := r.db.Collection("phone_change_requests").FindOne(ctx, bson.M{"_id": id}).Decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// List returns requests newest first, optionally filtered by status and block.
+func (r *PhoneChangeRepository) List(ctx context.Context, status, block string, limit, offset int64) ([]models.PhoneChangeRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if block != "" {
+		filter["block"] = block
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := r.db.Collection("phone_change_requests").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []models.PhoneChangeRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// Resolve moves a pending request to approved or rejected and returns the updated request.
+// It returns mongo.ErrNoDocuments if the request does not exist or was already resolved, so
+// two reviewers cannot both act on it.
+func (r *PhoneChangeRepository) Resolve(ctx context.Context, id primitive.ObjectID, status string, reviewerID primitive.ObjectID, note string) (*models.PhoneChangeRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var req models.PhoneChangeRequest
+	err := r.db.Collection("phone_change_requests").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.PhoneChangePending},
+		bson.M{"$set": bson.M{
+			"status":     status,
+			"reviewedBy": reviewerID,
+			"reviewNote": note,
+			"reviewedAt": now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// Reopen puts an approved request back to pending, used when the phone migration fails
+// after the request was claimed.
+func (r *PhoneChangeRepository) Reopen(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("phone_change_requests").UpdateOne(ctx,
+		bson.M{"_id": id, "status": models.PhoneChangeApproved},
+		bson.M{
+			"$set":   bson.M{"status": models.PhoneChangePending},
+			"$unset": bson.M{"reviewedBy": "", "reviewNote": "", "reviewedAt": ""},
+		},
+	)
+	return err
+}
+
+// FindByFarmerID returns all of a farmer's phone change requests, newest first.
+func (r *PhoneChangeRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.PhoneChangeRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.db.Collection("phone_change_requests").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []models.PhoneChangeRequest{}
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// DeleteByFarmerID removes all of a farmer's phone change requests.
+func (r *PhoneChangeRepository) DeleteByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("phone_change_requests").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,122 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PlotRepository handles all database operations for farm plots.
+type PlotRepository struct {
+	db *database.MongoDB
+}
+
+// NewPlotRepository creates a new PlotRepository instance.
+func NewPlotRepository(db *database.MongoDB) *PlotRepository {
+	return &PlotRepository{db: db}
+}
+
+// Create inserts a new plot into the database.
+func (r *PlotRepository) Create(ctx context.Context, plot *models.Plot) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	plot.CreatedAt = now
+	plot.UpdatedAt = now
+	result, err := r.db.Collection("plots").InsertOne(ctx, plot)
+	if err != nil {
+		return err
+	}
+
+	plot.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID retrieves a plot by its ObjectID.
+func (r *PlotRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Plot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var plot models.Plot
+	err := r.db.Collection("plots").FindOne(ctx, bson.M{"_id": id}).Decode(&plot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plot, nil
+}
+
+// FindByFarmerID lists a farmer's plots, oldest first.
+func (r *PlotRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.Plot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.db.Collection("plots").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plots := []models.Plot{}
+	if err := cursor.All(ctx, &plots); err != nil {
+		return nil, err
+	}
+	return plots, nil
+}
+
+// Update replaces the given fields of a plot and returns the updated plot.
+func (r *PlotRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (*models.Plot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	var plot models.Plot
+	err := r.db.Collection("plots").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&plot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plot, nil
+}
+
+// Delete removes a plot.
+func (r *PlotRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("plots").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// IsInvalidGeometryError reports whether MongoDB rejected a plot because its 2dsphere index
+// could not use the geometry (e.g. a self-intersecting polygon).
+func IsInvalidGeometryError(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(16755)
+}
+
+// DeleteByFarmerID removes all of a farmer's plots.
+func (r *PlotRepository) DeleteByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("plots").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,188 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionRepository handles all database operations for login sessions.
+type SessionRepository struct {
+	db *database.MongoDB
+}
+
+// NewSessionRepository creates a new SessionRepository instance.
+func NewSessionRepository(db *database.MongoDB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create inserts a new session into the database.
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	result, err := r.db.Collection("sessions").InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID retrieves a session by its ObjectID.
+func (r *SessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var session models.Session
+	err := r.db.Collection("sessions").FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// FindActiveByFarmerID lists a farmer's sessions that are neither revoked nor expired, newest first.
+func (r *SessionRepository) FindActiveByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.Session, error) {
+	return r.findActive(ctx, bson.M{"farmerId": farmerID})
+}
+
+// FindActiveByUserID lists a staff user's sessions that are neither revoked nor expired, newest first.
+func (r *SessionRepository) FindActiveByUserID(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	return r.findActive(ctx, bson.M{"userId": userID})
+}
+
+func (r *SessionRepository) findActive(ctx context.Context, filter bson.M) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter["revokedAt"] = bson.M{"$exists": false}
+	filter["expiresAt"] = bson.M{"$gt": time.Now()}
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}})
+
+	cursor, err := r.db.Collection("sessions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RotateRefreshToken swaps the session's refresh token hash, but only if the
+// presented hash is still the current one. Returns false when another request
+// rotated the token first or the session was revoked in the meantime.
+func (r *SessionRepository) RotateRefreshToken(ctx context.Context, id primitive.ObjectID, currentHash, newHash, ip string, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":              id,
+		"refreshTokenHash": currentHash,
+		"revokedAt":        bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"refreshTokenHash":         newHash,
+			"previousRefreshTokenHash": currentHash,
+			"ip":                       ip,
+			"lastSeenAt":               time.Now(),
+			"expiresAt":                expiresAt,
+		},
+	}
+
+	result, err := r.db.Collection("sessions").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Touch records that the session was just used from the given IP.
+func (r *SessionRepository) Touch(ctx context.Context, id primitive.ObjectID, ip string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"lastSeenAt": time.Now(),
+			"ip":         ip,
+		},
+	}
+
+	_, err := r.db.Collection("sessions").UpdateByID(ctx, id, update)
+	return err
+}
+
+// Revoke marks a single session as revoked.
+func (r *SessionRepository) Revoke(ctx context.Context, id primitive.ObjectID, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{
+			"revokedAt":     time.Now(),
+			"revokedReason": reason,
+		},
+	}
+
+	_, err := r.db.Collection("sessions").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RevokeAllForFarmer revokes every active session of a farmer and returns how many were revoked.
+func (r *SessionRepository) RevokeAllForFarmer(ctx context.Context, farmerID primitive.ObjectID, reason string) (int64, error) {
+	return r.revokeAll(ctx, bson.M{"farmerId": farmerID}, reason)
+}
+
+// RevokeAllForUser revokes every active session of a staff user and returns how many were revoked.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID, reason string) (int64, error) {
+	return r.revokeAll(ctx, bson.M{"userId": userID}, reason)
+}
+
+func (r *SessionRepository) revokeAll(ctx context.Context, filter bson.M, reason string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter["revokedAt"] = bson.M{"$exists": false}
+	update := bson.M{
+		"$set": bson.M{
+			"revokedAt":     time.Now(),
+			"revokedReason": reason,
+		},
+	}
+
+	result, err := r.db.Collection("sessions").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeleteAllForFarmer removes every session record of a farmer, revoked or not.
+func (r *SessionRepository) DeleteAllForFarmer(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("sessions").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -8,8 +8,10 @@ import (
 
 	"github.com/samyaksetu/backend/database"
 	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -24,8 +26,8 @@ func NewSoilRepository(db *database.MongoDB) *SoilRepository {
 }
 
 // Create inserts a new soil data record into the database.
-func (r *SoilRepository) Create(soil *models.SoilData) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *SoilRepository) Create(ctx context.Context, soil *models.SoilData) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	soil.CreatedAt = time.Now()
@@ -38,18 +40,230 @@ func (r *SoilRepository) Create(soil *models.SoilData) error {
 	return nil
 }
 
-// FindLatestByFarmerID retrieves the most recent soil analysis for a farmer.
-func (r *SoilRepository) FindLatestByFarmerID(farmerID primitive.ObjectID) (*models.SoilData, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// FindByID retrieves a soil sample by its ObjectID.
+func (r *SoilRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var soil models.SoilData
+	err := r.db.Collection("soil_data").FindOne(ctx, bson.M{"_id": id}).Decode(&soil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &soil, nil
+}
+
+// FindLatestByFarmerID retrieves a farmer's most recent soil sample that has a soil type,
+// skipping photos the AI has not analyzed (see analyzedSoilFilter).
+func (r *SoilRepository) FindLatestByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (*models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var soil models.SoilData
+	err := r.db.Collection("soil_data").FindOne(ctx, analyzedSoilFilter(bson.M{"farmerId": farmerID}), opts).Decode(&soil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &soil, nil
+}
+
+// FindLatestByPlotID retrieves the most recent soil sample taken on a plot that has a soil
+// type, skipping photos the AI has not analyzed (see analyzedSoilFilter).
+func (r *SoilRepository) FindLatestByPlotID(ctx context.Context, plotID primitive.ObjectID) (*models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var soil models.SoilData
+	err := r.db.Collection("soil_data").FindOne(ctx, analyzedSoilFilter(bson.M{"plotId": plotID}), opts).Decode(&soil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &soil, nil
+}
+
+// analyzedSoilFilter adds to filter the conditions for a sample with a usable soil type: not
+// the legacy placeholder of a failed analysis, and an analysis that is neither pending nor
+// failed unless the soil class was set by hand.
+func analyzedSoilFilter(filter bson.M) bson.M {
+	filter["soilType"] = bson.M{"$nin": bson.A{"", models.LegacyPendingSoilType}}
+	filter["$or"] = bson.A{
+		bson.M{"analysisStatus": bson.M{"$nin": bson.A{models.SoilAnalysisPending, models.SoilAnalysisFailed}}},
+		bson.M{"manualSoilClass": bson.M{"$nin": bson.A{nil, ""}}},
+	}
+	return filter
+}
+
+// FindAnalyzedByImagePath retrieves the most recent sample of the stored image whose
+// analysis is done. Images are stored under their content hash, so this finds earlier
+// uploads of the same photo, by any farmer.
+func (r *SoilRepository) FindAnalyzedByImagePath(ctx context.Context, imagePath string) (*models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
 
 	var soil models.SoilData
-	err := r.db.Collection("soil_data").FindOne(ctx, bson.M{"farmerId": farmerID}, opts).Decode(&soil)
+	err := r.db.Collection("soil_data").FindOne(ctx, bson.M{
+		"imagePath":      imagePath,
+		"analysisStatus": models.SoilAnalysisDone,
+		"analysis":       bson.M{"$exists": true},
+	}, opts).Decode(&soil)
 	if err != nil {
 		return nil, err
 	}
 
 	return &soil, nil
 }
+
+// FindLegacyPending returns up to limit samples whose analysis failed before failed
+// analyses were retried: their soil type is the legacy placeholder and they have no
+// analysis status.
+func (r *SoilRepository) FindLegacyPending(ctx context.Context, limit int64) ([]models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"soilType":       models.LegacyPendingSoilType,
+		"analysisStatus": bson.M{"$in": bson.A{nil, ""}},
+	}
+	cursor, err := r.db.Collection("soil_data").Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	soils := []models.SoilData{}
+	if err := cursor.All(ctx, &soils); err != nil {
+		return nil, err
+	}
+	return soils, nil
+}
+
+// ListByFarmer returns up to limit of a farmer's soil samples, newest first, starting after
+// the given cursor (nil for the first page). A non-nil plotID keeps only that plot's samples.
+func (r *SoilRepository) ListByFarmer(ctx context.Context, farmerID primitive.ObjectID, plotID *primitive.ObjectID, after *utils.Cursor, limit int64) ([]models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"farmerId": farmerID}
+	if plotID != nil {
+		filter["plotId"] = *plotID
+	}
+	if after != nil {
+		filter["$or"] = cursorFilter("createdAt", after)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := r.db.Collection("soil_data").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	soils := []models.SoilData{}
+	if err := cursor.All(ctx, &soils); err != nil {
+		return nil, err
+	}
+	return soils, nil
+}
+
+// Update sets the given fields of a soil sample.
+func (r *SoilRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("soil_data").UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
+
+// SaveAnalysis stores a finished analysis on a sample. The soil type follows the analysis
+// only while the sample has no manual label; the check and the write are one update, so a
+// relabel made while the analysis ran is never overwritten.
+func (r *SoilRepository) SaveAnalysis(ctx context.Context, id primitive.ObjectID, analysis *models.SoilAnalysis, aiProvider string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("soil_data").UpdateOne(ctx, bson.M{"_id": id}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			// $literal keeps strings in the AI's answer from being read as field paths
+			"analysis":       bson.M{"$literal": analysis},
+			"analysisStatus": models.SoilAnalysisDone,
+			"aiProvider":     bson.M{"$literal": aiProvider},
+			"soilType": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$manualSoilClass", ""}}, ""}},
+				bson.M{"$literal": analysis.Label()},
+				"$soilType",
+			}},
+		}}},
+	})
+	return err
+}
+
+// Relabel sets a manual soil class on a sample and returns the updated sample.
+func (r *SoilRepository) Relabel(ctx context.Context, id primitive.ObjectID, soilClass, by string) (*models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var soil models.SoilData
+	err := r.db.Collection("soil_data").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"manualSoilClass": soilClass,
+			"soilType":        models.SoilClassLabels[soilClass],
+			"relabeledBy":     by,
+			"relabeledAt":     time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&soil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &soil, nil
+}
+
+// Delete removes a soil sample. Its image is deleted separately.
+func (r *SoilRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection("soil_data").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// FindByFarmerID returns all of a farmer's soil analyses, newest first.
+func (r *SoilRepository) FindByFarmerID(ctx context.Context, farmerID primitive.ObjectID) ([]models.SoilData, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.db.Collection("soil_data").Find(ctx, bson.M{"farmerId": farmerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	soils := []models.SoilData{}
+	if err := cursor.All(ctx, &soils); err != nil {
+		return nil, err
+	}
+	return soils, nil
+}
+
+// DeleteByFarmerID removes all of a farmer's soil analyses.
+func (r *SoilRepository) DeleteByFarmerID(ctx context.Context, farmerID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.db.Collection("soil_data").DeleteMany(ctx, bson.M{"farmerId": farmerID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
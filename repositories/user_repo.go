@@ -0,0 +1,114 @@
+// All rights reserved Samyak-Setu
+
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/samyaksetu/backend/database"
+	"github.com/samyaksetu/backend/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserRepository handles all database operations for staff users.
+type UserRepository struct {
+	db *database.MongoDB
+}
+
+// NewUserRepository creates a new UserRepository instance.
+func NewUserRepository(db *database.MongoDB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Create inserts a new staff user into the database.
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	result, err := r.db.Collection("users").InsertOne(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// FindByID retrieves a staff user by their ObjectID.
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := r.db.Collection("users").FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindByPhone retrieves a staff user by their phone number.
+func (r *UserRepository) FindByPhone(ctx context.Context, phone string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := r.db.Collection("users").FindOne(ctx, bson.M{"phone": phone}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// List returns staff users, optionally filtered by role and block, sorted by name.
+func (r *UserRepository) List(ctx context.Context, role, block string) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if role != "" {
+		filter["role"] = role
+	}
+	if block != "" {
+		filter["block"] = block
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.db.Collection("users").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Update applies the given field changes to a staff user and returns the updated user.
+func (r *UserRepository) Update(ctx context.Context, id primitive.ObjectID, set bson.M) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	var user models.User
+	err := r.db.Collection("users").FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
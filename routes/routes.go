@@ -3,15 +3,40 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/samyaksetu/backend/controllers"
 	"github.com/samyaksetu/backend/middlewares"
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/repositories"
 	"github.com/samyaksetu/backend/services"
+	"github.com/samyaksetu/backend/utils"
+)
+
+// Timeouts holds the request budgets for groups of API routes. Default applies to every
+// route not listed in RegisterRoutes' budget table.
+type Timeouts struct {
+	Default time.Duration
+	Chat    time.Duration
+	Stream  time.Duration
+	Voice   time.Duration
+	Soil    time.Duration
+	Export  time.Duration
+}
+
+// Request body limits. Upload routes allow their largest file plus room for the other form
+// fields; every other route takes JSON or no body at all.
+const (
+	maxBodySize      = 1 << 20
+	maxImageBodySize = utils.MaxFileSize + 1<<20
+	maxAudioBodySize = utils.MaxAudioSize + 1<<20
 )
 
 // RegisterRoutes sets up all API routes on the Gin engine.
 func RegisterRoutes(
 	router *gin.Engine,
+	timeouts Timeouts,
 	authCtrl *controllers.AuthController,
 	farmerCtrl *controllers.FarmerController,
 	soilCtrl *controllers.SoilController,
@@ -19,32 +44,134 @@ func RegisterRoutes(
 	weatherCtrl *controllers.WeatherController,
 	samyakAICtrl *controllers.SamyakAIController,
 	voiceCtrl *controllers.VoiceController,
+	sessionCtrl *controllers.SessionController,
+	staffCtrl *controllers.StaffController,
+	adminCtrl *controllers.AdminController,
+	profileCtrl *controllers.ProfileController,
+	plotCtrl *controllers.PlotController,
+	conversationCtrl *controllers.ConversationController,
+	phoneChangeCtrl *controllers.PhoneChangeController,
+	accountCtrl *controllers.AccountController,
+	fileCtrl *controllers.FileController,
 	jwtService *services.JWTService,
+	sessionRepo *repositories.SessionRepository,
 ) {
 	api := router.Group("/api")
+	api.Use(middlewares.MaxBodySize(maxBodySize, map[string]int64{
+		"/api/profile-pic":       maxImageBodySize,
+		"/api/soil/upload":       maxImageBodySize,
+		"/api/chat":              maxImageBodySize,
+		"/api/chat/stream":       maxImageBodySize,
+		"/api/voice/stt":         maxAudioBodySize,
+		"/api/voice/chat":        maxAudioBodySize,
+		"/api/voice/chat/stream": maxAudioBodySize,
+	}))
+	api.Use(middlewares.RequestBudget(timeouts.Default, map[string]time.Duration{
+		"/api/chat":              timeouts.Chat,
+		"/api/samyakai":          timeouts.Chat,
+		"/api/chat/stream":       timeouts.Stream,
+		"/api/samyakai/stream":   timeouts.Stream,
+		"/api/voice/tts":         timeouts.Voice,
+		"/api/voice/stt":         timeouts.Voice,
+		"/api/voice/chat":        timeouts.Voice,
+		"/api/voice/chat/stream": timeouts.Stream,
+		"/api/soil/upload":       timeouts.Soil,
+		"/api/me/export":         timeouts.Export,
+	}))
 	{
 		// ── Public endpoints (no token required) ──
 		api.POST("/auth/send-otp", authCtrl.SendOTP)
 		api.POST("/signup", farmerCtrl.Signup)
 		api.POST("/login", farmerCtrl.Login)
+		api.POST("/auth/refresh", sessionCtrl.Refresh)
+		api.POST("/staff/login", staffCtrl.Login)
+		api.POST("/phone-change/recovery", phoneChangeCtrl.RequestRecovery)
+
+		// ── Provider callbacks (authenticated by SMS_WEBHOOK_SECRET) ──
+		api.POST("/webhooks/sms/:provider", authCtrl.DeliveryReceipt)
 
 		// ── Protected endpoints (JWT token required) ──
 		protected := api.Group("")
-		protected.Use(middlewares.JWTAuth(jwtService))
+		protected.Use(middlewares.JWTAuth(jwtService, sessionRepo))
 		{
-			protected.POST("/logout", farmerCtrl.Logout)
+			protected.POST("/logout", sessionCtrl.Logout)
+			protected.POST("/logout-all", sessionCtrl.LogoutAll)
+			protected.GET("/sessions", sessionCtrl.ListSessions)
+			protected.DELETE("/sessions/:id", sessionCtrl.RevokeSession)
+			protected.GET("/me", profileCtrl.GetMe)
+			protected.PATCH("/me", profileCtrl.UpdateMe)
+			protected.DELETE("/me", accountCtrl.DeleteMe)
+			protected.GET("/me/export", accountCtrl.ExportMe)
+			protected.PUT("/me/phone", phoneChangeCtrl.ChangePhone)
 			protected.PUT("/location", farmerCtrl.UpdateLocation)
 			protected.PUT("/profile-pic", farmerCtrl.UploadProfilePic)
+			protected.POST("/plots", plotCtrl.CreatePlot)
+			protected.GET("/plots", plotCtrl.ListPlots)
+			protected.GET("/plots/:id", plotCtrl.GetPlot)
+			protected.PATCH("/plots/:id", plotCtrl.UpdatePlot)
+			protected.DELETE("/plots/:id", plotCtrl.DeletePlot)
 			protected.POST("/soil/upload", soilCtrl.UploadSoil)
+			protected.GET("/soil", soilCtrl.ListSoil)
+			protected.GET("/soil/:id", soilCtrl.GetSoil)
+			protected.GET("/soil/:id/image", soilCtrl.GetSoilImage)
+			protected.PATCH("/soil/:id", soilCtrl.RelabelSoil)
+			protected.DELETE("/soil/:id", soilCtrl.DeleteSoil)
 			protected.POST("/chat", chatCtrl.Chat)
+			protected.POST("/chat/stream", chatCtrl.ChatStream)
+			protected.POST("/conversations", conversationCtrl.CreateConversation)
+			protected.GET("/conversations", conversationCtrl.ListConversations)
+			protected.GET("/conversations/:id", conversationCtrl.GetConversation)
+			protected.GET("/conversations/:id/messages", conversationCtrl.ListMessages)
+			protected.PATCH("/conversations/:id", conversationCtrl.UpdateConversation)
+			protected.DELETE("/conversations/:id", conversationCtrl.DeleteConversation)
 			protected.GET("/weather", weatherCtrl.GetWeather)
 			protected.POST("/samyakai", samyakAICtrl.Chat)
+			protected.POST("/samyakai/stream", samyakAICtrl.ChatStream)
 			protected.POST("/voice/tts", voiceCtrl.TextToSpeech)
 			protected.POST("/voice/stt", voiceCtrl.SpeechToText)
 			protected.POST("/voice/chat", voiceCtrl.VoiceChat)
+			protected.POST("/voice/chat/stream", voiceCtrl.VoiceChatStream)
+
+			// ── Staff endpoints (extension officers, agronomists, admins) ──
+			staff := protected.Group("/staff")
+			staff.Use(middlewares.RequireRole(models.StaffRoles...))
+			{
+				staff.GET("/farmers", staffCtrl.ListFarmers)
+				staff.GET("/farmers/:id", staffCtrl.GetFarmer)
+			}
+
+			// ── Phone change approvals (extension officers for their block, admins for all) ──
+			phoneChanges := protected.Group("/staff/phone-changes")
+			phoneChanges.Use(middlewares.RequireRole(models.RoleExtensionOfficer, models.RoleAdmin))
+			{
+				phoneChanges.GET("", phoneChangeCtrl.ListRequests)
+				phoneChanges.POST("/:id/approve", phoneChangeCtrl.ApproveRequest)
+				phoneChanges.POST("/:id/reject", phoneChangeCtrl.RejectRequest)
+			}
+
+			// ── Admin endpoints ──
+			admin := protected.Group("/admin")
+			admin.Use(middlewares.RequireRole(models.RoleAdmin))
+			{
+				admin.POST("/users", adminCtrl.CreateUser)
+				admin.GET("/users", adminCtrl.ListUsers)
+				admin.PATCH("/users/:id", adminCtrl.UpdateUser)
+				admin.DELETE("/users/:id", adminCtrl.DeactivateUser)
+				admin.PUT("/farmers/:id/block", adminCtrl.AssignFarmerBlock)
+				admin.GET("/audit-logs", adminCtrl.ListAuditLogs)
+			}
 		}
 	}
 
+	// Stored files, behind signed expiring links instead of API tokens
+	router.GET(services.FilesRoute+"*key", fileCtrl.ServeFile)
+
+	// Public keys for verifying access tokens (used by other SamyakSetu services)
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, jwtService.JWKS())
+	})
+
 	// Health check (always public)
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -0,0 +1,352 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// ErrNoAIProviderAvailable is returned when every provider's circuit breaker is open.
+var ErrNoAIProviderAvailable = errors.New("no AI provider available")
+
+// errCircuitOpen marks a provider that was skipped because its circuit breaker is open.
+var errCircuitOpen = errors.New("circuit open")
+
+// Circuit breaker states.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// BreakerSettings configures the circuit breaker kept for each AI provider. A breaker opens
+// when at least MinRequests of the last Window calls were made and FailureRate of them
+// failed. After OpenFor a single probe call is let through: success closes the breaker,
+// failure opens it again.
+type BreakerSettings struct {
+	Window      int
+	MinRequests int
+	FailureRate float64
+	OpenFor     time.Duration
+}
+
+// AIProvider is an AIService together with the name it was configured under.
+type AIProvider struct {
+	Name    string
+	Service AIService
+}
+
+// circuitBreaker tracks the outcome of recent calls to one provider.
+type circuitBreaker struct {
+	name     string
+	settings BreakerSettings
+
+	mu       sync.Mutex
+	state    string
+	outcomes []bool // ring buffer of recent calls, true = failed
+	next     int
+	count    int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string, settings BreakerSettings) *circuitBreaker {
+	return &circuitBreaker{
+		name:     name,
+		settings: settings,
+		state:    breakerClosed,
+		outcomes: make([]bool, settings.Window),
+	}
+}
+
+// allow reports whether a call may go to the provider. In the half-open state only one
+// probe is in flight at a time.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.settings.OpenFor {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		log.Printf("INFO: AI provider %s circuit half-open — sending a probe", b.name)
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record stores the outcome of a call that allow let through.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.state = breakerClosed
+		b.count, b.next = 0, 0
+		log.Printf("INFO: AI provider %s circuit closed — probe succeeded", b.name)
+		return
+	}
+
+	b.outcomes[b.next] = failed
+	b.next = (b.next + 1) % len(b.outcomes)
+	if b.count < len(b.outcomes) {
+		b.count++
+	}
+	if b.state == breakerClosed && b.count >= b.settings.MinRequests && b.failureRate() >= b.settings.FailureRate {
+		b.open()
+	}
+}
+
+// release gives back a half-open probe slot whose call ended without an outcome, such as
+// a call cancelled by the client.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) failureRate() float64 {
+	failures := 0
+	for i := 0; i < b.count; i++ {
+		if b.outcomes[i] {
+			failures++
+		}
+	}
+	return float64(failures) / float64(b.count)
+}
+
+// open trips the breaker. Callers hold b.mu.
+func (b *circuitBreaker) open() {
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+	b.count, b.next = 0, 0
+	log.Printf("WARN: AI provider %s circuit open — skipping it for %v", b.name, b.settings.OpenFor)
+}
+
+// AIFailoverChain is an AIService that sends each call to the first provider whose circuit
+// breaker allows it, falling back to the next provider when a call fails. The provider that
+// answered is noted in the context's AI provider trace (see WithAIProviderTrace).
+type AIFailoverChain struct {
+	providers []AIProvider
+	breakers  []*circuitBreaker
+}
+
+// NewAIFailoverChain builds a chain over providers, in fallback order.
+func NewAIFailoverChain(providers []AIProvider, settings BreakerSettings) (*AIFailoverChain, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("no AI providers configured")
+	}
+	if settings.Window < 1 {
+		return nil, fmt.Errorf("circuit breaker window must be at least 1, got %d", settings.Window)
+	}
+	// The window only ever holds Window calls, so a larger minimum could never be reached
+	if settings.MinRequests < 1 || settings.MinRequests > settings.Window {
+		return nil, fmt.Errorf("circuit breaker minimum requests must be between 1 and the window (%d), got %d", settings.Window, settings.MinRequests)
+	}
+	if settings.FailureRate <= 0 || settings.FailureRate > 1 {
+		return nil, fmt.Errorf("circuit breaker failure rate must be above 0 and at most 1, got %v", settings.FailureRate)
+	}
+	if settings.OpenFor <= 0 {
+		return nil, fmt.Errorf("circuit breaker open duration must be positive, got %v", settings.OpenFor)
+	}
+
+	chain := &AIFailoverChain{}
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		chain.providers = append(chain.providers, p)
+		chain.breakers = append(chain.breakers, newCircuitBreaker(p.Name, settings))
+		names[i] = p.Name
+	}
+	log.Printf("INFO: AI providers initialized (fallback order: %s)", strings.Join(names, " → "))
+	return chain, nil
+}
+
+// AnalyzeSoilImage sends the image to the first available provider.
+func (c *AIFailoverChain) AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error) {
+	return failover(ctx, c, "soil analysis", func(s AIService) (*models.SoilAnalysis, error) {
+		return s.AnalyzeSoilImage(ctx, imageData, mimeType)
+	})
+}
+
+// GenerateAdvisory sends the prompt to the first available provider.
+func (c *AIFailoverChain) GenerateAdvisory(ctx context.Context, prompt string) (string, error) {
+	return failover(ctx, c, "advisory", func(s AIService) (string, error) {
+		return s.GenerateAdvisory(ctx, prompt)
+	})
+}
+
+// GenerateAdvisoryWithImage sends the prompt and image to the first available provider.
+func (c *AIFailoverChain) GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error) {
+	return failover(ctx, c, "image advisory", func(s AIService) (string, error) {
+		return s.GenerateAdvisoryWithImage(ctx, prompt, imageData, mimeType)
+	})
+}
+
+// GenerateChat sends the conversation to the first available provider.
+func (c *AIFailoverChain) GenerateChat(ctx context.Context, system string, messages []Message) (string, error) {
+	return failover(ctx, c, "chat", func(s AIService) (string, error) {
+		return s.GenerateChat(ctx, system, messages)
+	})
+}
+
+// StreamChat streams the reply from the first available provider. It only falls back while
+// nothing has been streamed: once text has reached the caller the reply is that provider's.
+func (c *AIFailoverChain) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	streamed := false
+	return failover(ctx, c, "chat stream", func(s AIService) (string, error) {
+		reply, err := s.StreamChat(ctx, system, messages, func(delta string) error {
+			streamed = true
+			return onDelta(delta)
+		})
+		if err != nil && streamed {
+			return reply, &streamStartedError{err: err}
+		}
+		return reply, err
+	})
+}
+
+// Close releases providers that hold connections.
+func (c *AIFailoverChain) Close() {
+	for _, p := range c.providers {
+		if closer, ok := p.Service.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
+
+// streamStartedError marks a stream that failed after text was sent to the caller,
+// which must not fall back to another provider.
+type streamStartedError struct {
+	err error
+}
+
+func (e *streamStartedError) Error() string { return e.err.Error() }
+func (e *streamStartedError) Unwrap() error { return e.err }
+
+// failover runs fn against each provider of c in order until one succeeds. Calls cut short
+// by ctx are not held against the provider and are not retried elsewhere.
+func failover[T any](ctx context.Context, c *AIFailoverChain, kind string, fn func(AIService) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+	tried := false
+	for i, p := range c.providers {
+		breaker := c.breakers[i]
+		if !breaker.allow() {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, errCircuitOpen))
+			continue
+		}
+		tried = true
+
+		reply, err := fn(p.Service)
+		if err == nil {
+			breaker.record(false)
+			recordAIProvider(ctx, p.Name)
+			if i > 0 {
+				log.Printf("INFO: AI %s answered by fallback provider %s", kind, p.Name)
+			}
+			return reply, nil
+		}
+
+		var started *streamStartedError
+		if errors.As(err, &started) {
+			// The reply got under way, so the provider did answer; the interruption is
+			// reported to the caller together with the partial text.
+			breaker.record(ctx.Err() == nil)
+			recordAIProvider(ctx, p.Name)
+			return reply, started.err
+		}
+		if ctx.Err() != nil {
+			breaker.release()
+			return zero, err
+		}
+
+		breaker.record(true)
+		log.Printf("WARN: AI provider %s failed for %s: %v", p.Name, kind, err)
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+
+	if !tried {
+		return zero, fmt.Errorf("%w: %w", ErrNoAIProviderAvailable, errors.Join(errs...))
+	}
+	return zero, fmt.Errorf("all AI providers failed: %w", errors.Join(errs...))
+}
+
+// aiProviderTraceKey is the context key of the AI provider trace.
+type aiProviderTraceKey struct{}
+
+// aiProviderTrace notes the providers that answered AI calls made with a context.
+type aiProviderTrace struct {
+	mu        sync.Mutex
+	providers []string // in order of first answer
+	last      string
+}
+
+// WithAIProviderTrace returns a context in which AIFailoverChain notes which provider
+// answered each call. Read it back with AIProvidersUsed.
+func WithAIProviderTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, aiProviderTraceKey{}, &aiProviderTrace{})
+}
+
+// AIProvidersUsed returns the providers that answered AI calls made with ctx, in order of
+// their first answer. It is empty when ctx carries no trace.
+func AIProvidersUsed(ctx context.Context) []string {
+	trace, ok := ctx.Value(aiProviderTraceKey{}).(*aiProviderTrace)
+	if !ok {
+		return nil
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	return append([]string(nil), trace.providers...)
+}
+
+// AIProviderUsed returns the provider that answered the latest AI call made with ctx.
+func AIProviderUsed(ctx context.Context) string {
+	trace, ok := ctx.Value(aiProviderTraceKey{}).(*aiProviderTrace)
+	if !ok {
+		return ""
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	return trace.last
+}
+
+func recordAIProvider(ctx context.Context, name string) {
+	trace, ok := ctx.Value(aiProviderTraceKey{}).(*aiProviderTrace)
+	if !ok {
+		return
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	trace.last = name
+	for _, existing := range trace.providers {
+		if existing == name {
+			return
+		}
+	}
+	trace.providers = append(trace.providers, name)
+}
@@ -0,0 +1,298 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testBreaker = BreakerSettings{Window: 4, MinRequests: 2, FailureRate: 0.5, OpenFor: time.Minute}
+
+// failingAI returns a fake AI whose every chat call fails with err.
+func failingAI(err error) *FakeAIService {
+	ai := NewFakeAIService()
+	ai.Chat.SetFallback(FakeResponse{Err: err})
+	return ai
+}
+
+// answeringAI returns a fake AI whose every chat call is answered with reply.
+func answeringAI(reply string) *FakeAIService {
+	ai := NewFakeAIService()
+	ai.Chat.SetFallback(FakeResponse{Reply: reply})
+	return ai
+}
+
+// brokenStreamAI streams part of a reply and then fails, like a dropped connection.
+type brokenStreamAI struct {
+	*FakeAIService
+}
+
+func (s brokenStreamAI) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	if err := onDelta("partial "); err != nil {
+		return "", err
+	}
+	return "partial ", errors.New("connection reset")
+}
+
+func newTestChain(t *testing.T, services ...AIService) *AIFailoverChain {
+	t.Helper()
+	providers := make([]AIProvider, len(services))
+	for i, s := range services {
+		providers[i] = AIProvider{Name: string(rune('a' + i)), Service: s}
+	}
+	chain, err := NewAIFailoverChain(providers, testBreaker)
+	if err != nil {
+		t.Fatalf("NewAIFailoverChain: %v", err)
+	}
+	return chain
+}
+
+// tripBreaker opens b and, if elapsed, backdates it so that its open period is over.
+func tripBreaker(b *circuitBreaker, elapsed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open()
+	if elapsed {
+		b.openedAt = time.Now().Add(-b.settings.OpenFor)
+	}
+}
+
+func breakerState(b *circuitBreaker) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func TestNewAIFailoverChainValidatesSettings(t *testing.T) {
+	providers := []AIProvider{{Name: "fake", Service: NewFakeAIService()}}
+	tests := []struct {
+		name     string
+		settings BreakerSettings
+		wantErr  string
+	}{
+		{"valid", testBreaker, ""},
+		{"min requests equal to window", BreakerSettings{Window: 4, MinRequests: 4, FailureRate: 0.5, OpenFor: time.Second}, ""},
+		{"empty window", BreakerSettings{Window: 0, MinRequests: 1, FailureRate: 0.5, OpenFor: time.Second}, "window"},
+		{"min requests above window", BreakerSettings{Window: 4, MinRequests: 5, FailureRate: 0.5, OpenFor: time.Second}, "minimum requests"},
+		{"no min requests", BreakerSettings{Window: 4, MinRequests: 0, FailureRate: 0.5, OpenFor: time.Second}, "minimum requests"},
+		{"zero failure rate", BreakerSettings{Window: 4, MinRequests: 2, FailureRate: 0, OpenFor: time.Second}, "failure rate"},
+		{"failure rate above one", BreakerSettings{Window: 4, MinRequests: 2, FailureRate: 1.5, OpenFor: time.Second}, "failure rate"},
+		{"no open duration", BreakerSettings{Window: 4, MinRequests: 2, FailureRate: 0.5}, "open duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAIFailoverChain(providers, tt.settings)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewAIFailoverChain(nil, testBreaker); err == nil {
+		t.Fatal("expected an error without providers")
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	tests := []struct {
+		name        string
+		minRequests int
+		failureRate float64
+		outcomes    []bool // true = failed
+		want        string
+	}{
+		{"below min requests", 2, 0.5, []bool{true}, breakerClosed},
+		{"at min requests and failure rate", 2, 0.5, []bool{true, true}, breakerOpen},
+		{"rate reached exactly", 2, 0.5, []bool{false, true}, breakerOpen},
+		{"rate below threshold", 3, 0.5, []bool{false, false, true}, breakerClosed},
+		{"successes only", 2, 0.5, []bool{false, false, false, false, false, false}, breakerClosed},
+		{"old successes leave the window", 4, 0.75, []bool{false, false, false, false, true, true, true}, breakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := testBreaker
+			settings.MinRequests = tt.minRequests
+			settings.FailureRate = tt.failureRate
+			b := newCircuitBreaker("test", settings)
+			for _, failed := range tt.outcomes {
+				if !b.allow() {
+					t.Fatal("breaker refused a call before the test finished")
+				}
+				b.record(failed)
+			}
+			if got := breakerState(b); got != tt.want {
+				t.Fatalf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name        string
+		probeFailed bool
+		want        string
+	}{
+		{"probe succeeds", false, breakerClosed},
+		{"probe fails", true, breakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker("test", testBreaker)
+			tripBreaker(b, false)
+			if b.allow() {
+				t.Fatal("open breaker allowed a call before OpenFor elapsed")
+			}
+
+			tripBreaker(b, true)
+			if !b.allow() {
+				t.Fatal("breaker refused the probe after OpenFor elapsed")
+			}
+			if b.allow() {
+				t.Fatal("breaker allowed a second call while the probe was in flight")
+			}
+			if got := breakerState(b); got != breakerHalfOpen {
+				t.Fatalf("state = %s, want %s", got, breakerHalfOpen)
+			}
+
+			b.record(tt.probeFailed)
+			if got := breakerState(b); got != tt.want {
+				t.Fatalf("state after probe = %s, want %s", got, tt.want)
+			}
+			if allowed := b.allow(); allowed == tt.probeFailed {
+				t.Fatalf("allow after probe = %v, want %v", allowed, !tt.probeFailed)
+			}
+		})
+	}
+}
+
+func TestFailoverFallsBackAndSkipsOpenBreakers(t *testing.T) {
+	first, second := failingAI(errors.New("quota exceeded")), answeringAI("from b")
+	chain := newTestChain(t, first, second)
+
+	ctx := WithAIProviderTrace(context.Background())
+	reply, err := chain.GenerateAdvisory(ctx, "hello")
+	if err != nil || reply != "from b" {
+		t.Fatalf("GenerateAdvisory = %q, %v; want the fallback's reply", reply, err)
+	}
+	if got := AIProviderUsed(ctx); got != "b" {
+		t.Fatalf("provider used = %q, want b", got)
+	}
+
+	// A second failure opens the first provider's breaker; after that it is not called
+	if _, err := chain.GenerateAdvisory(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GenerateAdvisory(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := len(first.Chat.Calls()); calls != 2 {
+		t.Fatalf("failing provider called %d times, want 2", calls)
+	}
+
+	tripBreaker(chain.breakers[1], false)
+	_, err = chain.GenerateAdvisory(ctx, "hello")
+	if !errors.Is(err, ErrNoAIProviderAvailable) {
+		t.Fatalf("error = %v, want ErrNoAIProviderAvailable", err)
+	}
+}
+
+func TestFailoverAllProvidersFail(t *testing.T) {
+	chain := newTestChain(t, failingAI(errors.New("down")), failingAI(errors.New("also down")))
+	_, err := chain.GenerateAdvisory(context.Background(), "hello")
+	if err == nil || errors.Is(err, ErrNoAIProviderAvailable) {
+		t.Fatalf("error = %v, want the providers' failures", err)
+	}
+	if !strings.Contains(err.Error(), "down") || !strings.Contains(err.Error(), "also down") {
+		t.Fatalf("error = %v, want both failures", err)
+	}
+}
+
+func TestFailoverCancelledCallReleasesProbe(t *testing.T) {
+	slow := NewFakeAIService()
+	slow.Chat.SetFallback(FakeResponse{Reply: "late", Latency: time.Minute})
+	other := answeringAI("from b")
+	chain := newTestChain(t, slow, other)
+	tripBreaker(chain.breakers[0], true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chain.GenerateAdvisory(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if calls := len(other.Chat.Calls()); calls != 0 {
+		t.Fatalf("cancelled call was retried on the next provider (%d calls)", calls)
+	}
+
+	b := chain.breakers[0]
+	if got := breakerState(b); got != breakerHalfOpen {
+		t.Fatalf("state = %s, want %s", got, breakerHalfOpen)
+	}
+	if !b.allow() {
+		t.Fatal("probe slot was not released after the cancelled call")
+	}
+}
+
+func TestFailoverCancelledCallNotCounted(t *testing.T) {
+	slow := NewFakeAIService()
+	slow.Chat.SetFallback(FakeResponse{Reply: "late", Latency: time.Minute})
+	chain := newTestChain(t, slow)
+
+	for i := 0; i < testBreaker.Window; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _ = chain.GenerateAdvisory(ctx, "hello")
+	}
+	if got := breakerState(chain.breakers[0]); got != breakerClosed {
+		t.Fatalf("state = %s, want cancelled calls not to open the breaker", got)
+	}
+}
+
+func TestStreamChatFallback(t *testing.T) {
+	messages := []Message{{Role: MessageRoleUser, Text: "hello"}}
+
+	t.Run("falls back before anything is streamed", func(t *testing.T) {
+		chain := newTestChain(t, failingAI(errors.New("down")), answeringAI("from b"))
+		var got strings.Builder
+		reply, err := chain.StreamChat(context.Background(), "", messages, func(delta string) error {
+			got.WriteString(delta)
+			return nil
+		})
+		if err != nil || reply != "from b" || got.String() != "from b" {
+			t.Fatalf("StreamChat = %q (streamed %q), %v; want the fallback's reply", reply, got.String(), err)
+		}
+	})
+
+	t.Run("no fallback once streamed", func(t *testing.T) {
+		other := answeringAI("from b")
+		chain := newTestChain(t, brokenStreamAI{NewFakeAIService()}, other)
+		ctx := WithAIProviderTrace(context.Background())
+		var got strings.Builder
+		reply, err := chain.StreamChat(ctx, "", messages, func(delta string) error {
+			got.WriteString(delta)
+			return nil
+		})
+		if err == nil || err.Error() != "connection reset" {
+			t.Fatalf("error = %v, want the stream's own error", err)
+		}
+		if reply != "partial " || got.String() != "partial " {
+			t.Fatalf("reply = %q (streamed %q), want only the partial text", reply, got.String())
+		}
+		if calls := len(other.Chat.Calls()); calls != 0 {
+			t.Fatalf("fallback provider called %d times after text was streamed", calls)
+		}
+		if used := AIProviderUsed(ctx); used != "a" {
+			t.Fatalf("provider used = %q, want a", used)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import "fmt"
+
+// normalizeMessages prepares a conversation for providers that require turns to alternate
+// and start with the user: leading assistant turns are dropped and consecutive turns of
+// the same role are merged.
+func normalizeMessages(messages []Message) ([]Message, error) {
+	normalized := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != MessageRoleUser && msg.Role != MessageRoleAssistant {
+			return nil, fmt.Errorf("unknown message role %q", msg.Role)
+		}
+		if len(normalized) == 0 && msg.Role != MessageRoleUser {
+			continue
+		}
+
+		last := len(normalized) - 1
+		if last >= 0 && normalized[last].Role == msg.Role {
+			normalized[last].Text += "\n\n" + msg.Text
+			if len(msg.ImageData) > 0 {
+				normalized[last].ImageData = msg.ImageData
+				normalized[last].MimeType = msg.MimeType
+			}
+			continue
+		}
+		normalized = append(normalized, msg)
+	}
+
+	if len(normalized) == 0 || normalized[len(normalized)-1].Role != MessageRoleUser {
+		return nil, fmt.Errorf("conversation must end with a user message")
+	}
+	return normalized, nil
+}
@@ -0,0 +1,22 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// loadAWSConfig loads the AWS configuration for a region. With an access key pair the keys
+// are used as given; without one the SDK's default credential chain applies (environment,
+// shared config and credentials files, web identity, ECS task role or EC2 instance role).
+func loadAWSConfig(ctx context.Context, region, accessKey, secretKey string) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if accessKey != "" && secretKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
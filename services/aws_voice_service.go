@@ -13,8 +13,6 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/polly"
 	pollyTypes "github.com/aws/aws-sdk-go-v2/service/polly/types"
 	"github.com/aws/aws-sdk-go-v2/service/transcribe"
@@ -30,26 +28,19 @@ type AWSVoiceService struct {
 	s3Region         string
 }
 
-// NewAWSVoiceService initializes a new AWSVoiceService with Polly and Transcribe.
+// NewAWSVoiceService initializes a new AWSVoiceService with Polly and Transcribe. Without an
+// access key pair the default AWS credential chain is used.
 func NewAWSVoiceService(region, accessKey, secretKey, s3BucketName string, storageService StorageService) (*AWSVoiceService, error) {
-	creds := credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
-
 	// Polly uses ap-south-1 (Mumbai) because Kajal Neural voice is widely supported there,
 	// while it throws "engine not supported" in eu-north-1 (Stockholm).
-	pollyCfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion("ap-south-1"),
-		config.WithCredentialsProvider(creds),
-	)
+	pollyCfg, err := loadAWSConfig(context.TODO(), "ap-south-1", accessKey, secretKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config for Polly: %w", err)
 	}
 
 	// Transcribe uses the same region as S3 so it can read the uploaded audio file
 	// from the same bucket without cross-region access issues.
-	transcribeCfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(creds),
-	)
+	transcribeCfg, err := loadAWSConfig(context.TODO(), region, accessKey, secretKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config for Transcribe: %w", err)
 	}
@@ -67,18 +58,44 @@ func NewAWSVoiceService(region, accessKey, secretKey, s3BucketName string, stora
 	}, nil
 }
 
-// TextToSpeech converts text into an MP3 file using Amazon Polly, uploads to S3, and returns the public URL.
-func (s *AWSVoiceService) TextToSpeech(text string) (string, error) {
+// transcribeLanguages maps farmer language preferences to Amazon Transcribe language codes.
+var transcribeLanguages = map[string]transcribeTypes.LanguageCode{
+	"hi": transcribeTypes.LanguageCodeHiIn,
+	"en": transcribeTypes.LanguageCodeEnIn,
+	"mr": transcribeTypes.LanguageCodeMrIn,
+	"bn": transcribeTypes.LanguageCodeBnIn,
+	"gu": transcribeTypes.LanguageCodeGuIn,
+	"pa": transcribeTypes.LanguageCodePaIn,
+	"ta": transcribeTypes.LanguageCodeTaIn,
+	"te": transcribeTypes.LanguageCodeTeIn,
+	"kn": transcribeTypes.LanguageCodeKnIn,
+	"ml": transcribeTypes.LanguageCodeMlIn,
+	"or": transcribeTypes.LanguageCodeOrIn,
+}
+
+// TextToSpeech converts text into an MP3 file using Amazon Polly, uploads to S3, and returns its key.
+func (s *AWSVoiceService) TextToSpeech(ctx context.Context, text, language string) (string, error) {
 	// Kajal is a high-quality Indian Neural voice — sounds like a real person, not robotic.
-	// She can speak Hindi, English, and Hinglish seamlessly.
+	// She can speak Hindi, English, and Hinglish seamlessly. Polly has no neural voices for
+	// other Indian languages yet, so those are read with her Hindi voice.
+	languageCode := pollyTypes.LanguageCodeHiIn
+	switch language {
+	case "en":
+		languageCode = pollyTypes.LanguageCodeEnIn
+	case "", "hi":
+	default:
+		log.Printf("WARN: No Polly voice for language %q — using Hindi", language)
+	}
+
 	input := &polly.SynthesizeSpeechInput{
 		OutputFormat: pollyTypes.OutputFormatMp3,
 		Text:         aws.String(text),
 		VoiceId:      pollyTypes.VoiceIdKajal,
 		Engine:       pollyTypes.EngineNeural,
+		LanguageCode: languageCode,
 	}
 
-	out, err := s.pollyClient.SynthesizeSpeech(context.TODO(), input)
+	out, err := s.pollyClient.SynthesizeSpeech(ctx, input)
 	if err != nil {
 		return "", fmt.Errorf("failed to synthesize speech: %w", err)
 	}
@@ -89,17 +106,19 @@ func (s *AWSVoiceService) TextToSpeech(text string) (string, error) {
 		return "", fmt.Errorf("failed to read audio stream: %w", err)
 	}
 
-	publicURL, err := s.storageService.SaveBytes(audioBytes, "audio/mpeg", ".mp3", "audio")
+	key, err := s.storageService.SaveBytes(ctx, audioBytes, "audio/mpeg", ".mp3", "audio")
 	if err != nil {
 		return "", fmt.Errorf("failed to save audio to storage: %w", err)
 	}
 
-	return publicURL, nil
+	return key, nil
 }
 
 // SpeechToText converts an audio file to text using Amazon Transcribe.
 // It uploads the audio to S3, starts a transcription job, polls for completion, and returns the transcribed text.
-func (s *AWSVoiceService) SpeechToText(audioData []byte, ext string) (string, error) {
+// The farmer's language is added to the auto-detect candidates alongside Hindi and English,
+// since farmers often mix languages.
+func (s *AWSVoiceService) SpeechToText(ctx context.Context, audioData []byte, ext, language string) (string, error) {
 	// 1. Determine content type and media format
 	contentType := "audio/wav"
 	mediaFormat := transcribeTypes.MediaFormatWav
@@ -121,34 +140,48 @@ func (s *AWSVoiceService) SpeechToText(audioData []byte, ext string) (string, er
 	}
 
 	// 2. Upload audio to S3 so Transcribe can access it
-	s3URL, err := s.storageService.SaveBytes(audioData, contentType, ext, "stt-input")
+	key, err := s.storageService.SaveBytes(ctx, audioData, contentType, ext, "stt-input")
 	if err != nil {
 		return "", fmt.Errorf("failed to upload audio to S3: %w", err)
 	}
+	// The recording is the farmer's voice; keep it only as long as Transcribe needs it,
+	// even if the request is cancelled
+	defer func() {
+		if err := s.storageService.Delete(context.WithoutCancel(ctx), key); err != nil {
+			log.Printf("WARN: Failed to delete transcription input %s: %v", key, err)
+		}
+	}()
+	// Transcribe reads the private object directly from the bucket
+	s3URI := fmt.Sprintf("s3://%s/%s", s.s3BucketName, key)
 
 	// 3. Start transcription job with a unique name
 	jobName := fmt.Sprintf("samyak-stt-%d", time.Now().UnixNano())
-	_, err = s.transcribeClient.StartTranscriptionJob(context.TODO(), &transcribe.StartTranscriptionJobInput{
+	_, err = s.transcribeClient.StartTranscriptionJob(ctx, &transcribe.StartTranscriptionJobInput{
 		TranscriptionJobName: aws.String(jobName),
 		Media: &transcribeTypes.Media{
-			MediaFileUri: aws.String(s3URL),
+			MediaFileUri: aws.String(s3URI),
 		},
 		MediaFormat:      mediaFormat,
-		IdentifyLanguage: aws.Bool(true), // Auto-detect Hindi / English
-		LanguageOptions:  []transcribeTypes.LanguageCode{transcribeTypes.LanguageCodeHiIn, transcribeTypes.LanguageCodeEnUs, transcribeTypes.LanguageCodeEnIn},
+		IdentifyLanguage: aws.Bool(true), // Auto-detect among the farmer's language, Hindi and English
+		LanguageOptions:  transcribeLanguageOptions(language),
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to start transcription job: %w", err)
 	}
 
-	log.Printf("INFO: Transcription job started — name=%s", jobName)
+	log.Printf("INFO: Transcription job started — name=%s language=%s", jobName, language)
 
 	// 4. Poll until the job completes (max ~90 seconds)
 	var transcriptURI string
 	for i := 0; i < 30; i++ {
-		time.Sleep(3 * time.Second)
+		select {
+		case <-ctx.Done():
+			s.deleteTranscriptionJob(jobName)
+			return "", fmt.Errorf("transcription cancelled: %w", ctx.Err())
+		case <-time.After(3 * time.Second):
+		}
 
-		result, err := s.transcribeClient.GetTranscriptionJob(context.TODO(), &transcribe.GetTranscriptionJobInput{
+		result, err := s.transcribeClient.GetTranscriptionJob(ctx, &transcribe.GetTranscriptionJobInput{
 			TranscriptionJobName: aws.String(jobName),
 		})
 		if err != nil {
@@ -175,7 +208,11 @@ func (s *AWSVoiceService) SpeechToText(audioData []byte, ext string) (string, er
 	}
 
 	// 5. Download the JSON transcript
-	resp, err := http.Get(transcriptURI)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, transcriptURI, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build transcript request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to download transcript: %w", err)
 	}
@@ -210,9 +247,32 @@ func (s *AWSVoiceService) SpeechToText(audioData []byte, ext string) (string, er
 	log.Printf("INFO: Transcription complete — text_len=%d text=%s", len(text), text)
 
 	// 7. Clean up the transcription job (best effort, don't fail if this errors)
-	_, _ = s.transcribeClient.DeleteTranscriptionJob(context.TODO(), &transcribe.DeleteTranscriptionJobInput{
+	s.deleteTranscriptionJob(jobName)
+
+	return text, nil
+}
+
+// deleteTranscriptionJob removes a finished or abandoned transcription job. It is best effort
+// and runs on its own short deadline so it still happens after the request is cancelled.
+func (s *AWSVoiceService) deleteTranscriptionJob(jobName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, _ = s.transcribeClient.DeleteTranscriptionJob(ctx, &transcribe.DeleteTranscriptionJobInput{
 		TranscriptionJobName: aws.String(jobName),
 	})
+}
 
-	return text, nil
+// transcribeLanguageOptions returns the languages Transcribe should choose between.
+func transcribeLanguageOptions(language string) []transcribeTypes.LanguageCode {
+	options := []transcribeTypes.LanguageCode{transcribeTypes.LanguageCodeHiIn, transcribeTypes.LanguageCodeEnUs, transcribeTypes.LanguageCodeEnIn}
+	if code, ok := transcribeLanguages[language]; ok {
+		for _, existing := range options {
+			if existing == code {
+				return options
+			}
+		}
+		options = append([]transcribeTypes.LanguageCode{code}, options...)
+	}
+	return options
 }
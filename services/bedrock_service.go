@@ -14,6 +14,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/samyaksetu/backend/models"
 )
 
 // BedrockService implements AIService using AWS Bedrock (Amazon Nova).
@@ -50,24 +52,52 @@ func NewBedrockService(region, accessKey, secretKey, sessionToken string) (*Bedr
 	}, nil
 }
 
-// AnalyzeSoilImage sends a soil image to Amazon Nova and returns the soil type.
-func (s *BedrockService) AnalyzeSoilImage(imageData []byte, mimeType string) (string, error) {
-	prompt := `You are an expert agricultural soil scientist. Analyze this soil image and identify the soil type.
-Respond with ONLY the soil type name (e.g., "Clay", "Sandy", "Loamy", "Silt", "Peat", "Chalky", "Red Soil", "Black Soil", "Alluvial Soil", "Laterite Soil").
-If you cannot determine the soil type, respond with "Unknown".
-Do not include any other text or explanation.`
-
-	return s.callVisionWithRetry(prompt, imageData, mimeType, 2)
+// AnalyzeSoilImage sends a soil image to Amazon Nova and returns its structured analysis.
+func (s *BedrockService) AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error) {
+	return analyzeSoil(ctx, func(ctx context.Context, prompt string) (string, error) {
+		return s.callVisionWithRetry(ctx, prompt, imageData, mimeType, 2)
+	})
 }
 
 // GenerateAdvisory calls Amazon Nova text model for agricultural advice.
-func (s *BedrockService) GenerateAdvisory(prompt string) (string, error) {
-	return s.callTextWithRetry(prompt, 2)
+func (s *BedrockService) GenerateAdvisory(ctx context.Context, prompt string) (string, error) {
+	return s.callTextWithRetry(ctx, prompt, 2)
 }
 
 // GenerateAdvisoryWithImage calls Amazon Nova vision model for advice using text + image context.
-func (s *BedrockService) GenerateAdvisoryWithImage(prompt string, imageData []byte, mimeType string) (string, error) {
-	return s.callVisionWithRetry(prompt, imageData, mimeType, 2)
+func (s *BedrockService) GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error) {
+	return s.callVisionWithRetry(ctx, prompt, imageData, mimeType, 2)
+}
+
+// GenerateChat calls Amazon Nova with the conversation so far, for follow-up questions.
+func (s *BedrockService) GenerateChat(ctx context.Context, system string, messages []Message) (string, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return "", err
+	}
+	payload, err := novaChatPayload(system, messages)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := 30 * time.Second
+	if len(messages[len(messages)-1].ImageData) > 0 {
+		timeout = 45 * time.Second
+	}
+	return s.invokeWithRetry(ctx, "chat", payload, timeout, 2)
+}
+
+// StreamChat is GenerateChat delivering Amazon Nova's reply as it is generated.
+func (s *BedrockService) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return "", err
+	}
+	payload, err := novaChatPayload(system, messages)
+	if err != nil {
+		return "", err
+	}
+	return s.invokeStreamWithRetry(ctx, payload, onDelta, 2)
 }
 
 // Close releases any resources if necessary (AWS SDK handles this mostly, but provided to match interface).
@@ -100,7 +130,17 @@ type novaMessage struct {
 }
 
 type novaRequest struct {
-	Messages []novaMessage `json:"messages"`
+	System   []novaTextContent `json:"system,omitempty"`
+	Messages []novaMessage     `json:"messages"`
+}
+
+// novaStreamChunk is one event of a Nova response stream; only text deltas are used.
+type novaStreamChunk struct {
+	ContentBlockDelta struct {
+		Delta struct {
+			Text string `json:"text"`
+		} `json:"delta"`
+	} `json:"contentBlockDelta"`
 }
 
 type novaResponse struct {
@@ -114,7 +154,7 @@ type novaResponse struct {
 }
 
 // callTextWithRetry calls Amazon Nova text API
-func (s *BedrockService) callTextWithRetry(prompt string, maxRetries int) (string, error) {
+func (s *BedrockService) callTextWithRetry(ctx context.Context, prompt string, maxRetries int) (string, error) {
 	reqBody := novaRequest{
 		Messages: []novaMessage{
 			{
@@ -131,16 +171,43 @@ func (s *BedrockService) callTextWithRetry(prompt string, maxRetries int) (strin
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	return s.invokeWithRetry(ctx, "text", payloadInfo, 30*time.Second, maxRetries)
+}
+
+// callVisionWithRetry calls Amazon Nova vision API
+func (s *BedrockService) callVisionWithRetry(ctx context.Context, prompt string, imageData []byte, mimeType string, maxRetries int) (string, error) {
+	reqBody := novaRequest{
+		Messages: []novaMessage{
+			{
+				Role: "user",
+				Content: []interface{}{
+					novaImage(imageData, mimeType),
+					novaTextContent{Text: prompt},
+				},
+			},
+		},
+	}
+
+	payloadInfo, _ := json.Marshal(reqBody)
+
+	return s.invokeWithRetry(ctx, "vision", payloadInfo, 45*time.Second, maxRetries)
+}
+
+// invokeWithRetry sends a Nova request body to Bedrock and returns the reply text.
+// kind ("text", "vision", "chat") only labels logs and errors.
+func (s *BedrockService) invokeWithRetry(ctx context.Context, kind string, payload []byte, timeout time.Duration, maxRetries int) (string, error) {
 	var lastErr error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			log.Printf("INFO: Bedrock text retry attempt %d/%d", attempt, maxRetries)
-			time.Sleep(time.Duration(attempt) * time.Second)
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: Bedrock %s retry attempt %d/%d", kind, attempt, maxRetries)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		output, err := s.client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
-			Body:        payloadInfo,
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		output, err := s.client.InvokeModel(callCtx, &bedrockruntime.InvokeModelInput{
+			Body:        payload,
 			ModelId:     aws.String(s.model),
 			ContentType: aws.String("application/json"),
 			Accept:      aws.String("application/json"),
@@ -148,7 +215,8 @@ func (s *BedrockService) callTextWithRetry(prompt string, maxRetries int) (strin
 		cancel()
 
 		if err != nil {
-			lastErr = fmt.Errorf("bedrock API error: %w", err)
+			lastErr = fmt.Errorf("bedrock %s API error: %w", kind, err)
+			log.Printf("ERROR: bedrock %s error payload %v", kind, err)
 			continue
 		}
 
@@ -165,75 +233,117 @@ func (s *BedrockService) callTextWithRetry(prompt string, maxRetries int) (strin
 		lastErr = fmt.Errorf("bedrock returned empty content response")
 	}
 
-	return "", fmt.Errorf("bedrock failed after %d retries: %w", maxRetries, lastErr)
+	return "", fmt.Errorf("bedrock %s failed after %d retries: %w", kind, maxRetries, lastErr)
 }
 
-// callVisionWithRetry calls Amazon Nova vision API
-func (s *BedrockService) callVisionWithRetry(prompt string, imageData []byte, mimeType string, maxRetries int) (string, error) {
-	format := "png" // default
-	if strings.Contains(mimeType, "jpeg") || strings.Contains(mimeType, "jpg") {
-		format = "jpeg"
-	} else if strings.Contains(mimeType, "webp") {
-		format = "webp"
-	} else if strings.Contains(mimeType, "gif") {
-		format = "gif"
-	}
-
-	reqBody := novaRequest{
-		Messages: []novaMessage{
-			{
-				Role: "user",
-				Content: []interface{}{
-					novaImageContent{
-						Image: novaImageFormat{
-							Format: format,
-							Source: novaImageSource{
-								Bytes: imageData,
-							},
-						},
-					},
-					novaTextContent{Text: prompt},
-				},
-			},
-		},
-	}
-
-	payloadInfo, _ := json.Marshal(reqBody)
-
+// invokeStreamWithRetry streams a Nova reply from Bedrock, passing each text delta to onDelta.
+// Only failures before the first piece of text are retried: once text has reached the
+// caller the reply cannot be restarted.
+func (s *BedrockService) invokeStreamWithRetry(ctx context.Context, payload []byte, onDelta func(string) error, maxRetries int) (string, error) {
 	var lastErr error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
-			log.Printf("INFO: Bedrock vision retry attempt %d/%d", attempt, maxRetries)
-			time.Sleep(time.Duration(attempt) * time.Second)
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: Bedrock stream retry attempt %d/%d", attempt, maxRetries)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
-		output, err := s.client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
-			Body:        payloadInfo,
+		callCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
+		output, err := s.client.InvokeModelWithResponseStream(callCtx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+			Body:        payload,
 			ModelId:     aws.String(s.model),
 			ContentType: aws.String("application/json"),
 			Accept:      aws.String("application/json"),
 		})
-		cancel()
-
 		if err != nil {
-			lastErr = fmt.Errorf("bedrock vision API error: %w", err)
-			log.Printf("ERROR: bedrock vision error payload %v", err)
+			cancel()
+			lastErr = fmt.Errorf("bedrock stream API error: %w", err)
 			continue
 		}
 
-		var response novaResponse
-		if err := json.Unmarshal(output.Body, &response); err != nil {
-			lastErr = fmt.Errorf("failed to decode bedrock response: %w", err)
-			continue
+		stream := output.GetStream()
+		var reply strings.Builder
+		var callbackErr error
+		for event := range stream.Events() {
+			chunk, ok := event.(*types.ResponseStreamMemberChunk)
+			if !ok {
+				continue
+			}
+			var part novaStreamChunk
+			if err := json.Unmarshal(chunk.Value.Bytes, &part); err != nil {
+				continue
+			}
+			delta := part.ContentBlockDelta.Delta.Text
+			if delta == "" {
+				continue
+			}
+			reply.WriteString(delta)
+			if callbackErr = onDelta(delta); callbackErr != nil {
+				break
+			}
 		}
+		stream.Close()
+		streamErr := stream.Err()
+		cancel()
 
-		if len(response.Output.Message.Content) > 0 {
-			return response.Output.Message.Content[0].Text, nil
+		if callbackErr != nil {
+			return reply.String(), callbackErr
+		}
+		if reply.Len() > 0 {
+			if streamErr != nil {
+				return reply.String(), fmt.Errorf("bedrock stream interrupted: %w", streamErr)
+			}
+			return reply.String(), nil
+		}
+		lastErr = fmt.Errorf("bedrock stream returned empty content response")
+		if streamErr != nil {
+			lastErr = fmt.Errorf("bedrock stream error: %w", streamErr)
 		}
+	}
 
-		lastErr = fmt.Errorf("bedrock returned empty content response")
+	return "", fmt.Errorf("bedrock stream failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// novaChatPayload builds the request body for a multi-turn conversation.
+func novaChatPayload(system string, messages []Message) ([]byte, error) {
+	reqBody := novaRequest{Messages: make([]novaMessage, 0, len(messages))}
+	if system != "" {
+		reqBody.System = []novaTextContent{{Text: system}}
+	}
+	for _, msg := range messages {
+		content := []interface{}{}
+		if len(msg.ImageData) > 0 {
+			content = append(content, novaImage(msg.ImageData, msg.MimeType))
+		}
+		content = append(content, novaTextContent{Text: msg.Text})
+		reqBody.Messages = append(reqBody.Messages, novaMessage{Role: msg.Role, Content: content})
+	}
+
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return payload, nil
+}
+
+// novaImage wraps image bytes as a Nova image content block.
+func novaImage(imageData []byte, mimeType string) novaImageContent {
+	format := "png" // default
+	if strings.Contains(mimeType, "jpeg") || strings.Contains(mimeType, "jpg") {
+		format = "jpeg"
+	} else if strings.Contains(mimeType, "webp") {
+		format = "webp"
+	} else if strings.Contains(mimeType, "gif") {
+		format = "gif"
 	}
 
-	return "", fmt.Errorf("bedrock vision failed after %d retries: %w", maxRetries, lastErr)
+	return novaImageContent{
+		Image: novaImageFormat{
+			Format: format,
+			Source: novaImageSource{
+				Bytes: imageData,
+			},
+		},
+	}
 }
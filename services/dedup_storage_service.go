@@ -0,0 +1,211 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// mediaSweepBatch bounds how many expired objects one index query returns.
+const mediaSweepBatch = 500
+
+// A save of content whose file is being removed waits for the removal, checking every
+// mediaDeletePoll. A removal still marked after mediaDeleteWait is taken to have been
+// abandoned, and the save uploads the content anyway.
+const (
+	mediaDeletePoll = 200 * time.Millisecond
+	mediaDeleteWait = time.Minute
+)
+
+// MediaIndex keeps the reference counts of content-addressed files. It is implemented by
+// repositories.MediaRepository.
+type MediaIndex interface {
+	Acquire(ctx context.Context, obj *models.MediaObject) (*models.MediaObject, error)
+	FindByKey(ctx context.Context, key string) (*models.MediaObject, error)
+	MarkStored(ctx context.Context, key string) error
+	Release(ctx context.Context, key string) (*models.MediaObject, error)
+	BeginDelete(ctx context.Context, key string) (bool, error)
+	FinishDelete(ctx context.Context, key string) error
+	FindUnusedSince(ctx context.Context, prefix string, cutoff time.Time, limit int64) ([]models.MediaObject, error)
+	MarkExpired(ctx context.Context, key string, cutoff time.Time) (bool, error)
+}
+
+// DedupStorageService stores files under the SHA-256 hash of their content, so saving the
+// same bytes twice — a retried upload, speech generated again for the same text — reuses
+// the stored file. Every save takes a reference and every Delete drops one; the file is
+// removed with its last reference; saves of the same content meanwhile wait for the removal
+// and upload the file again. Files saved before content addressing are not in the index and
+// are deleted directly. Reads and links are passed through.
+type DedupStorageService struct {
+	StorageService
+	index MediaIndex
+}
+
+// NewDedupStorageService wraps storage so that files are stored once per content.
+func NewDedupStorageService(storage StorageService, index MediaIndex) *DedupStorageService {
+	return &DedupStorageService{StorageService: storage, index: index}
+}
+
+// SaveBytes stores raw bytes under their content hash and returns the key. Content that is
+// already stored is not uploaded again.
+func (s *DedupStorageService) SaveBytes(ctx context.Context, data []byte, contentType, ext, subDir string) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := path.Join(filepath.ToSlash(subDir), hash+ext)
+
+	obj, err := s.index.Acquire(ctx, &models.MediaObject{
+		Key:         key,
+		Hash:        hash,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to record media object: %w", err)
+	}
+	// Uploading while the file is being removed could see the upload deleted
+	if obj.DeletingAt != nil {
+		if obj, err = s.awaitDelete(ctx, key, obj); err != nil {
+			if releaseErr := s.Delete(context.WithoutCancel(ctx), key); releaseErr != nil {
+				log.Printf("WARN: Failed to release media object %s: %v", key, releaseErr)
+			}
+			return "", err
+		}
+	}
+	if obj.Stored {
+		return key, nil
+	}
+
+	if err := s.StorageService.Put(ctx, key, data, contentType); err != nil {
+		if releaseErr := s.Delete(context.WithoutCancel(ctx), key); releaseErr != nil {
+			log.Printf("WARN: Failed to release media object %s after a failed upload: %v", key, releaseErr)
+		}
+		return "", err
+	}
+	// Left unmarked, the next save of the same content just uploads it again
+	if err := s.index.MarkStored(ctx, key); err != nil {
+		log.Printf("WARN: Failed to mark media object %s stored: %v", key, err)
+	}
+	return key, nil
+}
+
+// awaitDelete waits until the removal of the file of obj has finished, or has gone on so long
+// it must have been abandoned, and returns the object's record as it is then.
+func (s *DedupStorageService) awaitDelete(ctx context.Context, key string, obj *models.MediaObject) (*models.MediaObject, error) {
+	ticker := time.NewTicker(mediaDeletePoll)
+	defer ticker.Stop()
+
+	for obj.DeletingAt != nil && time.Since(*obj.DeletingAt) < mediaDeleteWait {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := s.index.FindByKey(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up media object: %w", err)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("media object %s was removed while referenced", key)
+		}
+		obj = current
+	}
+	return obj, nil
+}
+
+// Delete drops a reference to a file and removes the file once nothing refers to it.
+func (s *DedupStorageService) Delete(ctx context.Context, key string) error {
+	obj, err := s.index.Release(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to release media object: %w", err)
+	}
+	if obj == nil {
+		return s.StorageService.Delete(ctx, key)
+	}
+	if obj.RefCount > 0 {
+		return nil
+	}
+
+	// A save of the same content in the meantime keeps the file. Saves from here on wait
+	// until it is gone and then upload it again.
+	started, err := s.index.BeginDelete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to remove media object: %w", err)
+	}
+	if !started {
+		return nil
+	}
+	return s.finishDelete(ctx, key)
+}
+
+// finishDelete removes the file of an object marked as being removed, then ends the mark,
+// so waiting saves go ahead whether or not the file could be removed.
+func (s *DedupStorageService) finishDelete(ctx context.Context, key string) error {
+	deleteErr := s.StorageService.Delete(ctx, key)
+	if err := s.index.FinishDelete(context.WithoutCancel(ctx), key); err != nil {
+		log.Printf("WARN: Failed to finish removing media object %s: %v", key, err)
+	}
+	return deleteErr
+}
+
+// DeleteOlderThan removes the files under subDir whose content was last saved before
+// cutoff, whether or not records still refer to them; saving the content again uploads it
+// afresh. Files from before content addressing go by their modification time.
+func (s *DedupStorageService) DeleteOlderThan(ctx context.Context, subDir string, cutoff time.Time, keep func(key string) bool) (int, error) {
+	prefix := strings.Trim(filepath.ToSlash(subDir), "/") + "/"
+
+	deleted := 0
+	for {
+		objects, err := s.index.FindUnusedSince(ctx, prefix, cutoff, mediaSweepBatch)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list expired media objects: %w", err)
+		}
+		expired := 0
+		for _, obj := range objects {
+			if keep != nil && keep(obj.Key) {
+				continue
+			}
+			// Content saved again since the listing is left alone
+			ok, err := s.index.MarkExpired(ctx, obj.Key, cutoff)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to expire media object: %w", err)
+			}
+			if !ok {
+				continue
+			}
+			expired++
+			if err := s.finishDelete(ctx, obj.Key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(objects) < mediaSweepBatch || expired == 0 {
+			break
+		}
+	}
+
+	n, err := s.StorageService.DeleteOlderThan(ctx, subDir, cutoff, func(key string) bool {
+		return isContentKey(key) || (keep != nil && keep(key))
+	})
+	return deleted + n, err
+}
+
+// isContentKey reports whether a key names a file stored under its content hash.
+func isContentKey(key string) bool {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil && strings.ToLower(name) == name
+}
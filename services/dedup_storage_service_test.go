@@ -0,0 +1,210 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// memoryIndex is a MediaIndex kept in memory, with the semantics of the Mongo repository.
+type memoryIndex struct {
+	mu       sync.Mutex
+	objects  map[string]models.MediaObject
+	acquired chan string // receives the key of every Acquire, when set
+}
+
+func newMemoryIndex() *memoryIndex {
+	return &memoryIndex{objects: map[string]models.MediaObject{}}
+}
+
+func (m *memoryIndex) Acquire(ctx context.Context, obj *models.MediaObject) (*models.MediaObject, error) {
+	m.mu.Lock()
+	current, ok := m.objects[obj.Key]
+	if !ok {
+		current = models.MediaObject{Key: obj.Key, Hash: obj.Hash, ContentType: obj.ContentType, Size: obj.Size, CreatedAt: time.Now()}
+	}
+	current.RefCount++
+	current.LastUsedAt = time.Now()
+	m.objects[obj.Key] = current
+	m.mu.Unlock()
+
+	if m.acquired != nil {
+		m.acquired <- obj.Key
+	}
+	return &current, nil
+}
+
+func (m *memoryIndex) FindByKey(ctx context.Context, key string) (*models.MediaObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, nil
+	}
+	return &obj, nil
+}
+
+func (m *memoryIndex) MarkStored(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if obj, ok := m.objects[key]; ok {
+		obj.Stored, obj.DeletingAt = true, nil
+		m.objects[key] = obj
+	}
+	return nil
+}
+
+func (m *memoryIndex) Release(ctx context.Context, key string) (*models.MediaObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, nil
+	}
+	obj.RefCount--
+	m.objects[key] = obj
+	return &obj, nil
+}
+
+func (m *memoryIndex) BeginDelete(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok || obj.RefCount > 0 || obj.DeletingAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	obj.Stored, obj.DeletingAt = false, &now
+	m.objects[key] = obj
+	return true, nil
+}
+
+func (m *memoryIndex) FinishDelete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil
+	}
+	if obj.RefCount <= 0 {
+		delete(m.objects, key)
+		return nil
+	}
+	obj.DeletingAt = nil
+	m.objects[key] = obj
+	return nil
+}
+
+func (m *memoryIndex) FindUnusedSince(ctx context.Context, prefix string, cutoff time.Time, limit int64) ([]models.MediaObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var objects []models.MediaObject
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) && obj.Stored && obj.LastUsedAt.Before(cutoff) && int64(len(objects)) < limit {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+func (m *memoryIndex) MarkExpired(ctx context.Context, key string, cutoff time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[key]
+	if !ok || !obj.Stored || !obj.LastUsedAt.Before(cutoff) {
+		return false, nil
+	}
+	now := time.Now()
+	obj.Stored, obj.DeletingAt = false, &now
+	m.objects[key] = obj
+	return true, nil
+}
+
+// hookedStorage runs beforeDelete ahead of every file removal.
+type hookedStorage struct {
+	StorageService
+	beforeDelete func(key string)
+}
+
+func (s *hookedStorage) Delete(ctx context.Context, key string) error {
+	if s.beforeDelete != nil {
+		s.beforeDelete(key)
+	}
+	return s.StorageService.Delete(ctx, key)
+}
+
+func TestDedupStorageSaveDuringDelete(t *testing.T) {
+	data := []byte("recorded answer")
+	tests := []struct {
+		name   string
+		remove func(t *testing.T, s *DedupStorageService, index *memoryIndex, key string)
+	}{
+		{"last reference released", func(t *testing.T, s *DedupStorageService, index *memoryIndex, key string) {
+			if err := s.Delete(context.Background(), key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+		}},
+		{"retention sweep", func(t *testing.T, s *DedupStorageService, index *memoryIndex, key string) {
+			index.mu.Lock()
+			obj := index.objects[key]
+			obj.LastUsedAt = time.Now().Add(-48 * time.Hour)
+			index.objects[key] = obj
+			index.mu.Unlock()
+			if _, err := s.DeleteOlderThan(context.Background(), "media", time.Now().Add(-24*time.Hour), nil); err != nil {
+				t.Fatalf("DeleteOlderThan: %v", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, err := NewLocalStorageService(t.TempDir(), NewURLSigner("test"), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			storage := &hookedStorage{StorageService: local}
+			index := newMemoryIndex()
+			s := NewDedupStorageService(storage, index)
+
+			key, err := s.SaveBytes(context.Background(), data, "audio/mpeg", ".mp3", "media")
+			if err != nil {
+				t.Fatalf("SaveBytes: %v", err)
+			}
+
+			// The same content is saved again while the file is being removed
+			var wg sync.WaitGroup
+			var saveErr error
+			storage.beforeDelete = func(string) {
+				storage.beforeDelete = nil
+				index.acquired = make(chan string)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, saveErr = s.SaveBytes(context.Background(), data, "audio/mpeg", ".mp3", "media")
+				}()
+				<-index.acquired
+				index.acquired = nil
+			}
+			tt.remove(t, s, index, key)
+			wg.Wait()
+			if saveErr != nil {
+				t.Fatalf("concurrent SaveBytes: %v", saveErr)
+			}
+
+			stored, err := s.ReadFile(context.Background(), key)
+			if err != nil || !bytes.Equal(stored, data) {
+				t.Fatalf("file after the concurrent save: %q, %v; want it stored", stored, err)
+			}
+			obj, _ := index.FindByKey(context.Background(), key)
+			if obj == nil || !obj.Stored || obj.DeletingAt != nil || obj.RefCount < 1 {
+				t.Fatalf("record after the concurrent save: %+v", obj)
+			}
+		})
+	}
+}
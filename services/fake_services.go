@@ -0,0 +1,446 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// FakeResponse is a scripted answer of a fake service. Latency is waited out before
+// answering (or until the caller's context ends); a non-nil Err is returned instead of Reply.
+type FakeResponse struct {
+	Reply   string
+	Err     error
+	Latency time.Duration
+}
+
+// fakeRule is one scripted response together with the input it answers.
+type fakeRule struct {
+	pattern  *regexp.Regexp
+	response FakeResponse
+}
+
+// FakeScript picks a fake service's response by matching the request's input against
+// regular expressions, in the order they were added. Inputs nothing matches get the
+// fallback response. It is safe for concurrent use and records every input it sees.
+type FakeScript struct {
+	mu       sync.Mutex
+	rules    []fakeRule
+	fallback FakeResponse
+	calls    []string
+}
+
+// NewFakeScript creates a script that answers every input with fallback.
+func NewFakeScript(fallback FakeResponse) *FakeScript {
+	return &FakeScript{fallback: fallback}
+}
+
+// On answers inputs matching pattern with response. It panics if pattern is not a valid
+// regular expression, like regexp.MustCompile.
+func (s *FakeScript) On(pattern string, response FakeResponse) *FakeScript {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, fakeRule{pattern: regexp.MustCompile(pattern), response: response})
+	return s
+}
+
+// SetFallback changes the response for inputs no rule matches.
+func (s *FakeScript) SetFallback(response FakeResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = response
+}
+
+// Reset removes all rules and forgets recorded calls. The fallback is kept.
+func (s *FakeScript) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+	s.calls = nil
+}
+
+// Calls returns the inputs the script has answered, oldest first.
+func (s *FakeScript) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// match records input and returns the response for it.
+func (s *FakeScript) match(input string) FakeResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, input)
+	for _, rule := range s.rules {
+		if rule.pattern.MatchString(input) {
+			return rule.response
+		}
+	}
+	return s.fallback
+}
+
+// respond waits out the response's latency and returns its reply or error.
+func (s *FakeScript) respond(ctx context.Context, input string) (string, error) {
+	response := s.match(input)
+	if err := fakeDelay(ctx, response.Latency); err != nil {
+		return "", err
+	}
+	if response.Err != nil {
+		return "", response.Err
+	}
+	return response.Reply, nil
+}
+
+func fakeDelay(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// FakeAIService implements AIService with scripted replies. Chat answers advisory and chat
+// requests, matched against the prompt or the last user message; Soil answers soil photo
+// analyses, matched against the image's MIME type. An empty scripted chat reply echoes the
+// question; an empty soil reply is an alluvial soil.
+type FakeAIService struct {
+	Chat *FakeScript
+	Soil *FakeScript
+}
+
+// fakeSoilAnalysis is the fake AI's answer for a soil photo; %s is the soil class.
+const fakeSoilAnalysis = `{"soilClass": %q, "confidence": 0.9, "texture": "loam",
+	"color": {"munsell": "10YR 4/3", "name": "brown"}, "organicMatter": "medium",
+	"moisture": "moist", "imageQuality": "good", "concerns": []}`
+
+// NewFakeAIService creates a fake AI that echoes questions and finds every soil alluvial.
+func NewFakeAIService() *FakeAIService {
+	return &FakeAIService{
+		Chat: NewFakeScript(FakeResponse{}),
+		Soil: NewFakeScript(FakeResponse{Reply: models.SoilClassAlluvial}),
+	}
+}
+
+// AnalyzeSoilImage returns the scripted soil analysis. A scripted reply is either the
+// analysis as JSON or just a soil class; malformed JSON goes through the same validation
+// and retries as a real model's answer.
+func (s *FakeAIService) AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error) {
+	return analyzeSoil(ctx, func(ctx context.Context, prompt string) (string, error) {
+		reply, err := s.Soil.respond(ctx, mimeType)
+		reply = strings.TrimSpace(reply)
+		if err != nil || strings.HasPrefix(reply, "{") {
+			return reply, err
+		}
+		if reply == "" {
+			reply = models.SoilClassAlluvial
+		}
+		return fmt.Sprintf(fakeSoilAnalysis, reply), nil
+	})
+}
+
+// GenerateAdvisory returns the scripted reply to prompt.
+func (s *FakeAIService) GenerateAdvisory(ctx context.Context, prompt string) (string, error) {
+	return s.reply(ctx, prompt)
+}
+
+// GenerateAdvisoryWithImage returns the scripted reply to prompt; the image is ignored.
+func (s *FakeAIService) GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error) {
+	return s.reply(ctx, prompt)
+}
+
+// GenerateChat returns the scripted reply to the last user message.
+func (s *FakeAIService) GenerateChat(ctx context.Context, system string, messages []Message) (string, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return "", err
+	}
+	return s.reply(ctx, messages[len(messages)-1].Text)
+}
+
+// StreamChat delivers the scripted reply to the last user message word by word.
+func (s *FakeAIService) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	reply, err := s.GenerateChat(ctx, system, messages)
+	if err != nil {
+		return "", err
+	}
+
+	var sent strings.Builder
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err := ctx.Err(); err != nil {
+			return sent.String(), err
+		}
+		sent.WriteString(word)
+		if err := onDelta(word); err != nil {
+			return sent.String(), err
+		}
+	}
+	return sent.String(), nil
+}
+
+func (s *FakeAIService) reply(ctx context.Context, question string) (string, error) {
+	reply, err := s.Chat.respond(ctx, question)
+	if err != nil {
+		return "", err
+	}
+	if reply == "" {
+		reply = "[fake AI] You asked: " + truncateText(strings.TrimSpace(question), 200)
+	}
+	return reply, nil
+}
+
+// FakeVoiceService implements VoiceService with scripted transcripts. TTS answers speech
+// requests, matched against the text; a scripted reply is returned as the audio's storage
+// key, and an empty one stores a short silent WAV file and returns its key. STT answers
+// transcriptions, matched against the audio bytes read as text; an empty reply returns the
+// audio itself if it is plain text, which lets tests "speak" by uploading a text file.
+type FakeVoiceService struct {
+	TTS            *FakeScript
+	STT            *FakeScript
+	storageService StorageService
+}
+
+// NewFakeVoiceService creates a fake voice service that stores its silent audio in storageService.
+func NewFakeVoiceService(storageService StorageService) *FakeVoiceService {
+	return &FakeVoiceService{
+		TTS:            NewFakeScript(FakeResponse{}),
+		STT:            NewFakeScript(FakeResponse{}),
+		storageService: storageService,
+	}
+}
+
+// TextToSpeech returns the scripted audio key, or stores half a second of silence.
+func (s *FakeVoiceService) TextToSpeech(ctx context.Context, text, language string) (string, error) {
+	key, err := s.TTS.respond(ctx, text)
+	if err != nil || key != "" {
+		return key, err
+	}
+	return s.storageService.SaveBytes(ctx, silentWAV(500*time.Millisecond), "audio/wav", ".wav", "audio")
+}
+
+// SpeechToText returns the scripted transcript of the audio.
+func (s *FakeVoiceService) SpeechToText(ctx context.Context, audioData []byte, ext, language string) (string, error) {
+	text, err := s.STT.respond(ctx, string(audioData))
+	if err != nil || text != "" {
+		return text, err
+	}
+	if utf8.Valid(audioData) && strings.TrimSpace(string(audioData)) != "" {
+		return strings.TrimSpace(string(audioData)), nil
+	}
+	return "Namaste. Meri fasal ke liye salah dijiye.", nil
+}
+
+// silentWAV returns a mono 8 kHz 8-bit PCM WAV file of the given length.
+func silentWAV(length time.Duration) []byte {
+	const sampleRate = 8000
+	samples := int(length.Seconds() * sampleRate)
+	wav := make([]byte, 44+samples)
+	copy(wav[0:], "RIFF")
+	binary.LittleEndian.PutUint32(wav[4:], uint32(36+samples))
+	copy(wav[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(wav[16:], 16)         // fmt chunk size
+	binary.LittleEndian.PutUint16(wav[20:], 1)          // PCM
+	binary.LittleEndian.PutUint16(wav[22:], 1)          // mono
+	binary.LittleEndian.PutUint32(wav[24:], sampleRate) // sample rate
+	binary.LittleEndian.PutUint32(wav[28:], sampleRate) // byte rate
+	binary.LittleEndian.PutUint16(wav[32:], 1)          // block align
+	binary.LittleEndian.PutUint16(wav[34:], 8)          // bits per sample
+	copy(wav[36:], "data")
+	binary.LittleEndian.PutUint32(wav[40:], uint32(samples))
+	for i := 44; i < len(wav); i++ {
+		wav[i] = 128 // silence for unsigned 8-bit samples
+	}
+	return wav
+}
+
+// FakeWeatherService implements WeatherService with weather derived from the coordinates,
+// so the same place always gets the same weather. Script is matched against the coordinates
+// formatted as "lat,lon" with four decimals; it can inject latency and errors, and a scripted
+// reply replaces the weather description.
+type FakeWeatherService struct {
+	Script *FakeScript
+}
+
+// NewFakeWeatherService creates a fake weather service with no scripted failures.
+func NewFakeWeatherService() *FakeWeatherService {
+	return &FakeWeatherService{Script: NewFakeScript(FakeResponse{})}
+}
+
+// GetWeather returns a summary of the fake current weather.
+func (s *FakeWeatherService) GetWeather(ctx context.Context, latitude, longitude float64) (string, error) {
+	data, err := s.GetWeatherDetailed(ctx, latitude, longitude)
+	if err != nil {
+		return "Weather data unavailable", nil
+	}
+	return fmt.Sprintf(
+		"Location: %s | Condition: %s | Temperature: %.1f°C (feels like %.1f°C) | Min: %.1f°C, Max: %.1f°C | Humidity: %d%% | Wind: %.1f m/s",
+		data.Location, data.Description, data.Temperature, data.FeelsLike, data.TempMin, data.TempMax, data.Humidity, data.WindSpeed,
+	), nil
+}
+
+// GetWeatherDetailed returns the fake current weather.
+func (s *FakeWeatherService) GetWeatherDetailed(ctx context.Context, latitude, longitude float64) (*WeatherData, error) {
+	description, err := s.Script.respond(ctx, fakeCoordinates(latitude, longitude))
+	if err != nil {
+		return nil, err
+	}
+	data := fakeWeather(latitude, longitude, 0)
+	if description != "" {
+		data.Description = description
+	}
+	return &WeatherData{
+		Location:    fmt.Sprintf("Demo Village (%s)", fakeCoordinates(latitude, longitude)),
+		Condition:   data.Condition,
+		Description: data.Description,
+		Temperature: data.Temperature,
+		FeelsLike:   data.Temperature + 1.5,
+		TempMin:     data.TempMin,
+		TempMax:     data.TempMax,
+		Humidity:    data.Humidity,
+		WindSpeed:   data.WindSpeed,
+		Icon:        data.Icon,
+	}, nil
+}
+
+// GetForecast returns five days of fake 3-hourly forecasts starting at the next full hour.
+func (s *FakeWeatherService) GetForecast(ctx context.Context, latitude, longitude float64) ([]ForecastItem, error) {
+	description, err := s.Script.respond(ctx, fakeCoordinates(latitude, longitude))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+	items := make([]ForecastItem, 0, 40)
+	for slot := 0; slot < 40; slot++ {
+		item := fakeWeather(latitude, longitude, slot)
+		item.DateTime = start.Add(time.Duration(slot) * 3 * time.Hour).Format("2006-01-02 15:04:05")
+		if description != "" {
+			item.Description = description
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func fakeCoordinates(latitude, longitude float64) string {
+	return fmt.Sprintf("%.4f,%.4f", latitude, longitude)
+}
+
+// fakeConditions are the weather conditions a fake forecast cycles through.
+var fakeConditions = []struct{ main, description, icon string }{
+	{"Clear", "clear sky", "01d"},
+	{"Clouds", "scattered clouds", "03d"},
+	{"Clouds", "overcast clouds", "04d"},
+	{"Rain", "light rain", "10d"},
+}
+
+// fakeWeather derives a forecast slot's weather from the coordinates: warmer towards the
+// equator, with a daily temperature swing.
+func fakeWeather(latitude, longitude float64, slot int) ForecastItem {
+	seed := int(math.Abs(latitude*100)+math.Abs(longitude*100)) + slot/8
+	condition := fakeConditions[seed%len(fakeConditions)]
+	temp := 34 - math.Abs(latitude)/3 + 4*math.Sin(float64(slot)*math.Pi/4)
+	temp = math.Round(temp*10) / 10
+	return ForecastItem{
+		Condition:   condition.main,
+		Description: condition.description,
+		Temperature: temp,
+		TempMin:     temp - 2,
+		TempMax:     temp + 2,
+		Humidity:    40 + seed%45,
+		WindSpeed:   float64(seed%60) / 10,
+		Icon:        fmt.Sprintf("https://openweathermap.org/img/wn/%s@2x.png", condition.icon),
+	}
+}
+
+// fakeScriptFile is the JSON layout of a file that scripts the fakes.
+type fakeScriptFile struct {
+	AI      []fakeScriptEntry `json:"ai"`
+	Soil    []fakeScriptEntry `json:"soil"`
+	TTS     []fakeScriptEntry `json:"tts"`
+	STT     []fakeScriptEntry `json:"stt"`
+	Weather []fakeScriptEntry `json:"weather"`
+}
+
+type fakeScriptEntry struct {
+	Pattern string `json:"pattern"`
+	Reply   string `json:"reply"`
+	Error   string `json:"error"`
+	Latency string `json:"latency"` // a Go duration such as "2s"
+}
+
+// LoadFakeScripts adds the rules in a JSON file to the fakes, so a running server can be
+// scripted without code. The file has one list of rules per script:
+//
+//	{"ai": [{"pattern": "(?i)wheat", "reply": "Sow wheat in early November."}],
+//	 "soil": [{"pattern": "png", "reply": "black"}],
+//	 "weather": [{"pattern": ".*", "error": "weather API down", "latency": "3s"}]}
+//
+// Lists are "ai", "soil", "tts", "stt" and "weather".
+func LoadFakeScripts(path string, ai *FakeAIService, voice *FakeVoiceService, weather *FakeWeatherService) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fake script: %w", err)
+	}
+	var file fakeScriptFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse fake script: %w", err)
+	}
+
+	scripts := []struct {
+		name    string
+		entries []fakeScriptEntry
+		script  *FakeScript
+	}{
+		{"ai", file.AI, ai.Chat},
+		{"soil", file.Soil, ai.Soil},
+		{"tts", file.TTS, voice.TTS},
+		{"stt", file.STT, voice.STT},
+		{"weather", file.Weather, weather.Script},
+	}
+	for _, s := range scripts {
+		for i, entry := range s.entries {
+			if _, err := regexp.Compile(entry.Pattern); err != nil {
+				return fmt.Errorf("fake script %s[%d]: invalid pattern: %w", s.name, i, err)
+			}
+			response := FakeResponse{Reply: entry.Reply}
+			if entry.Error != "" {
+				response.Err = errors.New(entry.Error)
+			}
+			if entry.Latency != "" {
+				if response.Latency, err = time.ParseDuration(entry.Latency); err != nil {
+					return fmt.Errorf("fake script %s[%d]: invalid latency: %w", s.name, i, err)
+				}
+			}
+			s.script.On(entry.Pattern, response)
+		}
+	}
+	return nil
+}
+
+// truncateText shortens s to at most n runes.
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
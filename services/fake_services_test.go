@@ -0,0 +1,283 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+func TestFakeScriptRules(t *testing.T) {
+	script := NewFakeScript(FakeResponse{Reply: "fallback"}).
+		On("(?i)wheat", FakeResponse{Reply: "wheat rule"}).
+		On("(?i)wheat|rice", FakeResponse{Reply: "grain rule"}).
+		On("down", FakeResponse{Err: errors.New("scripted failure")})
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"When do I sow Wheat?", "wheat rule", ""}, // the first matching rule wins
+		{"rice or wheat?", "wheat rule", ""},
+		{"When do I sow rice?", "grain rule", ""},
+		{"Is the server down?", "", "scripted failure"},
+		{"Anything else", "fallback", ""},
+	}
+	for _, tt := range tests {
+		got, err := script.respond(context.Background(), tt.input)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("respond(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("respond(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+
+	want := make([]string, len(tests))
+	for i, tt := range tests {
+		want[i] = tt.input
+	}
+	if calls := script.Calls(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("Calls() = %q, want %q", calls, want)
+	}
+
+	script.SetFallback(FakeResponse{Reply: "new fallback"})
+	script.Reset()
+	if calls := script.Calls(); len(calls) != 0 {
+		t.Errorf("Calls() after Reset = %q, want none", calls)
+	}
+	if got, _ := script.respond(context.Background(), "wheat"); got != "new fallback" {
+		t.Errorf("respond after Reset = %q, want the fallback kept and the rules gone", got)
+	}
+}
+
+func TestFakeScriptLatencyCutShort(t *testing.T) {
+	script := NewFakeScript(FakeResponse{Reply: "late", Latency: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := script.respond(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("cancelled call took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := script.respond(ctx, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// A short latency is waited out
+	script.SetFallback(FakeResponse{Reply: "soon", Latency: 20 * time.Millisecond})
+	start = time.Now()
+	got, err := script.respond(context.Background(), "hello")
+	if err != nil || got != "soon" || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("respond = %q, %v after %v; want the reply after the latency", got, err, time.Since(start))
+	}
+}
+
+func TestFakeAIService(t *testing.T) {
+	ai := NewFakeAIService()
+	ai.Chat.On("(?i)wheat", FakeResponse{Reply: "Sow wheat in early November."})
+	ai.Soil.On("png", FakeResponse{Reply: "black"})
+	ai.Soil.On("webp", FakeResponse{Reply: `{"soilClass": "red"}`})
+	ctx := context.Background()
+
+	if got, _ := ai.GenerateAdvisory(ctx, "  How much water for rice?  "); got != "[fake AI] You asked: How much water for rice?" {
+		t.Errorf("GenerateAdvisory = %q, want the question echoed", got)
+	}
+
+	messages := []Message{
+		{Role: MessageRoleUser, Text: "Tell me about rice"},
+		{Role: MessageRoleAssistant, Text: "Rice needs water."},
+		{Role: MessageRoleUser, Text: "And wheat?"},
+	}
+	var deltas []string
+	got, err := ai.StreamChat(ctx, "system", messages, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil || got != "Sow wheat in early November." {
+		t.Fatalf("StreamChat = %q, %v", got, err)
+	}
+	if len(deltas) != 5 || strings.Join(deltas, "") != got {
+		t.Errorf("deltas = %q, want the reply word by word", deltas)
+	}
+	if calls := ai.Chat.Calls(); calls[len(calls)-1] != "And wheat?" {
+		t.Errorf("chat matched against %q, want the last user message", calls[len(calls)-1])
+	}
+
+	analysis, err := ai.AnalyzeSoilImage(ctx, []byte("img"), "image/jpeg")
+	if err != nil || analysis.SoilClass != models.SoilClassAlluvial {
+		t.Errorf("AnalyzeSoilImage(jpeg) = %+v, %v; want the alluvial default", analysis, err)
+	}
+	analysis, err = ai.AnalyzeSoilImage(ctx, []byte("img"), "image/png")
+	if err != nil || analysis.SoilClass != models.SoilClassBlack {
+		t.Errorf("AnalyzeSoilImage(png) = %+v, %v; want the scripted class", analysis, err)
+	}
+	// Scripted JSON goes through validation, and is retried like a real model's answer
+	if _, err := ai.AnalyzeSoilImage(ctx, []byte("img"), "image/webp"); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("AnalyzeSoilImage(webp) error = %v, want the incomplete analysis rejected", err)
+	}
+}
+
+func TestLoadFakeScripts(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "fake.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	newFakes := func(t *testing.T) (*FakeAIService, *FakeVoiceService, *FakeWeatherService) {
+		t.Helper()
+		local, err := NewLocalStorageService(t.TempDir(), NewURLSigner("test"), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewFakeAIService(), NewFakeVoiceService(local), NewFakeWeatherService()
+	}
+
+	t.Run("rules are added to each script", func(t *testing.T) {
+		ai, voice, weather := newFakes(t)
+		path := write(t, `{
+			"ai": [{"pattern": "(?i)wheat", "reply": "Sow in November."}, {"pattern": ".*", "reply": "second"}],
+			"soil": [{"pattern": "png", "reply": "black"}],
+			"tts": [{"pattern": ".*", "reply": "audio/scripted.mp3"}],
+			"stt": [{"pattern": ".*", "error": "inaudible"}],
+			"weather": [{"pattern": ".*", "reply": "dust storm", "latency": "1h"}]
+		}`)
+		if err := LoadFakeScripts(path, ai, voice, weather); err != nil {
+			t.Fatalf("LoadFakeScripts: %v", err)
+		}
+
+		ctx := context.Background()
+		if got, _ := ai.GenerateAdvisory(ctx, "WHEAT"); got != "Sow in November." {
+			t.Errorf("ai reply = %q, want the first rule", got)
+		}
+		if got, _ := ai.GenerateAdvisory(ctx, "rice"); got != "second" {
+			t.Errorf("ai reply = %q, want the second rule", got)
+		}
+		if a, _ := ai.AnalyzeSoilImage(ctx, nil, "image/png"); a == nil || a.SoilClass != models.SoilClassBlack {
+			t.Errorf("soil analysis = %+v, want black", a)
+		}
+		if key, _ := voice.TextToSpeech(ctx, "hello", "hi"); key != "audio/scripted.mp3" {
+			t.Errorf("tts key = %q", key)
+		}
+		if _, err := voice.SpeechToText(ctx, []byte("hello"), ".wav", "hi"); err == nil || err.Error() != "inaudible" {
+			t.Errorf("stt error = %v, want the scripted error", err)
+		}
+		timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if _, err := weather.GetWeatherDetailed(timeout, 21.1458, 79.0882); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("weather error = %v, want the scripted latency cut short", err)
+		}
+	})
+
+	errorCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"invalid JSON", `{"ai": [`, "failed to parse"},
+		{"invalid pattern", `{"weather": [{"pattern": "(", "reply": "x"}]}`, "weather[0]: invalid pattern"},
+		{"invalid latency", `{"tts": [{"pattern": ".*"}, {"pattern": ".*", "latency": "soon"}]}`, "tts[1]: invalid latency"},
+	}
+	for _, tt := range errorCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ai, voice, weather := newFakes(t)
+			err := LoadFakeScripts(write(t, tt.content), ai, voice, weather)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		ai, voice, weather := newFakes(t)
+		if err := LoadFakeScripts(filepath.Join(t.TempDir(), "missing.json"), ai, voice, weather); err == nil {
+			t.Fatal("expected an error for a missing file")
+		}
+	})
+}
+
+func TestSilentWAV(t *testing.T) {
+	wav := silentWAV(500 * time.Millisecond)
+	const samples = 4000
+	if len(wav) != 44+samples {
+		t.Fatalf("length = %d, want a 44-byte header and %d samples", len(wav), samples)
+	}
+
+	if string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Fatalf("header chunks = %q %q %q", wav[0:4], wav[8:16], wav[36:40])
+	}
+	fields := []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"RIFF size", binary.LittleEndian.Uint32(wav[4:]), uint32(36 + samples)},
+		{"fmt size", binary.LittleEndian.Uint32(wav[16:]), 16},
+		{"format", uint32(binary.LittleEndian.Uint16(wav[20:])), 1},
+		{"channels", uint32(binary.LittleEndian.Uint16(wav[22:])), 1},
+		{"sample rate", binary.LittleEndian.Uint32(wav[24:]), 8000},
+		{"byte rate", binary.LittleEndian.Uint32(wav[28:]), 8000},
+		{"block align", uint32(binary.LittleEndian.Uint16(wav[32:])), 1},
+		{"bits per sample", uint32(binary.LittleEndian.Uint16(wav[34:])), 8},
+		{"data size", binary.LittleEndian.Uint32(wav[40:]), samples},
+	}
+	for _, f := range fields {
+		if f.got != f.want {
+			t.Errorf("%s = %d, want %d", f.name, f.got, f.want)
+		}
+	}
+	if !bytes.Equal(wav[44:], bytes.Repeat([]byte{128}, samples)) {
+		t.Error("samples are not silence")
+	}
+}
+
+func TestFakeVoiceStoresSilence(t *testing.T) {
+	local, err := NewLocalStorageService(t.TempDir(), NewURLSigner("test"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voice := NewFakeVoiceService(local)
+	ctx := context.Background()
+
+	key, err := voice.TextToSpeech(ctx, "Namaste", "hi")
+	if err != nil {
+		t.Fatalf("TextToSpeech: %v", err)
+	}
+	if !strings.HasPrefix(key, "audio/") || !strings.HasSuffix(key, ".wav") {
+		t.Errorf("key = %q, want a WAV file under audio/", key)
+	}
+	data, err := local.ReadFile(ctx, key)
+	if err != nil || !bytes.Equal(data, silentWAV(500*time.Millisecond)) {
+		t.Fatalf("stored audio is not half a second of silence (err %v)", err)
+	}
+
+	if text, _ := voice.SpeechToText(ctx, []byte("  meri fasal  "), ".txt", "hi"); text != "meri fasal" {
+		t.Errorf("SpeechToText(text) = %q, want the uploaded text", text)
+	}
+	if text, _ := voice.SpeechToText(ctx, silentWAV(time.Second), ".wav", "hi"); text == "" {
+		t.Error("SpeechToText(audio) returned no transcript")
+	}
+}
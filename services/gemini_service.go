@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/samyaksetu/backend/models"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -32,24 +34,39 @@ func NewGeminiService(apiKey string) (*GeminiService, error) {
 	return &GeminiService{client: client}, nil
 }
 
-// AnalyzeSoilImage sends a soil image to Gemini Vision and returns the soil type.
-func (s *GeminiService) AnalyzeSoilImage(imageData []byte, mimeType string) (string, error) {
-	prompt := `You are an expert agricultural soil scientist. Analyze this soil image and identify the soil type.
-Respond with ONLY the soil type name (e.g., "Clay", "Sandy", "Loamy", "Silt", "Peat", "Chalky", "Red Soil", "Black Soil", "Alluvial Soil", "Laterite Soil").
-If you cannot determine the soil type, respond with "Unknown".
-Do not include any other text or explanation.`
-
-	return s.callVisionWithRetry(prompt, imageData, mimeType, 2)
+// AnalyzeSoilImage sends a soil image to Gemini Vision and returns its structured analysis.
+func (s *GeminiService) AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error) {
+	return analyzeSoil(ctx, func(ctx context.Context, prompt string) (string, error) {
+		return s.callVisionWithRetry(ctx, prompt, imageData, mimeType, 2)
+	})
 }
 
 // GenerateAdvisory calls Gemini text model for agricultural advice.
-func (s *GeminiService) GenerateAdvisory(prompt string) (string, error) {
-	return s.callTextWithRetry(prompt, 2)
+func (s *GeminiService) GenerateAdvisory(ctx context.Context, prompt string) (string, error) {
+	return s.callTextWithRetry(ctx, prompt, 2)
 }
 
 // GenerateAdvisoryWithImage calls Gemini Vision for advice using text + image context.
-func (s *GeminiService) GenerateAdvisoryWithImage(prompt string, imageData []byte, mimeType string) (string, error) {
-	return s.callVisionWithRetry(prompt, imageData, mimeType, 2)
+func (s *GeminiService) GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error) {
+	return s.callVisionWithRetry(ctx, prompt, imageData, mimeType, 2)
+}
+
+// GenerateChat calls Gemini with the conversation so far, for follow-up questions.
+func (s *GeminiService) GenerateChat(ctx context.Context, system string, messages []Message) (string, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return "", err
+	}
+	return s.callChatWithRetry(ctx, system, messages, 2)
+}
+
+// StreamChat is GenerateChat delivering Gemini's reply as it is generated.
+func (s *GeminiService) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return "", err
+	}
+	return s.callChatStreamWithRetry(ctx, system, messages, onDelta, 2)
 }
 
 // Close releases the Gemini client resources.
@@ -60,21 +77,23 @@ func (s *GeminiService) Close() {
 }
 
 // callTextWithRetry calls the Gemini text model with retry logic.
-func (s *GeminiService) callTextWithRetry(prompt string, maxRetries int) (string, error) {
+func (s *GeminiService) callTextWithRetry(ctx context.Context, prompt string, maxRetries int) (string, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
 			log.Printf("INFO: Gemini text retry attempt %d/%d", attempt, maxRetries)
-			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		model := s.client.GenerativeModel("gemini-2.0-flash")
 		model.SetTemperature(0.7)
 		model.SetTopP(0.9)
 
-		resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+		resp, err := model.GenerateContent(callCtx, genai.Text(prompt))
 		cancel()
 
 		if err != nil {
@@ -94,21 +113,23 @@ func (s *GeminiService) callTextWithRetry(prompt string, maxRetries int) (string
 }
 
 // callVisionWithRetry calls the Gemini vision model with retry logic.
-func (s *GeminiService) callVisionWithRetry(prompt string, imageData []byte, mimeType string, maxRetries int) (string, error) {
+func (s *GeminiService) callVisionWithRetry(ctx context.Context, prompt string, imageData []byte, mimeType string, maxRetries int) (string, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
 			log.Printf("INFO: Gemini vision retry attempt %d/%d", attempt, maxRetries)
-			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+		callCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
 		model := s.client.GenerativeModel("gemini-2.0-flash")
 		model.SetTemperature(0.4)
 
 		imgPart := genai.ImageData(mimeType, imageData)
-		resp, err := model.GenerateContent(ctx, imgPart, genai.Text(prompt))
+		resp, err := model.GenerateContent(callCtx, imgPart, genai.Text(prompt))
 		cancel()
 
 		if err != nil {
@@ -127,6 +148,127 @@ func (s *GeminiService) callVisionWithRetry(prompt string, imageData []byte, mim
 	return "", fmt.Errorf("gemini vision failed after %d retries: %w", maxRetries, lastErr)
 }
 
+// callChatWithRetry sends a multi-turn conversation to the Gemini model with retry logic.
+// Earlier turns go in as chat history and the last user turn is sent as the new message.
+func (s *GeminiService) callChatWithRetry(ctx context.Context, system string, messages []Message, maxRetries int) (string, error) {
+	timeout := 30 * time.Second
+	if len(messages[len(messages)-1].ImageData) > 0 {
+		timeout = 45 * time.Second
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: Gemini chat retry attempt %d/%d", attempt, maxRetries)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		session, last := s.startChat(system, messages)
+		resp, err := session.SendMessage(callCtx, last.Parts...)
+		cancel()
+
+		if err != nil {
+			lastErr = fmt.Errorf("gemini chat API error: %w", err)
+			continue
+		}
+
+		text := extractText(resp)
+		if text != "" {
+			return text, nil
+		}
+
+		lastErr = fmt.Errorf("gemini chat returned empty response")
+	}
+
+	return "", fmt.Errorf("gemini chat failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// callChatStreamWithRetry streams a multi-turn conversation from the Gemini model.
+// Only failures before the first piece of text are retried: once text has reached the
+// caller the reply cannot be restarted.
+func (s *GeminiService) callChatStreamWithRetry(ctx context.Context, system string, messages []Message, onDelta func(string) error, maxRetries int) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: Gemini stream retry attempt %d/%d", attempt, maxRetries)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
+		session, last := s.startChat(system, messages)
+		iter := session.SendMessageStream(callCtx, last.Parts...)
+
+		var reply strings.Builder
+		for {
+			resp, err := iter.Next()
+			if err == iterator.Done {
+				lastErr = nil
+				break
+			}
+			if err != nil {
+				lastErr = fmt.Errorf("gemini stream API error: %w", err)
+				break
+			}
+
+			delta := deltaText(resp)
+			if delta == "" {
+				continue
+			}
+			reply.WriteString(delta)
+			if err := onDelta(delta); err != nil {
+				cancel()
+				return reply.String(), err
+			}
+		}
+		cancel()
+
+		if reply.Len() > 0 {
+			return reply.String(), lastErr
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("gemini stream returned empty response")
+		}
+	}
+
+	return "", fmt.Errorf("gemini stream failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// startChat opens a chat session holding every turn but the last, which it returns to be sent.
+// A fresh session is needed per attempt because sending appends to the history.
+func (s *GeminiService) startChat(system string, messages []Message) (*genai.ChatSession, *genai.Content) {
+	model := s.client.GenerativeModel("gemini-2.0-flash")
+	model.SetTemperature(0.7)
+	model.SetTopP(0.9)
+	if system != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	}
+
+	session := model.StartChat()
+	for _, msg := range messages[:len(messages)-1] {
+		session.History = append(session.History, geminiContent(msg))
+	}
+	return session, geminiContent(messages[len(messages)-1])
+}
+
+// geminiContent converts a conversation turn to Gemini's format; the assistant is "model".
+func geminiContent(msg Message) *genai.Content {
+	role := "user"
+	if msg.Role == MessageRoleAssistant {
+		role = "model"
+	}
+	var parts []genai.Part
+	if len(msg.ImageData) > 0 {
+		parts = append(parts, genai.ImageData(msg.MimeType, msg.ImageData))
+	}
+	parts = append(parts, genai.Text(msg.Text))
+	return &genai.Content{Role: role, Parts: parts}
+}
+
 // extractText pulls text content from a Gemini API response.
 func extractText(resp *genai.GenerateContentResponse) string {
 	if resp == nil || len(resp.Candidates) == 0 {
@@ -147,3 +289,19 @@ func extractText(resp *genai.GenerateContentResponse) string {
 
 	return strings.TrimSpace(strings.Join(parts, "\n"))
 }
+
+// deltaText pulls the text of one streamed chunk. Unlike extractText it keeps surrounding
+// whitespace, which separates words across chunks.
+func deltaText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if textPart, ok := part.(genai.Text); ok {
+			text.WriteString(string(textPart))
+		}
+	}
+	return text.String()
+}
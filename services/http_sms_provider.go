@@ -0,0 +1,259 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Default templates for the generic HTTP gateway. They can be overridden per provider to
+// match MSG91, Twilio or any other JSON/form based SMS API.
+const (
+	defaultSMSMessageTemplate = "Your SamyakSetu verification code is {{.Code}}. Do not share it with anyone."
+	defaultSMSBodyTemplate    = `{"to":{{json .E164}},"message":{{json .Message}}}`
+)
+
+// smsTemplateData is what URL, body and message templates can reference.
+type smsTemplateData struct {
+	Phone    string // phone as entered by the farmer, e.g. 9988776655
+	E164     string // phone with country code, e.g. +919988776655
+	Code     string
+	Message  string
+	SenderID string
+}
+
+// HTTPSMSProvider sends OTPs through any HTTP SMS gateway.
+//
+// Supported settings (from SMS_<NAME>_* environment variables):
+//
+//	URL                  gateway endpoint (template)                      required
+//	METHOD               HTTP method                                      POST
+//	CONTENT_TYPE         request content type                             application/json
+//	BODY_TEMPLATE        request body (template)                          {"to":"+91…","message":"…"}
+//	MESSAGE_TEMPLATE     SMS text (template)                              "Your SamyakSetu verification code is …"
+//	AUTH_HEADER          header name for an API key, e.g. authkey         —
+//	AUTH_TOKEN           value for AUTH_HEADER, or a bearer token          —
+//	BASIC_USER/PASSWORD  HTTP basic auth (Twilio account SID/auth token)  —
+//	SENDER_ID            available to templates as .SenderID              —
+//	COUNTRY_CODE         prefix for 10-digit numbers in .E164             91
+//	MESSAGE_ID_FIELD     dot path to the message ID in the JSON response  messageId
+//	RECEIPT_ID_FIELD     dot path to the message ID in delivery receipts  messageId
+//	RECEIPT_STATUS_FIELD dot path to the status in delivery receipts      status
+//	TIMEOUT              request timeout                                  10s
+//
+// Templates use Go text/template syntax and may call {{json .X}} and {{urlquery .X}}.
+type HTTPSMSProvider struct {
+	name               string
+	method             string
+	contentType        string
+	urlTemplate        *template.Template
+	bodyTemplate       *template.Template
+	messageTemplate    *template.Template
+	authHeader         string
+	authToken          string
+	basicUser          string
+	basicPassword      string
+	senderID           string
+	countryCode        string
+	messageIDField     string
+	receiptIDField     string
+	receiptStatusField string
+	httpClient         *http.Client
+}
+
+// NewHTTPSMSProvider creates an HTTP gateway provider from its settings.
+func NewHTTPSMSProvider(name string, settings map[string]string) (*HTTPSMSProvider, error) {
+	get := func(key, fallback string) string {
+		if v := settings[key]; v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	if settings["URL"] == "" {
+		return nil, fmt.Errorf("SMS_%s_URL is required for the http driver", strings.ToUpper(name))
+	}
+
+	timeout, err := time.ParseDuration(get("TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIMEOUT: %w", err)
+	}
+
+	funcs := template.FuncMap{
+		"json": func(v string) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"urlquery": url.QueryEscape,
+	}
+	parse := func(label, text string) (*template.Template, error) {
+		t, err := template.New(label).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", label, err)
+		}
+		return t, nil
+	}
+
+	p := &HTTPSMSProvider{
+		name:               name,
+		method:             strings.ToUpper(get("METHOD", http.MethodPost)),
+		contentType:        get("CONTENT_TYPE", "application/json"),
+		authHeader:         settings["AUTH_HEADER"],
+		authToken:          settings["AUTH_TOKEN"],
+		basicUser:          settings["BASIC_USER"],
+		basicPassword:      settings["BASIC_PASSWORD"],
+		senderID:           settings["SENDER_ID"],
+		countryCode:        get("COUNTRY_CODE", "91"),
+		messageIDField:     get("MESSAGE_ID_FIELD", "messageId"),
+		receiptIDField:     get("RECEIPT_ID_FIELD", "messageId"),
+		receiptStatusField: get("RECEIPT_STATUS_FIELD", "status"),
+		httpClient:         &http.Client{Timeout: timeout},
+	}
+
+	if p.urlTemplate, err = parse("URL", settings["URL"]); err != nil {
+		return nil, err
+	}
+	if p.bodyTemplate, err = parse("BODY_TEMPLATE", get("BODY_TEMPLATE", defaultSMSBodyTemplate)); err != nil {
+		return nil, err
+	}
+	if p.messageTemplate, err = parse("MESSAGE_TEMPLATE", get("MESSAGE_TEMPLATE", defaultSMSMessageTemplate)); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// SendOTP renders the message and request templates and posts them to the gateway.
+func (p *HTTPSMSProvider) SendOTP(phone, code string) (*OTPDelivery, error) {
+	data := smsTemplateData{
+		Phone:    phone,
+		E164:     p.toE164(phone),
+		Code:     code,
+		SenderID: p.senderID,
+	}
+
+	message, err := render(p.messageTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	data.Message = message
+
+	endpoint, err := render(p.urlTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if p.method != http.MethodGet {
+		rendered, err := render(p.bodyTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	req, err := http.NewRequest(p.method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SMS request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", p.contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case p.authHeader != "":
+		req.Header.Set(p.authHeader, p.authToken)
+	case p.authToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.authToken)
+	}
+	if p.basicUser != "" {
+		req.SetBasicAuth(p.basicUser, p.basicPassword)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("SMS gateway request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("SMS gateway returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	delivery := &OTPDelivery{Provider: p.name}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(respBody, &payload); err == nil {
+		delivery.MessageID = lookupField(payload, p.messageIDField)
+	}
+	return delivery, nil
+}
+
+// ParseDeliveryReceipt extracts the message ID and status from a gateway callback.
+func (p *HTTPSMSProvider) ParseDeliveryReceipt(payload map[string]interface{}) (*DeliveryReceipt, error) {
+	messageID := lookupField(payload, p.receiptIDField)
+	if messageID == "" {
+		return nil, fmt.Errorf("delivery receipt has no %q field", p.receiptIDField)
+	}
+	raw := lookupField(payload, p.receiptStatusField)
+	return &DeliveryReceipt{
+		MessageID:      messageID,
+		Status:         NormalizeDeliveryStatus(raw),
+		ProviderStatus: raw,
+	}, nil
+}
+
+// toE164 prefixes 10-digit Indian-style numbers with the configured country code.
+func (p *HTTPSMSProvider) toE164(phone string) string {
+	if len(phone) == 10 {
+		return "+" + p.countryCode + phone
+	}
+	return "+" + strings.TrimPrefix(phone, "+")
+}
+
+func render(t *template.Template, data smsTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// lookupField walks a dot-separated path ("data.id") through decoded JSON and returns
+// the value as a string. Array elements can be addressed by index ("messages.0.id").
+func lookupField(payload map[string]interface{}, path string) string {
+	var current interface{} = payload
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[part]
+		case []interface{}:
+			var idx int
+			if _, err := fmt.Sscanf(part, "%d", &idx); err != nil || idx < 0 || idx >= len(node) {
+				return ""
+			}
+			current = node[idx]
+		default:
+			return ""
+		}
+	}
+
+	switch v := current.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,282 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/samyaksetu/backend/models"
+	"github.com/samyaksetu/backend/utils"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// qualityEdge is the longest edge photos are scaled to before scoring sharpness and
+// brightness, so scores do not depend on the camera's resolution.
+const qualityEdge = 512
+
+// Reasons a photo is rejected by the image pipeline.
+const (
+	ImageRejectedTooSmall  = "too_small"
+	ImageRejectedTooDark   = "too_dark"
+	ImageRejectedTooBright = "too_bright"
+	ImageRejectedBlurry    = "blurry"
+)
+
+// ImageRejectedError explains why a photo cannot be used and how to take a better one.
+type ImageRejectedError struct {
+	Reason  string // one of the ImageRejected* constants
+	Message string // shown to the farmer
+}
+
+func (e *ImageRejectedError) Error() string { return e.Message }
+
+// ImageSettings configures the image pipeline.
+type ImageSettings struct {
+	MaxEdge       int     // longest edge of stored and analyzed images, in pixels
+	ThumbnailEdge int     // longest edge of thumbnails
+	Quality       int     // JPEG quality, 1–100
+	MinEdge       int     // photos with a shorter edge below this are rejected
+	MinSharpness  float64 // photos scoring below this are rejected as blurry
+	MinBrightness float64 // photos darker than this (0–1) are rejected
+	MaxBrightness float64 // photos brighter than this (0–1) are rejected
+}
+
+// ProcessedImage is an upright, resized JPEG without metadata, ready for storage and AI.
+type ProcessedImage struct {
+	Data      []byte
+	Thumbnail []byte
+	MimeType  string
+	Ext       string
+	Metadata  models.ImageMetadata
+}
+
+// ImagePipeline prepares uploaded photos: it applies the EXIF orientation, keeps the EXIF
+// capture time and GPS position as metadata while dropping the rest, scales the photo down,
+// re-encodes it as JPEG, makes a thumbnail, and rejects photos too blurry, dark or bright
+// to be of use.
+type ImagePipeline struct {
+	settings ImageSettings
+}
+
+// NewImagePipeline creates an image pipeline.
+func NewImagePipeline(settings ImageSettings) *ImagePipeline {
+	return &ImagePipeline{settings: settings}
+}
+
+// Process runs a photo through the pipeline. An unusable photo returns an *ImageRejectedError.
+func (p *ImagePipeline) Process(data []byte) (*ProcessedImage, error) {
+	return p.process(data, true)
+}
+
+// Normalize turns a picture upright, scales it down and re-encodes it without metadata like
+// Process, but never rejects it for its size or quality. It suits pictures that are only
+// looked at, such as profile pictures.
+func (p *ImagePipeline) Normalize(data []byte) (*ProcessedImage, error) {
+	return p.process(data, false)
+}
+
+func (p *ImagePipeline) process(data []byte, checkQuality bool) (*ProcessedImage, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	meta := models.ImageMetadata{}
+	orientation := 1
+	if exif, err := utils.ReadJPEGExif(data); err == nil {
+		if exif.Orientation > 0 {
+			orientation = exif.Orientation
+		}
+		meta.TakenAt = exif.TakenAt
+		meta.Latitude, meta.Longitude = exif.Latitude, exif.Longitude
+	}
+
+	bounds := src.Bounds()
+	meta.OriginalWidth, meta.OriginalHeight = bounds.Dx(), bounds.Dy()
+	if orientation >= 5 {
+		meta.OriginalWidth, meta.OriginalHeight = meta.OriginalHeight, meta.OriginalWidth
+	}
+	if checkQuality && min(meta.OriginalWidth, meta.OriginalHeight) < p.settings.MinEdge {
+		return nil, &ImageRejectedError{
+			Reason:  ImageRejectedTooSmall,
+			Message: fmt.Sprintf("The photo is too small (%d×%d). Take it with the phone camera instead of sending a screenshot or forwarded image.", meta.OriginalWidth, meta.OriginalHeight),
+		}
+	}
+
+	img := orient(scaleDown(src, p.settings.MaxEdge), orientation)
+	if checkQuality {
+		if err := p.checkQuality(img, &meta); err != nil {
+			return nil, err
+		}
+	}
+
+	encoded, err := encodeJPEG(img, p.settings.Quality)
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := encodeJPEG(scaleDown(img, p.settings.ThumbnailEdge), p.settings.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Width, meta.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	return &ProcessedImage{
+		Data:      encoded,
+		Thumbnail: thumbnail,
+		MimeType:  "image/jpeg",
+		Ext:       ".jpg",
+		Metadata:  meta,
+	}, nil
+}
+
+// checkQuality scores the photo's brightness and sharpness into meta and rejects photos
+// outside the configured limits.
+func (p *ImagePipeline) checkQuality(img *image.RGBA, meta *models.ImageMetadata) error {
+	luma := lumaOf(scaleDown(img, qualityEdge))
+	meta.Brightness = brightness(luma)
+	meta.Sharpness = sharpness(luma)
+
+	switch {
+	case meta.Brightness < p.settings.MinBrightness:
+		return &ImageRejectedError{
+			Reason:  ImageRejectedTooDark,
+			Message: "The photo is too dark. Take it in daylight, or turn on the flash.",
+		}
+	case meta.Brightness > p.settings.MaxBrightness:
+		return &ImageRejectedError{
+			Reason:  ImageRejectedTooBright,
+			Message: "The photo is too bright. Avoid direct sunlight and glare, or turn off the flash.",
+		}
+	case meta.Sharpness < p.settings.MinSharpness:
+		return &ImageRejectedError{
+			Reason:  ImageRejectedBlurry,
+			Message: "The photo is blurry. Hold the phone steady, tap the screen to focus and take it again.",
+		}
+	}
+	return nil
+}
+
+// scaleDown returns src as RGBA, scaled so its longest edge is at most maxEdge. Transparent
+// areas become white, since JPEG has no alpha.
+func scaleDown(src image.Image, maxEdge int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if longest := max(w, h); maxEdge > 0 && longest > maxEdge {
+		w = max(1, w*maxEdge/longest)
+		h = max(1, h*maxEdge/longest)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	} else {
+		draw.BiLinear.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	}
+	return dst
+}
+
+// orient turns an image stored with the given EXIF orientation upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // flip horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotate 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertically
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// lumaOf returns the image's luminance, 0–255, as rows of pixels.
+func lumaOf(img *image.RGBA) [][]float64 {
+	b := img.Bounds()
+	luma := make([][]float64, b.Dy())
+	for y := range luma {
+		row := make([]float64, b.Dx())
+		for x := range row {
+			i := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+			row[x] = 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+		}
+		luma[y] = row
+	}
+	return luma
+}
+
+// brightness is the mean luminance scaled to 0–1.
+func brightness(luma [][]float64) float64 {
+	var sum float64
+	n := 0
+	for _, row := range luma {
+		for _, v := range row {
+			sum += v
+		}
+		n += len(row)
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n) / 255
+}
+
+// sharpness is the variance of the Laplacian: blurry photos have few strong edges, so the
+// second derivative stays close to zero everywhere.
+func sharpness(luma [][]float64) float64 {
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < len(luma)-1; y++ {
+		for x := 1; x < len(luma[y])-1; x++ {
+			lap := luma[y-1][x] + luma[y+1][x] + luma[y][x-1] + luma[y][x+1] - 4*luma[y][x]
+			sum += lap
+			sumSq += lap * lap
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
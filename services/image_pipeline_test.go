@@ -0,0 +1,197 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/samyaksetu/backend/utils"
+)
+
+var testImageSettings = ImageSettings{
+	MaxEdge:       1600,
+	ThumbnailEdge: 64,
+	Quality:       90,
+	MinEdge:       128,
+	MinSharpness:  15,
+	MinBrightness: 0.08,
+	MaxBrightness: 0.92,
+}
+
+// checkerboard returns a w×h image of 4-pixel squares alternating between the two grey
+// levels: sharp, and as bright as their average.
+func checkerboard(w, h int, dark, light uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := dark
+			if (x/4+y/4)%2 == 0 {
+				v = light
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func testJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withOrientation inserts an EXIF segment holding only the orientation after the JPEG's
+// start-of-image marker.
+func withOrientation(data []byte, orientation byte) []byte {
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0, // little-endian header, IFD0 at 8
+		1, 0, // one entry
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, orientation, 0, 0, 0, // Orientation, SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	segment := append([]byte{0xFF, 0xE1, 0, byte(2 + 6 + len(tiff))}, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image; the stored top-left pixel is marked and must end up where EXIF says
+	const w, h = 3, 2
+	mark := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		orientation  int
+		wantW, wantH int
+		markX, markY int
+	}{
+		{1, w, h, 0, 0},
+		{2, w, h, w - 1, 0},
+		{3, w, h, w - 1, h - 1},
+		{4, w, h, 0, h - 1},
+		{5, h, w, 0, 0},
+		{6, h, w, h - 1, 0},
+		{7, h, w, h - 1, w - 1},
+		{8, h, w, 0, w - 1},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, w, h))
+		src.Set(0, 0, mark)
+
+		got := orient(src, tt.orientation)
+		if b := got.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			continue
+		}
+		if c := got.RGBAAt(tt.markX, tt.markY); c != mark {
+			t.Errorf("orientation %d: marked pixel not at (%d,%d)", tt.orientation, tt.markX, tt.markY)
+		}
+	}
+}
+
+func TestImagePipelineAppliesOrientation(t *testing.T) {
+	pipeline := NewImagePipeline(testImageSettings)
+	data := withOrientation(testJPEG(t, checkerboard(400, 200, 80, 170)), 6)
+
+	processed, err := pipeline.Process(data)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	meta := processed.Metadata
+	if meta.Width != 200 || meta.Height != 400 || meta.OriginalWidth != 200 || meta.OriginalHeight != 400 {
+		t.Errorf("size %dx%d (original %dx%d), want the photo turned upright to 200x400",
+			meta.Width, meta.Height, meta.OriginalWidth, meta.OriginalHeight)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(processed.Data))
+	if err != nil {
+		t.Fatalf("output is not a JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 400 {
+		t.Errorf("encoded size %dx%d, want 200x400", b.Dx(), b.Dy())
+	}
+	if _, err := utils.ReadJPEGExif(processed.Data); err == nil {
+		t.Error("output still carries EXIF metadata")
+	}
+
+	thumb, err := jpeg.Decode(bytes.NewReader(processed.Thumbnail))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Errorf("thumbnail size %dx%d, want 32x64", b.Dx(), b.Dy())
+	}
+}
+
+func TestImagePipelineQualityChecks(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		wantReason string
+	}{
+		{"usable photo", checkerboard(300, 300, 80, 170), ""},
+		{"too small", checkerboard(100, 300, 80, 170), ImageRejectedTooSmall},
+		{"too dark", checkerboard(300, 300, 0, 12), ImageRejectedTooDark},
+		{"too bright", checkerboard(300, 300, 243, 255), ImageRejectedTooBright},
+		{"blurry", checkerboard(300, 300, 128, 128), ImageRejectedBlurry},
+	}
+	pipeline := NewImagePipeline(testImageSettings)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := pipeline.Process(testJPEG(t, tt.img))
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("Process: %v", err)
+				}
+				if m := processed.Metadata; m.Sharpness < testImageSettings.MinSharpness || m.Brightness < 0.3 || m.Brightness > 0.7 {
+					t.Errorf("scores sharpness=%v brightness=%v out of the expected range", m.Sharpness, m.Brightness)
+				}
+				return
+			}
+			var rejected *ImageRejectedError
+			if !errors.As(err, &rejected) {
+				t.Fatalf("error = %v, want an ImageRejectedError", err)
+			}
+			if rejected.Reason != tt.wantReason {
+				t.Errorf("reason = %s, want %s", rejected.Reason, tt.wantReason)
+			}
+		})
+	}
+
+	if _, err := pipeline.Process([]byte("not an image")); err == nil {
+		t.Error("expected an error for data that is not an image")
+	}
+}
+
+func TestImagePipelineNormalize(t *testing.T) {
+	pipeline := NewImagePipeline(testImageSettings)
+	// Small and blurry: Process would reject it, Normalize only re-encodes it
+	data := withOrientation(testJPEG(t, checkerboard(100, 60, 128, 128)), 6)
+
+	picture, err := pipeline.Normalize(data)
+	if err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(picture.Data))
+	if err != nil {
+		t.Fatalf("output is not a JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 60 || b.Dy() != 100 {
+		t.Errorf("encoded size %dx%d, want the picture turned upright to 60x100", b.Dx(), b.Dy())
+	}
+	if _, err := utils.ReadJPEGExif(picture.Data); err == nil {
+		t.Error("output still carries EXIF metadata")
+	}
+
+	if _, err := pipeline.Normalize([]byte("not an image")); err == nil {
+		t.Error("expected an error for data that is not an image")
+	}
+}
@@ -2,18 +2,51 @@
 
 package services
 
-import "mime/multipart"
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
 
 // AIService defines the contract for any AI provider (Gemini, Bedrock, etc.).
+// Every call stops, retries included, once ctx is cancelled or its deadline passes.
 type AIService interface {
-	// AnalyzeSoilImage sends an image to the AI and returns the identified soil type.
-	AnalyzeSoilImage(imageData []byte, mimeType string) (string, error)
+	// AnalyzeSoilImage sends a soil photo to the AI and returns its analysis, validated
+	// against the soil taxonomy in models.
+	AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error)
 
 	// GenerateAdvisory creates an agricultural advisory response based on context.
-	GenerateAdvisory(prompt string) (string, error)
+	GenerateAdvisory(ctx context.Context, prompt string) (string, error)
 
 	// GenerateAdvisoryWithImage creates an advisory response using both text and image.
-	GenerateAdvisoryWithImage(prompt string, imageData []byte, mimeType string) (string, error)
+	GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error)
+
+	// GenerateChat continues a conversation: system carries the instructions and context,
+	// messages the turns so far, oldest first, ending with the user's new message.
+	// system may be empty when the instructions are part of the message.
+	GenerateChat(ctx context.Context, system string, messages []Message) (string, error)
+
+	// StreamChat is GenerateChat delivering the reply while it is generated: onDelta receives
+	// each piece of text in order. It returns the whole reply. If onDelta returns an error the
+	// stream stops and that error is returned together with the text received so far.
+	StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error)
+}
+
+// Roles of the turns in a conversation sent to an AIService.
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation sent to an AIService.
+// An image may be attached to user turns.
+type Message struct {
+	Role      string // MessageRoleUser or MessageRoleAssistant
+	Text      string
+	ImageData []byte
+	MimeType  string
 }
 
 // WeatherData holds structured weather information for API responses.
@@ -47,28 +80,52 @@ type ForecastItem struct {
 type WeatherService interface {
 	// GetWeather fetches current weather data for given coordinates.
 	// Returns a human-readable weather summary string.
-	GetWeather(latitude, longitude float64) (string, error)
+	GetWeather(ctx context.Context, latitude, longitude float64) (string, error)
 
 	// GetWeatherDetailed fetches current weather as structured data.
-	GetWeatherDetailed(latitude, longitude float64) (*WeatherData, error)
+	GetWeatherDetailed(ctx context.Context, latitude, longitude float64) (*WeatherData, error)
 
 	// GetForecast fetches a 5-day / 3-hour forecast for the given coordinates.
-	GetForecast(latitude, longitude float64) ([]ForecastItem, error)
+	GetForecast(ctx context.Context, latitude, longitude float64) ([]ForecastItem, error)
 }
 
 // StorageService defines the contract for any file storage provider (local, S3, etc.).
+// Files are addressed by keys such as "soil/1709230501.jpg"; the database stores keys, and
+// clients get short-lived URLs, so stored files are never publicly readable.
 type StorageService interface {
-	// SaveFile stores an uploaded file and returns the stored file path.
-	SaveFile(file *multipart.FileHeader, subDir string) (string, error)
+	// SaveBytes stores raw bytes as a file and returns its key.
+	SaveBytes(ctx context.Context, data []byte, contentType, ext, subDir string) (string, error)
+
+	// Put stores raw bytes under the given key, replacing any file already there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Open returns a reader for a stored file. The caller must close it. A missing file
+	// returns ErrFileNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// ReadFile returns the contents of a stored file.
+	ReadFile(ctx context.Context, key string) ([]byte, error)
+
+	// Stat describes a stored file. A missing file returns ErrFileNotFound.
+	Stat(ctx context.Context, key string) (*FileInfo, error)
+
+	// URL returns a link to a stored file that works without an API token until ttl has
+	// passed. A ttl of zero or less uses the storage's default lifetime.
+	URL(ctx context.Context, key string, ttl time.Duration) (string, error)
+
+	// Delete removes a stored file. Deleting a file that no longer exists is not an error.
+	Delete(ctx context.Context, key string) error
 
-	// SaveBytes stores raw bytes as a file and returns the stored file path.
-	SaveBytes(data []byte, contentType, ext, subDir string) (string, error)
+	// DeleteOlderThan removes the files under subDir last modified before cutoff, except those
+	// keep (which may be nil) reports true for, and returns how many were removed.
+	DeleteOlderThan(ctx context.Context, subDir string, cutoff time.Time, keep func(key string) bool) (int, error)
 }
 
 // VoiceService defines the contract for speech-to-text and text-to-speech.
+// language is a models.SupportedLanguages code such as "hi"; empty means auto-detect / default voice.
 type VoiceService interface {
-	// TextToSpeech converts text to speech and returns the public URL of the audio file.
-	TextToSpeech(text string) (string, error)
+	// TextToSpeech converts text to speech and returns the storage key of the audio file.
+	TextToSpeech(ctx context.Context, text, language string) (string, error)
 	// SpeechToText converts speech to text. It expects raw audio bytes.
-	SpeechToText(audioData []byte, ext string) (string, error)
+	SpeechToText(ctx context.Context, audioData []byte, ext, language string) (string, error)
 }
@@ -0,0 +1,219 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing tokens.
+const minRSAKeyBits = 2048
+
+// jwtKey is a single signing key in the keyring, identified by its kid.
+type jwtKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// JWTKeyring holds every key that may verify tokens and the one key used to sign new tokens.
+// Rotating keys means adding the new key, switching the active kid, and removing the old
+// key once the longest-lived token signed with it has expired.
+type JWTKeyring struct {
+	keys      map[string]*jwtKey
+	activeKID string
+}
+
+// JWK is a single public key in JSON Web Key format.
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWTKeyring creates an empty keyring.
+func NewJWTKeyring() *JWTKeyring {
+	return &JWTKeyring{keys: make(map[string]*jwtKey)}
+}
+
+// AddHMACKey adds a shared-secret HS256 key. HMAC keys are never published in the JWKS.
+func (k *JWTKeyring) AddHMACKey(kid string, secret []byte) error {
+	if len(secret) == 0 {
+		return fmt.Errorf("HMAC key %q is empty", kid)
+	}
+	return k.add(&jwtKey{kid: kid, method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret})
+}
+
+// AddPrivateKeyPEM adds an RSA (RS256) or Ed25519 (EdDSA) private key in PEM format.
+// PKCS#8 ("PRIVATE KEY") and PKCS#1 ("RSA PRIVATE KEY") encodings are accepted.
+func (k *JWTKeyring) AddPrivateKeyPEM(kid string, pemData []byte) error {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return fmt.Errorf("key %q: no PEM block found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return fmt.Errorf("key %q: unsupported PEM block type %q", kid, block.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("key %q: %w", kid, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("key %q: RSA key must be at least %d bits", kid, minRSAKeyBits)
+		}
+		return k.add(&jwtKey{kid: kid, method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey})
+	case ed25519.PrivateKey:
+		return k.add(&jwtKey{kid: kid, method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()})
+	default:
+		return fmt.Errorf("key %q: unsupported key type %T (use RSA or Ed25519)", kid, parsed)
+	}
+}
+
+// AddPrivateKeyFile reads a PEM private key from disk and adds it under the given kid.
+func (k *JWTKeyring) AddPrivateKeyFile(kid, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("key %q: failed to read %s: %w", kid, path, err)
+	}
+	return k.AddPrivateKeyPEM(kid, data)
+}
+
+// SetActive chooses which key signs new tokens.
+func (k *JWTKeyring) SetActive(kid string) error {
+	if _, ok := k.keys[kid]; !ok {
+		return fmt.Errorf("active key %q is not in the keyring", kid)
+	}
+	k.activeKID = kid
+	return nil
+}
+
+// ActiveKID returns the kid of the signing key.
+func (k *JWTKeyring) ActiveKID() string {
+	return k.activeKID
+}
+
+// Algorithms returns the distinct signing algorithms present in the keyring.
+func (k *JWTKeyring) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range k.keys {
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			algs = append(algs, key.method.Alg())
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWKS returns the public halves of all asymmetric keys so other services can verify tokens.
+func (k *JWTKeyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.sortedKeys() {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kid: key.kid,
+				Kty: "RSA",
+				Alg: key.method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kid: key.kid,
+				Kty: "OKP",
+				Alg: key.method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+// sign signs the token with the active key and stamps its kid header.
+func (k *JWTKeyring) sign(claims jwt.Claims) (string, error) {
+	key, ok := k.keys[k.activeKID]
+	if !ok {
+		return "", errors.New("no active JWT signing key configured")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.signKey)
+}
+
+// keyFunc selects the verification key by the token's kid header and checks the algorithm matches.
+func (k *JWTKeyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.verifyKey, nil
+}
+
+func (k *JWTKeyring) add(key *jwtKey) error {
+	if key.kid == "" {
+		return errors.New("key ID (kid) must not be empty")
+	}
+	if _, exists := k.keys[key.kid]; exists {
+		return fmt.Errorf("duplicate key ID %q", key.kid)
+	}
+	k.keys[key.kid] = key
+	if k.activeKID == "" {
+		k.activeKID = key.kid
+	}
+	return nil
+}
+
+func (k *JWTKeyring) sortedKeys() []*jwtKey {
+	keys := make([]*jwtKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].kid < keys[j].kid })
+	return keys
+}
@@ -0,0 +1,154 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ed25519PEM returns a fresh Ed25519 private key in PKCS#8 PEM format.
+func ed25519PEM(t *testing.T) (ed25519.PublicKey, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// newTestKeyring returns a keyring with an HS256 key "hs" and an active EdDSA key "ed".
+func newTestKeyring(t *testing.T) (*JWTKeyring, ed25519.PublicKey) {
+	t.Helper()
+	keyring := NewJWTKeyring()
+	if err := keyring.AddHMACKey("hs", []byte("legacy-secret")); err != nil {
+		t.Fatal(err)
+	}
+	pub, pemData := ed25519PEM(t)
+	if err := keyring.AddPrivateKeyPEM("ed", pemData); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetActive("ed"); err != nil {
+		t.Fatal(err)
+	}
+	return keyring, pub
+}
+
+func TestJWTKeyringValidateToken(t *testing.T) {
+	keyring, edPublic := newTestKeyring(t)
+	svc := NewJWTService(keyring, time.Hour, 24*time.Hour)
+
+	// forge signs a farmer token with the given header kid, method and key
+	forge := func(t *testing.T, kid string, method jwt.SigningMethod, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, JWTClaims{
+			FarmerID:  "farmer-1",
+			SessionID: "session-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    svc.issuer,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	t.Run("active key", func(t *testing.T) {
+		token, err := svc.GenerateToken("farmer-1", "9876543210", "Asha", "session-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := svc.ValidateToken(token)
+		if err != nil || claims.FarmerID != "farmer-1" {
+			t.Fatalf("ValidateToken = %+v, %v", claims, err)
+		}
+	})
+
+	t.Run("key rotated out of signing", func(t *testing.T) {
+		token := forge(t, "hs", jwt.SigningMethodHS256, []byte("legacy-secret"))
+		if _, err := svc.ValidateToken(token); err != nil {
+			t.Fatalf("token signed with an inactive key in the keyring was rejected: %v", err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr string
+	}{
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				return forge(t, "retired", jwt.SigningMethodHS256, []byte("legacy-secret"))
+			},
+			wantErr: "unknown signing key",
+		},
+		{
+			name: "no kid",
+			token: func(t *testing.T) string {
+				return forge(t, "", jwt.SigningMethodHS256, []byte("legacy-secret"))
+			},
+			wantErr: "no kid",
+		},
+		{
+			// HS256 keyed with the public Ed25519 key, the classic algorithm confusion attack
+			name: "algorithm does not match the key",
+			token: func(t *testing.T) string {
+				return forge(t, "ed", jwt.SigningMethodHS256, []byte(edPublic))
+			},
+			wantErr: "unexpected signing method",
+		},
+		{
+			name: "algorithm not in the keyring",
+			token: func(t *testing.T) string {
+				return forge(t, "hs", jwt.SigningMethodHS512, []byte("legacy-secret"))
+			},
+			wantErr: "signing method",
+		},
+		{
+			name: "wrong secret for the kid",
+			token: func(t *testing.T) string {
+				return forge(t, "hs", jwt.SigningMethodHS256, []byte("guessed-secret"))
+			},
+			wantErr: "signature is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.ValidateToken(tt.token(t))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTKeyringSetActive(t *testing.T) {
+	keyring, _ := newTestKeyring(t)
+	if err := keyring.SetActive("missing"); err == nil {
+		t.Fatal("expected an error activating a kid that is not in the keyring")
+	}
+	if keyring.ActiveKID() != "ed" {
+		t.Fatalf("active kid = %q, want it unchanged", keyring.ActiveKID())
+	}
+	if err := keyring.AddHMACKey("hs", []byte("another")); err == nil {
+		t.Fatal("expected an error for a duplicate kid")
+	}
+}
@@ -3,59 +3,105 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/samyaksetu/backend/models"
 )
 
 // JWTService handles creation and validation of JSON Web Tokens for session management.
+// Access tokens are short-lived, signed with the keyring's active key and bound to a
+// server-side session; refresh tokens are opaque random strings whose hash is stored on the session.
 type JWTService struct {
-	secretKey []byte
-	issuer    string
+	keyring    *JWTKeyring
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
 }
 
-// JWTClaims extends standard JWT claims with farmer-specific data.
+// JWTClaims extends standard JWT claims with the caller's identity.
+// Farmer tokens carry FarmerID; staff tokens carry UserID, a staff role and, for
+// extension officers, the block they cover.
 type JWTClaims struct {
-	FarmerID string `json:"farmerId"`
-	Phone    string `json:"phone"`
-	Name     string `json:"name"`
+	FarmerID  string `json:"farmerId,omitempty"`
+	UserID    string `json:"userId,omitempty"`
+	Phone     string `json:"phone"`
+	Name      string `json:"name"`
+	Role      string `json:"role,omitempty"`
+	Block     string `json:"block,omitempty"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// NewJWTService creates a new JWT service with the given secret key.
-func NewJWTService(secret string) *JWTService {
+// NewJWTService creates a new JWT service with the given keyring and token lifetimes.
+func NewJWTService(keyring *JWTKeyring, accessTTL, refreshTTL time.Duration) *JWTService {
 	return &JWTService{
-		secretKey: []byte(secret),
-		issuer:    "SamyakSetu",
+		keyring:    keyring,
+		issuer:     "SamyakSetu",
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
 	}
 }
 
-// GenerateToken creates a signed JWT token for the given farmer that expires in 7 days.
-func (s *JWTService) GenerateToken(farmerID, phone, name string) (string, error) {
+// AccessTTL returns how long an access token stays valid.
+func (s *JWTService) AccessTTL() time.Duration {
+	return s.accessTTL
+}
+
+// RefreshTTL returns how long a refresh token (and its session) stays valid without being used.
+func (s *JWTService) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// GenerateToken creates a signed access token for the given farmer bound to a session.
+func (s *JWTService) GenerateToken(farmerID, phone, name, sessionID string) (string, error) {
 	claims := JWTClaims{
-		FarmerID: farmerID,
-		Phone:    phone,
-		Name:     name,
+		FarmerID:  farmerID,
+		Phone:     phone,
+		Name:      name,
+		Role:      models.RoleFarmer,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    s.issuer,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7 days
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTTL)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
+	return s.keyring.sign(claims)
+}
+
+// GenerateStaffToken creates a signed access token for a staff user bound to a session.
+func (s *JWTService) GenerateStaffToken(user *models.User, sessionID string) (string, error) {
+	claims := JWTClaims{
+		UserID:    user.ID.Hex(),
+		Phone:     user.Phone,
+		Name:      user.Name,
+		Role:      user.Role,
+		Block:     user.Block,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTTL)),
+		},
+	}
+
+	return s.keyring.sign(claims)
 }
 
 // ValidateToken parses and validates the JWT token string and returns the claims.
 func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return s.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keyring.keyFunc,
+		jwt.WithValidMethods(s.keyring.Algorithms()),
+		jwt.WithIssuer(s.issuer),
+	)
 
 	if err != nil {
 		return nil, err
@@ -66,5 +112,50 @@ func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.SessionID == "" {
+		return nil, errors.New("token is not bound to a session")
+	}
+	if claims.UserID != "" && !models.IsStaffRole(claims.Role) {
+		return nil, errors.New("staff token without a staff role")
+	}
+	if claims.UserID == "" && claims.FarmerID == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if claims.FarmerID != "" && claims.Role != "" && claims.Role != models.RoleFarmer {
+		return nil, errors.New("farmer token with a staff role")
+	}
+
 	return claims, nil
 }
+
+// JWKS returns the public keys that verify access tokens.
+func (s *JWTService) JWKS() JWKSet {
+	return s.keyring.JWKS()
+}
+
+// GenerateRefreshToken creates a refresh token for the given session.
+// The token has the form "<sessionID>.<secret>"; only its hash should be stored.
+func GenerateRefreshToken(sessionID string) (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	token = sessionID + "." + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashRefreshToken(token), nil
+}
+
+// ParseRefreshToken extracts the session ID from a refresh token.
+func ParseRefreshToken(token string) (string, error) {
+	sessionID, secret, found := strings.Cut(token, ".")
+	if !found || sessionID == "" || secret == "" {
+		return "", errors.New("malformed refresh token")
+	}
+	return sessionID, nil
+}
+
+// HashRefreshToken returns the hex SHA-256 of a refresh token for storage and comparison.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
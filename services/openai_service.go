@@ -0,0 +1,323 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// OpenAICompatibleService implements AIService against any server speaking the OpenAI
+// chat-completions API: OpenAI itself, Ollama, vLLM or a llama.cpp server. Images are sent
+// inline as base64 data URLs, so vision needs a multimodal model (e.g. llava, qwen2.5vl).
+type OpenAICompatibleService struct {
+	baseURL     string
+	apiKey      string
+	model       string
+	visionModel string
+	timeout     time.Duration
+	httpClient  *http.Client
+}
+
+// NewOpenAICompatibleService creates a client for the chat-completions API under baseURL
+// (e.g. "http://localhost:11434/v1" for Ollama). apiKey may be empty for local servers.
+// visionModel is used for requests carrying an image and defaults to model. timeout bounds
+// each attempt; small models on a CPU can take minutes to answer.
+func NewOpenAICompatibleService(baseURL, apiKey, model, visionModel string, timeout time.Duration) (*OpenAICompatibleService, error) {
+	if baseURL == "" {
+		return nil, errors.New("base URL is required")
+	}
+	if model == "" {
+		return nil, errors.New("model is required")
+	}
+	if visionModel == "" {
+		visionModel = model
+	}
+
+	log.Printf("INFO: OpenAI-compatible client initialized (%s, model=%s vision=%s)", baseURL, model, visionModel)
+	return &OpenAICompatibleService{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		apiKey:      apiKey,
+		model:       model,
+		visionModel: visionModel,
+		timeout:     timeout,
+		httpClient:  &http.Client{},
+	}, nil
+}
+
+// AnalyzeSoilImage sends a soil image to the vision model and returns its structured analysis.
+func (s *OpenAICompatibleService) AnalyzeSoilImage(ctx context.Context, imageData []byte, mimeType string) (*models.SoilAnalysis, error) {
+	return analyzeSoil(ctx, func(ctx context.Context, prompt string) (string, error) {
+		return s.GenerateAdvisoryWithImage(ctx, prompt, imageData, mimeType)
+	})
+}
+
+// GenerateAdvisory sends a single prompt to the text model.
+func (s *OpenAICompatibleService) GenerateAdvisory(ctx context.Context, prompt string) (string, error) {
+	return s.GenerateChat(ctx, "", []Message{{Role: MessageRoleUser, Text: prompt}})
+}
+
+// GenerateAdvisoryWithImage sends a prompt and an image to the vision model.
+func (s *OpenAICompatibleService) GenerateAdvisoryWithImage(ctx context.Context, prompt string, imageData []byte, mimeType string) (string, error) {
+	return s.GenerateChat(ctx, "", []Message{{Role: MessageRoleUser, Text: prompt, ImageData: imageData, MimeType: mimeType}})
+}
+
+// GenerateChat sends the conversation so far and returns the model's reply.
+func (s *OpenAICompatibleService) GenerateChat(ctx context.Context, system string, messages []Message) (string, error) {
+	payload, err := s.chatPayload(system, messages, false)
+	if err != nil {
+		return "", err
+	}
+	return s.completeWithRetry(ctx, payload, 2)
+}
+
+// StreamChat is GenerateChat delivering the reply as the model generates it.
+func (s *OpenAICompatibleService) StreamChat(ctx context.Context, system string, messages []Message, onDelta func(delta string) error) (string, error) {
+	payload, err := s.chatPayload(system, messages, true)
+	if err != nil {
+		return "", err
+	}
+	return s.streamWithRetry(ctx, payload, onDelta, 2)
+}
+
+// --- OpenAI chat-completions structs ---
+
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // a string, or []openAIContentPart when an image is attached
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// openAIStatusError is a non-200 answer from the server. Client errors other than
+// timeouts and rate limits are not worth retrying.
+type openAIStatusError struct {
+	status int
+	body   string
+}
+
+func (e *openAIStatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.body)
+}
+
+func (e *openAIStatusError) retryable() bool {
+	return e.status >= 500 || e.status == http.StatusTooManyRequests || e.status == http.StatusRequestTimeout
+}
+
+// chatPayload builds the request body. Turns with an image switch the request to the
+// vision model.
+func (s *OpenAICompatibleService) chatPayload(system string, messages []Message, stream bool) ([]byte, error) {
+	messages, err := normalizeMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	req := openAIRequest{Model: s.model, Temperature: 0.7, Stream: stream}
+	if system != "" {
+		req.Messages = append(req.Messages, openAIMessage{Role: "system", Content: system})
+	}
+	for _, msg := range messages {
+		if len(msg.ImageData) == 0 {
+			req.Messages = append(req.Messages, openAIMessage{Role: msg.Role, Content: msg.Text})
+			continue
+		}
+		req.Model = s.visionModel
+		req.Temperature = 0.4
+		dataURL := "data:" + msg.MimeType + ";base64," + base64.StdEncoding.EncodeToString(msg.ImageData)
+		req.Messages = append(req.Messages, openAIMessage{Role: msg.Role, Content: []openAIContentPart{
+			{Type: "text", Text: msg.Text},
+			{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURL}},
+		}})
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return payload, nil
+}
+
+// post sends a chat-completions request and returns the response once its status is 200.
+func (s *OpenAICompatibleService) post(ctx context.Context, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &openAIStatusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// completeWithRetry sends a non-streaming request with retry logic.
+func (s *OpenAICompatibleService) completeWithRetry(ctx context.Context, payload []byte, maxRetries int) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: OpenAI-compatible retry attempt %d/%d", attempt, maxRetries)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		text, err := s.complete(callCtx, payload)
+		cancel()
+		if err == nil {
+			return text, nil
+		}
+
+		lastErr = fmt.Errorf("openai-compatible API error: %w", err)
+		var statusErr *openAIStatusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			return "", lastErr
+		}
+	}
+
+	return "", fmt.Errorf("openai-compatible request failed after %d retries: %w", maxRetries, lastErr)
+}
+
+func (s *OpenAICompatibleService) complete(ctx context.Context, payload []byte) (string, error) {
+	resp, err := s.post(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var parsed openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(parsed.Choices) == 0 || strings.TrimSpace(parsed.Choices[0].Message.Content) == "" {
+		return "", errors.New("empty response")
+	}
+	return parsed.Choices[0].Message.Content, nil
+}
+
+// streamWithRetry streams a reply, passing each text delta to onDelta. Only failures before
+// the first piece of text are retried: once text has reached the caller the reply cannot be
+// restarted.
+func (s *OpenAICompatibleService) streamWithRetry(ctx context.Context, payload []byte, onDelta func(string) error, maxRetries int) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := waitBeforeRetry(ctx, attempt, lastErr); err != nil {
+				return "", err
+			}
+			log.Printf("INFO: OpenAI-compatible stream retry attempt %d/%d", attempt, maxRetries)
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		resp, err := s.post(callCtx, payload)
+		if err != nil {
+			cancel()
+			lastErr = fmt.Errorf("openai-compatible stream API error: %w", err)
+			var statusErr *openAIStatusError
+			if errors.As(err, &statusErr) && !statusErr.retryable() {
+				return "", lastErr
+			}
+			continue
+		}
+
+		var reply strings.Builder
+		var callbackErr error
+		done := false
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				done = true
+				break
+			}
+			var chunk openAIResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) == 0 {
+				continue
+			}
+			delta := chunk.Choices[0].Delta.Content
+			if delta == "" {
+				continue
+			}
+			reply.WriteString(delta)
+			if callbackErr = onDelta(delta); callbackErr != nil {
+				break
+			}
+		}
+		streamErr := scanner.Err()
+		if streamErr == nil && !done && callbackErr == nil {
+			// The server closed the stream without its end marker, so the reply may be cut off
+			streamErr = io.ErrUnexpectedEOF
+		}
+		resp.Body.Close()
+		cancel()
+
+		if callbackErr != nil {
+			return reply.String(), callbackErr
+		}
+		if reply.Len() > 0 {
+			if streamErr != nil {
+				return reply.String(), fmt.Errorf("openai-compatible stream interrupted: %w", streamErr)
+			}
+			return reply.String(), nil
+		}
+		lastErr = errors.New("openai-compatible stream returned empty response")
+		if streamErr != nil {
+			lastErr = fmt.Errorf("openai-compatible stream error: %w", streamErr)
+		}
+	}
+
+	return "", fmt.Errorf("openai-compatible stream failed after %d retries: %w", maxRetries, lastErr)
+}
@@ -0,0 +1,270 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openAIStandIn is a local chat-completions server. Each request is answered by the next
+// handler in turn; the last one answers any further requests.
+type openAIStandIn struct {
+	*httptest.Server
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+	requests []openAIRequest
+	auth     []string
+}
+
+func newOpenAIStandIn(t *testing.T, handlers ...http.HandlerFunc) *openAIStandIn {
+	t.Helper()
+	s := &openAIStandIn{handlers: handlers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		n := len(s.requests)
+		s.requests = append(s.requests, req)
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		handler := s.handlers[min(n, len(s.handlers)-1)]
+		s.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *openAIStandIn) calls() []openAIRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openAIRequest(nil), s.requests...)
+}
+
+func (s *openAIStandIn) service(t *testing.T) *OpenAICompatibleService {
+	t.Helper()
+	svc, err := NewOpenAICompatibleService(s.URL+"/v1/", "secret", "llama3", "llava", 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewOpenAICompatibleService: %v", err)
+	}
+	return svc
+}
+
+// openAIReply answers with a complete chat-completions response.
+func openAIReply(content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": %q}}]}`, content)
+	}
+}
+
+// openAIStatus answers with an error status.
+func openAIStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "nope"}}`, code)
+	}
+}
+
+// openAIStream answers with SSE chunks carrying deltas, followed by [DONE] if done.
+func openAIStream(done bool, deltas ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive comment\n\n")
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"role\": \"assistant\"}}]}\n\n")
+		for _, d := range deltas {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", d)
+			w.(http.Flusher).Flush()
+		}
+		if done {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}
+	}
+}
+
+// openAICutStream sends deltas and then drops the connection in the middle of the response.
+func openAICutStream(deltas ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, d := range deltas {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", d)
+		}
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestOpenAICompatibleGenerateChat(t *testing.T) {
+	t.Run("reply", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIReply("Sow wheat in November."))
+		got, err := server.service(t).GenerateChat(context.Background(), "You are an agronomist.", []Message{
+			{Role: MessageRoleUser, Text: "When do I sow wheat?"},
+		})
+		if err != nil || got != "Sow wheat in November." {
+			t.Fatalf("GenerateChat = %q, %v", got, err)
+		}
+
+		calls := server.calls()
+		if len(calls) != 1 {
+			t.Fatalf("server called %d times, want 1", len(calls))
+		}
+		req := calls[0]
+		if req.Model != "llama3" || req.Stream {
+			t.Errorf("model = %q stream = %v, want the text model without streaming", req.Model, req.Stream)
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[0].Content != "You are an agronomist." {
+			t.Errorf("messages = %+v, want the system prompt first", req.Messages)
+		}
+		if req.Messages[1].Role != MessageRoleUser || req.Messages[1].Content != "When do I sow wheat?" {
+			t.Errorf("user message = %+v", req.Messages[1])
+		}
+		if server.auth[0] != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the API key", server.auth[0])
+		}
+	})
+
+	t.Run("client error is not retried", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStatus(http.StatusBadRequest), openAIReply("too late"))
+		_, err := server.service(t).GenerateAdvisory(context.Background(), "hello")
+		var statusErr *openAIStatusError
+		if !errors.As(err, &statusErr) || statusErr.status != http.StatusBadRequest {
+			t.Fatalf("error = %v, want the 400", err)
+		}
+		if n := len(server.calls()); n != 1 {
+			t.Fatalf("server called %d times, want 1", n)
+		}
+	})
+
+	t.Run("server error is retried", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStatus(http.StatusServiceUnavailable), openAIReply("back again"))
+		got, err := server.service(t).GenerateAdvisory(context.Background(), "hello")
+		if err != nil || got != "back again" {
+			t.Fatalf("GenerateAdvisory = %q, %v; want the retry's reply", got, err)
+		}
+		if n := len(server.calls()); n != 2 {
+			t.Fatalf("server called %d times, want 2", n)
+		}
+	})
+}
+
+func TestOpenAICompatibleVisionRequest(t *testing.T) {
+	server := newOpenAIStandIn(t, openAIReply("Looks like black soil."))
+	image := []byte("\xff\xd8\xff\xe0 jpeg bytes")
+	if _, err := server.service(t).GenerateAdvisoryWithImage(context.Background(), "What soil is this?", image, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := server.calls()[0]
+	if req.Model != "llava" {
+		t.Errorf("model = %q, want the vision model", req.Model)
+	}
+	if len(req.Messages) != 1 {
+		t.Fatalf("messages = %+v, want one user turn", req.Messages)
+	}
+	// Content decodes as a generic list of parts
+	parts, ok := req.Messages[0].Content.([]interface{})
+	if !ok || len(parts) != 2 {
+		t.Fatalf("content = %#v, want text and image parts", req.Messages[0].Content)
+	}
+	text, _ := parts[0].(map[string]interface{})
+	if text["type"] != "text" || text["text"] != "What soil is this?" {
+		t.Errorf("text part = %v", text)
+	}
+	img, _ := parts[1].(map[string]interface{})
+	imageURL, _ := img["image_url"].(map[string]interface{})
+	want := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(image)
+	if img["type"] != "image_url" || imageURL["url"] != want {
+		t.Errorf("image part = %v, want a data URL of the image", img)
+	}
+}
+
+func TestOpenAICompatibleStreamChat(t *testing.T) {
+	messages := []Message{{Role: MessageRoleUser, Text: "hello"}}
+
+	collect := func(t *testing.T, server *openAIStandIn) (string, string, error) {
+		t.Helper()
+		var streamed strings.Builder
+		got, err := server.service(t).StreamChat(context.Background(), "", messages, func(delta string) error {
+			streamed.WriteString(delta)
+			return nil
+		})
+		return got, streamed.String(), err
+	}
+
+	t.Run("complete stream", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStream(true, "Sow ", "in ", "November."))
+		got, streamed, err := collect(t, server)
+		if err != nil || got != "Sow in November." || streamed != got {
+			t.Fatalf("StreamChat = %q (streamed %q), %v", got, streamed, err)
+		}
+		if !server.calls()[0].Stream {
+			t.Error("request did not ask for a stream")
+		}
+	})
+
+	t.Run("connection dropped mid-reply", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAICutStream("Sow ", "in "), openAIStream(true, "retried"))
+		got, streamed, err := collect(t, server)
+		if err == nil {
+			t.Fatal("expected an error for a stream cut off mid-reply")
+		}
+		if got != "Sow in " || streamed != got {
+			t.Fatalf("reply = %q (streamed %q), want the partial text", got, streamed)
+		}
+		if n := len(server.calls()); n != 1 {
+			t.Fatalf("server called %d times, want no retry once text was streamed", n)
+		}
+	})
+
+	t.Run("stream ended without [DONE]", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStream(false, "Sow ", "in "))
+		got, _, err := collect(t, server)
+		if !errors.Is(err, io.ErrUnexpectedEOF) || got != "Sow in " {
+			t.Fatalf("StreamChat = %q, %v; want the partial text and io.ErrUnexpectedEOF", got, err)
+		}
+	})
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStream(true, "one ", "two ", "three"))
+		stop := errors.New("client gone")
+		got, err := server.service(t).StreamChat(context.Background(), "", messages, func(delta string) error {
+			if delta == "two " {
+				return stop
+			}
+			return nil
+		})
+		if !errors.Is(err, stop) || got != "one two " {
+			t.Fatalf("StreamChat = %q, %v; want the text so far and the callback's error", got, err)
+		}
+	})
+
+	t.Run("client error before any text is not retried", func(t *testing.T) {
+		server := newOpenAIStandIn(t, openAIStatus(http.StatusUnauthorized), openAIStream(true, "too late"))
+		if _, _, err := collect(t, server); err == nil {
+			t.Fatal("expected an error")
+		}
+		if n := len(server.calls()); n != 1 {
+			t.Fatalf("server called %d times, want 1", n)
+		}
+	})
+}
@@ -4,13 +4,20 @@ package services
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"io"
 	"log"
 )
 
+// OTPDelivery identifies an SMS accepted by a provider, so delivery receipts can be matched to it.
+type OTPDelivery struct {
+	Provider  string
+	MessageID string
+}
+
 // OTPService handles sending SMS OTPs to a phone number.
 type OTPService interface {
-	SendOTP(phone, code string) error
+	SendOTP(phone, code string) (*OTPDelivery, error)
 }
 
 // MockOTPService logs the OTP to the console instead of sending a real SMS.
@@ -21,11 +28,14 @@ func NewMockOTPService() *MockOTPService {
 	return &MockOTPService{}
 }
 
-func (s *MockOTPService) SendOTP(phone, code string) error {
+func (s *MockOTPService) SendOTP(phone, code string) (*OTPDelivery, error) {
 	log.Printf("---------------------------------------------------------")
 	log.Printf("[MOCK SMS] To: %s | Message: Your SamyakSetu verification code is: %s", phone, code)
 	log.Printf("---------------------------------------------------------")
-	return nil
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return &OTPDelivery{Provider: "mock", MessageID: "mock-" + hex.EncodeToString(id)}, nil
 }
 
 // GenerateOTP generates a random 6-digit number string.
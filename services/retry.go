@@ -0,0 +1,23 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// waitBeforeRetry sleeps for the back-off before the given retry attempt. It returns early
+// once ctx is done, wrapping ctx's error together with the error that caused the retry.
+func waitBeforeRetry(ctx context.Context, attempt int, lastErr error) error {
+	timer := time.NewTimer(time.Duration(attempt) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+	case <-timer.C:
+		return nil
+	}
+}
@@ -5,101 +5,234 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"mime/multipart"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-// S3StorageService implements StorageService using AWS S3.
+// s3DeleteBatch is the most keys one DeleteObjects call accepts.
+const s3DeleteBatch = 1000
+
+// S3Settings configures S3 storage.
+type S3Settings struct {
+	Region    string
+	AccessKey string // with SecretKey; both empty uses the default AWS credential chain
+	SecretKey string
+	Bucket    string
+	Endpoint  string        // S3-compatible server such as MinIO, e.g. http://localhost:9000; empty for AWS
+	PathStyle bool          // address the bucket in the path (endpoint/bucket/key), as MinIO needs
+	URLTTL    time.Duration // default lifetime of presigned URLs
+}
+
+// S3StorageService implements StorageService using AWS S3 or an S3-compatible server. The
+// bucket can stay private: files are handed out as presigned GET URLs.
 type S3StorageService struct {
 	client     *s3.Client
+	presigner  *s3.PresignClient
 	bucketName string
 	region     string
+	urlTTL     time.Duration
 }
 
-// NewS3StorageService initializes a new S3 client and returns the S3StorageService.
-func NewS3StorageService(region, accessKey, secretKey, bucketName string) (*S3StorageService, error) {
-	// Create custom credentials provider
-	creds := credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
-
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(creds),
-	)
+// NewS3StorageService initializes a new S3 client and returns the S3StorageService. Its
+// presigned URLs are valid for settings.URLTTL unless a call asks otherwise.
+func NewS3StorageService(settings S3Settings) (*S3StorageService, error) {
+	region := settings.Region
+	if region == "" && settings.Endpoint != "" {
+		// S3-compatible servers accept any region, but requests must still be signed for one
+		region = "us-east-1"
+	}
+	cfg, err := loadAWSConfig(context.TODO(), region, settings.AccessKey, settings.SecretKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
-	log.Printf("INFO: AWS S3 storage initialized to bucket: %s", bucketName)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if settings.Endpoint != "" {
+			o.BaseEndpoint = aws.String(settings.Endpoint)
+		}
+		o.UsePathStyle = settings.PathStyle
+	})
+	if settings.Endpoint != "" {
+		log.Printf("INFO: S3 storage initialized to bucket %s at %s (path-style=%v)", settings.Bucket, settings.Endpoint, settings.PathStyle)
+	} else {
+		log.Printf("INFO: AWS S3 storage initialized to bucket: %s", settings.Bucket)
+	}
 
 	return &S3StorageService{
 		client:     client,
-		bucketName: bucketName,
+		presigner:  s3.NewPresignClient(client),
+		bucketName: settings.Bucket,
 		region:     region,
+		urlTTL:     settings.URLTTL,
 	}, nil
 }
 
-// SaveFile uploads a file to S3 and returns the public URL.
-func (s *S3StorageService) SaveFile(file *multipart.FileHeader, subDir string) (string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	uniqueName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
+// SaveBytes creates a file from raw bytes in S3 and returns its key.
+func (s *S3StorageService) SaveBytes(ctx context.Context, data []byte, contentType, ext, subDir string) (string, error) {
+	s3Key := fmt.Sprintf("%s/%d%s", subDir, time.Now().UnixNano(), ext)
+	if err := s.Put(ctx, s3Key, data, contentType); err != nil {
+		return "", err
+	}
+	return s3Key, nil
+}
 
-	// Create the S3 key (path inside bucket)
-	// Example: soil/1709230501.jpg
-	s3Key := fmt.Sprintf("%s/%s", subDir, uniqueName)
+// Put uploads raw bytes to the object with the given key.
+func (s *S3StorageService) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload bytes to S3: %w", err)
+	}
+	return nil
+}
 
-	// Open the uploaded file
-	src, err := file.Open()
+// Open streams an object from S3.
+func (s *S3StorageService) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, key)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
 	}
-	defer src.Close()
+	return out.Body, nil
+}
 
-	// Get file content type
-	contentType := file.Header.Get("Content-Type")
+// ReadFile downloads an object from S3.
+func (s *S3StorageService) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	body, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
 
-	// Upload directly to S3
-	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(s3Key),
-		Body:        src,
-		ContentType: aws.String(contentType),
+// Stat reads an object's metadata from S3.
+func (s *S3StorageService) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.objectKey(key)),
 	})
-
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, key)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+		return nil, fmt.Errorf("failed to stat S3 object: %w", err)
 	}
+	return &FileInfo{
+		Key:         s.objectKey(key),
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+		ModTime:     aws.ToTime(out.LastModified),
+	}, nil
+}
 
-	// Construct public URL
-	publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, s3Key)
-	return publicURL, nil
+// URL returns a presigned GET URL for the object.
+func (s *S3StorageService) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = s.urlTTL
+	}
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.objectKey(key)),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 URL: %w", err)
+	}
+	return req.URL, nil
 }
 
-// SaveBytes creates a file from raw bytes in S3 and returns the public URL.
-func (s *S3StorageService) SaveBytes(data []byte, contentType, ext, subDir string) (string, error) {
-	uniqueName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	s3Key := fmt.Sprintf("%s/%s", subDir, uniqueName)
+// Delete deletes an object. S3 treats deleting a missing key as success.
+func (s *S3StorageService) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete from S3: %w", err)
+	}
+	return nil
+}
 
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(s3Key),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(contentType),
+// DeleteOlderThan deletes the objects under subDir last modified before cutoff, except those
+// keep reports true for, in batches.
+func (s *S3StorageService) DeleteOlderThan(ctx context.Context, subDir string, cutoff time.Time, keep func(key string) bool) (int, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(strings.TrimSuffix(subDir, "/") + "/"),
 	})
 
+	deleted := 0
+	var batch []types.ObjectIdentifier
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list S3 objects under %s: %w", subDir, err)
+		}
+		for _, obj := range page.Contents {
+			if obj.LastModified != nil && obj.LastModified.Before(cutoff) && (keep == nil || !keep(aws.ToString(obj.Key))) {
+				batch = append(batch, types.ObjectIdentifier{Key: obj.Key})
+			}
+		}
+		// Deleting while listing is safe: later pages continue after the last key listed
+		for len(batch) >= s3DeleteBatch {
+			n, err := s.deleteObjects(ctx, batch[:s3DeleteBatch])
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+			batch = batch[s3DeleteBatch:]
+		}
+	}
+	if len(batch) > 0 {
+		n, err := s.deleteObjects(ctx, batch)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteObjects deletes up to s3DeleteBatch objects in one request and returns how many
+// were deleted.
+func (s *S3StorageService) deleteObjects(ctx context.Context, objects []types.ObjectIdentifier) (int, error) {
+	out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.bucketName),
+		Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to upload bytes to S3: %w", err)
+		return 0, fmt.Errorf("failed to delete S3 objects: %w", err)
 	}
+	if len(out.Errors) > 0 {
+		first := out.Errors[0]
+		return len(objects) - len(out.Errors), fmt.Errorf("failed to delete %d S3 objects, first %s: %s",
+			len(out.Errors), aws.ToString(first.Key), aws.ToString(first.Message))
+	}
+	return len(objects), nil
+}
 
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, s3Key), nil
+// objectKey returns the key of an object. Records from before keys were stored hold the
+// object's public URL instead, which is turned back into its key.
+func (s *S3StorageService) objectKey(key string) string {
+	prefix := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", s.bucketName, s.region)
+	return strings.TrimPrefix(key, prefix)
 }
@@ -0,0 +1,174 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Delivery statuses recorded against OTP requests. Providers' own status strings are
+// normalised to one of these; the raw value is kept alongside.
+const (
+	DeliveryStatusSent      = "sent"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+	DeliveryStatusUnknown   = "unknown"
+)
+
+// DeliveryReceipt is a provider's report on what happened to a sent SMS.
+type DeliveryReceipt struct {
+	Provider       string
+	MessageID      string
+	Status         string // one of the DeliveryStatus* constants
+	ProviderStatus string // the provider's raw status value
+}
+
+// DeliveryReceiptParser is implemented by providers that can post delivery receipts back to us.
+type DeliveryReceiptParser interface {
+	ParseDeliveryReceipt(payload map[string]interface{}) (*DeliveryReceipt, error)
+}
+
+// DeliveryReceiptRouter routes a webhook payload to the parser of the provider it came from.
+type DeliveryReceiptRouter interface {
+	ParseDeliveryReceipt(provider string, payload map[string]interface{}) (*DeliveryReceipt, error)
+}
+
+// OTPProviderFactory builds a provider from its settings. Settings are the provider's
+// SMS_<NAME>_* environment variables with the prefix stripped (e.g. "URL", "METHOD").
+type OTPProviderFactory func(name string, settings map[string]string) (OTPService, error)
+
+var (
+	otpProvidersMu sync.RWMutex
+	otpProviders   = map[string]OTPProviderFactory{
+		"mock": func(name string, settings map[string]string) (OTPService, error) {
+			return NewMockOTPService(), nil
+		},
+		"http": func(name string, settings map[string]string) (OTPService, error) {
+			return NewHTTPSMSProvider(name, settings)
+		},
+	}
+)
+
+// RegisterOTPProvider makes an SMS driver available to SMS_PROVIDERS under the given name.
+func RegisterOTPProvider(driver string, factory OTPProviderFactory) {
+	otpProvidersMu.Lock()
+	defer otpProvidersMu.Unlock()
+	otpProviders[driver] = factory
+}
+
+// OTPProviderConfig names one configured provider and the driver that implements it.
+type OTPProviderConfig struct {
+	Name     string
+	Driver   string
+	Settings map[string]string
+}
+
+// namedOTPService is a provider together with the name it was configured under.
+type namedOTPService struct {
+	name    string
+	service OTPService
+}
+
+// OTPProviderChain sends OTPs through an ordered list of providers, falling back to the
+// next one when a provider fails.
+type OTPProviderChain struct {
+	providers []namedOTPService
+}
+
+// NewOTPProviderChain builds every configured provider through the registry, in fallback order.
+func NewOTPProviderChain(configs []OTPProviderConfig) (*OTPProviderChain, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no SMS providers configured")
+	}
+
+	otpProvidersMu.RLock()
+	defer otpProvidersMu.RUnlock()
+
+	chain := &OTPProviderChain{}
+	for _, cfg := range configs {
+		factory, ok := otpProviders[cfg.Driver]
+		if !ok {
+			return nil, fmt.Errorf("SMS provider %q: unknown driver %q (available: %s)", cfg.Name, cfg.Driver, strings.Join(registeredOTPDrivers(), ", "))
+		}
+		service, err := factory(cfg.Name, cfg.Settings)
+		if err != nil {
+			return nil, fmt.Errorf("SMS provider %q: %w", cfg.Name, err)
+		}
+		chain.providers = append(chain.providers, namedOTPService{name: cfg.Name, service: service})
+	}
+
+	names := make([]string, len(chain.providers))
+	for i, p := range chain.providers {
+		names[i] = p.name
+	}
+	log.Printf("INFO: SMS providers initialized (fallback order: %s)", strings.Join(names, " → "))
+	return chain, nil
+}
+
+// SendOTP tries each provider in order and returns the first successful delivery.
+func (c *OTPProviderChain) SendOTP(phone, code string) (*OTPDelivery, error) {
+	var errs []error
+	for _, p := range c.providers {
+		delivery, err := p.service.SendOTP(phone, code)
+		if err != nil {
+			log.Printf("WARN: SMS provider %s failed for %s: %v", p.name, phone, err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+			continue
+		}
+		if delivery == nil {
+			delivery = &OTPDelivery{}
+		}
+		delivery.Provider = p.name
+		return delivery, nil
+	}
+	return nil, fmt.Errorf("all SMS providers failed: %w", errors.Join(errs...))
+}
+
+// ParseDeliveryReceipt hands a webhook payload to the named provider's receipt parser.
+func (c *OTPProviderChain) ParseDeliveryReceipt(provider string, payload map[string]interface{}) (*DeliveryReceipt, error) {
+	for _, p := range c.providers {
+		if p.name != provider {
+			continue
+		}
+		parser, ok := p.service.(DeliveryReceiptParser)
+		if !ok {
+			return nil, fmt.Errorf("SMS provider %q does not support delivery receipts", provider)
+		}
+		receipt, err := parser.ParseDeliveryReceipt(payload)
+		if err != nil {
+			return nil, err
+		}
+		receipt.Provider = provider
+		return receipt, nil
+	}
+	return nil, fmt.Errorf("unknown SMS provider %q", provider)
+}
+
+// NormalizeDeliveryStatus maps common provider status strings (Twilio, MSG91, SMPP DLRs)
+// to one of the DeliveryStatus* constants.
+func NormalizeDeliveryStatus(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "delivered", "delivrd", "success", "1":
+		return DeliveryStatusDelivered
+	case "failed", "undelivered", "undeliv", "rejected", "rejectd", "expired", "2", "16":
+		return DeliveryStatusFailed
+	case "sent", "queued", "accepted", "submitted", "sending", "8":
+		return DeliveryStatusSent
+	default:
+		return DeliveryStatusUnknown
+	}
+}
+
+func registeredOTPDrivers() []string {
+	drivers := make([]string, 0, len(otpProviders))
+	for name := range otpProviders {
+		drivers = append(drivers, name)
+	}
+	sort.Strings(drivers)
+	return drivers
+}
@@ -0,0 +1,101 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+// soilAnalysisAttempts is how many times a model is asked for a soil analysis before a
+// malformed answer is given up on. Transport failures are retried by the providers themselves.
+const soilAnalysisAttempts = 3
+
+// soilAnalysisPrompt asks a vision model for a soil analysis as JSON matching models.SoilAnalysis.
+var soilAnalysisPrompt = `You are an expert agricultural soil scientist working with Indian farmers. Analyze this photo of a soil sample.
+Respond with ONLY a JSON object, no code fences and no other text, matching this schema:
+{
+  "soilClass": one of ` + quotedList(models.SoilClasses) + `,
+  "confidence": number from 0 to 1, how sure you are of soilClass,
+  "texture": one of ` + quotedList(models.SoilTextures) + `,
+  "color": {"munsell": Munsell-like notation such as "10YR 4/3", or "" if unsure, "name": plain colour name such as "dark brown"},
+  "organicMatter": visible organic matter, one of ` + quotedList(models.SoilOrganicMatterLevels) + `,
+  "moisture": one of ` + quotedList(models.SoilMoistureLevels) + `,
+  "imageQuality": one of ` + quotedList(models.SoilImageQualities) + ` ("not_soil" if the photo does not show soil),
+  "concerns": list of short visible problems such as "salt crust on the surface" or "surface cracking", [] if none (at most 8)
+}
+If the photo is too poor to judge, use "unknown" and a low confidence rather than guessing.`
+
+// analyzeSoil asks a vision model for a soil analysis and validates the answer. A malformed
+// answer is retried with the validation error added to the prompt.
+func analyzeSoil(ctx context.Context, vision func(ctx context.Context, prompt string) (string, error)) (*models.SoilAnalysis, error) {
+	prompt := soilAnalysisPrompt
+	var lastErr error
+	for attempt := 1; attempt <= soilAnalysisAttempts; attempt++ {
+		text, err := vision(ctx, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		analysis, err := parseSoilAnalysis(text)
+		if err == nil {
+			return analysis, nil
+		}
+		lastErr = err
+		log.Printf("WARN: Malformed soil analysis (attempt %d/%d): %v", attempt, soilAnalysisAttempts, err)
+		prompt = soilAnalysisPrompt + "\n\nYour previous answer was rejected: " + err.Error() + ". Answer again with valid JSON only."
+	}
+	return nil, fmt.Errorf("soil analysis still malformed after %d attempts: %w", soilAnalysisAttempts, lastErr)
+}
+
+// parseSoilAnalysis decodes and validates a model's JSON answer. Code fences and text around
+// the object are tolerated; enum values are compared case-insensitively.
+func parseSoilAnalysis(text string) (*models.SoilAnalysis, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in the answer")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text[start : end+1])))
+	decoder.DisallowUnknownFields()
+	var analysis models.SoilAnalysis
+	if err := decoder.Decode(&analysis); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	analysis.SoilClass = normalizeEnum(analysis.SoilClass)
+	analysis.Texture = normalizeEnum(analysis.Texture)
+	analysis.OrganicMatter = normalizeEnum(analysis.OrganicMatter)
+	analysis.Moisture = normalizeEnum(analysis.Moisture)
+	analysis.ImageQuality = strings.ReplaceAll(normalizeEnum(analysis.ImageQuality), " ", "_")
+	analysis.Color.Munsell = strings.ToUpper(strings.TrimSpace(analysis.Color.Munsell))
+	analysis.Color.Name = strings.TrimSpace(analysis.Color.Name)
+	for i, concern := range analysis.Concerns {
+		analysis.Concerns[i] = strings.TrimSpace(concern)
+	}
+
+	if err := analysis.Validate(); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+func normalizeEnum(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func quotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = `"` + v + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,129 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/samyaksetu/backend/models"
+)
+
+const validSoilJSON = `{"soilClass": "black", "confidence": 0.85, "texture": "clay", "color": {"munsell": "10YR 3/1", "name": "very dark grey"}, "organicMatter": "medium", "moisture": "moist", "imageQuality": "good", "concerns": ["surface cracking"]}`
+
+func TestParseSoilAnalysis(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string // empty for a valid answer
+		check   func(t *testing.T, a *models.SoilAnalysis)
+	}{
+		{name: "plain JSON", text: validSoilJSON},
+		{name: "code fence", text: "```json\n" + validSoilJSON + "\n```"},
+		{name: "text around the object", text: "Here is the analysis:\n" + validSoilJSON + "\nHope this helps!"},
+		{
+			name: "enum values in other cases",
+			text: `{"soilClass": " Black ", "confidence": 0.6, "texture": "Sandy Loam", "color": {"munsell": "10yr 4/3", "name": " brown "}, "organicMatter": "LOW", "moisture": "Dry", "imageQuality": "Not Soil", "concerns": []}`,
+			check: func(t *testing.T, a *models.SoilAnalysis) {
+				if a.SoilClass != "black" || a.Texture != "sandy loam" || a.OrganicMatter != "low" || a.Moisture != "dry" {
+					t.Errorf("enums not normalized: %+v", a)
+				}
+				if a.ImageQuality != models.ImageQualityNotSoil {
+					t.Errorf("imageQuality = %q, want %q", a.ImageQuality, models.ImageQualityNotSoil)
+				}
+				if a.Color.Munsell != "10YR 4/3" || a.Color.Name != "brown" {
+					t.Errorf("color = %+v, want trimmed and upper-cased Munsell", a.Color)
+				}
+			},
+		},
+		{
+			name: "neutral Munsell and no Munsell",
+			text: `{"soilClass": "red", "confidence": 1, "texture": "loam", "color": {"munsell": "", "name": "red"}, "organicMatter": "low", "moisture": "dry", "imageQuality": "usable", "concerns": []}`,
+		},
+		{name: "no JSON", text: "I cannot tell from this photo.", wantErr: "no JSON object"},
+		{name: "truncated JSON", text: `{"soilClass": "black", "confidence": 0.8`, wantErr: "no JSON object"},
+		{name: "unknown field", text: strings.Replace(validSoilJSON, `"concerns"`, `"ph": 7.5, "concerns"`, 1), wantErr: "unknown field"},
+		{name: "unknown soil class", text: strings.Replace(validSoilJSON, `"black"`, `"volcanic"`, 1), wantErr: "soilClass"},
+		{name: "unknown texture", text: strings.Replace(validSoilJSON, `"clay"`, `"gravel"`, 1), wantErr: "texture"},
+		{name: "bad Munsell notation", text: strings.Replace(validSoilJSON, `"10YR 3/1"`, `"dark 3-1"`, 1), wantErr: "munsell"},
+		{name: "Munsell hue without value", text: strings.Replace(validSoilJSON, `"10YR 3/1"`, `"10YR"`, 1), wantErr: "munsell"},
+		{name: "confidence above one", text: strings.Replace(validSoilJSON, `0.85`, `85`, 1), wantErr: "confidence"},
+		{name: "negative confidence", text: strings.Replace(validSoilJSON, `0.85`, `-0.1`, 1), wantErr: "confidence"},
+		{name: "confidence as text", text: strings.Replace(validSoilJSON, `0.85`, `"high"`, 1), wantErr: "invalid JSON"},
+		{name: "missing colour name", text: strings.Replace(validSoilJSON, `"very dark grey"`, `" "`, 1), wantErr: "color.name"},
+		{name: "unknown moisture", text: strings.Replace(validSoilJSON, `"moist"`, `"damp"`, 1), wantErr: "moisture"},
+		{name: "unknown image quality", text: strings.Replace(validSoilJSON, `"good"`, `"blurry"`, 1), wantErr: "imageQuality"},
+		{name: "concerns missing", text: strings.Replace(validSoilJSON, `, "concerns": ["surface cracking"]`, ``, 1), wantErr: "concerns is required"},
+		{name: "concerns null", text: strings.Replace(validSoilJSON, `["surface cracking"]`, `null`, 1), wantErr: "concerns is required"},
+		{name: "empty concern", text: strings.Replace(validSoilJSON, `["surface cracking"]`, `["  "]`, 1), wantErr: "each concern"},
+		{name: "too many concerns", text: strings.Replace(validSoilJSON, `["surface cracking"]`, `["a","b","c","d","e","f","g","h","i"]`, 1), wantErr: "at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parseSoilAnalysis(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, a)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSoilRetriesMalformedAnswers(t *testing.T) {
+	t.Run("retry with the validation error", func(t *testing.T) {
+		var prompts []string
+		answers := []string{`{"soilClass": "volcanic"}`, validSoilJSON}
+		a, err := analyzeSoil(context.Background(), func(ctx context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return answers[len(prompts)-1], nil
+		})
+		if err != nil || a.SoilClass != models.SoilClassBlack {
+			t.Fatalf("analyzeSoil = %+v, %v; want the second answer", a, err)
+		}
+		if len(prompts) != 2 {
+			t.Fatalf("model asked %d times, want 2", len(prompts))
+		}
+		if prompts[0] != soilAnalysisPrompt {
+			t.Error("first prompt is not the plain soil analysis prompt")
+		}
+		if !strings.HasPrefix(prompts[1], soilAnalysisPrompt) || !strings.Contains(prompts[1], "previous answer was rejected") || !strings.Contains(prompts[1], "volcanic") {
+			t.Errorf("retry prompt does not carry the validation error:\n%s", prompts[1][len(soilAnalysisPrompt):])
+		}
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		calls := 0
+		_, err := analyzeSoil(context.Background(), func(ctx context.Context, prompt string) (string, error) {
+			calls++
+			return "not JSON", nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "still malformed") {
+			t.Fatalf("error = %v, want the attempts to be given up", err)
+		}
+		if calls != soilAnalysisAttempts {
+			t.Fatalf("model asked %d times, want %d", calls, soilAnalysisAttempts)
+		}
+	})
+
+	t.Run("model errors are not retried", func(t *testing.T) {
+		calls := 0
+		down := errors.New("model unavailable")
+		_, err := analyzeSoil(context.Background(), func(ctx context.Context, prompt string) (string, error) {
+			calls++
+			return "", down
+		})
+		if !errors.Is(err, down) || calls != 1 {
+			t.Fatalf("analyzeSoil = %v after %d calls, want the model's error after 1", err, calls)
+		}
+	})
+}
@@ -3,89 +3,218 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
-	"mime/multipart"
+	"mime"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
-// LocalStorageService implements StorageService using local filesystem storage.
+// ErrFileNotFound is returned for keys with no stored file.
+var ErrFileNotFound = errors.New("file not found")
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// LocalStorageService implements StorageService using local filesystem storage. Files are
+// served through signed links to FilesRoute.
 type LocalStorageService struct {
 	basePath string
+	signer   *URLSigner
+	urlTTL   time.Duration
 }
 
-// NewLocalStorageService creates a new LocalStorageService.
-// It ensures the base upload directory exists.
-func NewLocalStorageService(basePath string) (*LocalStorageService, error) {
+// NewLocalStorageService creates a new LocalStorageService whose links are signed by signer
+// and valid for urlTTL unless a call asks otherwise. It ensures the base upload directory exists.
+func NewLocalStorageService(basePath string, signer *URLSigner, urlTTL time.Duration) (*LocalStorageService, error) {
 	if err := os.MkdirAll(basePath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create upload directory %s: %w", basePath, err)
 	}
 
 	log.Printf("INFO: Local storage initialized at: %s", basePath)
-	return &LocalStorageService{basePath: basePath}, nil
+	return &LocalStorageService{basePath: basePath, signer: signer, urlTTL: urlTTL}, nil
+}
+
+// SaveBytes creates a file from raw bytes on the local filesystem.
+func (s *LocalStorageService) SaveBytes(ctx context.Context, data []byte, contentType, ext, subDir string) (string, error) {
+	key := path.Join(filepath.ToSlash(subDir), fmt.Sprintf("%d%s", time.Now().UnixNano(), ext))
+	if err := s.Put(ctx, key, data, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
 }
 
-// SaveFile stores an uploaded file to the local filesystem.
-// Returns the relative path to the saved file.
-func (s *LocalStorageService) SaveFile(file *multipart.FileHeader, subDir string) (string, error) {
-	// Create subdirectory if needed
-	targetDir := filepath.Join(s.basePath, subDir)
+// Put writes raw bytes to the file with the given key. The file is written under a
+// temporary name and renamed, so readers never see it half-written.
+func (s *LocalStorageService) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	targetDir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory %s: %w", targetDir, err)
+		return fmt.Errorf("failed to create directory %s: %w", targetDir, err)
 	}
 
-	// Generate unique filename using timestamp
-	ext := filepath.Ext(file.Filename)
-	uniqueName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(targetDir, uniqueName)
+	tmp, err := os.CreateTemp(targetDir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fullPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write bytes to file: %w", err)
+	}
+	return nil
+}
 
-	// Open uploaded file
-	src, err := file.Open()
+// Open opens a stored file for reading.
+func (s *LocalStorageService) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullPath, err := s.resolve(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
+	}
+	f, err := os.Open(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, key)
 	}
-	defer src.Close()
+	return f, err
+}
 
-	// Create destination file
-	dst, err := os.Create(filePath)
+// ReadFile reads a stored file.
+func (s *LocalStorageService) ReadFile(ctx context.Context, key string) ([]byte, error) {
+	f, err := s.Open(ctx, key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create destination file: %w", err)
+		return nil, err
 	}
-	defer dst.Close()
+	defer f.Close()
+	return io.ReadAll(f)
+}
 
-	// Copy content
-	buf := make([]byte, 32*1024)
-	for {
-		n, readErr := src.Read(buf)
-		if n > 0 {
-			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
-				return "", fmt.Errorf("failed to write file: %w", writeErr)
-			}
-		}
-		if readErr != nil {
-			break
-		}
+// Stat describes a stored file. The content type comes from the key's extension.
+func (s *LocalStorageService) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, key)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Return subDir/filename path
-	return filepath.Join(subDir, uniqueName), nil
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &FileInfo{Key: key, Size: info.Size(), ContentType: contentType, ModTime: info.ModTime()}, nil
 }
 
-// SaveBytes creates a file from raw bytes on the local filesystem.
-func (s *LocalStorageService) SaveBytes(data []byte, contentType, ext, subDir string) (string, error) {
-	targetDir := filepath.Join(s.basePath, subDir)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory %s: %w", targetDir, err)
+// URL returns a signed link to the file under FilesRoute.
+func (s *LocalStorageService) URL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if _, err := s.resolve(key); err != nil {
+		return "", err
 	}
+	if ttl <= 0 {
+		ttl = s.urlTTL
+	}
+	return s.signer.SignedURL(key, time.Now().Add(ttl)), nil
+}
 
-	uniqueName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(targetDir, uniqueName)
+// Delete removes a stored file.
+func (s *LocalStorageService) Delete(ctx context.Context, key string) error {
+	fullPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return "", fmt.Errorf("failed to write bytes to file: %w", err)
+// DeleteOlderThan removes the files under subDir last modified before cutoff, except those
+// keep reports true for.
+func (s *LocalStorageService) DeleteOlderThan(ctx context.Context, subDir string, cutoff time.Time, keep func(key string) bool) (int, error) {
+	dir, err := s.resolve(subDir)
+	if err != nil {
+		return 0, err
 	}
 
-	return filepath.Join(subDir, uniqueName), nil
+	deleted := 0
+	err = filepath.WalkDir(dir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.basePath, fullPath)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) && (keep == nil || !keep(filepath.ToSlash(rel))) {
+			if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to delete file: %w", err)
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// resolve maps a key to a path under basePath, refusing keys that escape it.
+func (s *LocalStorageService) resolve(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return filepath.Join(s.basePath, cleaned), nil
 }
@@ -0,0 +1,70 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// FilesRoute is where signed links to locally stored files are served.
+const FilesRoute = "/files/"
+
+// ErrInvalidSignature is returned for file links that were tampered with or have expired.
+var ErrInvalidSignature = errors.New("invalid or expired file link")
+
+// URLSigner makes and checks HMAC-signed, expiring links to stored files, so files can be
+// fetched without an API token but only by whoever the backend handed a link to.
+type URLSigner struct {
+	secret []byte
+}
+
+// NewURLSigner creates a signer. Without a secret a random one is generated, which works for
+// a single server but invalidates every link on restart.
+func NewURLSigner(secret string) *URLSigner {
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			log.Fatalf("FATAL: Failed to generate a file link secret: %v", err)
+		}
+		log.Println("WARN: FILE_URL_SECRET is not set — file links use a random secret and stop working when the server restarts")
+		return &URLSigner{secret: random}
+	}
+	return &URLSigner{secret: []byte(secret)}
+}
+
+// SignedURL returns a link to the file with the given key, valid until expires.
+func (s *URLSigner) SignedURL(key string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{"expires": {exp}, "signature": {s.signature(key, exp)}}
+	return FilesRoute + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode()
+}
+
+// Verify checks a link's expiry and signature. It returns the expiry time.
+func (s *URLSigner) Verify(key, expires, signature string) (time.Time, error) {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+	expiry := time.Unix(unix, 0)
+	if time.Now().After(expiry) {
+		return time.Time{}, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, expires))) {
+		return time.Time{}, ErrInvalidSignature
+	}
+	return expiry, nil
+}
+
+func (s *URLSigner) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
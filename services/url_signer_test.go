@@ -0,0 +1,68 @@
+// All rights reserved Samyak-Setu
+
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// splitSignedURL returns the key, expires and signature of a link made by SignedURL.
+func splitSignedURL(t *testing.T, link string) (key, expires, signature string) {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u.Path, FilesRoute) {
+		t.Fatalf("link %q is not under %s", link, FilesRoute)
+	}
+	return strings.TrimPrefix(u.Path, FilesRoute), u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := NewURLSigner("test-secret")
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	key, exp, sig := splitSignedURL(t, signer.SignedURL("soil/ab/abc123 photo.jpg", expires))
+
+	t.Run("valid link", func(t *testing.T) {
+		if key != "soil/ab/abc123 photo.jpg" {
+			t.Fatalf("key = %q, want the escaped key to round-trip", key)
+		}
+		got, err := signer.Verify(key, exp, sig)
+		if err != nil || !got.Equal(expires) {
+			t.Fatalf("Verify = %v, %v; want %v", got, err, expires)
+		}
+	})
+
+	later := strconv.FormatInt(expires.Add(24*time.Hour).Unix(), 10)
+	past := time.Now().Add(-time.Minute)
+	_, pastExp, pastSig := splitSignedURL(t, signer.SignedURL(key, past))
+
+	tests := []struct {
+		name                    string
+		key, expires, signature string
+	}{
+		{name: "tampered key", key: "soil/ab/other.jpg", expires: exp, signature: sig},
+		{name: "tampered expiry", key: key, expires: later, signature: sig},
+		{name: "expiry not a number", key: key, expires: "tomorrow", signature: sig},
+		{name: "tampered signature", key: key, expires: exp, signature: strings.Repeat("0", len(sig))},
+		{name: "missing signature", key: key, expires: exp},
+		{name: "expired link", key: key, expires: pastExp, signature: pastSig},
+		{name: "signed with another secret", key: key, expires: exp, signature: func() string {
+			_, _, s := splitSignedURL(t, NewURLSigner("other-secret").SignedURL(key, expires))
+			return s
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.Verify(tt.key, tt.expires, tt.signature); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Verify error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -47,14 +48,23 @@ func NewOpenWeatherService(apiKey string) *OpenWeatherService {
 	}
 }
 
+// get issues a GET request to the weather API that is abandoned when ctx is done.
+func (s *OpenWeatherService) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.httpClient.Do(req)
+}
+
 // GetWeather fetches current weather for the given coordinates and returns a summary.
-func (s *OpenWeatherService) GetWeather(latitude, longitude float64) (string, error) {
+func (s *OpenWeatherService) GetWeather(ctx context.Context, latitude, longitude float64) (string, error) {
 	url := fmt.Sprintf(
 		"https://api.openweathermap.org/data/2.5/weather?lat=%.6f&lon=%.6f&appid=%s&units=metric",
 		latitude, longitude, s.apiKey,
 	)
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		log.Printf("ERROR: Weather API request failed: %v", err)
 		return "Weather data unavailable", nil
@@ -95,13 +105,13 @@ func (s *OpenWeatherService) GetWeather(latitude, longitude float64) (string, er
 }
 
 // GetWeatherDetailed fetches current weather as structured data for API responses.
-func (s *OpenWeatherService) GetWeatherDetailed(latitude, longitude float64) (*WeatherData, error) {
+func (s *OpenWeatherService) GetWeatherDetailed(ctx context.Context, latitude, longitude float64) (*WeatherData, error) {
 	url := fmt.Sprintf(
 		"https://api.openweathermap.org/data/2.5/weather?lat=%.6f&lon=%.6f&appid=%s&units=metric",
 		latitude, longitude, s.apiKey,
 	)
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("weather API request failed: %w", err)
 	}
@@ -158,13 +168,13 @@ type forecastAPIResponse struct {
 }
 
 // GetForecast fetches a 5-day forecast with 3-hour intervals from OpenWeatherMap.
-func (s *OpenWeatherService) GetForecast(latitude, longitude float64) ([]ForecastItem, error) {
+func (s *OpenWeatherService) GetForecast(ctx context.Context, latitude, longitude float64) ([]ForecastItem, error) {
 	url := fmt.Sprintf(
 		"https://api.openweathermap.org/data/2.5/forecast?lat=%.6f&lon=%.6f&appid=%s&units=metric",
 		latitude, longitude, s.apiKey,
 	)
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("forecast API request failed: %w", err)
 	}
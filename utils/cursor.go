@@ -0,0 +1,51 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cursor marks a position in a list sorted newest first by a timestamp, with the
+// document ID breaking ties. The next page starts strictly after it.
+type Cursor struct {
+	Time time.Time
+	ID   primitive.ObjectID
+}
+
+// EncodeCursor turns a cursor into an opaque, URL-safe token for API responses.
+func EncodeCursor(cur Cursor) string {
+	raw := strconv.FormatInt(cur.Time.UnixMilli(), 10) + ":" + cur.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a token produced by EncodeCursor. An empty token returns (nil, nil),
+// meaning the first page.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	millis, hex, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &Cursor{Time: time.UnixMilli(ms), ID: id}, nil
+}
@@ -0,0 +1,240 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ExifData is the part of a photo's EXIF metadata the backend uses.
+type ExifData struct {
+	Orientation int        // 1–8 as defined by EXIF; 1 (or 0 when absent) means upright
+	TakenAt     *time.Time // DateTimeOriginal, in the camera's local time unless an offset was recorded
+	Latitude    *float64
+	Longitude   *float64
+}
+
+// EXIF tags read by ReadJPEGExif.
+const (
+	exifTagOrientation      = 0x0112
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	exifTagOffsetTime       = 0x9011
+	gpsTagLatitudeRef       = 0x0001
+	gpsTagLatitude          = 0x0002
+	gpsTagLongitudeRef      = 0x0003
+	gpsTagLongitude         = 0x0004
+)
+
+// errNoExif is returned for JPEGs without an EXIF segment.
+var errNoExif = errors.New("no EXIF metadata")
+
+// ReadJPEGExif extracts orientation, capture time and GPS position from a JPEG's EXIF
+// segment. Fields that are missing or malformed are left empty; an error is returned only
+// when the file has no readable EXIF segment at all.
+func ReadJPEGExif(data []byte) (*ExifData, error) {
+	tiff, err := findExifSegment(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tiff) < 8 {
+		return nil, errors.New("truncated EXIF header")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid EXIF byte order")
+	}
+	r := exifReader{data: tiff, order: order}
+
+	result := &ExifData{}
+	ifd0 := r.readIFD(order.Uint32(tiff[4:8]))
+	if v, ok := ifd0[exifTagOrientation]; ok {
+		if o, ok := r.short(v); ok && o >= 1 && o <= 8 {
+			result.Orientation = int(o)
+		}
+	}
+
+	if v, ok := ifd0[exifTagExifIFD]; ok {
+		if offset, ok := r.long(v); ok {
+			exifIFD := r.readIFD(offset)
+			if taken, ok := r.ascii(exifIFD[exifTagDateTimeOriginal]); ok {
+				offset, _ := r.ascii(exifIFD[exifTagOffsetTime])
+				result.TakenAt = parseExifTime(taken, offset)
+			}
+		}
+	}
+
+	if v, ok := ifd0[exifTagGPSIFD]; ok {
+		if offset, ok := r.long(v); ok {
+			gps := r.readIFD(offset)
+			lat, latOK := r.degrees(gps[gpsTagLatitude])
+			lng, lngOK := r.degrees(gps[gpsTagLongitude])
+			if latOK && lngOK {
+				if ref, _ := r.ascii(gps[gpsTagLatitudeRef]); strings.EqualFold(ref, "S") {
+					lat = -lat
+				}
+				if ref, _ := r.ascii(gps[gpsTagLongitudeRef]); strings.EqualFold(ref, "W") {
+					lng = -lng
+				}
+				if ValidateCoordinates(lat, lng) == nil && (lat != 0 || lng != 0) {
+					result.Latitude, result.Longitude = &lat, &lng
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// findExifSegment walks the JPEG markers up to the image data and returns the TIFF block
+// of the APP1 "Exif" segment.
+func findExifSegment(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("not a JPEG")
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil, errNoExif
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return nil, errNoExif
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, errNoExif
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+		i += 2 + length
+	}
+	return nil, errNoExif
+}
+
+// exifEntry is a raw IFD entry: its type, count and the 4-byte value or offset field.
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifReader reads IFDs out of a TIFF block, bounds-checking every offset.
+type exifReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func (r exifReader) readIFD(offset uint32) map[uint16]exifEntry {
+	entries := map[uint16]exifEntry{}
+	if uint64(offset)+2 > uint64(len(r.data)) {
+		return entries
+	}
+	count := int(r.order.Uint16(r.data[offset:]))
+	start := int(offset) + 2
+	for i := 0; i < count; i++ {
+		p := start + i*12
+		if p+12 > len(r.data) {
+			break
+		}
+		tag := r.order.Uint16(r.data[p:])
+		entries[tag] = exifEntry{
+			typ:   r.order.Uint16(r.data[p+2:]),
+			count: r.order.Uint32(r.data[p+4:]),
+			value: r.data[p+8 : p+12],
+		}
+	}
+	return entries
+}
+
+// payload returns the bytes of an entry of size bytes per component, inline or at its offset.
+func (r exifReader) payload(e exifEntry, size int) ([]byte, bool) {
+	total := uint64(e.count) * uint64(size)
+	if total == 0 || total > 1<<16 {
+		return nil, false
+	}
+	if total <= 4 {
+		return e.value[:total], true
+	}
+	offset := uint64(r.order.Uint32(e.value))
+	if offset+total > uint64(len(r.data)) {
+		return nil, false
+	}
+	return r.data[offset : offset+total], true
+}
+
+func (r exifReader) short(e exifEntry) (uint16, bool) {
+	if e.typ != 3 || e.count < 1 {
+		return 0, false
+	}
+	return r.order.Uint16(e.value), true
+}
+
+func (r exifReader) long(e exifEntry) (uint32, bool) {
+	if e.typ != 4 || e.count < 1 {
+		return 0, false
+	}
+	return r.order.Uint32(e.value), true
+}
+
+func (r exifReader) ascii(e exifEntry) (string, bool) {
+	if e.typ != 2 {
+		return "", false
+	}
+	b, ok := r.payload(e, 1)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimRight(string(b), "\x00 "), true
+}
+
+// degrees reads a GPS coordinate stored as three rationals: degrees, minutes, seconds.
+func (r exifReader) degrees(e exifEntry) (float64, bool) {
+	if e.typ != 5 || e.count != 3 {
+		return 0, false
+	}
+	b, ok := r.payload(e, 8)
+	if !ok {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num := r.order.Uint32(b[i*8:])
+		den := r.order.Uint32(b[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+// parseExifTime parses an EXIF "2006:01:02 15:04:05" time with an optional "+05:30" offset.
+// Without an offset the time is taken as UTC, which is the camera's local clock reading.
+func parseExifTime(value, offset string) *time.Time {
+	layout, input := "2006:01:02 15:04:05", value
+	if offset != "" {
+		layout, input = layout+"-07:00", value+offset
+	}
+	t, err := time.Parse(layout, input)
+	if err != nil || t.Year() < 1990 {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,370 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// testOrder is a byte order that can also append, as binary.LittleEndian and BigEndian do.
+type testOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// testEntry is an IFD entry for building test EXIF blocks. An entry with sub set points at
+// that IFD instead of holding data.
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte // value in the block's byte order
+	sub   []testEntry
+}
+
+// buildTIFF lays out ifd0 and the IFDs it points at as a TIFF block: header, IFDs, then
+// the values too large to fit in their entries.
+func buildTIFF(order testOrder, ifd0 []testEntry) []byte {
+	ifds := [][]testEntry{ifd0}
+	for i := 0; i < len(ifds); i++ {
+		for _, e := range ifds[i] {
+			if e.sub != nil {
+				ifds = append(ifds, e.sub)
+			}
+		}
+	}
+
+	offsets := make([]uint32, len(ifds))
+	next := uint32(8)
+	for i, ifd := range ifds {
+		offsets[i] = next
+		next += uint32(2 + 12*len(ifd) + 4)
+	}
+
+	buf := make([]byte, 8, next)
+	if order == binary.LittleEndian {
+		copy(buf, "II")
+	} else {
+		copy(buf, "MM")
+	}
+	order.PutUint16(buf[2:], 42)
+	order.PutUint32(buf[4:], offsets[0])
+
+	var extra []byte
+	subIndex := 1
+	for _, ifd := range ifds {
+		buf = order.AppendUint16(buf, uint16(len(ifd)))
+		for _, e := range ifd {
+			buf = order.AppendUint16(buf, e.tag)
+			value := make([]byte, 4)
+			if e.sub != nil {
+				buf = order.AppendUint16(buf, 4)
+				buf = order.AppendUint32(buf, 1)
+				order.PutUint32(value, offsets[subIndex])
+				subIndex++
+			} else {
+				buf = order.AppendUint16(buf, e.typ)
+				buf = order.AppendUint32(buf, e.count)
+				if len(e.data) <= 4 {
+					copy(value, e.data)
+				} else {
+					order.PutUint32(value, next+uint32(len(extra)))
+					extra = append(extra, e.data...)
+				}
+			}
+			buf = append(buf, value...)
+		}
+		buf = order.AppendUint32(buf, 0)
+	}
+	return append(buf, extra...)
+}
+
+// wrapJPEG returns a minimal JPEG whose APP1 segment holds tiff.
+func wrapJPEG(tiff []byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	data = append(data, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0) // APP0 before the EXIF
+	data = append(data, 0xFF, 0xE1)
+	data = binary.BigEndian.AppendUint16(data, uint16(2+6+len(tiff)))
+	data = append(data, "Exif\x00\x00"...)
+	data = append(data, tiff...)
+	return append(data, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func shortEntry(order testOrder, tag, v uint16) testEntry {
+	return testEntry{tag: tag, typ: 3, count: 1, data: order.AppendUint16(nil, v)}
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+// degreesEntry encodes a coordinate as degrees, minutes and seconds rationals.
+func degreesEntry(order testOrder, tag uint16, deg, min, secTimes100 uint32) testEntry {
+	var data []byte
+	for _, r := range [][2]uint32{{deg, 1}, {min, 1}, {secTimes100, 100}} {
+		data = order.AppendUint32(data, r[0])
+		data = order.AppendUint32(data, r[1])
+	}
+	return testEntry{tag: tag, typ: 5, count: 3, data: data}
+}
+
+// fullExif is an EXIF block with every field ReadJPEGExif reads: orientation 6, a capture
+// time in IST and a position of 12°58'30" S, 77°35'24" W.
+func fullExif(order testOrder) []byte {
+	return buildTIFF(order, []testEntry{
+		shortEntry(order, exifTagOrientation, 6),
+		{tag: exifTagExifIFD, sub: []testEntry{
+			asciiEntry(exifTagDateTimeOriginal, "2025:11:03 09:15:00"),
+			asciiEntry(exifTagOffsetTime, "+05:30"),
+		}},
+		{tag: exifTagGPSIFD, sub: []testEntry{
+			asciiEntry(gpsTagLatitudeRef, "S"),
+			degreesEntry(order, gpsTagLatitude, 12, 58, 3000),
+			asciiEntry(gpsTagLongitudeRef, "W"),
+			degreesEntry(order, gpsTagLongitude, 77, 35, 2400),
+		}},
+	})
+}
+
+func TestReadJPEGExifByteOrders(t *testing.T) {
+	wantTaken := time.Date(2025, 11, 3, 9, 15, 0, 0, time.FixedZone("", 5*3600+1800))
+	wantLat, wantLng := -(12 + 58.0/60 + 30.0/3600), -(77 + 35.0/60 + 24.0/3600)
+
+	for _, order := range []testOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			exif, err := ReadJPEGExif(wrapJPEG(fullExif(order)))
+			if err != nil {
+				t.Fatalf("ReadJPEGExif: %v", err)
+			}
+			if exif.Orientation != 6 {
+				t.Errorf("Orientation = %d, want 6", exif.Orientation)
+			}
+			if exif.TakenAt == nil || !exif.TakenAt.Equal(wantTaken) {
+				t.Errorf("TakenAt = %v, want %v", exif.TakenAt, wantTaken)
+			}
+			if exif.Latitude == nil || exif.Longitude == nil {
+				t.Fatalf("position missing: %v, %v", exif.Latitude, exif.Longitude)
+			}
+			if math.Abs(*exif.Latitude-wantLat) > 1e-9 || math.Abs(*exif.Longitude-wantLng) > 1e-9 {
+				t.Errorf("position = %v, %v; want %v, %v", *exif.Latitude, *exif.Longitude, wantLat, wantLng)
+			}
+		})
+	}
+}
+
+func TestReadJPEGExifOrientation(t *testing.T) {
+	for _, order := range []testOrder{binary.LittleEndian, binary.BigEndian} {
+		for value := uint16(0); value <= 9; value++ {
+			want := int(value)
+			if value < 1 || value > 8 {
+				want = 0
+			}
+			exif, err := ReadJPEGExif(wrapJPEG(buildTIFF(order, []testEntry{shortEntry(order, exifTagOrientation, value)})))
+			if err != nil {
+				t.Fatalf("%v orientation %d: %v", order, value, err)
+			}
+			if exif.Orientation != want {
+				t.Errorf("%v orientation %d: got %d, want %d", order, value, exif.Orientation, want)
+			}
+		}
+	}
+}
+
+func TestReadJPEGExifMalformed(t *testing.T) {
+	le := binary.LittleEndian
+	full := wrapJPEG(fullExif(le))
+
+	// outOfRange points the value at offset 0xFFFF, past the end of the block
+	outOfRange := func(e testEntry) testEntry {
+		e.data = le.AppendUint32(nil, 0xFFFF)
+		return e
+	}
+	badGPS := degreesEntry(le, gpsTagLatitude, 12, 0, 0)
+	le.PutUint32(badGPS.data[4:], 0) // zero denominator
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+		check   func(t *testing.T, exif *ExifData)
+	}{
+		{name: "empty", data: nil, wantErr: true},
+		{name: "not a JPEG", data: []byte("\x89PNG\r\n\x1a\n0000"), wantErr: true},
+		{name: "JPEG without EXIF", data: []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}, wantErr: true},
+		{name: "segment longer than file", data: full[:len(full)/2], wantErr: true},
+		{name: "segment length below 2", data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01, 0x00, 0x00}, wantErr: true},
+		{name: "garbage between segments", data: []byte{0xFF, 0xD8, 0x00, 0x01, 0x02, 0x03}, wantErr: true},
+		{name: "truncated TIFF header", data: wrapJPEG([]byte("II*\x00")), wantErr: true},
+		{name: "unknown byte order", data: wrapJPEG([]byte("XX*\x00\x08\x00\x00\x00")), wantErr: true},
+		{
+			name: "IFD0 past the end",
+			data: wrapJPEG([]byte("II*\x00\xff\xff\x00\x00")),
+			check: func(t *testing.T, exif *ExifData) {
+				if *exif != (ExifData{}) {
+					t.Errorf("got %+v, want nothing", exif)
+				}
+			},
+		},
+		{
+			name: "IFD0 entry count past the end",
+			data: func() []byte {
+				tiff := buildTIFF(le, []testEntry{shortEntry(le, exifTagOrientation, 3)})
+				le.PutUint16(tiff[8:], 500)
+				return wrapJPEG(tiff)
+			}(),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.Orientation != 3 {
+					t.Errorf("Orientation = %d, want the entries that are present to be read", exif.Orientation)
+				}
+			},
+		},
+		{
+			name: "sub-IFDs past the end",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagExifIFD, typ: 4, count: 1, data: le.AppendUint32(nil, 0xFFFF)},
+				{tag: exifTagGPSIFD, typ: 4, count: 1, data: le.AppendUint32(nil, 0xFFFFFFFF)},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.TakenAt != nil || exif.Latitude != nil {
+					t.Errorf("got %+v, want nothing", exif)
+				}
+			},
+		},
+		{
+			name: "values past the end",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagExifIFD, sub: []testEntry{outOfRange(asciiEntry(exifTagDateTimeOriginal, "2025:11:03 09:15:00"))}},
+				{tag: exifTagGPSIFD, sub: []testEntry{
+					outOfRange(degreesEntry(le, gpsTagLatitude, 12, 0, 0)),
+					outOfRange(degreesEntry(le, gpsTagLongitude, 77, 0, 0)),
+				}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.TakenAt != nil || exif.Latitude != nil {
+					t.Errorf("got %+v, want nothing", exif)
+				}
+			},
+		},
+		{
+			name: "huge value count",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagExifIFD, sub: []testEntry{{tag: exifTagDateTimeOriginal, typ: 2, count: 0xFFFFFFFF, data: le.AppendUint32(nil, 8)}}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.TakenAt != nil {
+					t.Errorf("TakenAt = %v, want nil", exif.TakenAt)
+				}
+			},
+		},
+		{
+			name: "wrong value types",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagOrientation, typ: 4, count: 1, data: le.AppendUint32(nil, 6)},
+				{tag: exifTagGPSIFD, sub: []testEntry{
+					{tag: gpsTagLatitude, typ: 3, count: 3, data: make([]byte, 6)},
+					degreesEntry(le, gpsTagLongitude, 77, 0, 0),
+				}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.Orientation != 0 || exif.Latitude != nil {
+					t.Errorf("got %+v, want nothing", exif)
+				}
+			},
+		},
+		{
+			name: "zero denominator",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagGPSIFD, sub: []testEntry{badGPS, degreesEntry(le, gpsTagLongitude, 77, 0, 0)}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.Latitude != nil {
+					t.Errorf("Latitude = %v, want nil", *exif.Latitude)
+				}
+			},
+		},
+		{
+			name: "position out of range",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagGPSIFD, sub: []testEntry{degreesEntry(le, gpsTagLatitude, 95, 0, 0), degreesEntry(le, gpsTagLongitude, 77, 0, 0)}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.Latitude != nil {
+					t.Errorf("Latitude = %v, want nil", *exif.Latitude)
+				}
+			},
+		},
+		{
+			name: "time without offset",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagExifIFD, sub: []testEntry{asciiEntry(exifTagDateTimeOriginal, "2025:11:03 09:15:00")}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				want := time.Date(2025, 11, 3, 9, 15, 0, 0, time.UTC)
+				if exif.TakenAt == nil || !exif.TakenAt.Equal(want) {
+					t.Errorf("TakenAt = %v, want %v", exif.TakenAt, want)
+				}
+			},
+		},
+		{
+			name: "unset camera clock",
+			data: wrapJPEG(buildTIFF(le, []testEntry{
+				{tag: exifTagExifIFD, sub: []testEntry{asciiEntry(exifTagDateTimeOriginal, "0000:00:00 00:00:00")}},
+			})),
+			check: func(t *testing.T, exif *ExifData) {
+				if exif.TakenAt != nil {
+					t.Errorf("TakenAt = %v, want nil", exif.TakenAt)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exif, err := ReadJPEGExif(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", exif)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadJPEGExif: %v", err)
+			}
+			tt.check(t, exif)
+		})
+	}
+
+	if _, err := ReadJPEGExif([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}); !errors.Is(err, errNoExif) {
+		t.Errorf("error = %v, want errNoExif", err)
+	}
+}
+
+func FuzzReadJPEGExif(f *testing.F) {
+	f.Add(wrapJPEG(fullExif(binary.LittleEndian)))
+	f.Add(wrapJPEG(fullExif(binary.BigEndian)))
+	f.Add(wrapJPEG([]byte("MM\x00*\x00\x00\x00\x08\x00\x00")))
+	f.Add([]byte{0xFF, 0xD8, 0xFF, 0xFF, 0xE1, 0x00, 0x02})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		exif, err := ReadJPEGExif(data)
+		if err != nil {
+			return
+		}
+		if exif.Orientation < 0 || exif.Orientation > 8 {
+			t.Fatalf("Orientation = %d", exif.Orientation)
+		}
+		if (exif.Latitude == nil) != (exif.Longitude == nil) {
+			t.Fatal("only one coordinate was set")
+		}
+		if exif.Latitude != nil && ValidateCoordinates(*exif.Latitude, *exif.Longitude) != nil {
+			t.Fatalf("invalid position %v, %v", *exif.Latitude, *exif.Longitude)
+		}
+		if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+			t.Fatal("EXIF read from a file that is not a JPEG")
+		}
+	})
+}
@@ -0,0 +1,146 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Geometry limits for farm plot boundaries.
+const (
+	MaxPolygonPositions = 1000
+	earthRadiusMeters   = 6378137.0 // WGS84 equatorial radius, as used by GeoJSON tooling
+	SqMetersPerAcre     = 4046.8564224
+	SqMetersPerHectare  = 10000.0
+)
+
+// Geometry is a parsed GeoJSON Point or Polygon. Positions are [longitude, latitude].
+type Geometry struct {
+	Type    string         // "Point" or "Polygon"
+	Point   [2]float64     // set for Point
+	Polygon [][][2]float64 // set for Polygon: outer ring first, then holes
+}
+
+// ParseGeometry parses and validates a GeoJSON Point or Polygon.
+// Polygon rings must be closed, have at least four positions, and the outer ring
+// must not be degenerate.
+func ParseGeometry(geometryType string, coordinates json.RawMessage) (*Geometry, error) {
+	switch geometryType {
+	case "Point":
+		var pos []float64
+		if err := json.Unmarshal(coordinates, &pos); err != nil || len(pos) < 2 {
+			return nil, fmt.Errorf("point coordinates must be [longitude, latitude]")
+		}
+		if err := ValidateCoordinates(pos[1], pos[0]); err != nil {
+			return nil, err
+		}
+		return &Geometry{Type: "Point", Point: [2]float64{pos[0], pos[1]}}, nil
+
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(coordinates, &rings); err != nil || len(rings) == 0 {
+			return nil, fmt.Errorf("polygon coordinates must be an array of linear rings")
+		}
+
+		total := 0
+		polygon := make([][][2]float64, 0, len(rings))
+		for i, ring := range rings {
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("polygon ring %d must have at least 4 positions", i)
+			}
+			total += len(ring)
+			if total > MaxPolygonPositions {
+				return nil, fmt.Errorf("polygon must have at most %d positions", MaxPolygonPositions)
+			}
+
+			parsed := make([][2]float64, len(ring))
+			for j, pos := range ring {
+				if len(pos) < 2 {
+					return nil, fmt.Errorf("polygon ring %d position %d must be [longitude, latitude]", i, j)
+				}
+				if err := ValidateCoordinates(pos[1], pos[0]); err != nil {
+					return nil, err
+				}
+				parsed[j] = [2]float64{pos[0], pos[1]}
+			}
+			if parsed[0] != parsed[len(parsed)-1] {
+				return nil, fmt.Errorf("polygon ring %d must be closed (first and last positions equal)", i)
+			}
+			polygon = append(polygon, parsed)
+		}
+
+		g := &Geometry{Type: "Polygon", Polygon: polygon}
+		if g.AreaSqMeters() <= 0 {
+			return nil, fmt.Errorf("polygon has no area")
+		}
+		return g, nil
+
+	default:
+		return nil, fmt.Errorf("geometry type must be Point or Polygon, got: %q", geometryType)
+	}
+}
+
+// Coordinates returns the GeoJSON coordinates array for storage or output.
+func (g *Geometry) Coordinates() interface{} {
+	if g.Type == "Point" {
+		return []float64{g.Point[0], g.Point[1]}
+	}
+	rings := make([][][]float64, len(g.Polygon))
+	for i, ring := range g.Polygon {
+		rings[i] = make([][]float64, len(ring))
+		for j, pos := range ring {
+			rings[i][j] = []float64{pos[0], pos[1]}
+		}
+	}
+	return rings
+}
+
+// AreaSqMeters returns the area of a polygon on the sphere (holes subtracted); 0 for points.
+func (g *Geometry) AreaSqMeters() float64 {
+	if g.Type != "Polygon" || len(g.Polygon) == 0 {
+		return 0
+	}
+	area := math.Abs(ringArea(g.Polygon[0]))
+	for _, hole := range g.Polygon[1:] {
+		area -= math.Abs(ringArea(hole))
+	}
+	return math.Max(area, 0)
+}
+
+// Centroid returns the latitude and longitude of the geometry's centre.
+// For polygons this is the average of the outer ring's vertices, which is close enough
+// for field-sized shapes to look up weather.
+func (g *Geometry) Centroid() (lat, lng float64) {
+	if g.Type == "Point" {
+		return g.Point[1], g.Point[0]
+	}
+	ring := g.Polygon[0]
+	n := len(ring) - 1 // the closing position repeats the first
+	for _, pos := range ring[:n] {
+		lng += pos[0]
+		lat += pos[1]
+	}
+	return lat / float64(n), lng / float64(n)
+}
+
+// ringArea computes the signed spherical area of a closed ring in square metres
+// (Chamberlain & Duquette, "Some Algorithms for Polygons on a Sphere", 2007).
+func ringArea(ring [][2]float64) float64 {
+	n := len(ring)
+	if n < 3 {
+		return 0
+	}
+	var total float64
+	for i := 0; i < n-1; i++ {
+		lng1, lat1 := toRadians(ring[i][0]), toRadians(ring[i][1])
+		lng2, lat2 := toRadians(ring[i+1][0]), toRadians(ring[i+1][1])
+		total += (lng2 - lng1) * (2 + math.Sin(lat1) + math.Sin(lat2))
+	}
+	return total * earthRadiusMeters * earthRadiusMeters / 2
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,433 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// polyglotMarkers are signs of markup or script hidden inside a binary file, which browsers
+// or other tools could run if the file were served back.
+var polyglotMarkers = [][]byte{
+	[]byte("<script"),
+	[]byte("<?php"),
+	[]byte("<html"),
+	[]byte("<!doctype"),
+	[]byte("<svg"),
+	[]byte("<iframe"),
+	[]byte("javascript:"),
+}
+
+// zipEndOfDirectory marks the end of a ZIP archive; ZIP (and JAR, APK) readers look for it
+// near the end of a file, so one appended to an image or recording still opens.
+var zipEndOfDirectory = []byte("PK\x05\x06")
+
+// sniffWindow is how much of the start of a file browsers look at to guess its type. The
+// same amount at the end is checked too, for short payloads appended to a file.
+const sniffWindow = 512
+
+// checkPolyglot rejects files that are valid media but also carry markup, a PDF or a ZIP
+// archive that other programs would open. Markup is only looked for where a file holds
+// bytes as they were written — its first and last bytes, metadata and anything after the
+// end of its format — and not in the compressed image or audio data, which contains any
+// short byte run by chance.
+func checkPolyglot(data []byte, fileType FileType) error {
+	regions := append(metadataRegions(data, fileType),
+		data[:min(len(data), sniffWindow)],
+		data[max(0, len(data)-sniffWindow):],
+	)
+	for _, region := range regions {
+		if containsMarkup(region) {
+			return fmt.Errorf("file contains embedded markup or script")
+		}
+	}
+	// PDF readers accept the header anywhere in the first kilobyte
+	if bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return fmt.Errorf("file is also a PDF document")
+	}
+	// The end-of-directory record sits in the last 22 bytes plus up to 64 KB of comment
+	if bytes.Contains(data[max(0, len(data)-(22+65535)):], zipEndOfDirectory) {
+		return fmt.Errorf("file has an archive appended")
+	}
+	return nil
+}
+
+// containsMarkup reports whether b contains one of the polyglot markers, ignoring ASCII case.
+func containsMarkup(b []byte) bool {
+	for i := range b {
+		c := b[i]
+		if c != '<' && c|0x20 != 'j' {
+			continue
+		}
+		for _, marker := range polyglotMarkers {
+			if hasPrefixFold(b[i:], marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPrefixFold is bytes.HasPrefix ignoring ASCII case; prefix must be lower case.
+func hasPrefixFold(b, prefix []byte) bool {
+	if len(b) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		c := b[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != p {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataRegions returns the parts of a file that are not compressed image or audio data:
+// metadata such as comments and tags, and whatever follows the end of the file's format.
+// Damaged structure ends the walk with the regions found so far.
+func metadataRegions(data []byte, fileType FileType) [][]byte {
+	switch fileType.MimeType {
+	case FileTypeJPEG.MimeType:
+		return jpegMetadata(data)
+	case FileTypePNG.MimeType:
+		return pngMetadata(data)
+	case FileTypeGIF.MimeType:
+		return gifMetadata(data)
+	case FileTypeWebP.MimeType:
+		return riffMetadata(data, "VP8 ", "VP8L", "ALPH", "ANMF", "EXIF")
+	case FileTypeWAV.MimeType:
+		return riffMetadata(data, "data")
+	case FileTypeMP3.MimeType:
+		return mp3Metadata(data)
+	case FileTypeM4A.MimeType:
+		return mp4Metadata(data)
+	case FileTypeOGG.MimeType:
+		return oggMetadata(data)
+	case FileTypeFLAC.MimeType:
+		return flacMetadata(data)
+	case FileTypeWebM.MimeType:
+		return webmMetadata(data)
+	}
+	return nil
+}
+
+// jpegMetadata returns a JPEG's marker segments except the EXIF block and APP2 (ICC profile,
+// multi-picture index), which are binary and may hold preview images, and the data after
+// the end of the image up to any further JPEG appended by the camera.
+func jpegMetadata(data []byte) [][]byte {
+	var regions [][]byte
+	inScan := false
+	for i := 2; i+1 < len(data); {
+		if data[i] != 0xFF {
+			if !inScan {
+				return regions
+			}
+			next := bytes.IndexByte(data[i:], 0xFF)
+			if next < 0 {
+				return regions
+			}
+			i += next
+			continue
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0x00 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01: // stuffed byte, restart, TEM
+			i += 2
+			continue
+		case marker == 0xD9: // end of image
+			trailer := data[i+2:]
+			if next := bytes.Index(trailer, []byte{0xFF, 0xD8, 0xFF}); next >= 0 {
+				trailer = trailer[:next]
+			}
+			return append(regions, trailer)
+		}
+
+		if i+4 > len(data) {
+			return regions
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return regions
+		}
+		segment := data[i+4 : end]
+		isApp := marker >= 0xE0 && marker <= 0xEF
+		if (isApp || marker == 0xFE) && marker != 0xE2 && !(marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00"))) {
+			regions = append(regions, segment)
+		}
+		inScan = marker == 0xDA
+		i = end
+	}
+	return regions
+}
+
+// pngMetadata returns a PNG's chunks except compressed ones, and the data after IEND.
+func pngMetadata(data []byte) [][]byte {
+	var regions [][]byte
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if end > len(data) || end < i {
+			return regions
+		}
+		switch typ {
+		case "IDAT", "fdAT", "zTXt", "iCCP":
+		default:
+			regions = append(regions, data[i+8:i+8+length])
+		}
+		if typ == "IEND" {
+			return append(regions, data[end:])
+		}
+		i = end
+	}
+	return regions
+}
+
+// gifMetadata returns a GIF's comment, plain text and application extensions, and the data
+// after its trailer.
+func gifMetadata(data []byte) [][]byte {
+	if len(data) < 13 {
+		return nil
+	}
+	var regions [][]byte
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 0x07) + 1) // global color table
+	}
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: label, then data sub-blocks
+			if i+2 > len(data) {
+				return regions
+			}
+			label := data[i+1]
+			start := i + 2
+			end, ok := skipGIFSubBlocks(data, start)
+			if !ok {
+				return regions
+			}
+			if label == 0xFE || label == 0x01 || label == 0xFF {
+				regions = append(regions, data[start:end])
+			}
+			i = end
+		case 0x2C: // image: descriptor, optional color table, LZW code size, data sub-blocks
+			if i+11 > len(data) {
+				return regions
+			}
+			next := i + 10
+			if flags := data[i+9]; flags&0x80 != 0 {
+				next += 3 << ((flags & 0x07) + 1)
+			}
+			end, ok := skipGIFSubBlocks(data, next+1)
+			if !ok {
+				return regions
+			}
+			i = end
+		case 0x3B: // trailer
+			return append(regions, data[i+1:])
+		default:
+			return regions
+		}
+	}
+	return regions
+}
+
+// skipGIFSubBlocks returns the position after the sub-blocks starting at i and their
+// zero-length terminator.
+func skipGIFSubBlocks(data []byte, i int) (int, bool) {
+	for i < len(data) {
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, true
+		}
+		i += size
+	}
+	return 0, false
+}
+
+// riffMetadata returns a RIFF file's chunks other than the skipped ones, which hold the
+// compressed data, and the data after the RIFF container.
+func riffMetadata(data []byte, skip ...string) [][]byte {
+	if len(data) < 12 {
+		return nil
+	}
+	var regions [][]byte
+	end := len(data)
+	if size := uint64(binary.LittleEndian.Uint32(data[4:])) + 8; size < uint64(len(data)) {
+		end = int(size)
+		regions = append(regions, data[end:])
+	}
+	for i := 12; i+8 <= end; {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		next := i + 8 + size + size&1
+		if next > end || next < i {
+			return regions
+		}
+		if !contains(skip, id) {
+			regions = append(regions, data[i+8:i+8+size])
+		}
+		i = next
+	}
+	return regions
+}
+
+// mp3Metadata returns an MP3's ID3v2 tag at the start and ID3v1 tag at the end.
+func mp3Metadata(data []byte) [][]byte {
+	var regions [][]byte
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		// Tag size is "syncsafe": 7 bits per byte
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		if data[5]&0x10 != 0 { // footer
+			size += 10
+		}
+		regions = append(regions, data[10:min(len(data), 10+size)])
+	}
+	if len(data) >= 128 && bytes.HasPrefix(data[len(data)-128:], []byte("TAG")) {
+		regions = append(regions, data[len(data)-128:])
+	}
+	return regions
+}
+
+// mp4Metadata returns an MP4's top-level boxes other than the media data.
+func mp4Metadata(data []byte) [][]byte {
+	var regions [][]byte
+	for i := 0; i+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		header := uint64(8)
+		switch size {
+		case 0: // box runs to the end of the file
+			size = uint64(len(data) - i)
+		case 1: // 64-bit size follows the type
+			if i+16 > len(data) {
+				return regions
+			}
+			size, header = binary.BigEndian.Uint64(data[i+8:]), 16
+		}
+		if size < header || size > uint64(len(data)-i) {
+			return regions
+		}
+		if typ != "mdat" {
+			regions = append(regions, data[i+int(header):i+int(size)])
+		}
+		i += int(size)
+	}
+	return regions
+}
+
+// oggMetadata returns the bodies of an Ogg stream's header pages, which carry the codec
+// setup and comments, up to the first page of audio.
+func oggMetadata(data []byte) [][]byte {
+	var regions [][]byte
+	for i := 0; i+27 <= len(data) && bytes.HasPrefix(data[i:], []byte("OggS")); {
+		granule := binary.LittleEndian.Uint64(data[i+6:])
+		segments := int(data[i+26])
+		body := i + 27 + segments
+		if body > len(data) {
+			return regions
+		}
+		length := 0
+		for _, s := range data[i+27 : body] {
+			length += int(s)
+		}
+		end := body + length
+		if end > len(data) {
+			return regions
+		}
+		// Header pages end no packet at a sample position: 0, or -1 when a packet continues
+		if granule != 0 && granule != ^uint64(0) {
+			return regions
+		}
+		regions = append(regions, data[body:end])
+		i = end
+	}
+	return regions
+}
+
+// flacMetadata returns a FLAC file's metadata blocks except embedded pictures.
+func flacMetadata(data []byte) [][]byte {
+	var regions [][]byte
+	for i := 4; i+4 <= len(data); {
+		last, typ := data[i]&0x80 != 0, data[i]&0x7F
+		end := i + 4 + (int(data[i+1])<<16 | int(data[i+2])<<8 | int(data[i+3]))
+		if end > len(data) {
+			return regions
+		}
+		if typ != 6 { // PICTURE
+			regions = append(regions, data[i+4:end])
+		}
+		if last {
+			return regions
+		}
+		i = end
+	}
+	return regions
+}
+
+// Matroska element IDs walked by webmMetadata.
+const (
+	ebmlSegment     = 0x18538067
+	ebmlCluster     = 0x1F43B675
+	ebmlAttachments = 0x1941A469
+)
+
+// webmMetadata returns a WebM file's elements other than clusters of audio and attachments.
+// Recorders that stream often leave sizes unknown; the walk stops at the first of those.
+func webmMetadata(data []byte) [][]byte {
+	var regions [][]byte
+	for i := 0; i < len(data); {
+		id, idLen, ok := ebmlVint(data[i:], true)
+		if !ok {
+			return regions
+		}
+		size, sizeLen, ok := ebmlVint(data[i+idLen:], false)
+		if !ok {
+			return regions
+		}
+		start := i + idLen + sizeLen
+		if id == ebmlSegment {
+			i = start // walk the segment's children
+			continue
+		}
+		if size == 1<<(7*uint(sizeLen))-1 || size > uint64(len(data)-start) {
+			return regions // unknown or damaged size
+		}
+		end := start + int(size)
+		if id != ebmlCluster && id != ebmlAttachments {
+			regions = append(regions, data[start:end])
+		}
+		i = end
+	}
+	return regions
+}
+
+// ebmlVint reads a variable-length EBML integer, keeping its length marker for element IDs.
+func ebmlVint(b []byte, keepMarker bool) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if len(b) < n {
+		return 0, 0, false
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= 0xFF >> n
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, true
+}
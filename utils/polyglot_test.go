@@ -0,0 +1,153 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// noise returns n pseudo-random bytes, standing in for compressed media data.
+func noise(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+// plant overwrites data in the middle of b with s, as a chance byte run would appear.
+func plant(b []byte, s string) []byte {
+	out := append([]byte{}, b...)
+	copy(out[len(out)/2:], s)
+	return out
+}
+
+func noisyJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 256, 256))
+	copy(img.Pix, noise(len(img.Pix)))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithComment inserts a COM segment after the start-of-image marker.
+func jpegWithComment(data []byte, comment string) []byte {
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xFF, 0xFE)
+	out = binary.BigEndian.AppendUint16(out, uint16(2+len(comment)))
+	out = append(out, comment...)
+	return append(out, data[2:]...)
+}
+
+// inScanData plants s inside the JPEG's entropy-coded data, away from both ends.
+func inScanData(data []byte, s string) []byte {
+	sos := bytes.Index(data, []byte{0xFF, 0xDA})
+	out := append([]byte{}, data...)
+	copy(out[sos+(len(data)-sos)/2:], s)
+	return out
+}
+
+func pngWith(t *testing.T, chunkType, chunkData string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Insert the chunk after IHDR (8-byte signature + 25-byte chunk); the CRC is not checked
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(chunkData)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, chunkData...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	out := append([]byte{}, data[:33]...)
+	out = append(out, chunk...)
+	return append(out, data[33:]...)
+}
+
+func wav(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(out, body...)
+}
+
+func riffChunk(id string, data []byte) []byte {
+	out := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func id3(frames string) []byte {
+	size := len(frames)
+	out := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(out, frames...)
+}
+
+func TestCheckPolyglot(t *testing.T) {
+	jpg := noisyJPEG(t)
+	frames := append([]byte{0xFF, 0xFB, 0x90, 0x64}, noise(64*1024)...)
+	samples := noise(64 * 1024)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		fileType FileType
+		wantErr  string
+	}{
+		{"plain JPEG", jpg, FileTypeJPEG, ""},
+		{"chance markup in JPEG scan data", inScanData(jpg, "<SvG"), FileTypeJPEG, ""},
+		{"markup in JPEG comment", jpegWithComment(jpg, "<script>alert(1)</script>"), FileTypeJPEG, "markup"},
+		{"markup after JPEG end", append(append([]byte{}, jpg...), strings.Repeat(" ", 4096)+"<html><body>"+strings.Repeat(" ", 4096)...), FileTypeJPEG, "markup"},
+		{"markup at the start", append([]byte("\xff\xd8\xff<!DOCTYPE html>"), jpg[3:]...), FileTypeJPEG, "markup"},
+		{"PDF in JPEG comment", jpegWithComment(jpg, "%PDF-1.7"), FileTypeJPEG, "PDF"},
+		{"ZIP appended", append(append([]byte{}, jpg...), "PK\x05\x06\x00\x00\x00\x00"...), FileTypeJPEG, "archive"},
+		{"chance markup in PNG image data", pngWith(t, "IDAT", string(plant(noise(4096), "<svg"))), FileTypePNG, ""},
+		{"markup in PNG text", pngWith(t, "tEXt", "Comment\x00<svg onload=alert(1)>"), FileTypePNG, "markup"},
+		{"chance markup in MP3 frames", append(id3("TIT2\x00\x00\x00\x05\x00\x00\x00Note"), plant(frames, "<sVg")...), FileTypeMP3, ""},
+		{"markup in ID3 tag", append(id3("COMM\x00\x00\x00\x14\x00\x00\x00javascript:alert(1)"), frames...), FileTypeMP3, "markup"},
+		{"chance markup in WAV samples", wav(riffChunk("fmt ", make([]byte, 16)), riffChunk("data", plant(samples, "<SVG"))), FileTypeWAV, ""},
+		{"markup in WAV info", wav(riffChunk("fmt ", make([]byte, 16)), riffChunk("LIST", []byte("INFOICMT<iframe src=x>")), riffChunk("data", samples)), FileTypeWAV, "markup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPolyglot(tt.data, tt.fileType)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected rejection: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetadataRegionsSkipMediaData(t *testing.T) {
+	jpg := jpegWithComment(noisyJPEG(t), "hello")
+	total := 0
+	for _, region := range jpegMetadata(jpg) {
+		total += len(region)
+	}
+	// The comment and the encoder's small JFIF header, nothing of the scan data
+	if total > 64 {
+		t.Fatalf("metadata regions hold %d bytes of a %d-byte JPEG", total, len(jpg))
+	}
+}
@@ -0,0 +1,191 @@
+// All rights reserved Samyak-Setu
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Upload limits.
+const (
+	MaxFileSize    = 5 * 1024 * 1024  // largest image upload (5 MB)
+	MaxAudioSize   = 10 * 1024 * 1024 // largest audio upload (10 MB)
+	MaxImagePixels = 50_000_000       // largest decoded image, so small files cannot expand into huge bitmaps
+	MaxImageEdge   = 16384            // longest image edge, in pixels
+)
+
+// FileType is a file format recognised from its content.
+type FileType struct {
+	MimeType string   // canonical MIME type
+	Ext      string   // extension used when the file is stored
+	Aliases  []string // other MIME types clients send for the format
+	Exts     []string // file name extensions of the format
+}
+
+// Accepted image formats.
+var (
+	FileTypeJPEG = FileType{MimeType: "image/jpeg", Ext: ".jpg", Aliases: []string{"image/jpg", "image/pjpeg"}, Exts: []string{".jpg", ".jpeg", ".jfif"}}
+	FileTypePNG  = FileType{MimeType: "image/png", Ext: ".png", Aliases: []string{"image/x-png"}, Exts: []string{".png"}}
+	FileTypeGIF  = FileType{MimeType: "image/gif", Ext: ".gif", Exts: []string{".gif"}}
+	FileTypeWebP = FileType{MimeType: "image/webp", Ext: ".webp", Exts: []string{".webp"}}
+)
+
+// Accepted audio formats, the ones Amazon Transcribe reads.
+var (
+	FileTypeWAV  = FileType{MimeType: "audio/wav", Ext: ".wav", Aliases: []string{"audio/x-wav", "audio/wave", "audio/vnd.wave"}, Exts: []string{".wav", ".wave"}}
+	FileTypeMP3  = FileType{MimeType: "audio/mpeg", Ext: ".mp3", Aliases: []string{"audio/mp3", "audio/mpeg3", "audio/x-mpeg-3"}, Exts: []string{".mp3"}}
+	FileTypeM4A  = FileType{MimeType: "audio/mp4", Ext: ".m4a", Aliases: []string{"audio/m4a", "audio/x-m4a", "video/mp4", "audio/3gpp", "video/3gpp"}, Exts: []string{".m4a", ".mp4", ".3gp"}}
+	FileTypeOGG  = FileType{MimeType: "audio/ogg", Ext: ".ogg", Aliases: []string{"application/ogg", "audio/opus"}, Exts: []string{".ogg", ".oga", ".opus"}}
+	FileTypeFLAC = FileType{MimeType: "audio/flac", Ext: ".flac", Aliases: []string{"audio/x-flac"}, Exts: []string{".flac"}}
+	FileTypeWebM = FileType{MimeType: "audio/webm", Ext: ".webm", Aliases: []string{"video/webm"}, Exts: []string{".webm"}}
+)
+
+// genericMimeTypes are declared types that say nothing about the format; files sent with
+// them are judged by their content alone.
+var genericMimeTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+}
+
+// SniffImageType recognises an accepted image format from the file's magic bytes.
+func SniffImageType(data []byte) (FileType, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FileTypeJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return FileTypePNG, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FileTypeGIF, true
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return FileTypeWebP, true
+	}
+	return FileType{}, false
+}
+
+// SniffAudioType recognises an accepted audio format from the file's magic bytes.
+func SniffAudioType(data []byte) (FileType, bool) {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return FileTypeWAV, true
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return FileTypeMP3, true
+	// MPEG audio frame sync; a zero layer field would be AAC in an ADTS stream instead
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0 && data[1]&0x06 != 0:
+		return FileTypeMP3, true
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return FileTypeM4A, true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return FileTypeOGG, true
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return FileTypeFLAC, true
+	// Matroska header whose document type is WebM
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}) && bytes.Contains(data[:min(len(data), 64)], []byte("webm")):
+		return FileTypeWebM, true
+	}
+	return FileType{}, false
+}
+
+// ValidateImage checks an uploaded image by its content: it must be a JPEG, PNG, GIF or WebP
+// matching the declared type and file name, within the size and dimension limits, and not
+// also be a file of another kind. It returns the detected format.
+func ValidateImage(file *multipart.FileHeader, data []byte) (FileType, error) {
+	if len(data) > MaxFileSize {
+		return FileType{}, fmt.Errorf("file size %d bytes exceeds maximum of 5MB", len(data))
+	}
+	fileType, ok := SniffImageType(data)
+	if !ok {
+		return FileType{}, fmt.Errorf("unsupported image type (allowed: jpeg, png, webp, gif)")
+	}
+	if err := checkDeclaredType(file, fileType); err != nil {
+		return FileType{}, err
+	}
+
+	// Only the header is decoded, so an oversized image is caught before it is expanded
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return FileType{}, fmt.Errorf("image is damaged or incomplete")
+	}
+	if config.Width <= 0 || config.Height <= 0 || max(config.Width, config.Height) > MaxImageEdge ||
+		int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return FileType{}, fmt.Errorf("image dimensions %d×%d exceed the limit of %d megapixels", config.Width, config.Height, MaxImagePixels/1_000_000)
+	}
+
+	if err := checkPolyglot(data, fileType); err != nil {
+		return FileType{}, err
+	}
+	return fileType, nil
+}
+
+// ValidateAudio checks an uploaded recording by its content: it must be WAV, MP3, M4A, OGG,
+// FLAC or WebM matching the declared type and file name, within the size limit, and not also
+// be a file of another kind. It returns the detected format.
+func ValidateAudio(file *multipart.FileHeader, data []byte) (FileType, error) {
+	if len(data) == 0 {
+		return FileType{}, fmt.Errorf("audio file is empty")
+	}
+	if len(data) > MaxAudioSize {
+		return FileType{}, fmt.Errorf("file size %d bytes exceeds maximum of 10MB", len(data))
+	}
+	fileType, ok := SniffAudioType(data)
+	if !ok {
+		return FileType{}, fmt.Errorf("unsupported audio type (allowed: wav, mp3, m4a, ogg, flac, webm)")
+	}
+	if err := checkDeclaredType(file, fileType); err != nil {
+		return FileType{}, err
+	}
+	if err := checkPolyglot(data, fileType); err != nil {
+		return FileType{}, err
+	}
+	return fileType, nil
+}
+
+// checkDeclaredType rejects files whose Content-Type or file name extension names a format
+// other than the detected one. Generic types and missing extensions are not held against it.
+func checkDeclaredType(file *multipart.FileHeader, fileType FileType) error {
+	declared := strings.ToLower(strings.TrimSpace(strings.Split(file.Header.Get("Content-Type"), ";")[0]))
+	if !genericMimeTypes[declared] && declared != fileType.MimeType && !contains(fileType.Aliases, declared) {
+		return fmt.Errorf("file content is %s but it was sent as %s", fileType.MimeType, declared)
+	}
+
+	if ext := strings.ToLower(filepath.Ext(file.Filename)); ext != "" && !contains(fileType.Exts, ext) {
+		return fmt.Errorf("file content is %s but its name ends in %s", fileType.MimeType, ext)
+	}
+	return nil
+}
+
+// ReadFileBytes reads the full contents of a multipart file into memory.
+func ReadFileBytes(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	// A single Read may return fewer bytes than the file holds
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -4,7 +4,6 @@ package utils
 
 import (
 	"fmt"
-	"mime/multipart"
 	"regexp"
 	"strings"
 )
@@ -42,58 +41,60 @@ func ValidateCoordinates(lat, lng float64) error {
 	return ValidateLongitude(lng)
 }
 
-// AllowedImageTypes contains the set of accepted image MIME types.
-var AllowedImageTypes = map[string]bool{
-	"image/jpeg": true,
-	"image/jpg":  true,
-	"image/png":  true,
-	"image/webp": true,
-	"image/gif":  true,
-}
-
-// MaxFileSize is the maximum allowed upload size (5 MB).
-const MaxFileSize = 5 * 1024 * 1024
+// Profile field limits.
+const (
+	MaxNameLength   = 100
+	MaxRegionLength = 60 // state, district and block names
+	MaxLandSize     = 10000
+	MaxCrops        = 10
+	MaxCropLength   = 40
+)
 
-// ValidateImageFile checks that the uploaded file is an allowed image type and within size limits.
-func ValidateImageFile(file *multipart.FileHeader) error {
-	if file.Size > MaxFileSize {
-		return fmt.Errorf("file size %d bytes exceeds maximum of 5MB", file.Size)
+// ValidateName checks that a display name is present and not too long.
+func ValidateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("name cannot be empty")
 	}
-
-	contentType := file.Header.Get("Content-Type")
-	// Normalize content type
-	contentType = strings.ToLower(strings.Split(contentType, ";")[0])
-
-	if !AllowedImageTypes[contentType] {
-		return fmt.Errorf("unsupported image type: %s (allowed: jpeg, png, webp, gif)", contentType)
+	if len([]rune(name)) > MaxNameLength {
+		return fmt.Errorf("name must be at most %d characters", MaxNameLength)
 	}
-
 	return nil
 }
 
-// GetMimeType extracts and normalizes the MIME type from a file header.
-func GetMimeType(file *multipart.FileHeader) string {
-	ct := file.Header.Get("Content-Type")
-	ct = strings.ToLower(strings.Split(ct, ";")[0])
-	if ct == "image/jpg" {
-		ct = "image/jpeg"
+// ValidateRegion checks a state, district or block name. Empty is allowed.
+func ValidateRegion(field, value string) error {
+	if len([]rune(value)) > MaxRegionLength {
+		return fmt.Errorf("%s must be at most %d characters", field, MaxRegionLength)
 	}
-	return ct
+	return nil
 }
 
-// ReadFileBytes reads the full contents of a multipart file into memory.
-func ReadFileBytes(file *multipart.FileHeader) ([]byte, error) {
-	src, err := file.Open()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+// ValidateLandSize checks that a land holding in acres is positive and plausible.
+// Zero is allowed and means "not specified".
+func ValidateLandSize(acres float64) error {
+	if acres < 0 || acres > MaxLandSize {
+		return fmt.Errorf("landSizeAcres must be between 0 and %d, got: %g", MaxLandSize, acres)
 	}
-	defer src.Close()
+	return nil
+}
 
-	data := make([]byte, file.Size)
-	_, err = src.Read(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+// NormalizeCrops trims, lower-cases and de-duplicates a crop list and checks its limits.
+func NormalizeCrops(crops []string) ([]string, error) {
+	seen := make(map[string]bool, len(crops))
+	result := make([]string, 0, len(crops))
+	for _, crop := range crops {
+		crop = strings.ToLower(strings.TrimSpace(crop))
+		if crop == "" || seen[crop] {
+			continue
+		}
+		if len([]rune(crop)) > MaxCropLength {
+			return nil, fmt.Errorf("crop name %q must be at most %d characters", crop, MaxCropLength)
+		}
+		seen[crop] = true
+		result = append(result, crop)
 	}
-
-	return data, nil
+	if len(result) > MaxCrops {
+		return nil, fmt.Errorf("at most %d primary crops are allowed", MaxCrops)
+	}
+	return result, nil
 }